@@ -0,0 +1,181 @@
+// Package capture reads the contents of windows and pixmaps back from the
+// server as images, for screenshots and visual regression tests. Pixels are
+// read into shared memory with MIT-SHM when the server runs on the same
+// machine, and with core GetImage requests otherwise.
+package capture
+
+import (
+	"errors"
+	"image"
+	"image/color"
+
+	"github.com/dzeromsk/helloX11/mitshm"
+	"github.com/dzeromsk/helloX11/x11"
+)
+
+var errVisual = errors.New("capture: no visual for the drawable's depth")
+
+// allPlanes keeps every bit of the pixels.
+const allPlanes = 0xffffffff
+
+// Capturer captures drawables of a connection. It keeps a shared memory
+// segment between captures, grown as needed.
+type Capturer struct {
+	c   *x11.Conn
+	shm *mitshm.Shm     // nil without MIT-SHM
+	seg *mitshm.Segment // for ShmGetImage
+}
+
+// New returns a capturer for c. It uses MIT-SHM if the server offers it.
+func New(c *x11.Conn) *Capturer {
+	cp := &Capturer{c: c}
+	cp.shm, _ = mitshm.New(c)
+	return cp
+}
+
+// Capture returns the contents of the whole drawable. For a window, that
+// excludes its border; see CaptureRect for the restrictions.
+func (cp *Capturer) Capture(drawable uint32) (*image.RGBA, error) {
+	g, err := cp.c.GetGeometry(drawable)
+	if err != nil {
+		return nil, err
+	}
+	return cp.CaptureRect(drawable, image.Rect(0, 0, int(g.Width), int(g.Height)))
+}
+
+// CaptureRect returns the part r of drawable, in its coordinates, with
+// the pixels decoded according to the drawable's visual. PseudoColor
+// pixels are looked up in the screen's default colormap, which windows use
+// unless given one of their own. A window must be viewable and r on
+// screen; parts obscured by other windows hold whatever covers them, or are
+// undefined.
+func (cp *Capturer) CaptureRect(drawable uint32, r image.Rectangle) (*image.RGBA, error) {
+	var (
+		data   []byte
+		depth  uint8
+		visual uint32
+	)
+	if cp.shm != nil {
+		if err := cp.grow(r.Dx() * r.Dy() * 4); err != nil {
+			cp.shm = nil // remote server, use GetImage from now on
+		}
+	}
+	if cp.shm != nil {
+		var (
+			size uint32
+			err  error
+		)
+		depth, visual, size, err = cp.shm.GetImage(drawable, int16(r.Min.X), int16(r.Min.Y),
+			uint16(r.Dx()), uint16(r.Dy()), allPlanes, x11.X11_IMAGE_FORMAT_Z_PIXMAP, cp.seg.ID, 0)
+		if err != nil {
+			return nil, err
+		}
+		data = cp.seg.Data[:size]
+	} else {
+		img, err := cp.c.GetImage(x11.X11_IMAGE_FORMAT_Z_PIXMAP, drawable, int16(r.Min.X), int16(r.Min.Y),
+			uint16(r.Dx()), uint16(r.Dy()), allPlanes)
+		if err != nil {
+			return nil, err
+		}
+		data, depth, visual = img.Data, img.Depth, img.Visual
+	}
+
+	v := cp.visual(depth, visual)
+	format := cp.c.Setup().Format(depth)
+	if v == nil || format == nil {
+		return nil, errVisual
+	}
+	fb, err := x11.NewFramebuffer(data, r.Dx(), r.Dy(), v, depth, format, cp.c.Setup().ImageByteOrder)
+	if err != nil {
+		return nil, err
+	}
+	if v.Class != x11.VISUAL_CLASS_PSEUDO_COLOR {
+		return toRGBA(fb, nil), nil
+	}
+
+	// The framebuffer has no colors for the pixels, ask the colormap
+	var pixels []uint32
+	palette := make(map[uint32]color.RGBA)
+	for y := fb.Rect.Min.Y; y < fb.Rect.Max.Y; y++ {
+		for x := fb.Rect.Min.X; x < fb.Rect.Max.X; x++ {
+			p := fb.PixelAt(x, y)
+			if _, ok := palette[p]; !ok {
+				palette[p] = color.RGBA{}
+				pixels = append(pixels, p)
+			}
+		}
+	}
+	colors, err := cp.c.QueryColors(cp.c.Screen().DefaultColormap, pixels...)
+	if err != nil {
+		return nil, err
+	}
+	for i, c := range colors {
+		palette[pixels[i]] = color.RGBA{uint8(c.R >> 8), uint8(c.G >> 8), uint8(c.B >> 8), 0xff}
+	}
+	return toRGBA(fb, palette), nil
+}
+
+// Close frees the shared memory segment.
+func (cp *Capturer) Close() error {
+	if cp.seg == nil {
+		return nil
+	}
+	err := cp.seg.Close()
+	cp.seg = nil
+	return err
+}
+
+// grow makes sure the segment holds at least size bytes.
+func (cp *Capturer) grow(size int) error {
+	if cp.seg != nil && len(cp.seg.Data) >= size {
+		return nil
+	}
+	if err := cp.Close(); err != nil {
+		return err
+	}
+	seg, err := cp.shm.NewSegment(size)
+	if err != nil {
+		return err
+	}
+	cp.seg = seg
+	return nil
+}
+
+// visual returns the visual with the given id or, for pixmaps which have
+// none, the root visual or a TrueColor visual of the depth.
+func (cp *Capturer) visual(depth uint8, id uint32) *x11.Visual {
+	screen := cp.c.Screen()
+	if id == x11.X11_NONE && depth == screen.RootDepth {
+		id = screen.RootVisual
+	}
+	if v, _ := screen.Visual(id); v != nil {
+		return v
+	}
+	for _, d := range screen.Depths {
+		if d.Depth != depth {
+			continue
+		}
+		for i := range d.Visuals {
+			if d.Visuals[i].Class == x11.VISUAL_CLASS_TRUE_COLOR {
+				return &d.Visuals[i]
+			}
+		}
+	}
+	return nil
+}
+
+// toRGBA converts fb to an image.RGBA. Unless palette is nil, it holds the
+// colors of the pixel values.
+func toRGBA(fb *x11.Framebuffer, palette map[uint32]color.RGBA) *image.RGBA {
+	img := image.NewRGBA(fb.Rect)
+	for y := fb.Rect.Min.Y; y < fb.Rect.Max.Y; y++ {
+		for x := fb.Rect.Min.X; x < fb.Rect.Max.X; x++ {
+			if palette != nil {
+				img.SetRGBA(x, y, palette[fb.PixelAt(x, y)])
+			} else {
+				img.SetRGBA(x, y, fb.RGBAAt(x, y))
+			}
+		}
+	}
+	return img
+}
@@ -0,0 +1,52 @@
+package capture
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/dzeromsk/helloX11/x11"
+)
+
+func TestToRGBA(t *testing.T) {
+	visual := &x11.Visual{Class: x11.VISUAL_CLASS_TRUE_COLOR, RedMask: 0xff0000, GreenMask: 0x00ff00, BlueMask: 0x0000ff}
+	format := &x11.Format{Depth: 24, BitsPerPixel: 32, ScanlinePad: 32}
+	data := []byte{
+		0x30, 0x20, 0x10, 0x00, 0xff, 0xff, 0xff, 0x00, // BGRX, LSBFirst
+		0x00, 0x00, 0xff, 0x00, 0x00, 0x80, 0x00, 0x00,
+	}
+	fb, err := x11.NewFramebuffer(data, 2, 2, visual, 24, format, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := toRGBA(fb, nil)
+	for _, tt := range []struct {
+		x, y int
+		want color.RGBA
+	}{
+		{0, 0, color.RGBA{0x10, 0x20, 0x30, 0xff}},
+		{1, 0, color.RGBA{0xff, 0xff, 0xff, 0xff}},
+		{0, 1, color.RGBA{0xff, 0x00, 0x00, 0xff}},
+		{1, 1, color.RGBA{0x00, 0x80, 0x00, 0xff}},
+	} {
+		if got := img.RGBAAt(tt.x, tt.y); got != tt.want {
+			t.Errorf("pixel (%d, %d) = %v, want %v", tt.x, tt.y, got, tt.want)
+		}
+	}
+}
+
+func TestToRGBAPalette(t *testing.T) {
+	visual := &x11.Visual{Class: x11.VISUAL_CLASS_PSEUDO_COLOR, BitsPerRGBValue: 8, ColormapEntries: 256}
+	format := &x11.Format{Depth: 8, BitsPerPixel: 8, ScanlinePad: 32}
+	fb, err := x11.NewFramebuffer([]byte{3, 7, 0, 0}, 2, 1, visual, 8, format, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	palette := map[uint32]color.RGBA{3: {0xff, 0, 0, 0xff}, 7: {0, 0x80, 0xff, 0xff}}
+	img := toRGBA(fb, palette)
+	if got := img.RGBAAt(0, 0); got != palette[3] {
+		t.Errorf("pixel 0 = %v, want %v", got, palette[3])
+	}
+	if got := img.RGBAAt(1, 0); got != palette[7] {
+		t.Errorf("pixel 1 = %v, want %v", got, palette[7])
+	}
+}
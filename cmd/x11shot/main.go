@@ -0,0 +1,64 @@
+// Command x11shot writes a PNG screenshot of a window, or of the whole
+// screen.
+//
+//	x11shot [-display :0] [-window 0x2a00004] [-o screenshot.png]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image/png"
+	"os"
+	"strconv"
+
+	"github.com/dzeromsk/helloX11/capture"
+	"github.com/dzeromsk/helloX11/x11"
+)
+
+var (
+	display = flag.String("display", "", "X server to connect to, defaults to $DISPLAY")
+	window  = flag.String("window", "", "ID of the window to capture, in decimal or 0x hex, defaults to the root window")
+	output  = flag.String("o", "screenshot.png", "PNG file to write")
+)
+
+func main() {
+	flag.Parse()
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, "x11shot:", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	conn, err := x11.Dial(*display)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	drawable := conn.Screen().Root
+	if *window != "" {
+		id, err := strconv.ParseUint(*window, 0, 32)
+		if err != nil {
+			return fmt.Errorf("bad window ID %q", *window)
+		}
+		drawable = uint32(id)
+	}
+
+	cp := capture.New(conn)
+	defer cp.Close()
+	img, err := cp.Capture(drawable)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,533 @@
+// Package xtest provides an in-memory X server for the tests of the
+// packages built on x11.
+package xtest
+
+import (
+	"io"
+	"math/bits"
+	"net"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/dzeromsk/helloX11/x11"
+	"github.com/dzeromsk/helloX11/x11byte"
+)
+
+// Root is the root window of the server's only screen, 1920×1080 pixels.
+const Root = 0x123
+
+// Server is an in-memory X server implementing just enough of the core
+// protocol for selection transfers and drags between its clients: windows
+// with their geometry, event masks, atoms, properties, selections,
+// SendEvent, coordinate translation, grabs and a keymap with Escape on
+// keycode 9. Other requests are ignored, except for GetInputFocus, which
+// Sync uses, and QueryExtension, which finds no extensions.
+type Server struct {
+	// MaxRequestLength is the maximum request length announced to clients
+	// dialed afterwards, in 4-byte units.
+	MaxRequestLength uint16
+
+	// Handle, if set, is called with each request before the server
+	// handles it, on the goroutine serving the client that sent it. If it
+	// returns a reply, error or event, that is sent instead of the
+	// server's answer and the request is otherwise ignored.
+	Handle func(req []byte) []byte
+
+	t *testing.T
+
+	mu      sync.Mutex
+	time    uint32
+	clients int
+	atoms   map[string]uint32
+	names   map[uint32]string
+	windows map[uint32]*fakeWindow
+	order   []uint32          // windows from bottom to top
+	owners  map[uint32]uint32 // selection → window
+}
+
+type fakeWindow struct {
+	creator    *fakeClient
+	parent     uint32
+	x, y, w, h int // relative to the parent
+	masks      map[*fakeClient]uint32
+	props      map[uint32]*fakeProp
+}
+
+type fakeProp struct {
+	typ    uint32
+	format uint8
+	data   []byte
+}
+
+type fakeClient struct {
+	conn net.Conn
+	mu   sync.Mutex
+	seq  uint16
+}
+
+// event is an event to write to a client once the server lock is released.
+type event struct {
+	to   *fakeClient
+	data []byte
+}
+
+// NewServer returns a server whose clients are closed when t finishes.
+func NewServer(t *testing.T) *Server {
+	s := &Server{
+		MaxRequestLength: 0xffff,
+		t:                t,
+		atoms:            make(map[string]uint32),
+		names:            make(map[uint32]string),
+		windows:          make(map[uint32]*fakeWindow),
+		owners:           make(map[uint32]uint32),
+	}
+	for name, atom := range map[string]uint32{"PRIMARY": 1, "ATOM": 4, "INTEGER": 19, "STRING": 31} {
+		s.atoms[name], s.names[atom] = atom, name
+	}
+	s.windows[Root] = &fakeWindow{w: 1920, h: 1080, masks: map[*fakeClient]uint32{}, props: map[uint32]*fakeProp{}}
+	return s
+}
+
+// Dial connects a new client.
+func (s *Server) Dial() *x11.Conn {
+	s.t.Helper()
+	client, server := net.Pipe()
+	s.mu.Lock()
+	s.clients++
+	base := uint32(s.clients) << 21
+	s.mu.Unlock()
+
+	go s.serve(&fakeClient{conn: server}, base)
+	c, err := x11.NewConn(client)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	s.t.Cleanup(func() {
+		c.Close()
+		server.Close()
+	})
+	return c
+}
+
+func (s *Server) serve(fc *fakeClient, base uint32) {
+	if _, err := io.ReadFull(fc.conn, make([]byte, 12)); err != nil {
+		return
+	}
+	fc.conn.Write(s.setup(base))
+	for {
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(fc.conn, header); err != nil {
+			return
+		}
+		req := make([]byte, (int(header[2])|int(header[3])<<8)*4)
+		copy(req, header)
+		if _, err := io.ReadFull(fc.conn, req[4:]); err != nil {
+			return
+		}
+		fc.mu.Lock()
+		fc.seq++
+		fc.mu.Unlock()
+
+		if s.Handle != nil {
+			if reply := s.Handle(req); reply != nil {
+				fc.write(reply)
+				continue
+			}
+		}
+		reply, events := s.handle(fc, req)
+		if reply != nil {
+			fc.write(reply)
+		}
+		for _, ev := range events {
+			ev.to.write(ev.data)
+		}
+	}
+}
+
+func (fc *fakeClient) write(data []byte) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if data[0] == 1 || data[0]&0x7f != x11.X11_EVENT_GENERIC_EVENT {
+		data[2], data[3] = byte(fc.seq), byte(fc.seq>>8)
+	}
+	fc.conn.Write(data)
+}
+
+func (s *Server) handle(fc *fakeClient, req x11byte.String) (reply []byte, events []event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u32 := func(off int) uint32 {
+		v := x11byte.String(req[off:])
+		var x uint32
+		v.ReadUint32(&x)
+		return x
+	}
+	u16 := func(off int) int { return int(req[off]) | int(req[off+1])<<8 }
+
+	switch req[0] {
+	case x11.X11_REQUEST_CREATE_WINDOW:
+		w := &fakeWindow{
+			creator: fc,
+			parent:  u32(8),
+			x:       int(int16(u16(12))),
+			y:       int(int16(u16(14))),
+			w:       u16(16),
+			h:       u16(18),
+			masks:   map[*fakeClient]uint32{},
+			props:   map[uint32]*fakeProp{},
+		}
+		s.windows[u32(4)] = w
+		s.order = append(s.order, u32(4))
+		s.selectInput(fc, w, u32(28), req[32:])
+
+	case x11.X11_REQUEST_DESTROY_WINDOW:
+		window := u32(4)
+		w := s.windows[window]
+		if w == nil {
+			break
+		}
+		for fc, mask := range w.masks {
+			if mask&x11.X11_EVENT_FLAG_STRUCTURE_NOTIFY == 0 {
+				continue
+			}
+			var b x11byte.Builder
+			b.AddUint8(x11.X11_EVENT_DESTROY_NOTIFY)
+			b.AddBytes(make([]byte, 3))
+			b.AddUint32(window) // event
+			b.AddUint32(window) // window
+			b.AddBytes(make([]byte, 20))
+			events = append(events, event{fc, b.BytesOrPanic()})
+		}
+		delete(s.windows, window)
+		for selection, owner := range s.owners {
+			if owner == window {
+				delete(s.owners, selection)
+			}
+		}
+		s.order = slices.DeleteFunc(s.order, func(id uint32) bool { return id == window })
+
+	case x11.X11_REQUEST_TRANSLATE_COORDINATES:
+		src, dst := s.windows[u32(4)], s.windows[u32(8)]
+		if src == nil || dst == nil {
+			reply = Error(x11.X11_ERROR_BAD_WINDOW, u32(4), req[0])
+			break
+		}
+		sx, sy := s.origin(u32(4))
+		dx, dy := s.origin(u32(8))
+		x, y := sx+int(int16(u16(12))), sy+int(int16(u16(14)))
+		child := uint32(x11.X11_NONE)
+		for _, id := range s.order {
+			w := s.windows[id]
+			if w.parent == u32(8) && x >= dx+w.x && x < dx+w.x+w.w && y >= dy+w.y && y < dy+w.y+w.h {
+				child = id // the last one is on top
+			}
+		}
+		var b x11byte.Builder
+		b.AddUint32(child)          // child
+		b.AddUint16(uint16(x - dx)) // dstX
+		b.AddUint16(uint16(y - dy)) // dstY
+		reply = Reply(1, b.BytesOrPanic())
+
+	case x11.X11_REQUEST_GRAB_POINTER, x11.X11_REQUEST_GRAB_KEYBOARD:
+		reply = Reply(0, nil) // Success
+
+	case x11.X11_REQUEST_GET_KEYBOARD_MAPPING:
+		first, count := int(req[4]), int(req[5])
+		var b x11byte.Builder
+		b.AddBytes(make([]byte, 24)) // unused
+		for keycode := first; keycode < first+count; keycode++ {
+			if keycode == 9 {
+				b.AddUint32(x11.XK_Escape)
+			} else {
+				b.AddUint32(0)
+			}
+		}
+		reply = Reply(1, b.BytesOrPanic())
+
+	case x11.X11_REQUEST_GET_MODIFIER_MAPPING:
+		reply = Reply(0, nil) // no modifiers
+
+	case x11.X11_REQUEST_CHANGE_WINDOW_ATTRIBUTES:
+		if w := s.windows[u32(4)]; w != nil {
+			s.selectInput(fc, w, u32(8), req[12:])
+		}
+
+	case x11.X11_REQUEST_INTERN_ATOM:
+		name := string(req[8 : 8+u16(4)])
+		atom, ok := s.atoms[name]
+		if !ok {
+			atom = uint32(len(s.atoms) + 100)
+			s.atoms[name], s.names[atom] = atom, name
+		}
+		var b x11byte.Builder
+		b.AddUint32(atom)
+		reply = Reply(0, b.BytesOrPanic())
+
+	case x11.X11_REQUEST_GET_ATOM_NAME:
+		name := s.names[u32(4)]
+		var b x11byte.Builder
+		b.AddUint16(uint16(len(name)))
+		b.AddBytes(make([]byte, 22))
+		b.AddBytes([]byte(name))
+		reply = Reply(0, b.BytesOrPanic())
+
+	case x11.X11_REQUEST_CHANGE_PROPERTY:
+		w, prop := s.windows[u32(4)], u32(8)
+		if w == nil {
+			reply = Error(x11.X11_ERROR_BAD_WINDOW, u32(4), req[0])
+			break
+		}
+		format := req[16]
+		data := req[24 : 24+int(u32(20))*int(format/8)]
+		p := w.props[prop]
+		if p == nil || req[1] == x11.X11_PROP_MODE_REPLACE {
+			p = &fakeProp{typ: u32(12), format: format}
+			w.props[prop] = p
+		}
+		switch req[1] {
+		case x11.X11_PROP_MODE_PREPEND:
+			p.data = append(append([]byte(nil), data...), p.data...)
+		default:
+			p.data = append(p.data, data...)
+		}
+		events = s.propertyNotify(u32(4), prop, false)
+
+	case x11.X11_REQUEST_DELETE_PROPERTY:
+		if w := s.windows[u32(4)]; w != nil && w.props[u32(8)] != nil {
+			delete(w.props, u32(8))
+			events = s.propertyNotify(u32(4), u32(8), true)
+		}
+
+	case x11.X11_REQUEST_GET_PROPERTY:
+		w, prop := s.windows[u32(4)], u32(8)
+		if w == nil {
+			reply = Error(x11.X11_ERROR_BAD_WINDOW, u32(4), req[0])
+			break
+		}
+		p := w.props[prop]
+		var b x11byte.Builder
+		if p == nil {
+			b.AddUint32(0)               // type
+			b.AddBytes(make([]byte, 20)) // bytesAfter, valueLength, unused
+			reply = Reply(0, b.BytesOrPanic())
+			break
+		}
+		start := min(int(u32(16))*4, len(p.data))
+		end := min(start+int(u32(20))*4, len(p.data))
+		value := p.data[start:end]
+		after := len(p.data) - end
+		b.AddUint32(p.typ)                                // type
+		b.AddUint32(uint32(after))                        // bytesAfter
+		b.AddUint32(uint32(len(value) / int(p.format/8))) // valueLength
+		b.AddBytes(make([]byte, 12))                      // unused
+		b.AddBytes(value)                                 // value
+		b.AddBytes(make([]byte, (4-len(value)%4)%4))      // padding
+		reply = Reply(p.format, b.BytesOrPanic())
+		if req[1] != 0 && after == 0 {
+			delete(w.props, prop)
+			events = s.propertyNotify(u32(4), prop, true)
+		}
+
+	case x11.X11_REQUEST_SET_SELECTION_OWNER:
+		owner, selection := u32(4), u32(8)
+		if old := s.owners[selection]; old != 0 && old != owner {
+			var b x11byte.Builder
+			b.AddUint8(x11.X11_EVENT_SELECTION_CLEAR)
+			b.AddBytes(make([]byte, 3))
+			b.AddUint32(s.time)
+			b.AddUint32(old)
+			b.AddUint32(selection)
+			b.AddBytes(make([]byte, 16))
+			events = append(events, event{s.windows[old].creator, b.BytesOrPanic()})
+		}
+		s.owners[selection] = owner
+
+	case x11.X11_REQUEST_GET_SELECTION_OWNER:
+		var b x11byte.Builder
+		b.AddUint32(s.owners[u32(4)])
+		reply = Reply(0, b.BytesOrPanic())
+
+	case x11.X11_REQUEST_CONVERT_SELECTION:
+		requestor, selection, target, property, time := u32(4), u32(8), u32(12), u32(16), u32(20)
+		var b x11byte.Builder
+		if owner := s.owners[selection]; owner != 0 {
+			b.AddUint8(x11.X11_EVENT_SELECTION_REQUEST)
+			b.AddBytes(make([]byte, 3))
+			b.AddUint32(time)
+			b.AddUint32(owner)
+			b.AddUint32(requestor)
+			b.AddUint32(selection)
+			b.AddUint32(target)
+			b.AddUint32(property)
+			b.AddBytes(make([]byte, 4))
+			events = append(events, event{s.windows[owner].creator, b.BytesOrPanic()})
+		} else {
+			b.AddUint8(x11.X11_EVENT_SELECTION_NOTIFY)
+			b.AddBytes(make([]byte, 3))
+			b.AddUint32(time)
+			b.AddUint32(requestor)
+			b.AddUint32(selection)
+			b.AddUint32(target)
+			b.AddUint32(x11.X11_NONE)
+			b.AddBytes(make([]byte, 8))
+			if w := s.windows[requestor]; w != nil {
+				events = append(events, event{w.creator, b.BytesOrPanic()})
+			}
+		}
+
+	case x11.X11_REQUEST_SEND_EVENT:
+		if w := s.windows[u32(4)]; w != nil && w.creator != nil {
+			data := append([]byte(nil), req[12:44]...)
+			data[0] |= 0x80
+			events = append(events, event{w.creator, data})
+		}
+
+	case x11.X11_REQUEST_GET_INPUT_FOCUS:
+		reply = Reply(0, nil)
+
+	case x11.X11_REQUEST_QUERY_EXTENSION:
+		reply = Reply(0, nil) // not present
+	}
+	return reply, events
+}
+
+// selectInput applies the event mask among window attribute values.
+func (s *Server) selectInput(fc *fakeClient, w *fakeWindow, valueMask uint32, values []byte) {
+	if valueMask&x11.X11_FLAG_WIN_EVENT == 0 {
+		return
+	}
+	i := bits.OnesCount32(valueMask & (x11.X11_FLAG_WIN_EVENT - 1))
+	v := x11byte.String(values[i*4:])
+	var mask uint32
+	v.ReadUint32(&mask)
+	w.masks[fc] = mask
+}
+
+// origin returns the root coordinates of a window.
+func (s *Server) origin(window uint32) (x, y int) {
+	for window != Root {
+		w := s.windows[window]
+		x, y, window = x+w.x, y+w.y, w.parent
+	}
+	return x, y
+}
+
+func (s *Server) propertyNotify(window, atom uint32, deleted bool) []event {
+	s.time++
+	var events []event
+	for fc, mask := range s.windows[window].masks {
+		if mask&x11.X11_EVENT_FLAG_PROPERTY_CHANGE == 0 {
+			continue
+		}
+		var b x11byte.Builder
+		b.AddUint8(x11.X11_EVENT_PROPERTY_NOTIFY)
+		b.AddBytes(make([]byte, 3))
+		b.AddUint32(window)
+		b.AddUint32(atom)
+		b.AddUint32(s.time)
+		b.AddUint8(boolByte(deleted))
+		b.AddBytes(make([]byte, 15))
+		events = append(events, event{fc, b.BytesOrPanic()})
+	}
+	return events
+}
+
+// Reply returns a reply with data in its second byte and body after the
+// 8-byte header, padded to at least 24 bytes. The server fills in the
+// sequence number.
+func Reply(data uint8, body []byte) []byte {
+	body = append(body, make([]byte, max(24-len(body), (4-len(body)%4)%4))...)
+	var b x11byte.Builder
+	b.AddUint8(1)                             // reply
+	b.AddUint8(data)                          // data
+	b.AddUint16(0)                            // sequenceNumber
+	b.AddUint32(uint32((len(body) - 24) / 4)) // replyLength
+	b.AddBytes(body)
+	return b.BytesOrPanic()
+}
+
+// Error returns an error of a request with major opcode major.
+func Error(code uint8, value uint32, major uint8) []byte {
+	var b x11byte.Builder
+	b.AddUint8(0)                // error
+	b.AddUint8(code)             // code
+	b.AddUint16(0)               // sequenceNumber
+	b.AddUint32(value)           // badValue
+	b.AddUint16(0)               // minorOpcode
+	b.AddUint8(major)            // majorOpcode
+	b.AddBytes(make([]byte, 21)) // unused
+	return b.BytesOrPanic()
+}
+
+func boolByte(v bool) uint8 {
+	if v {
+		return 1
+	}
+	return 0
+}
+
+func (s *Server) setup(base uint32) []byte {
+	var b x11byte.Builder
+	b.AddUint32(0)                  // releaseNumber
+	b.AddUint32(base)               // resourceIDBase
+	b.AddUint32(0x001fffff)         // resourceIDMask
+	b.AddUint32(0)                  // motionBufferSize
+	b.AddUint16(4)                  // lengthOfVendor
+	b.AddUint16(s.MaxRequestLength) // maximumRequestLength
+	b.AddUint8(1)                   // numberOfScreensInRoot
+	b.AddUint8(1)                   // numberOfFormats
+	b.AddUint8(0)                   // imageByteOrder
+	b.AddUint8(0)                   // bitmapFormatBitOrder
+	b.AddUint8(32)                  // bitmapFormatScanlineUnit
+	b.AddUint8(32)                  // bitmapFormatScanlinePad
+	b.AddUint8(8)                   // minKeycode
+	b.AddUint8(255)                 // maxKeyCode
+	b.AddUint32(0)                  // unused
+	b.AddBytes([]byte("fake"))
+
+	b.AddUint8(24)              // depth
+	b.AddUint8(32)              // bitsPerPixel
+	b.AddUint8(32)              // scanlinePad
+	b.AddBytes(make([]byte, 5)) // unused
+
+	b.AddUint32(Root)     // root
+	b.AddUint32(0x20)     // defaultColormap
+	b.AddUint32(0xffffff) // whitePixel
+	b.AddUint32(0)        // blackPixel
+	b.AddUint32(0)        // currentInputMask
+	b.AddUint16(1920)     // widthInPixels
+	b.AddUint16(1080)     // heightInPixels
+	b.AddUint16(508)      // widthInMillimeters
+	b.AddUint16(285)      // heightInMillimeters
+	b.AddUint16(1)        // minInstalledMaps
+	b.AddUint16(1)        // maxInstalledMaps
+	b.AddUint32(0x21)     // rootVisual
+	b.AddUint8(0)         // backingStores
+	b.AddUint8(0)         // saveUnders
+	b.AddUint8(24)        // rootDepth
+	b.AddUint8(1)         // allowedDepthsLen
+	b.AddUint8(24)        // depth
+	b.AddUint8(0)         // unused
+	b.AddUint16(1)        // visualsLen
+	b.AddUint32(0)        // unused
+	b.AddUint32(0x21)     // visualID
+	b.AddUint8(4)         // class, TrueColor
+	b.AddUint8(8)         // bitsPerRGBValue
+	b.AddUint16(256)      // colormapEntries
+	b.AddUint32(0xff0000) // redMask
+	b.AddUint32(0x00ff00) // greenMask
+	b.AddUint32(0x0000ff) // blueMask
+	b.AddUint32(0)        // unused
+	body := b.BytesOrPanic()
+
+	var h x11byte.Builder
+	h.AddUint8(1)                      // status
+	h.AddUint8(0)                      // unused
+	h.AddUint16(11)                    // majorVersion
+	h.AddUint16(0)                     // minorVersion
+	h.AddUint16(uint16(len(body) / 4)) // replyLength
+	h.AddBytes(body)
+	return h.BytesOrPanic()
+}
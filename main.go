@@ -2,14 +2,20 @@
 package main
 
 import (
+	"context"
 	"encoding/hex"
-	"errors"
-	"io"
-	"net"
-
-	"github.com/dzeromsk/helloX11/x11byte"
-
-	"github.com/gen2brain/shm"
+	"flag"
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/dzeromsk/helloX11/render"
+	"github.com/dzeromsk/helloX11/selection"
+	"github.com/dzeromsk/helloX11/surface"
+	"github.com/dzeromsk/helloX11/x11"
+	"github.com/dzeromsk/helloX11/xdnd"
+	"github.com/dzeromsk/helloX11/xinput"
+	"github.com/dzeromsk/helloX11/xkb"
 )
 
 const (
@@ -17,433 +23,395 @@ const (
 	height = 1024
 )
 
+var (
+	display     = flag.String("display", "", "X server to connect to, defaults to $DISPLAY")
+	fullscreen  = flag.Bool("fullscreen", false, "start in fullscreen mode")
+	above       = flag.Bool("above", false, "keep the window above other windows")
+	undecorated = flag.Bool("undecorated", false, "ask the window manager not to decorate the window")
+	windows     = flag.Int("windows", 1, "number of windows to open")
+	cursor      = flag.String("cursor", "crosshair", "pointer shape: crosshair, hand, text, dot or hidden")
+	animate     = flag.Bool("animate", false, "scroll the image, drawn by a render goroutine")
+)
+
 func main() {
-	// Prepare Image
-	shmid, err := shm.Get(shm.IPC_PRIVATE, width*height*4, shm.IPC_CREAT|0600)
+	flag.Parse()
+
+	conn, err := x11.Dial(*display)
 	if err != nil {
 		panic(err)
 	}
+	defer conn.Close()
 
-	shmaddr, err := shm.At(shmid, 0, 0)
+	var states []string
+	if *fullscreen {
+		states = append(states, x11.NetWMStateFullscreen)
+	}
+	if *above {
+		states = append(states, x11.NetWMStateAbove)
+	}
+
+	opts := []x11.WindowOption{
+		x11.WithBorderWidth(1),
+		x11.WithState(states...),
+	}
+	if *undecorated {
+		opts = append(opts, x11.WithoutDecorations())
+	}
+
+	keyboard, err := conn.NewKeyboard()
 	if err != nil {
 		panic(err)
 	}
-	defer shm.Dt(shmaddr)
-	defer shm.Ctl(shmid, shm.IPC_RMID, nil)
 
-	for i := range height {
-		for j := range width {
-			offset := (i*width + j) * 4
-			shmaddr[offset+0] = uint8(i / 4 % 256)
-			shmaddr[offset+1] = uint8(j / 4 % 256)
-			shmaddr[offset+2] = 0x00
-			shmaddr[offset+3] = 0x00
+	d := x11.NewDispatcher(conn)
+	d.Error = func(e *x11.Error) {
+		println(e.Error())
+	}
+	d.Keyboard = keyboard // follow layout changes
+
+	// Prefer XKB for groups, level 3 and dead keys
+	lookup, text := keyboard.Lookup, keyboard.Text
+	d.Repeat = x11.NewRepeatDetector(conn)
+	d.CompressMotion = true
+	if kb, err := xkb.New(conn); err == nil {
+		d.Filter = kb.Filter
+		lookup, text = kb.Lookup, kb.Text
+		if d.Repeat.Detectable, err = kb.SetDetectableAutoRepeat(true); err != nil {
+			panic(err)
 		}
 	}
+	var composer xkb.Composer
 
-	conn, err := net.Dial("unix", "/tmp/.X11-unix/X0")
-	// conn, err := net.Dial("tcp4", "127.0.0.1:6000")
+	// Copy and paste, on a connection of its own
+	selConn, err := x11.Dial(*display)
 	if err != nil {
 		panic(err)
 	}
-	defer conn.Close()
-
-	nextID, parentID, visualID, err := authenticate(conn)
+	defer selConn.Close()
+	selections, err := selection.NewManager(selConn)
 	if err != nil {
 		panic(err)
 	}
-	_ = visualID
+	clipboard := selections.Clipboard()
 
-	// TODO(dzeromsk): verify wmProtocols and wmDeleteWindow are static
-	// wmProtocols, wmDeleteWindow, err := internAtom(conn)
-	// if err != nil {
-	// 	panic(err)
-	// }
-	wmProtocols, wmDeleteWindow := uint32(441), uint32(439)
-	// println(wmProtocols, wmDeleteWindow)
-
-	// TODO(dzeromsk): verify mitshmOpcode is static
-	// mitshmOpcode, err := mitshmExtension(conn)
-	// if err != nil {
-	// 	panic(err)
-	// }
-	mitshmOpcode := uint8(130)
-	// println(mitshmOpcode)
-
-	var b x11byte.Builder
-
-	windowID := nextID()
-
-	// Create Window, required
-	b.AddUint8(X11_REQUEST_CREATE_WINDOW) // opcode
-	b.AddUint8(0)                         // depth
-	b.AddUint16(10)                       // requestLength
-	b.AddUint32(windowID)                 // windowID
-	b.AddUint32(parentID)                 // parent
-	b.AddUint16(0)                        // x
-	b.AddUint16(0)                        // y
-	b.AddUint16(width)                    // width
-	b.AddUint16(height)                   // height
-	b.AddUint16(1)                        // borderWidth
-	// b.AddUint16(WINDOWCLASS_INPUTOUTPUT)                     // windowClass
-	// b.AddUint32(visualID)                                    // visualID
-	b.AddUint16(0)                                              // windowClass
-	b.AddUint32(0)                                              // visualID
-	b.AddUint32(X11_FLAG_BACKGROUND_PIXEL | X11_FLAG_WIN_EVENT) // windowValueMask
-	b.AddUint32(0x00000000)                                     // backgroundPixel
-	b.AddUint32(X11_EVENT_FLAG_EXPOSURE)                        // windowEvents
-
-	shmID := nextID()
-
-	// MIT-SHM Attach, to avoid image data copy
-	b.AddUint8(mitshmOpcode)   // opcode
-	b.AddUint8(1)              // extension-minor, attach
-	b.AddUint16(4)             // requestLength
-	b.AddUint32(shmID)         // shmseg
-	b.AddUint32(uint32(shmid)) // shmid
-	b.AddUint8(0)              // read only
-	b.AddUint24(0)             // unused
-
-	// Change Property, to let know WM that we support delete window
-	b.AddUint8(X11_REQUEST_CHANGE_PROPERTY) // opcode
-	b.AddUint8(0)                           // mode
-	b.AddUint16(7)                          // requestLength
-	b.AddUint32(windowID)                   // windowID
-	b.AddUint32(wmProtocols)                // property
-	b.AddUint32(4)                          // type
-	b.AddUint8(32)                          // format
-	b.AddUint24(0)                          // unused
-	b.AddUint32(1)                          // dataLength
-	b.AddUint32(wmDeleteWindow)             // data
-
-	gcID := nextID()
-
-	// Create GC, needed by mit-shm PutImage
-	b.AddUint8(X11_REQUEST_CREATE_GC)   // opcode
-	b.AddUint8(0)                       // unused
-	b.AddUint16(5)                      // requestLength
-	b.AddUint32(gcID)                   // cid
-	b.AddUint32(windowID)               // drawable
-	b.AddUint32(X11_GC_FLAG_BACKGROUND) // gcValueMask
-	b.AddUint32(0x00000000)             // background
-
-	// Map window, required
-	b.AddUint8(X11_REQUEST_MAP_WINDOW) // opcode
-	b.AddUint8(0)                      // unused
-	b.AddUint16(2)                     // requestLength
-	b.AddUint32(windowID)              // windowID
-
-	if _, err := conn.Write(b.BytesOrPanic()); err != nil {
+	// Drag and drop, seeing events before XKB
+	dnd, err := xdnd.New(conn, selections)
+	if err != nil {
 		panic(err)
 	}
+	dnd.Error = func(err error) {
+		println("drop:", err.Error())
+	}
+	kbFilter := d.Filter
+	d.Filter = func(ev x11.Event) (bool, error) {
+		if handled, err := dnd.Filter(ev); handled || err != nil {
+			return handled, err
+		}
+		if kbFilter != nil {
+			return kbFilter(ev)
+		}
+		return false, nil
+	}
 
-	data := x11byte.String(make([]byte, 4096))
-recv:
-	for {
-		n, err := conn.Read(data)
+	// Smooth scrolling and touch, if the server has XInput 2
+	xi, err := xinput.New(conn)
+	var scroller *xinput.Scroller
+	if err == nil {
+		devices, err := xi.QueryDevice(xinput.XI_ALL_DEVICES)
 		if err != nil {
 			panic(err)
 		}
-		if n == 0 {
-			break
+		scroller = xinput.NewScroller(devices)
+	}
+	d.Unhandled = func(ev x11.Event) {
+		if raw, ok := ev.(x11.RawEvent); ok {
+			print(hex.Dump(raw))
 		}
+	}
 
-		msg := data[:n]
-		switch msg[0] {
-		case 0:
-			println("response error")
-			print(hex.Dump(msg))
-
-		case 1:
-			println("reply ok")
-			print(hex.Dump(msg))
-
-		default:
-			// println("event")
-
-			switch msg[0] {
-			case 12: // Expose event, need to redraw
-				msg.Skip(1) // evetcode
-				msg.Skip(1) // unused
-				msg.Skip(2) // sequenceNumber
-				msg.Skip(4) // window
-				var x, y, w, h uint16
-				msg.ReadUint16(&x)
-				msg.ReadUint16(&y)
-				msg.ReadUint16(&w)
-				msg.ReadUint16(&h)
-				// println(x, y, w, h)
+	// Pointer shape, a standard one from the cursor font or a custom image
+	var cursorID uint32
+	switch *cursor {
+	case "crosshair":
+		cursorID, err = conn.CreateFontCursor(x11.X11_CURSOR_CROSSHAIR)
+	case "hand":
+		cursorID, err = conn.CreateFontCursor(x11.X11_CURSOR_HAND2)
+	case "text":
+		cursorID, err = conn.CreateFontCursor(x11.X11_CURSOR_XTERM)
+	case "dot":
+		var r *render.Render
+		if r, err = render.New(conn); err == nil {
+			cursorID, err = r.CreateCursor(dotCursor(16), 8, 8)
+		}
+	case "hidden":
+		cursorID, err = conn.CreateBlankCursor()
+	}
+	if err != nil {
+		panic(err)
+	}
 
-				var r x11byte.Builder
-				dstx, dsty := max((int(w)-width)/2, 0), max((int(h)-height)/2, 0)
-				// MIT-SHM PutImage
-				r.AddUint8(mitshmOpcode) // opcode
-				r.AddUint8(3)            // extension-minor, PutImage
-				r.AddUint16(10)          // requestLength
-				r.AddUint32(windowID)    // drawable
-				r.AddUint32(gcID)        // gc
-				r.AddUint16(width)       // totalWidth
-				r.AddUint16(height)      // totalHeight
-				r.AddUint16(0)           // srcX
-				r.AddUint16(0)           // srcY
-				r.AddUint16(width)       // srcWidth
-				r.AddUint16(height)      // srcHeight
-				// r.AddUint16(0)           // dstX
-				// r.AddUint16(0)           // dstY
-				r.AddUint16(uint16(dstx)) // dstX
-				r.AddUint16(uint16(dsty)) // dstY
-				r.AddUint8(24)            // depth
-				r.AddUint8(2)             // format
-				r.AddUint8(0)             // sendEvent
-				r.AddUint8(0)             // unused
-				r.AddUint32(shmID)        // shmseg
-				r.AddUint32(0)            // offset
+	for range *windows {
+		// Create Window, required
+		window, err := conn.CreateWindow(conn.Screen().Root, width, height, opts...)
+		if err != nil {
+			panic(err)
+		}
 
-				put := r.BytesOrPanic()
+		// Let know WM that we support delete window
+		if err := window.EnableDeleteWindow(); err != nil {
+			panic(err)
+		}
 
-				if _, err := conn.Write(put); err != nil {
-					panic(err)
+		// Prepare Image, shared with the server through MIT-SHM if possible
+		surf, err := surface.New(window, width, height)
+		if err != nil {
+			panic(err)
+		}
+		defer surf.Close()
+		fb := surf.Image()
+		gradient(fb, 0)
+		println("shared memory", surf.Shared())
+
+		// Or animate it, drawing each frame while the server shows the last,
+		// once per vertical blank if the server has Present
+		var chain animator
+		if *animate {
+			if loop, err := surface.NewLoop(window, width, height, 3); err == nil {
+				loop.Presented = func(f surface.Frame) {
+					if f.Serial%60 == 0 {
+						println("frame", f.Serial, f.MSC, f.UST)
+					}
 				}
-			case 161: // Client Message, maybe vmDeleteWindow from Window Manager
-				msg.Skip(1) // eventCode
-				msg.Skip(1) // format
-				msg.Skip(2) // sequenceNumber
-				msg.Skip(4) // window
-				var typ, value uint32
-				msg.ReadUint32(&typ)
-				msg.ReadUint32(&value)
-				// println(typ, value)
-				if typ == wmProtocols && value == wmDeleteWindow {
-					break recv
+				chain = loop
+			} else if chain, err = surface.NewChain(window, width, height, 3); err != nil {
+				panic(err)
+			}
+			defer chain.Close()
+			filter := d.Filter
+			d.Filter = func(ev x11.Event) (bool, error) {
+				if handled, err := chain.Filter(ev); handled || err != nil {
+					return handled, err
 				}
-			default:
-				print(hex.Dump(msg))
+				return filter(ev)
 			}
+			go func() {
+				for frame := 0; ; frame++ {
+					fb, err := chain.Acquire(context.Background())
+					if err != nil {
+						panic(err)
+					}
+					gradient(fb, frame)
+					if err := chain.Present(fb); err != nil {
+						println("present:", err.Error())
+						return
+					}
+				}
+			}()
 		}
-	}
-}
-
-const (
-	X11_FLAG_WIN_EVENT        = 0x00000800
-	X11_FLAG_BACKGROUND_PIXEL = 0x00000002
-)
-
-const (
-	WINDOWCLASS_COPYFROMPARENT = 0
-	WINDOWCLASS_INPUTOUTPUT    = 1
-	WINDOWCLASS_INPUTONLY      = 2
-)
 
-const (
-	X11_EVENT_FLAG_KEY_PRESS   = 0x00000001
-	X11_EVENT_FLAG_KEY_RELEASE = 0x00000002
-	X11_EVENT_FLAG_EXPOSURE    = 0x8000
-)
+		d.Register(window, &x11.WindowHandler{
+			Key: func(ev *x11.KeyEvent) { // print typed text
+				if !ev.Pressed {
+					return
+				}
+				if ev.State.Has(x11.X11_MOD_MASK_CONTROL) {
+					switch lookup(ev) {
+					case 'c': // copy
+						if err := clipboard.Write(selection.MimeText, []byte("Hello from helloX11")); err != nil {
+							println("copy:", err.Error())
+						}
+						return
+					case 'v': // paste, without blocking the event loop
+						go func() {
+							data, err := clipboard.Read(context.Background(), selection.MimeText)
+							if err != nil {
+								println("paste:", err.Error())
+								return
+							}
+							println("paste:", string(data))
+						}()
+						return
+					}
+				}
+				if s := composer.Compose(lookup(ev), text(ev)); s != "" {
+					print(s)
+				}
+			},
+			Button: func(ev *x11.ButtonEvent) {
+				if !ev.Pressed {
+					return
+				}
+				println("button", ev.Button, ev.EventX, ev.EventY)
 
-const (
-	X11_GC_FLAG_BACKGROUND = 0x00000008
-)
+				// Mark the spot and send only that part of the image
+				spot := image.Rect(-4, -4, 4, 4).Add(image.Pt(int(ev.EventX), int(ev.EventY)).Sub(surf.Offset))
+				draw.Draw(fb, spot, image.White, image.Point{}, draw.Src)
+				surf.Damage(spot)
+				if err := surf.Flush(); err != nil {
+					panic(err)
+				}
+			},
+			Motion: func(ev *x11.MotionEvent) { // drag text out of the window
+				if !ev.State.Button(x11.X11_BUTTON_LEFT) {
+					return
+				}
+				err := dnd.StartDrag(window, &xdnd.Drag{
+					Formats: map[string][]byte{selection.MimeText: []byte("Hello from helloX11")},
+					Finished: func(action string) {
+						println("drag:", action)
+					},
+				}, ev.Time)
+				if err != nil && err != xdnd.ErrDragging {
+					println("drag:", err.Error())
+				}
+			},
+			Scroll: func(ev *x11.ScrollEvent) { // move the image on the server, draw only the uncovered strips
+				println("scroll", ev.DX, ev.DY)
+				d := image.Pt(-32*ev.DX, -32*ev.DY)
+				if err := surf.Scroll(fb.Rect, d); err != nil {
+					panic(err)
+				}
+				moved := fb.Rect.Add(d)
+				for _, r := range []image.Rectangle{
+					image.Rect(0, 0, width, moved.Min.Y), image.Rect(0, moved.Max.Y, width, height),
+					image.Rect(0, 0, moved.Min.X, height), image.Rect(moved.Max.X, 0, width, height),
+				} {
+					if r = r.Intersect(fb.Rect); !r.Empty() {
+						draw.Draw(fb, r, image.NewUniform(color.Gray{0x40}), image.Point{}, draw.Src)
+						surf.Damage(r)
+					}
+				}
+				if err := surf.Flush(); err != nil {
+					panic(err)
+				}
+			},
+			Focus: func(ev *x11.FocusEvent) {
+				println("focus", window.ID, ev.In)
+			},
+			Enter: func(ev *x11.CrossingEvent) {
+				if scroller != nil {
+					scroller.Reset() // scroll axes moved while outside
+				}
+			},
+			Event: func(e x11.Event) {
+				ev, ok := e.(*xinput.DeviceEvent)
+				if !ok {
+					return
+				}
+				switch ev.Type {
+				case xinput.XI_EVENT_MOTION:
+					if dx, dy, ok := scroller.Scroll(ev); ok {
+						println("smooth scroll", dx, dy)
+					}
+				case xinput.XI_EVENT_TOUCH_BEGIN, xinput.XI_EVENT_TOUCH_UPDATE, xinput.XI_EVENT_TOUCH_END:
+					println("touch", ev.Type, ev.Detail, ev.EventX, ev.EventY)
+				}
+			},
+			Configure: func(ev *x11.ConfigureNotifyEvent) { // keep the image centered
+				surf.Offset = image.Pt(max((int(ev.Width)-width)/2, 0), max((int(ev.Height)-height)/2, 0))
+				if chain != nil {
+					chain.SetOffset(surf.Offset)
+				}
+			},
+			Expose: func(ev *x11.ExposeEvent) { // need to redraw the exposed part
+				expose := surf.Expose
+				if chain != nil {
+					expose = chain.Expose
+				}
+				if err := expose(ev); err != nil {
+					panic(err)
+				}
+			},
+			GraphicsExpose: func(ev *x11.GraphicsExposureEvent) { // scrolled from a hidden part
+				if err := surf.GraphicsExpose(ev); err != nil {
+					panic(err)
+				}
+			},
+			StateChange: func() { // WM changed _NET_WM_STATE
+				state, err := window.State()
+				if err != nil {
+					panic(err)
+				}
+				println("state", window.ID, len(state))
+				for _, s := range state {
+					println(" ", s)
+				}
+			},
+		})
+
+		// Accept dropped files and text
+		err = dnd.Register(window, &xdnd.Target{
+			Types: []string{xdnd.MimeURIList, selection.MimeText},
+			Drop: func(drop *xdnd.Drop) {
+				println("drop:", drop.Type, drop.X, drop.Y)
+				print(string(drop.Data), "\n")
+			},
+		})
+		if err != nil {
+			panic(err)
+		}
 
-const (
-	X11_REQUEST_CREATE_WINDOW   = 1
-	X11_REQUEST_MAP_WINDOW      = 8
-	X11_REQUEST_INTERN_ATOM     = 16
-	X11_REQUEST_CHANGE_PROPERTY = 18
-	X11_REQUEST_CREATE_GC       = 55
-	X11_REQUEST_QUERY_EXTENSION = 98
-)
+		if xi != nil {
+			err := xi.SelectEvents(window.ID, xinput.XI_ALL_MASTER_DEVICES,
+				xinput.XI_EVENT_MOTION,
+				xinput.XI_EVENT_TOUCH_BEGIN, xinput.XI_EVENT_TOUCH_UPDATE, xinput.XI_EVENT_TOUCH_END)
+			if err != nil {
+				panic(err)
+			}
+		}
 
-var (
-	errResponseStateFailed       = errors.New("RESPONSE_STATE_FAILED")
-	errResponseStateAuthenticate = errors.New("RESPONSE_STATE_AUTHENTICATE")
-	errResponseStateUnknown      = errors.New("RESPONSE_STATE_UNKNOWN")
-)
+		if cursorID != x11.X11_NONE {
+			if err := window.DefineCursor(cursorID); err != nil {
+				panic(err)
+			}
+		}
 
-func authenticate(conn net.Conn) (func() uint32, uint32, uint32, error) {
-	var b x11byte.Builder
-	b.AddUint8('l') // byte-order
-	b.AddUint8(0)   // unused
-	b.AddUint16(11) // protocol-major-version
-	b.AddUint16(0)  // protocol-minor-version
-	b.AddUint16(0)  // authorization-protocol-name-length
-	b.AddUint16(0)  // authorization-protocol-data-length
-	b.AddUint16(0)  // protocol-minor-version
-	if _, err := conn.Write(b.BytesOrPanic()); err != nil {
-		return nil, 0, 0, err
+		// Map window, required
+		if err := window.Map(); err != nil {
+			panic(err)
+		}
 	}
 
-	header := x11byte.String(make([]byte, 8))
-	if _, err := io.ReadFull(conn, header); err != nil {
-		return nil, 0, 0, err
+	// Run until the last window is closed
+	if err := d.Run(); err != nil {
+		panic(err)
 	}
+}
 
-	var (
-		status       uint8
-		replayLength uint16
-	)
-	header.ReadUint8(&status)
-	header.Skip(1) // unused
-	header.Skip(2) // majorVersion
-	header.Skip(2) // minorVersion
-	header.ReadUint16(&replayLength)
+// animator is a surface.Chain or, paced to the display, a surface.Loop.
+type animator interface {
+	Acquire(ctx context.Context) (*x11.Framebuffer, error)
+	Present(fb *x11.Framebuffer) error
+	Filter(ev x11.Event) (bool, error)
+	Expose(ev *x11.ExposeEvent) error
+	SetOffset(p image.Point)
+	Close() error
+}
 
-	switch status {
-	case 0:
-		return nil, 0, 0, errResponseStateFailed
-	case 1:
-		// RESPONSE_STATE_SUCCESS
-	case 2:
-		return nil, 0, 0, errResponseStateAuthenticate
-	default:
-		return nil, 0, 0, errResponseStateUnknown
+// gradient fills fb with a green and blue gradient, scrolled by frame
+// pixels.
+func gradient(fb *x11.Framebuffer, frame int) {
+	for y := range height {
+		for x := range width {
+			fb.SetRGBA(x, y, color.RGBA{0x00, uint8((x + frame) / 4 % 256), uint8(y / 4 % 256), 0xff})
+		}
 	}
+}
 
-	replay := x11byte.String(make([]byte, replayLength*4))
-	if _, err := io.ReadFull(conn, replay); err != nil {
-		return nil, 0, 0, err
+// dotCursor draws a translucent red dot with a solid center.
+func dotCursor(size int) image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	r := size / 2
+	for y := range size {
+		for x := range size {
+			dx, dy := x-r, y-r
+			switch d := dx*dx + dy*dy; {
+			case d <= 4:
+				img.Set(x, y, color.NRGBA{0xff, 0x00, 0x00, 0xff})
+			case d < r*r:
+				img.Set(x, y, color.NRGBA{0xff, 0x00, 0x00, 0x60})
+			}
+		}
 	}
-
-	var (
-		resourceIDBase  uint32
-		resourceIDMask  uint32
-		lengthOfVendor  uint16
-		numberOfFormats uint8
-	)
-	replay.Skip(4) // releaseNumber
-	replay.ReadUint32(&resourceIDBase)
-	replay.ReadUint32(&resourceIDMask)
-	replay.Skip(4) // motionBufferSize
-	replay.ReadUint16(&lengthOfVendor)
-	replay.Skip(2) // maximumRequestLength
-	replay.Skip(1) // numberOfScreensInRoot
-	replay.ReadUint8(&numberOfFormats)
-	replay.Skip(1) // imageByteOrder
-	replay.Skip(1) // bitmapFormatByteOrder
-	replay.Skip(1) // bitmapFormatScanlineUnit
-	replay.Skip(1) // bitmapFormatScanlinePad
-	replay.Skip(1) // minKeycode
-	replay.Skip(1) // maxKeyCode
-	replay.Skip(4) // unused
-
-	// skip large arrays
-	replay.Skip(int(lengthOfVendor))                 // vendor
-	replay.Skip(int((4 - (lengthOfVendor % 4)) % 4)) // padding
-	replay.Skip(int(numberOfFormats * 8))            // formats
-
-	var (
-		root       uint32
-		rootVisual uint32
-	)
-	replay.ReadUint32(&root)
-	replay.Skip(4) // defaultColormap
-	replay.Skip(4) // whitePixel
-	replay.Skip(4) // blackPixel
-	replay.Skip(4) // currentInputMask
-	replay.Skip(2) // widthInPixels
-	replay.Skip(2) // heightInPixels
-	replay.Skip(2) // widthInMillimeters
-	replay.Skip(2) // heightInMillimeters
-	replay.Skip(2) // minInstalledMaps
-	replay.Skip(2) // maxInstalledMaps
-	replay.ReadUint32(&rootVisual)
-	replay.Skip(1) // backingStores
-	replay.Skip(1) // saveUnders
-	replay.Skip(1) // rootDepth
-	replay.Skip(1) // allowedDepthsLen
-
-	// depth details follow, skip...
-
-	var resourceID uint32
-	return func() uint32 {
-		id := (resourceID & resourceIDMask) | resourceIDBase
-		resourceID++
-		return id
-	}, root, rootVisual, nil
+	return img
 }
-
-// func internAtom(conn net.Conn) (uint32, uint32, error) {
-// 	var b x11byte.Builder
-
-// 	// Intern Atom
-// 	b.AddUint8(X11_REQUEST_INTERN_ATOM) // opcode
-// 	b.AddUint8(0)                       // onlyIfExists
-// 	b.AddUint16(5)                      // requestLength
-// 	b.AddUint16(12)                     // nameLength
-// 	b.AddUint16(0)                      // unused
-// 	b.AddBytes([]byte("WM_PROTOCOLS"))  // name
-
-// 	// Intern Atom
-// 	b.AddUint8(X11_REQUEST_INTERN_ATOM)    // opcode
-// 	b.AddUint8(0)                          // onlyIfExists
-// 	b.AddUint16(6)                         // requestLength
-// 	b.AddUint16(16)                        // nameLength
-// 	b.AddUint16(0)                         // unused
-// 	b.AddBytes([]byte("WM_DELETE_WINDOW")) // name
-
-// 	if _, err := conn.Write(b.BytesOrPanic()); err != nil {
-// 		return 0, 0, err
-// 	}
-
-// 	var atoms [2]uint32
-// 	for i := range 2 {
-// 		header := x11byte.String(make([]byte, 32))
-// 		if _, err := io.ReadFull(conn, header); err != nil {
-// 			return 0, 0, err
-// 		}
-
-// 		var (
-// 			reply          uint8
-// 			sequenceNumber uint16
-// 			replayLength   uint32
-// 		)
-
-// 		header.ReadUint8(&reply)
-// 		header.Skip(1)
-// 		header.ReadUint16(&sequenceNumber)
-// 		header.ReadUint32(&replayLength)
-// 		header.ReadUint32(&atoms[i])
-// 		header.Skip(20)
-// 	}
-
-// 	return atoms[0], atoms[1], nil
-// }
-
-// func mitshmExtension(conn net.Conn) (uint8, error) {
-// 	var b x11byte.Builder
-
-// 	b.AddUint8(X11_REQUEST_QUERY_EXTENSION) // opcode
-// 	b.AddUint8(1)                           // extension-minor, attach
-// 	b.AddUint16(4)                          // requestLength
-// 	b.AddUint16(7)                          // nameLength
-// 	b.AddUint16(0)                          // unused
-// 	b.AddBytes([]byte("MIT-SHM"))           // name
-// 	b.AddUint8(1)                           // unused
-
-// 	if _, err := conn.Write(b.BytesOrPanic()); err != nil {
-// 		return 0, err
-// 	}
-
-// 	header := x11byte.String(make([]byte, 32))
-// 	if _, err := io.ReadFull(conn, header); err != nil {
-// 		return 0, err
-// 	}
-
-// 	var (
-// 		reply          uint8
-// 		sequenceNumber uint16
-// 		replayLength   uint32
-// 		present        uint8
-// 		majorOpcode    uint8
-// 	)
-
-// 	header.ReadUint8(&reply)
-// 	header.Skip(1)
-// 	header.ReadUint16(&sequenceNumber)
-// 	header.ReadUint32(&replayLength)
-// 	header.ReadUint8(&present)
-// 	header.ReadUint8(&majorOpcode)
-// 	header.Skip(1)
-// 	header.Skip(1)
-
-// 	return majorOpcode, nil
-// }
@@ -0,0 +1,37 @@
+package mitshm
+
+import (
+	"github.com/dzeromsk/helloX11/x11"
+	"github.com/dzeromsk/helloX11/x11byte"
+)
+
+// Events, relative to the extension's first event code.
+const (
+	SHM_EVENT_COMPLETION = 0
+)
+
+// CompletionEvent reports that the server finished reading a segment for a
+// request sent with sendEvent, so the memory may be written again.
+type CompletionEvent struct {
+	Drawable   uint32
+	MinorEvent uint16 // minor opcode of the request, SHM_REQUEST_PUT_IMAGE
+	MajorEvent uint8
+	Segment    uint32 // shmseg
+	Offset     uint32
+}
+
+func (e *CompletionEvent) EventWindow() uint32 { return e.Drawable }
+
+func decodeEvent(buf x11byte.String) x11.Event {
+	var e CompletionEvent
+	buf.Skip(1) // eventCode
+	buf.Skip(1) // unused
+	buf.Skip(2) // sequenceNumber
+	buf.ReadUint32(&e.Drawable)
+	buf.ReadUint16(&e.MinorEvent)
+	buf.ReadUint8(&e.MajorEvent)
+	buf.Skip(1) // unused
+	buf.ReadUint32(&e.Segment)
+	buf.ReadUint32(&e.Offset)
+	return &e
+}
@@ -0,0 +1,44 @@
+package mitshm
+
+import (
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// mfdCloexec is MFD_CLOEXEC, closing the memfd on exec.
+const mfdCloexec = 0x1
+
+// sysMemfdCreate is the number of the Linux memfd_create system call, which
+// the syscall package does not define, or 0 where it is not known.
+var sysMemfdCreate = map[string]uintptr{
+	"386":     356,
+	"amd64":   319,
+	"arm":     385,
+	"arm64":   279,
+	"ppc64le": 360,
+	"riscv64": 279,
+	"s390x":   350,
+}[runtime.GOARCH]
+
+// memfdCreate returns anonymous memory of size bytes as a file descriptor,
+// freed once it is closed and unmapped everywhere.
+func memfdCreate(name string, size int) (int, error) {
+	if runtime.GOOS != "linux" || sysMemfdCreate == 0 {
+		return -1, syscall.ENOSYS
+	}
+	p, err := syscall.BytePtrFromString(name)
+	if err != nil {
+		return -1, err
+	}
+	r, _, errno := syscall.Syscall(sysMemfdCreate, uintptr(unsafe.Pointer(p)), mfdCloexec, 0)
+	if errno != 0 {
+		return -1, errno
+	}
+	fd := int(r)
+	if err := syscall.Ftruncate(fd, int64(size)); err != nil {
+		syscall.Close(fd)
+		return -1, err
+	}
+	return fd, nil
+}
@@ -0,0 +1,269 @@
+// Package mitshm implements the MIT-SHM extension, which lets a local
+// client and the server share image memory, so images are shown without
+// copying them through the connection.
+package mitshm
+
+import (
+	"errors"
+	"syscall"
+
+	"github.com/dzeromsk/helloX11/x11"
+	"github.com/dzeromsk/helloX11/x11byte"
+)
+
+var errNoFd = errors.New("mitshm: CreateSegment reply carries no file descriptor")
+
+// Requests, as minor opcodes of the extension.
+const (
+	SHM_REQUEST_QUERY_VERSION  = 0
+	SHM_REQUEST_ATTACH         = 1
+	SHM_REQUEST_DETACH         = 2
+	SHM_REQUEST_PUT_IMAGE      = 3
+	SHM_REQUEST_GET_IMAGE      = 4
+	SHM_REQUEST_CREATE_PIXMAP  = 5
+	SHM_REQUEST_ATTACH_FD      = 6
+	SHM_REQUEST_CREATE_SEGMENT = 7
+)
+
+// Shm is a connection's handle on the extension.
+type Shm struct {
+	c      *x11.Conn
+	opcode uint8
+
+	// Major and Minor are the protocol version of the server.
+	Major, Minor uint16
+
+	// SharedPixmaps reports whether pixmaps can be created over segments,
+	// in PixmapFormat.
+	SharedPixmaps bool
+	PixmapFormat  uint8
+}
+
+// New initializes the MIT-SHM extension. It succeeds for remote servers
+// too, where attaching segments fails; see NewSegment.
+func New(c *x11.Conn) (*Shm, error) {
+	ext, err := c.RequireExtension("MIT-SHM")
+	if err != nil {
+		return nil, err
+	}
+	s := &Shm{c: c, opcode: ext.MajorOpcode}
+	if err := s.queryVersion(); err != nil {
+		return nil, err
+	}
+	c.RegisterEventDecoder(ext.FirstEvent+SHM_EVENT_COMPLETION, decodeEvent)
+	return s, nil
+}
+
+func (s *Shm) queryVersion() error {
+	var b x11byte.Builder
+	b.AddUint8(s.opcode)                  // opcode
+	b.AddUint8(SHM_REQUEST_QUERY_VERSION) // extension-minor
+	b.AddUint16(1)                        // requestLength
+
+	reply, err := s.c.Request(b.BytesOrPanic())
+	if err != nil {
+		return err
+	}
+
+	var sharedPixmaps uint8
+	reply.Skip(1) // reply
+	reply.ReadUint8(&sharedPixmaps)
+	reply.Skip(2) // sequenceNumber
+	reply.Skip(4) // replyLength
+	reply.ReadUint16(&s.Major)
+	reply.ReadUint16(&s.Minor)
+	reply.Skip(2) // uid
+	reply.Skip(2) // gid
+	reply.ReadUint8(&s.PixmapFormat)
+	s.SharedPixmaps = sharedPixmaps != 0
+	return nil
+}
+
+// Attach makes the System V shared memory segment shmid known to the
+// server as shmseg. The server fails it with BadAccess if it cannot map the
+// segment, as happens when it runs on another machine.
+func (s *Shm) Attach(shmseg uint32, shmid int, readOnly bool) error {
+	var ro uint8
+	if readOnly {
+		ro = 1
+	}
+
+	var b x11byte.Builder
+	b.AddUint8(s.opcode)           // opcode
+	b.AddUint8(SHM_REQUEST_ATTACH) // extension-minor
+	b.AddUint16(4)                 // requestLength
+	b.AddUint32(shmseg)            // shmseg
+	b.AddUint32(uint32(shmid))     // shmid
+	b.AddUint8(ro)                 // readOnly
+	b.AddUint24(0)                 // unused
+
+	return s.c.SendChecked(b.BytesOrPanic())
+}
+
+// FdPassing reports whether segments can be passed as file descriptors,
+// which needs version 1.2 and a UNIX socket.
+func (s *Shm) FdPassing() bool {
+	return (s.Major > 1 || s.Major == 1 && s.Minor >= 2) && s.c.FdPassing()
+}
+
+// AttachFd makes the shared memory behind fd, a memfd or any other
+// mappable file, known to the server as shmseg. The caller still owns fd.
+func (s *Shm) AttachFd(shmseg uint32, fd int, readOnly bool) error {
+	var ro uint8
+	if readOnly {
+		ro = 1
+	}
+
+	var b x11byte.Builder
+	b.AddUint8(s.opcode)              // opcode
+	b.AddUint8(SHM_REQUEST_ATTACH_FD) // extension-minor
+	b.AddUint16(3)                    // requestLength
+	b.AddUint32(shmseg)               // shmseg
+	b.AddUint8(ro)                    // readOnly
+	b.AddUint24(0)                    // unused
+
+	return s.c.SendCheckedFds(b.BytesOrPanic(), fd)
+}
+
+// CreateSegment asks the server to allocate size bytes of shared memory as
+// shmseg, and returns a file descriptor for it, to be mapped and closed by
+// the caller.
+func (s *Shm) CreateSegment(shmseg, size uint32, readOnly bool) (int, error) {
+	var ro uint8
+	if readOnly {
+		ro = 1
+	}
+
+	var b x11byte.Builder
+	b.AddUint8(s.opcode)                   // opcode
+	b.AddUint8(SHM_REQUEST_CREATE_SEGMENT) // extension-minor
+	b.AddUint16(4)                         // requestLength
+	b.AddUint32(shmseg)                    // shmseg
+	b.AddUint32(size)                      // size
+	b.AddUint8(ro)                         // readOnly
+	b.AddUint24(0)                         // unused
+
+	_, fds, err := s.c.RequestFds(b.BytesOrPanic(), 1)
+	if err != nil {
+		return -1, err
+	}
+	if len(fds) != 1 {
+		for _, fd := range fds {
+			syscall.Close(fd)
+		}
+		return -1, errNoFd
+	}
+	return fds[0], nil
+}
+
+// Detach makes the server forget shmseg and unmap its memory.
+func (s *Shm) Detach(shmseg uint32) error {
+	var b x11byte.Builder
+	b.AddUint8(s.opcode)           // opcode
+	b.AddUint8(SHM_REQUEST_DETACH) // extension-minor
+	b.AddUint16(2)                 // requestLength
+	b.AddUint32(shmseg)            // shmseg
+	return s.c.Send(b.BytesOrPanic())
+}
+
+// Image describes an image stored in a segment, as used by PutImage.
+type Image struct {
+	Segment       uint32 // shmseg
+	Offset        uint32 // of the first pixel in the segment
+	Width, Height uint16 // of the whole image; Width includes scanline padding
+	Depth         uint8
+	Format        uint8 // X11_IMAGE_FORMAT_*
+}
+
+// PutImage draws the srcWidth × srcHeight rectangle at srcX, srcY of img
+// to drawable at dstX, dstY. With sendEvent, the server reports a
+// Completion event once it no longer reads the segment.
+func (s *Shm) PutImage(drawable, gc uint32, img Image, srcX, srcY, srcWidth, srcHeight uint16, dstX, dstY int16, sendEvent bool) error {
+	var send uint8
+	if sendEvent {
+		send = 1
+	}
+
+	var b x11byte.Builder
+	b.AddUint8(s.opcode)              // opcode
+	b.AddUint8(SHM_REQUEST_PUT_IMAGE) // extension-minor
+	b.AddUint16(10)                   // requestLength
+	b.AddUint32(drawable)             // drawable
+	b.AddUint32(gc)                   // gc
+	b.AddUint16(img.Width)            // totalWidth
+	b.AddUint16(img.Height)           // totalHeight
+	b.AddUint16(srcX)                 // srcX
+	b.AddUint16(srcY)                 // srcY
+	b.AddUint16(srcWidth)             // srcWidth
+	b.AddUint16(srcHeight)            // srcHeight
+	b.AddUint16(uint16(dstX))         // dstX
+	b.AddUint16(uint16(dstY))         // dstY
+	b.AddUint8(img.Depth)             // depth
+	b.AddUint8(img.Format)            // format
+	b.AddUint8(send)                  // sendEvent
+	b.AddUint8(0)                     // unused
+	b.AddUint32(img.Segment)          // shmseg
+	b.AddUint32(img.Offset)           // offset
+
+	return s.c.Send(b.BytesOrPanic())
+}
+
+// GetImage reads back the width × height rectangle at x, y of drawable
+// into shmseg at offset, in the given format, keeping the bits of
+// planeMask. It returns the depth and visual of drawable, X11_NONE for
+// pixmaps, and the number of bytes written.
+func (s *Shm) GetImage(drawable uint32, x, y int16, width, height uint16, planeMask uint32, format uint8, shmseg, offset uint32) (depth uint8, visual, size uint32, err error) {
+	var b x11byte.Builder
+	b.AddUint8(s.opcode)              // opcode
+	b.AddUint8(SHM_REQUEST_GET_IMAGE) // extension-minor
+	b.AddUint16(8)                    // requestLength
+	b.AddUint32(drawable)             // drawable
+	b.AddUint16(uint16(x))            // x
+	b.AddUint16(uint16(y))            // y
+	b.AddUint16(width)                // width
+	b.AddUint16(height)               // height
+	b.AddUint32(planeMask)            // planeMask
+	b.AddUint8(format)                // format
+	b.AddUint24(0)                    // unused
+	b.AddUint32(shmseg)               // shmseg
+	b.AddUint32(offset)               // offset
+
+	reply, err := s.c.Request(b.BytesOrPanic())
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	reply.Skip(1) // reply
+	reply.ReadUint8(&depth)
+	reply.Skip(2) // sequenceNumber
+	reply.Skip(4) // replyLength
+	reply.ReadUint32(&visual)
+	reply.ReadUint32(&size)
+	return depth, visual, size, nil
+}
+
+// CreatePixmap creates a width × height pixmap of the given depth over
+// shmseg at offset, for the screen of drawable, so drawing into the segment
+// changes the pixmap. It needs SharedPixmaps, and the segment holds the
+// pixels in PixmapFormat.
+func (s *Shm) CreatePixmap(drawable uint32, width, height uint16, depth uint8, shmseg, offset uint32) (uint32, error) {
+	pid, err := s.c.NewID()
+	if err != nil {
+		return 0, err
+	}
+
+	var b x11byte.Builder
+	b.AddUint8(s.opcode)                  // opcode
+	b.AddUint8(SHM_REQUEST_CREATE_PIXMAP) // extension-minor
+	b.AddUint16(7)                        // requestLength
+	b.AddUint32(pid)                      // pid
+	b.AddUint32(drawable)                 // drawable
+	b.AddUint16(width)                    // width
+	b.AddUint16(height)                   // height
+	b.AddUint8(depth)                     // depth
+	b.AddUint24(0)                        // unused
+	b.AddUint32(shmseg)                   // shmseg
+	b.AddUint32(offset)                   // offset
+
+	return pid, s.c.SendChecked(b.BytesOrPanic())
+}
@@ -0,0 +1,59 @@
+package mitshm
+
+import (
+	"bytes"
+	"syscall"
+	"testing"
+
+	"github.com/dzeromsk/helloX11/x11byte"
+)
+
+func TestMemfd(t *testing.T) {
+	fd, err := memfdCreate("test", 8192)
+	if err == syscall.ENOSYS {
+		t.Skip("no memfd_create")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(fd)
+
+	var st syscall.Stat_t
+	if err := syscall.Fstat(fd, &st); err != nil || st.Size != 8192 {
+		t.Fatalf("size = %d, %v, want 8192", st.Size, err)
+	}
+	data, err := syscall.Mmap(fd, 0, 8192, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Munmap(data)
+	copy(data[4096:], "shared")
+
+	got := make([]byte, 6)
+	if _, err := syscall.Pread(fd, got, 4096); err != nil || !bytes.Equal(got, []byte("shared")) {
+		t.Errorf("read %q, %v through the fd", got, err)
+	}
+}
+
+func TestDecodeCompletion(t *testing.T) {
+	var b x11byte.Builder
+	b.AddUint8(0x60)                   // eventCode
+	b.AddUint8(0)                      // unused
+	b.AddUint16(3)                     // sequenceNumber
+	b.AddUint32(0x400001)              // drawable
+	b.AddUint16(SHM_REQUEST_PUT_IMAGE) // minorEvent
+	b.AddUint8(0x82)                   // majorEvent
+	b.AddUint8(0)                      // unused
+	b.AddUint32(0x400002)              // shmseg
+	b.AddUint32(0)                     // offset
+	b.AddBytes(make([]byte, 12))       // unused
+
+	ev, ok := decodeEvent(b.BytesOrPanic()).(*CompletionEvent)
+	if !ok {
+		t.Fatal("not a CompletionEvent")
+	}
+	want := CompletionEvent{Drawable: 0x400001, MinorEvent: SHM_REQUEST_PUT_IMAGE, MajorEvent: 0x82, Segment: 0x400002}
+	if *ev != want {
+		t.Errorf("event = %+v, want %+v", *ev, want)
+	}
+}
@@ -0,0 +1,105 @@
+package mitshm
+
+import (
+	"errors"
+	"syscall"
+
+	"github.com/dzeromsk/helloX11/x11"
+
+	"github.com/gen2brain/shm"
+)
+
+// ErrNotLocal is returned by NewSegment when the server cannot map the
+// client's shared memory, because it runs on another machine or in another
+// IPC namespace.
+var ErrNotLocal = errors.New("mitshm: server cannot access shared memory")
+
+// Segment is shared memory mapped by both the client and the server.
+type Segment struct {
+	ID   uint32 // shmseg, as used in requests
+	Data []byte
+
+	s     *Shm
+	unmap func([]byte) error
+}
+
+// NewSegment allocates size bytes of memory shared with the server. With
+// version 1.2 over a UNIX socket, it is a memfd passed with AttachFd, or
+// memory the server allocates with CreateSegment, both freed whenever the
+// process exits. Otherwise, or if both fail, it is System V shared memory,
+// which fails with ErrNotLocal if the server cannot access it, in which
+// case images have to be sent with core PutImage.
+func (s *Shm) NewSegment(size int) (*Segment, error) {
+	if s.FdPassing() {
+		if g, err := s.newFdSegment(size); err == nil {
+			return g, nil
+		}
+	}
+	return s.newSysVSegment(size)
+}
+
+func (s *Shm) newFdSegment(size int) (*Segment, error) {
+	id, err := s.c.NewID()
+	if err != nil {
+		return nil, err
+	}
+	fd, err := memfdCreate("helloX11", size)
+	if err == nil {
+		if err = s.AttachFd(id, fd, false); err != nil {
+			syscall.Close(fd)
+		}
+	}
+	if err != nil {
+		// No memfd, or the server would not map it
+		if fd, err = s.CreateSegment(id, uint32(size), false); err != nil {
+			return nil, err
+		}
+	}
+	// The mapping keeps the memory alive
+	defer syscall.Close(fd)
+
+	data, err := syscall.Mmap(fd, 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		s.Detach(id)
+		return nil, err
+	}
+	return &Segment{ID: id, Data: data, s: s, unmap: syscall.Munmap}, nil
+}
+
+func (s *Shm) newSysVSegment(size int) (*Segment, error) {
+	shmid, err := shm.Get(shm.IPC_PRIVATE, size, shm.IPC_CREAT|0600)
+	if err != nil {
+		return nil, err
+	}
+	// Marked for removal once the server attached it, the memory is freed
+	// when both sides detach, even if the client dies.
+	defer shm.Rm(shmid)
+
+	data, err := shm.At(shmid, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	id, err := s.c.NewID()
+	if err != nil {
+		shm.Dt(data)
+		return nil, err
+	}
+	if err := s.Attach(id, shmid, false); err != nil {
+		shm.Dt(data)
+		if xerr, ok := err.(*x11.Error); ok && xerr.Code == x11.X11_ERROR_BAD_ACCESS {
+			return nil, ErrNotLocal
+		}
+		return nil, err
+	}
+	return &Segment{ID: id, Data: data[:size], s: s, unmap: shm.Dt}, nil
+}
+
+// Close detaches the segment from the server and unmaps it. Requests using
+// it must have completed.
+func (g *Segment) Close() error {
+	err := g.s.Detach(g.ID)
+	if uerr := g.unmap(g.Data); err == nil {
+		err = uerr
+	}
+	return err
+}
@@ -0,0 +1,131 @@
+package present
+
+import (
+	"github.com/dzeromsk/helloX11/x11"
+	"github.com/dzeromsk/helloX11/x11byte"
+)
+
+// Event types, sent as GenericEvents.
+const (
+	PRESENT_EVENT_CONFIGURE_NOTIFY = 0
+	PRESENT_EVENT_COMPLETE_NOTIFY  = 1
+	PRESENT_EVENT_IDLE_NOTIFY      = 2
+)
+
+// Event masks of SelectInput.
+const (
+	PRESENT_EVENT_MASK_NO_EVENT         = 0
+	PRESENT_EVENT_MASK_CONFIGURE_NOTIFY = 1
+	PRESENT_EVENT_MASK_COMPLETE_NOTIFY  = 2
+	PRESENT_EVENT_MASK_IDLE_NOTIFY      = 4
+)
+
+// Kinds of CompleteNotify.
+const (
+	PRESENT_COMPLETE_KIND_PIXMAP     = 0
+	PRESENT_COMPLETE_KIND_NOTIFY_MSC = 1
+)
+
+// Modes of CompleteNotify, how a pixmap reached the screen.
+const (
+	PRESENT_COMPLETE_MODE_COPY            = 0
+	PRESENT_COMPLETE_MODE_FLIP            = 1
+	PRESENT_COMPLETE_MODE_SKIP            = 2 // replaced by a later pixmap before being shown
+	PRESENT_COMPLETE_MODE_SUBOPTIMAL_COPY = 3
+)
+
+// ConfigureNotifyEvent reports a change of the window's size or position,
+// before the matching core ConfigureNotify, so pixmaps can be resized in
+// time.
+type ConfigureNotifyEvent struct {
+	EventID       uint32
+	Window        uint32
+	X, Y          int16
+	Width, Height uint16
+	OffX, OffY    int16
+	PixmapWidth   uint16
+	PixmapHeight  uint16
+	PixmapFlags   uint32
+}
+
+func (e *ConfigureNotifyEvent) EventWindow() uint32 { return e.Window }
+
+// CompleteNotifyEvent reports that a Pixmap or NotifyMSC request was
+// carried out: at UST, in microseconds of the server's monotonic clock, on
+// vertical blank MSC.
+type CompleteNotifyEvent struct {
+	Kind    uint8 // PRESENT_COMPLETE_KIND_*
+	Mode    uint8 // PRESENT_COMPLETE_MODE_*
+	EventID uint32
+	Window  uint32
+	Serial  uint32
+	UST     uint64
+	MSC     uint64
+}
+
+func (e *CompleteNotifyEvent) EventWindow() uint32 { return e.Window }
+
+// IdleNotifyEvent reports that the server no longer reads a presented
+// pixmap, so it may be drawn into again.
+type IdleNotifyEvent struct {
+	EventID   uint32
+	Window    uint32
+	Serial    uint32
+	Pixmap    uint32
+	IdleFence uint32
+}
+
+func (e *IdleNotifyEvent) EventWindow() uint32 { return e.Window }
+
+func decodeEvent(buf x11byte.String) x11.Event {
+	var evtype uint16
+	buf.Skip(1) // eventCode
+	buf.Skip(1) // extension
+	buf.Skip(2) // sequenceNumber
+	buf.Skip(4) // length
+	buf.ReadUint16(&evtype)
+
+	switch evtype {
+	case PRESENT_EVENT_CONFIGURE_NOTIFY:
+		var (
+			e                ConfigureNotifyEvent
+			x, y, offX, offY uint16
+		)
+		buf.Skip(2) // unused
+		buf.ReadUint32(&e.EventID)
+		buf.ReadUint32(&e.Window)
+		buf.ReadUint16(&x)
+		buf.ReadUint16(&y)
+		buf.ReadUint16(&e.Width)
+		buf.ReadUint16(&e.Height)
+		buf.ReadUint16(&offX)
+		buf.ReadUint16(&offY)
+		buf.ReadUint16(&e.PixmapWidth)
+		buf.ReadUint16(&e.PixmapHeight)
+		buf.ReadUint32(&e.PixmapFlags)
+		e.X, e.Y, e.OffX, e.OffY = int16(x), int16(y), int16(offX), int16(offY)
+		return &e
+
+	case PRESENT_EVENT_COMPLETE_NOTIFY:
+		var e CompleteNotifyEvent
+		buf.ReadUint8(&e.Kind)
+		buf.ReadUint8(&e.Mode)
+		buf.ReadUint32(&e.EventID)
+		buf.ReadUint32(&e.Window)
+		buf.ReadUint32(&e.Serial)
+		e.UST = readUint64(&buf)
+		e.MSC = readUint64(&buf)
+		return &e
+
+	case PRESENT_EVENT_IDLE_NOTIFY:
+		var e IdleNotifyEvent
+		buf.Skip(2) // unused
+		buf.ReadUint32(&e.EventID)
+		buf.ReadUint32(&e.Window)
+		buf.ReadUint32(&e.Serial)
+		buf.ReadUint32(&e.Pixmap)
+		buf.ReadUint32(&e.IdleFence)
+		return &e
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+// Package present implements the Present extension, which shows pixmaps in
+// windows at a chosen vertical blank and reports when each one reached the
+// screen, so animations can be paced to the display refresh without tearing.
+package present
+
+import (
+	"fmt"
+
+	"github.com/dzeromsk/helloX11/x11"
+	"github.com/dzeromsk/helloX11/x11byte"
+)
+
+// Requests, as minor opcodes of the extension.
+const (
+	PRESENT_REQUEST_QUERY_VERSION      = 0
+	PRESENT_REQUEST_PIXMAP             = 1
+	PRESENT_REQUEST_NOTIFY_MSC         = 2
+	PRESENT_REQUEST_SELECT_INPUT       = 3
+	PRESENT_REQUEST_QUERY_CAPABILITIES = 4
+)
+
+// Protocol version requested by New.
+const (
+	PRESENT_MAJOR_VERSION = 1
+	PRESENT_MINOR_VERSION = 2
+)
+
+// Options of PresentPixmap.
+const (
+	PRESENT_OPTION_NONE       = 0
+	PRESENT_OPTION_ASYNC      = 1 // may tear rather than miss the target
+	PRESENT_OPTION_COPY       = 2 // never flip
+	PRESENT_OPTION_UST        = 4
+	PRESENT_OPTION_SUBOPTIMAL = 8
+)
+
+// Capabilities reported by QueryCapabilities.
+const (
+	PRESENT_CAPABILITY_NONE  = 0
+	PRESENT_CAPABILITY_ASYNC = 1
+	PRESENT_CAPABILITY_FENCE = 2
+	PRESENT_CAPABILITY_UST   = 4
+)
+
+// Present is a connection's handle on the extension.
+type Present struct {
+	c      *x11.Conn
+	opcode uint8
+
+	// Major and Minor are the protocol version the server agreed to.
+	Major, Minor uint16
+}
+
+// New initializes the Present extension and registers decoders for its
+// events.
+func New(c *x11.Conn) (*Present, error) {
+	ext, err := c.RequireExtension("Present")
+	if err != nil {
+		return nil, err
+	}
+	p := &Present{c: c, opcode: ext.MajorOpcode}
+	p.Major, p.Minor, err = p.QueryVersion(PRESENT_MAJOR_VERSION, PRESENT_MINOR_VERSION)
+	if err != nil {
+		return nil, err
+	}
+	if p.Major < 1 {
+		return nil, fmt.Errorf("present: server supports version %d.%d, need 1.0", p.Major, p.Minor)
+	}
+	c.RegisterGenericEventDecoder(ext.MajorOpcode, decodeEvent)
+	return p, nil
+}
+
+// QueryVersion announces the version the client supports and returns the
+// version the server will use.
+func (p *Present) QueryVersion(major, minor uint32) (uint16, uint16, error) {
+	var b x11byte.Builder
+	b.AddUint8(p.opcode)                      // opcode
+	b.AddUint8(PRESENT_REQUEST_QUERY_VERSION) // extension-minor
+	b.AddUint16(3)                            // requestLength
+	b.AddUint32(major)                        // majorVersion
+	b.AddUint32(minor)                        // minorVersion
+
+	reply, err := p.c.Request(b.BytesOrPanic())
+	if err != nil {
+		return 0, 0, err
+	}
+
+	reply.Skip(1) // reply
+	reply.Skip(1) // unused
+	reply.Skip(2) // sequenceNumber
+	reply.Skip(4) // replyLength
+	reply.ReadUint32(&major)
+	reply.ReadUint32(&minor)
+	return uint16(major), uint16(minor), nil
+}
+
+// QueryCapabilities returns the PRESENT_CAPABILITY_* flags of the CRTC or
+// window target.
+func (p *Present) QueryCapabilities(target uint32) (uint32, error) {
+	var b x11byte.Builder
+	b.AddUint8(p.opcode)                           // opcode
+	b.AddUint8(PRESENT_REQUEST_QUERY_CAPABILITIES) // extension-minor
+	b.AddUint16(2)                                 // requestLength
+	b.AddUint32(target)                            // target
+
+	reply, err := p.c.Request(b.BytesOrPanic())
+	if err != nil {
+		return 0, err
+	}
+
+	var capabilities uint32
+	reply.Skip(1) // reply
+	reply.Skip(1) // unused
+	reply.Skip(2) // sequenceNumber
+	reply.Skip(4) // replyLength
+	reply.ReadUint32(&capabilities)
+	return capabilities, nil
+}
+
+// Target is the vertical blank a request waits for, counted by the media
+// stream counter (MSC) of the window's CRTC. With a zero Divisor, the
+// request is carried out at TargetMSC or right away if it has passed.
+// Otherwise, once TargetMSC has passed, it waits for the next MSC with
+// MSC % Divisor == Remainder; {0, 1, 0} is the next vertical blank.
+type Target struct {
+	TargetMSC, Divisor, Remainder uint64
+}
+
+// NextVBlank is the next vertical blank.
+var NextVBlank = Target{Divisor: 1}
+
+// Pixmap asks for the contents of pixmap to be shown in window, with its
+// origin at xOff, yOff, at the target vertical blank. The server reports
+// CompleteNotify with serial once shown, and IdleNotify once the pixmap
+// may be drawn into again. Options are PRESENT_OPTION_* flags.
+func (p *Present) Pixmap(window, pixmap, serial uint32, xOff, yOff int16, target Target, options uint32) error {
+	var b x11byte.Builder
+	b.AddUint8(p.opcode)               // opcode
+	b.AddUint8(PRESENT_REQUEST_PIXMAP) // extension-minor
+	b.AddUint16(18)                    // requestLength
+	b.AddUint32(window)                // window
+	b.AddUint32(pixmap)                // pixmap
+	b.AddUint32(serial)                // serial
+	b.AddUint32(x11.X11_NONE)          // valid
+	b.AddUint32(x11.X11_NONE)          // update
+	b.AddUint16(uint16(xOff))          // xOff
+	b.AddUint16(uint16(yOff))          // yOff
+	b.AddUint32(x11.X11_NONE)          // targetCrtc
+	b.AddUint32(x11.X11_NONE)          // waitFence
+	b.AddUint32(x11.X11_NONE)          // idleFence
+	b.AddUint32(options)               // options
+	b.AddUint32(0)                     // unused
+	addUint64(&b, target.TargetMSC)    // targetMsc
+	addUint64(&b, target.Divisor)      // divisor
+	addUint64(&b, target.Remainder)    // remainder
+
+	return p.c.Send(b.BytesOrPanic())
+}
+
+// NotifyMSC asks for a CompleteNotify event of kind
+// PRESENT_COMPLETE_KIND_NOTIFY_MSC with serial at the target vertical
+// blank of window's CRTC, without showing anything.
+func (p *Present) NotifyMSC(window, serial uint32, target Target) error {
+	var b x11byte.Builder
+	b.AddUint8(p.opcode)                   // opcode
+	b.AddUint8(PRESENT_REQUEST_NOTIFY_MSC) // extension-minor
+	b.AddUint16(10)                        // requestLength
+	b.AddUint32(window)                    // window
+	b.AddUint32(serial)                    // serial
+	b.AddUint32(0)                         // unused
+	addUint64(&b, target.TargetMSC)        // targetMsc
+	addUint64(&b, target.Divisor)          // divisor
+	addUint64(&b, target.Remainder)        // remainder
+
+	return p.c.Send(b.BytesOrPanic())
+}
+
+// SelectInput selects the PRESENT_EVENT_MASK_* events of window and
+// returns the event context ID they carry, to be passed to Deselect.
+func (p *Present) SelectInput(window, mask uint32) (uint32, error) {
+	eid, err := p.c.NewID()
+	if err != nil {
+		return 0, err
+	}
+	return eid, p.selectInput(eid, window, mask)
+}
+
+// Deselect removes the selection with event context eid.
+func (p *Present) Deselect(eid, window uint32) error {
+	return p.selectInput(eid, window, 0)
+}
+
+func (p *Present) selectInput(eid, window, mask uint32) error {
+	var b x11byte.Builder
+	b.AddUint8(p.opcode)                     // opcode
+	b.AddUint8(PRESENT_REQUEST_SELECT_INPUT) // extension-minor
+	b.AddUint16(4)                           // requestLength
+	b.AddUint32(eid)                         // eid
+	b.AddUint32(window)                      // window
+	b.AddUint32(mask)                        // eventMask
+
+	return p.c.SendChecked(b.BytesOrPanic())
+}
+
+// addUint64 appends a CARD64, in the connection's byte order.
+func addUint64(b *x11byte.Builder, v uint64) {
+	b.AddUint32(uint32(v))
+	b.AddUint32(uint32(v >> 32))
+}
+
+// readUint64 reads a CARD64.
+func readUint64(s *x11byte.String) uint64 {
+	var lo, hi uint32
+	s.ReadUint32(&lo)
+	s.ReadUint32(&hi)
+	return uint64(hi)<<32 | uint64(lo)
+}
@@ -0,0 +1,64 @@
+package present
+
+import (
+	"testing"
+
+	"github.com/dzeromsk/helloX11/x11"
+	"github.com/dzeromsk/helloX11/x11byte"
+)
+
+func TestDecodeCompleteNotify(t *testing.T) {
+	var b x11byte.Builder
+	b.AddUint8(x11.X11_EVENT_GENERIC_EVENT)    // eventCode
+	b.AddUint8(0x90)                           // extension
+	b.AddUint16(7)                             // sequenceNumber
+	b.AddUint32(2)                             // length
+	b.AddUint16(PRESENT_EVENT_COMPLETE_NOTIFY) // evtype
+	b.AddUint8(PRESENT_COMPLETE_KIND_PIXMAP)   // kind
+	b.AddUint8(PRESENT_COMPLETE_MODE_FLIP)     // mode
+	b.AddUint32(0x200001)                      // eid
+	b.AddUint32(0x400002)                      // window
+	b.AddUint32(42)                            // serial
+	addUint64(&b, 1_700_000_000_123_456)       // ust
+	addUint64(&b, 1<<33|5)                     // msc
+
+	ev, ok := decodeEvent(b.BytesOrPanic()).(*CompleteNotifyEvent)
+	if !ok {
+		t.Fatal("not a CompleteNotifyEvent")
+	}
+	want := CompleteNotifyEvent{
+		Kind:    PRESENT_COMPLETE_KIND_PIXMAP,
+		Mode:    PRESENT_COMPLETE_MODE_FLIP,
+		EventID: 0x200001,
+		Window:  0x400002,
+		Serial:  42,
+		UST:     1_700_000_000_123_456,
+		MSC:     1<<33 | 5,
+	}
+	if *ev != want {
+		t.Errorf("event = %+v, want %+v", *ev, want)
+	}
+}
+
+func TestDecodeIdleNotify(t *testing.T) {
+	var b x11byte.Builder
+	b.AddUint8(x11.X11_EVENT_GENERIC_EVENT) // eventCode
+	b.AddUint8(0x90)                        // extension
+	b.AddUint16(7)                          // sequenceNumber
+	b.AddUint32(0)                          // length
+	b.AddUint16(PRESENT_EVENT_IDLE_NOTIFY)  // evtype
+	b.AddUint16(0)                          // unused
+	b.AddUint32(0x200001)                   // eid
+	b.AddUint32(0x400002)                   // window
+	b.AddUint32(42)                         // serial
+	b.AddUint32(0x200005)                   // pixmap
+	b.AddUint32(x11.X11_NONE)               // idleFence
+
+	ev, ok := decodeEvent(b.BytesOrPanic()).(*IdleNotifyEvent)
+	if !ok {
+		t.Fatal("not an IdleNotifyEvent")
+	}
+	if ev.Window != 0x400002 || ev.Serial != 42 || ev.Pixmap != 0x200005 {
+		t.Errorf("event = %+v", *ev)
+	}
+}
@@ -0,0 +1,114 @@
+package render
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"time"
+
+	"github.com/dzeromsk/helloX11/x11"
+	"github.com/dzeromsk/helloX11/x11byte"
+)
+
+var errEmptyCursor = errors.New("render: empty cursor image")
+
+// AnimFrame is one frame of an animated cursor.
+type AnimFrame struct {
+	Cursor uint32
+	Delay  time.Duration
+}
+
+// CreateCursor creates a full-color cursor from img, with the hotspot at
+// hotX, hotY relative to the image's top-left corner. Partially transparent
+// pixels are blended with what is under the cursor.
+func (r *Render) CreateCursor(img image.Image, hotX, hotY int) (uint32, error) {
+	bounds := img.Bounds()
+	if bounds.Empty() {
+		return 0, errEmptyCursor
+	}
+	c := r.c
+	width, height := bounds.Dx(), bounds.Dy()
+	root := c.Screen().Root
+
+	// The cursor keeps a copy of the image, the pixmap, GC and picture are
+	// freed once it is created or on failure.
+	pixmap, err := c.CreatePixmap(root, 32, uint16(width), uint16(height))
+	if err != nil {
+		return 0, err
+	}
+	defer c.FreePixmap(pixmap)
+	gc, err := c.CreateGC(pixmap, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer c.FreeGC(gc)
+	data := cursorPixels(img, c.Setup().ImageByteOrder)
+	err = c.PutImage(x11.X11_IMAGE_FORMAT_Z_PIXMAP, pixmap, gc, 32, uint16(width), uint16(height), 0, 0, width*4, data)
+	if err != nil {
+		return 0, err
+	}
+	picture, err := r.CreatePicture(pixmap, r.argb32)
+	if err != nil {
+		return 0, err
+	}
+	defer r.FreePicture(picture)
+
+	cursorID, err := c.NewID()
+	if err != nil {
+		return 0, err
+	}
+	var b x11byte.Builder
+	b.AddUint8(r.opcode)                     // opcode
+	b.AddUint8(RENDER_REQUEST_CREATE_CURSOR) // extension-minor
+	b.AddUint16(4)                           // requestLength
+	b.AddUint32(cursorID)                    // cid
+	b.AddUint32(picture)                     // source
+	b.AddUint16(uint16(hotX))                // x
+	b.AddUint16(uint16(hotY))                // y
+	if err := c.Send(b.BytesOrPanic()); err != nil {
+		return 0, err
+	}
+	return cursorID, nil
+}
+
+// CreateAnimCursor creates a cursor that cycles through frames, each shown
+// for its Delay. The frame cursors may be freed afterwards.
+func (r *Render) CreateAnimCursor(frames ...AnimFrame) (uint32, error) {
+	cursorID, err := r.c.NewID()
+	if err != nil {
+		return 0, err
+	}
+
+	var b x11byte.Builder
+	b.AddUint8(r.opcode)                          // opcode
+	b.AddUint8(RENDER_REQUEST_CREATE_ANIM_CURSOR) // extension-minor
+	b.AddUint16(uint16(2 + 2*len(frames)))        // requestLength
+	b.AddUint32(cursorID)                         // cid
+	for _, f := range frames {
+		b.AddUint32(f.Cursor)                       // cursor
+		b.AddUint32(uint32(f.Delay.Milliseconds())) // delay
+	}
+
+	if err := r.c.Send(b.BytesOrPanic()); err != nil {
+		return 0, err
+	}
+	return cursorID, nil
+}
+
+// cursorPixels converts img to premultiplied ARGB32 in the server's byte
+// order.
+func cursorPixels(img image.Image, byteOrder uint8) []byte {
+	bounds := img.Bounds()
+	data := make([]byte, 0, bounds.Dx()*bounds.Dy()*4)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			col := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+			if byteOrder == 0 { // LSBFirst
+				data = append(data, col.B, col.G, col.R, col.A)
+			} else {
+				data = append(data, col.A, col.R, col.G, col.B)
+			}
+		}
+	}
+	return data
+}
@@ -0,0 +1,204 @@
+// Package render implements the parts of the X Rendering Extension needed
+// for full-color cursors with alpha: picture formats, pictures and cursors
+// created from them.
+package render
+
+import (
+	"errors"
+
+	"github.com/dzeromsk/helloX11/x11"
+	"github.com/dzeromsk/helloX11/x11byte"
+)
+
+// Requests, as minor opcodes of the extension.
+const (
+	RENDER_REQUEST_QUERY_VERSION      = 0
+	RENDER_REQUEST_QUERY_PICT_FORMATS = 1
+	RENDER_REQUEST_CREATE_PICTURE     = 4
+	RENDER_REQUEST_FREE_PICTURE       = 7
+	RENDER_REQUEST_CREATE_CURSOR      = 27
+	RENDER_REQUEST_CREATE_ANIM_CURSOR = 31
+)
+
+// Protocol version requested by New. Animated cursors need 0.8.
+const (
+	RENDER_MAJOR_VERSION = 0
+	RENDER_MINOR_VERSION = 8
+)
+
+// Picture format types.
+const (
+	RENDER_PICT_TYPE_INDEXED = 0
+	RENDER_PICT_TYPE_DIRECT  = 1
+)
+
+var errNoARGB32 = errors.New("render: server has no 32-bit ARGB picture format")
+
+// PictFormat describes how pixels of a picture are stored.
+type PictFormat struct {
+	ID    uint32
+	Type  uint8 // RENDER_PICT_TYPE_*
+	Depth uint8
+
+	// Shifts and masks of each channel, for direct formats.
+	RedShift, RedMask     uint16
+	GreenShift, GreenMask uint16
+	BlueShift, BlueMask   uint16
+	AlphaShift, AlphaMask uint16
+
+	Colormap uint32
+}
+
+// isARGB32 reports whether the format is the standard PictStandardARGB32.
+func (f *PictFormat) isARGB32() bool {
+	return f.Type == RENDER_PICT_TYPE_DIRECT && f.Depth == 32 &&
+		f.AlphaShift == 24 && f.AlphaMask == 0xff &&
+		f.RedShift == 16 && f.RedMask == 0xff &&
+		f.GreenShift == 8 && f.GreenMask == 0xff &&
+		f.BlueShift == 0 && f.BlueMask == 0xff
+}
+
+// Render is a connection's handle on the extension.
+type Render struct {
+	c      *x11.Conn
+	opcode uint8
+
+	// Major and Minor are the protocol version the server agreed to.
+	Major, Minor uint32
+
+	argb32 uint32 // ARGB32 picture format
+}
+
+// New initializes the Render extension and looks up the ARGB32 format.
+func New(c *x11.Conn) (*Render, error) {
+	ext, err := c.RequireExtension("RENDER")
+	if err != nil {
+		return nil, err
+	}
+	r := &Render{c: c, opcode: ext.MajorOpcode}
+	r.Major, r.Minor, err = r.QueryVersion(RENDER_MAJOR_VERSION, RENDER_MINOR_VERSION)
+	if err != nil {
+		return nil, err
+	}
+	formats, err := r.QueryPictFormats()
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range formats {
+		if f.isARGB32() {
+			r.argb32 = f.ID
+			break
+		}
+	}
+	if r.argb32 == 0 {
+		return nil, errNoARGB32
+	}
+	return r, nil
+}
+
+// QueryVersion announces the version the client supports and returns the
+// version the server will use.
+func (r *Render) QueryVersion(major, minor uint32) (uint32, uint32, error) {
+	var b x11byte.Builder
+	b.AddUint8(r.opcode)                     // opcode
+	b.AddUint8(RENDER_REQUEST_QUERY_VERSION) // extension-minor
+	b.AddUint16(3)                           // requestLength
+	b.AddUint32(major)                       // majorVersion
+	b.AddUint32(minor)                       // minorVersion
+
+	reply, err := r.c.Request(b.BytesOrPanic())
+	if err != nil {
+		return 0, 0, err
+	}
+
+	reply.Skip(1) // reply
+	reply.Skip(1) // unused
+	reply.Skip(2) // sequenceNumber
+	reply.Skip(4) // replyLength
+	reply.ReadUint32(&major)
+	reply.ReadUint32(&minor)
+	return major, minor, nil
+}
+
+// QueryPictFormats returns the picture formats the server supports.
+func (r *Render) QueryPictFormats() ([]PictFormat, error) {
+	var b x11byte.Builder
+	b.AddUint8(r.opcode)                          // opcode
+	b.AddUint8(RENDER_REQUEST_QUERY_PICT_FORMATS) // extension-minor
+	b.AddUint16(1)                                // requestLength
+
+	reply, err := r.c.Request(b.BytesOrPanic())
+	if err != nil {
+		return nil, err
+	}
+	return parsePictFormats(reply), nil
+}
+
+func parsePictFormats(reply x11byte.String) []PictFormat {
+	var numFormats uint32
+	reply.Skip(1) // reply
+	reply.Skip(1) // unused
+	reply.Skip(2) // sequenceNumber
+	reply.Skip(4) // replyLength
+	reply.ReadUint32(&numFormats)
+	reply.Skip(4) // numScreens
+	reply.Skip(4) // numDepths
+	reply.Skip(4) // numVisuals
+	reply.Skip(4) // numSubpixel
+	reply.Skip(4) // unused
+
+	formats := make([]PictFormat, 0, numFormats)
+	for range numFormats {
+		var f PictFormat
+		if !reply.ReadUint32(&f.ID) {
+			break
+		}
+		reply.ReadUint8(&f.Type)
+		reply.ReadUint8(&f.Depth)
+		reply.Skip(2) // unused
+		reply.ReadUint16(&f.RedShift)
+		reply.ReadUint16(&f.RedMask)
+		reply.ReadUint16(&f.GreenShift)
+		reply.ReadUint16(&f.GreenMask)
+		reply.ReadUint16(&f.BlueShift)
+		reply.ReadUint16(&f.BlueMask)
+		reply.ReadUint16(&f.AlphaShift)
+		reply.ReadUint16(&f.AlphaMask)
+		reply.ReadUint32(&f.Colormap)
+		formats = append(formats, f)
+	}
+	return formats
+}
+
+// CreatePicture creates a picture for drawable in the given format, with no
+// attributes set.
+func (r *Render) CreatePicture(drawable, format uint32) (uint32, error) {
+	pictureID, err := r.c.NewID()
+	if err != nil {
+		return 0, err
+	}
+
+	var b x11byte.Builder
+	b.AddUint8(r.opcode)                      // opcode
+	b.AddUint8(RENDER_REQUEST_CREATE_PICTURE) // extension-minor
+	b.AddUint16(5)                            // requestLength
+	b.AddUint32(pictureID)                    // pid
+	b.AddUint32(drawable)                     // drawable
+	b.AddUint32(format)                       // format
+	b.AddUint32(0)                            // valueMask
+
+	if err := r.c.Send(b.BytesOrPanic()); err != nil {
+		return 0, err
+	}
+	return pictureID, nil
+}
+
+// FreePicture frees a picture. The drawable it refers to is unaffected.
+func (r *Render) FreePicture(picture uint32) error {
+	var b x11byte.Builder
+	b.AddUint8(r.opcode)                    // opcode
+	b.AddUint8(RENDER_REQUEST_FREE_PICTURE) // extension-minor
+	b.AddUint16(2)                          // requestLength
+	b.AddUint32(picture)                    // picture
+	return r.c.Send(b.BytesOrPanic())
+}
@@ -0,0 +1,71 @@
+package render
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/dzeromsk/helloX11/x11byte"
+)
+
+func TestParsePictFormats(t *testing.T) {
+	var b x11byte.Builder
+	b.AddUint8(1)                // reply
+	b.AddUint8(0)                // unused
+	b.AddUint16(1)               // sequenceNumber
+	b.AddUint32(0)               // replyLength
+	b.AddUint32(2)               // numFormats
+	b.AddBytes(make([]byte, 20)) // numScreens, numDepths, numVisuals, numSubpixel, unused
+	for _, f := range []struct {
+		id, depth uint8
+		alpha     uint16
+	}{
+		{0x23, 24, 0},
+		{0x24, 32, 0xff},
+	} {
+		b.AddUint32(uint32(f.id))           // id
+		b.AddUint8(RENDER_PICT_TYPE_DIRECT) // type
+		b.AddUint8(f.depth)                 // depth
+		b.AddUint16(0)                      // unused
+		b.AddUint16(16)                     // redShift
+		b.AddUint16(0xff)                   // redMask
+		b.AddUint16(8)                      // greenShift
+		b.AddUint16(0xff)                   // greenMask
+		b.AddUint16(0)                      // blueShift
+		b.AddUint16(0xff)                   // blueMask
+		b.AddUint16(24)                     // alphaShift
+		b.AddUint16(f.alpha)                // alphaMask
+		b.AddUint32(0)                      // colormap
+	}
+
+	formats := parsePictFormats(b.BytesOrPanic())
+	if len(formats) != 2 {
+		t.Fatalf("got %d formats, want 2", len(formats))
+	}
+	if formats[0].isARGB32() || !formats[1].isARGB32() || formats[1].ID != 0x24 {
+		t.Errorf("formats = %+v", formats)
+	}
+}
+
+func TestCursorPixels(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	img.Set(0, 0, color.NRGBA{0xff, 0x80, 0x00, 0xff})
+	img.Set(1, 0, color.NRGBA{0xff, 0xff, 0xff, 0x80}) // premultiplied to 0x80
+
+	want := []byte{0x00, 0x80, 0xff, 0xff, 0x80, 0x80, 0x80, 0x80}
+	if got := cursorPixels(img, 0); !bytes.Equal(got, want) {
+		t.Errorf("LSBFirst pixels = % x, want % x", got, want)
+	}
+	want = []byte{0xff, 0xff, 0x80, 0x00, 0x80, 0x80, 0x80, 0x80}
+	if got := cursorPixels(img, 1); !bytes.Equal(got, want) {
+		t.Errorf("MSBFirst pixels = % x, want % x", got, want)
+	}
+}
+
+func TestCreateCursorEmpty(t *testing.T) {
+	r := &Render{}
+	if _, err := r.CreateCursor(image.NewNRGBA(image.Rect(3, 3, 3, 8)), 0, 0); err != errEmptyCursor {
+		t.Errorf("CreateCursor() of empty image = %v, want errEmptyCursor", err)
+	}
+}
@@ -0,0 +1,156 @@
+package selection
+
+import (
+	"context"
+	"time"
+
+	"github.com/dzeromsk/helloX11/x11"
+	"github.com/dzeromsk/helloX11/x11byte"
+)
+
+// maxIncrChunk caps the chunks of INCR transfers, which otherwise are as
+// large as a request allows.
+const maxIncrChunk = 256 << 10
+
+// maxIncrPrealloc caps the memory reserved for an incoming INCR transfer
+// from the size the owner announces.
+const maxIncrPrealloc = 1 << 20
+
+// incrKey identifies an outgoing INCR transfer.
+type incrKey struct {
+	requestor, property uint32
+}
+
+// incrSend is the state of an outgoing INCR transfer. Data is the part not
+// sent yet.
+type incrSend struct {
+	typ   uint32
+	data  []byte
+	timer *time.Timer
+}
+
+// chunkSize returns the largest chunk sent in one property change, the
+// request less its header and a BIG-REQUESTS length. Larger selections are
+// sent with INCR.
+func (m *Manager) chunkSize() int {
+	return min((m.c.MaxRequestLength()-28)&^3, maxIncrChunk)
+}
+
+// startIncr begins sending it to requestor with the INCR protocol: the
+// property is set to type INCR, and each time the requestor deletes it the
+// next chunk is stored, until an empty chunk marks the end.
+func (m *Manager) startIncr(requestor, property uint32, it item) error {
+	key := incrKey{requestor, property}
+	t := &incrSend{typ: it.typ, data: it.data}
+
+	m.mu.Lock()
+	old := m.outgoing[key]
+	m.outgoing[key] = t
+	if old != nil {
+		old.timer.Stop()
+	} else {
+		m.watched[requestor]++
+	}
+	t.timer = time.AfterFunc(m.Timeout, func() { m.endIncr(key, t) })
+	m.mu.Unlock()
+
+	err := m.c.ChangeWindowAttributes(requestor, x11.X11_FLAG_WIN_EVENT, x11.X11_EVENT_FLAG_PROPERTY_CHANGE)
+	if err != nil {
+		return err
+	}
+	return m.c.ChangePropertyUint32(requestor, property, m.incr, uint32(len(it.data)))
+}
+
+// continueIncr sends the next chunk of the transfer whose property the
+// requestor just deleted.
+func (m *Manager) continueIncr(ev *x11.PropertyNotifyEvent) error {
+	key := incrKey{ev.Window, ev.Atom}
+	m.mu.Lock()
+	t := m.outgoing[key]
+	m.mu.Unlock()
+	if t == nil {
+		return nil
+	}
+
+	n := min(len(t.data), m.chunkSize())
+	chunk := t.data[:n]
+	t.data = t.data[n:]
+	if n == 0 {
+		m.endIncr(key, t)
+	} else {
+		t.timer.Reset(m.Timeout)
+	}
+	return m.c.ChangeProperty(x11.X11_PROP_MODE_REPLACE, ev.Window, ev.Atom, t.typ, 8, chunk)
+}
+
+// endIncr forgets a finished or abandoned transfer, and stops listening to
+// the requestor's property changes once none of its transfers is left.
+func (m *Manager) endIncr(key incrKey, t *incrSend) {
+	m.mu.Lock()
+	if m.outgoing[key] != t {
+		m.mu.Unlock()
+		return
+	}
+	t.timer.Stop()
+	delete(m.outgoing, key)
+	m.watched[key.requestor]--
+	last := m.watched[key.requestor] == 0
+	if last {
+		delete(m.watched, key.requestor)
+	}
+	m.mu.Unlock()
+
+	if last {
+		// The window may be gone already, the error is harmless.
+		m.c.ChangeWindowAttributes(key.requestor, x11.X11_FLAG_WIN_EVENT, 0)
+	}
+}
+
+// expectChunk expects the next chunk of an incoming INCR transfer.
+func (m *Manager) expectChunk() *waiter {
+	return m.expect(func(ev x11.Event) bool {
+		e, ok := ev.(*x11.PropertyNotifyEvent)
+		return ok && e.Window == m.window.ID && e.Atom == m.property && !e.Deleted
+	})
+}
+
+// readIncr receives an INCR transfer whose INCR property was just read and
+// deleted. Next expects the first chunk and hint is the INCR value, a lower
+// bound on the size.
+func (m *Manager) readIncr(ctx context.Context, next *waiter, hint []byte) (uint32, []byte, error) {
+	var size uint32
+	s := x11byte.String(hint)
+	s.ReadUint32(&size)
+
+	var (
+		typ  uint32
+		data = make([]byte, 0, min(int(size), m.MaxSize, maxIncrPrealloc))
+	)
+	for {
+		chunkCtx, cancel := context.WithTimeout(ctx, m.Timeout)
+		_, err := m.wait(chunkCtx, next)
+		cancel()
+		if err == context.DeadlineExceeded && ctx.Err() == nil {
+			err = ErrTimeout
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+
+		next = m.expectChunk()
+		chunkType, chunk, err := m.readProperty(m.property, m.MaxSize-len(data))
+		if err == ErrTooLarge {
+			// The chunk too many is left in place, undeleted, so the owner
+			// never sends the next one and gives up after its timeout.
+			// The property is replaced by the next conversion.
+			m.forget(next)
+			return 0, nil, ErrTooLarge
+		}
+		if err != nil || len(chunk) == 0 {
+			m.forget(next)
+			return typ, data, err
+		}
+		typ = chunkType
+		data = append(data, chunk...)
+	}
+}
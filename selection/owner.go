@@ -0,0 +1,156 @@
+package selection
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dzeromsk/helloX11/x11"
+)
+
+// contents is what the application offers for a selection it owns.
+type contents struct {
+	time  uint32          // when ownership was taken
+	items map[uint32]item // by target atom
+	order []uint32        // targets in the order they are advertised
+}
+
+type item struct {
+	typ  uint32 // property type
+	data []byte
+}
+
+func (m *Manager) newContents(formats map[string][]byte) (*contents, error) {
+	cont := &contents{items: make(map[uint32]item)}
+	add := func(target, typ uint32, data []byte) {
+		if _, ok := cont.items[target]; !ok {
+			cont.items[target] = item{typ, data}
+			cont.order = append(cont.order, target)
+		}
+	}
+
+	var text []byte
+	for mime, data := range formats {
+		target, err := m.c.Atom(mime)
+		if err != nil {
+			return nil, err
+		}
+		add(target, target, data)
+		if isText(mime) && text == nil {
+			text = data
+		}
+	}
+	if text != nil {
+		add(m.utf8String, m.utf8String, text)
+		add(m.text, m.utf8String, text)
+		add(x11.X11_ATOM_STRING, x11.X11_ATOM_STRING, toLatin1(text))
+	}
+	return cont, nil
+}
+
+// handleRequest answers another client's SelectionRequest. A request that
+// fails with a protocol error, as when the requestor's window is already
+// gone, is refused; only connection errors are returned.
+func (m *Manager) handleRequest(ev *x11.SelectionRequestEvent) error {
+	m.mu.Lock()
+	cont := m.owned[ev.Selection]
+	m.mu.Unlock()
+
+	property := ev.Property
+	if property == x11.X11_NONE {
+		property = ev.Target // obsolete client
+	}
+	ok := false
+	if cont != nil && (ev.Time == x11.X11_CURRENT_TIME || ev.Time >= cont.time) {
+		var err error
+		if ev.Target == m.multiple && ev.Property != x11.X11_NONE {
+			ok, err = m.convertMultiple(ev.Requestor, property, cont)
+		} else {
+			ok, err = m.convertTarget(ev.Requestor, property, ev.Target, cont)
+		}
+		if err != nil {
+			if _, refused := err.(*x11.Error); !refused {
+				return err
+			}
+			ok = false
+		}
+	}
+	if !ok {
+		property = x11.X11_NONE
+	}
+	return m.c.SendSelectionNotify(ev, property)
+}
+
+// convertTarget stores the selection as target in property of requestor. It
+// reports false if the target is not offered.
+func (m *Manager) convertTarget(requestor, property, target uint32, cont *contents) (bool, error) {
+	switch target {
+	case m.targets:
+		targets := append([]uint32{m.targets, m.multiple, m.timestamp}, cont.order...)
+		return true, m.c.ChangePropertyUint32(requestor, property, x11.X11_ATOM_ATOM, targets...)
+	case m.timestamp:
+		return true, m.c.ChangePropertyUint32(requestor, property, x11.X11_ATOM_INTEGER, cont.time)
+	}
+
+	it, ok := cont.items[target]
+	if !ok {
+		return false, nil
+	}
+	if len(it.data) > m.chunkSize() {
+		return true, m.startIncr(requestor, property, it)
+	}
+	return true, m.c.ChangeProperty(x11.X11_PROP_MODE_REPLACE, requestor, property, it.typ, 8, it.data)
+}
+
+// convertMultiple answers a MULTIPLE request, whose property lists pairs of
+// target and property atoms. Pairs that cannot be converted get their
+// property replaced with None.
+func (m *Manager) convertMultiple(requestor, property uint32, cont *contents) (bool, error) {
+	p, err := m.c.GetProperty(false, requestor, property, m.atomPair, 0, 1<<20)
+	if err != nil {
+		return false, err
+	}
+	pairs := p.Uint32s()
+	if len(pairs) == 0 {
+		return false, nil
+	}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		target := pairs[i]
+		ok := false
+		if target != m.multiple {
+			if ok, err = m.convertTarget(requestor, pairs[i+1], target, cont); err != nil {
+				return false, err
+			}
+		}
+		if !ok {
+			pairs[i+1] = x11.X11_NONE
+		}
+	}
+	return true, m.c.ChangePropertyUint32(requestor, property, m.atomPair, pairs...)
+}
+
+// isText reports whether mime is a text/plain type.
+func isText(mime string) bool {
+	return mime == "text/plain" || strings.HasPrefix(mime, "text/plain;")
+}
+
+// toLatin1 converts UTF-8 text to ISO 8859-1 for STRING targets, replacing
+// characters it cannot represent with '?'.
+func toLatin1(text []byte) []byte {
+	out := make([]byte, 0, len(text))
+	for _, r := range string(text) {
+		if r > 0xff {
+			r = '?'
+		}
+		out = append(out, byte(r))
+	}
+	return out
+}
+
+// fromLatin1 converts ISO 8859-1 text to UTF-8.
+func fromLatin1(text []byte) []byte {
+	out := make([]byte, 0, len(text))
+	for _, c := range text {
+		out = utf8.AppendRune(out, rune(c))
+	}
+	return out
+}
@@ -0,0 +1,460 @@
+// Package selection implements the ICCCM selection protocol behind copy
+// and paste: owning CLIPBOARD or PRIMARY and answering other clients'
+// requests for its contents, and reading selections owned by others.
+//
+// A Manager reads the events of its connection on its own goroutine, so
+// Read and Write may be called from anywhere, including event handlers of
+// the application's main connection. Give it a connection of its own:
+//
+//	conn, err := x11.Dial("")
+//	m, err := selection.NewManager(conn)
+//	text, err := m.Clipboard().Read(ctx, selection.MimeText)
+package selection
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/dzeromsk/helloX11/x11"
+)
+
+// MimeText is the MIME type of UTF-8 text. Text written under any
+// text/plain type is also offered as UTF8_STRING, STRING and TEXT.
+const MimeText = "text/plain;charset=utf-8"
+
+var (
+	// ErrEmpty is returned by Read when nobody owns the selection.
+	ErrEmpty = errors.New("selection: selection has no owner")
+
+	// ErrUnavailable is returned by Read when the owner cannot convert the
+	// selection to the requested type.
+	ErrUnavailable = errors.New("selection: type not available")
+
+	// ErrNotOwner is returned by Write when another client took the
+	// selection with a later timestamp.
+	ErrNotOwner = errors.New("selection: could not become selection owner")
+
+	// ErrTooLarge is returned by Read when the selection exceeds
+	// Manager.MaxSize.
+	ErrTooLarge = errors.New("selection: selection too large")
+
+	// ErrTimeout is returned by Read when an incremental transfer stalls
+	// for longer than Manager.Timeout.
+	ErrTimeout = errors.New("selection: transfer timed out")
+
+	errClosed = errors.New("selection: connection closed")
+)
+
+// Manager owns and reads selections on behalf of the application, using an
+// invisible window on a dedicated connection.
+type Manager struct {
+	// MaxSize limits the size of selections Read accepts, 64 MiB by
+	// default.
+	MaxSize int
+
+	// Timeout is how long an incremental transfer may stall in either
+	// direction before it is abandoned, 10 seconds by default.
+	Timeout time.Duration
+
+	c      *x11.Conn
+	window *x11.Window
+
+	// Atoms used by the protocol.
+	clipboard, targets, multiple, timestamp, utf8String, text, atomPair, incr, property, timeProperty uint32
+
+	mu       sync.Mutex
+	owned    map[uint32]*contents // by selection atom
+	waiters  []*waiter
+	outgoing map[incrKey]*incrSend
+	watched  map[uint32]int // requestor windows selected for PropertyNotify, with their transfer counts
+	err      error          // set when the event loop stops
+	done     chan struct{}
+
+	readMu sync.Mutex // serializes conversions into property
+}
+
+// waiter is an event the Manager expects, such as the SelectionNotify
+// answering a conversion.
+type waiter struct {
+	match func(x11.Event) bool
+	ch    chan x11.Event
+}
+
+// NewManager creates the selection window on c and starts reading its
+// events. The Manager takes over c's event queue.
+func NewManager(c *x11.Conn) (*Manager, error) {
+	window, err := c.CreateWindow(c.Screen().Root, 1, 1,
+		x11.WithInputOnly(),
+		x11.WithEventMask(x11.X11_EVENT_FLAG_PROPERTY_CHANGE),
+	)
+	if err != nil {
+		return nil, err
+	}
+	atoms, err := c.Atoms("CLIPBOARD", "TARGETS", "MULTIPLE", "TIMESTAMP", "UTF8_STRING", "TEXT", "ATOM_PAIR",
+		"INCR", "HELLOX11_SELECTION", "HELLOX11_TIMESTAMP")
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manager{
+		MaxSize:  64 << 20,
+		Timeout:  10 * time.Second,
+		c:        c,
+		window:   window,
+		owned:    make(map[uint32]*contents),
+		outgoing: make(map[incrKey]*incrSend),
+		watched:  make(map[uint32]int),
+		done:     make(chan struct{}),
+	}
+	m.clipboard, m.targets, m.multiple, m.timestamp, m.utf8String, m.text, m.atomPair, m.incr, m.property, m.timeProperty =
+		atoms[0], atoms[1], atoms[2], atoms[3], atoms[4], atoms[5], atoms[6], atoms[7], atoms[8], atoms[9]
+	go m.run()
+	return m, nil
+}
+
+// Clipboard returns the CLIPBOARD selection, used by explicit copy and
+// paste commands.
+func (m *Manager) Clipboard() *Selection {
+	return &Selection{m: m, atom: m.clipboard}
+}
+
+// Primary returns the PRIMARY selection, which holds the last selected text
+// and is pasted with the middle mouse button.
+func (m *Manager) Primary() *Selection {
+	return &Selection{m: m, atom: x11.X11_ATOM_PRIMARY}
+}
+
+// Selection returns the selection with the given name.
+func (m *Manager) Selection(name string) (*Selection, error) {
+	atom, err := m.c.Atom(name)
+	if err != nil {
+		return nil, err
+	}
+	return &Selection{m: m, atom: atom}, nil
+}
+
+func (m *Manager) run() {
+	defer close(m.done)
+	for {
+		ev, err := m.c.WaitForEvent()
+		if err != nil {
+			m.stop(err)
+			return
+		}
+		if m.deliver(ev) {
+			continue
+		}
+		switch ev := ev.(type) {
+		case *x11.SelectionRequestEvent:
+			if err := m.handleRequest(ev); err != nil {
+				m.stop(err)
+				return
+			}
+		case *x11.PropertyNotifyEvent:
+			if ev.Deleted {
+				if err := m.continueIncr(ev); err != nil {
+					m.stop(err)
+					return
+				}
+			}
+		case *x11.SelectionClearEvent:
+			m.mu.Lock()
+			if cont, ok := m.owned[ev.Selection]; ok && ev.Time >= cont.time {
+				delete(m.owned, ev.Selection)
+			}
+			m.mu.Unlock()
+		}
+	}
+}
+
+func (m *Manager) stop(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.err = err
+}
+
+// deliver hands ev to the first waiter expecting it.
+func (m *Manager) deliver(ev x11.Event) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, w := range m.waiters {
+		if w.match(ev) {
+			m.waiters = append(m.waiters[:i], m.waiters[i+1:]...)
+			w.ch <- ev
+			return true
+		}
+	}
+	return false
+}
+
+// expect registers interest in an event matching match. It must be called
+// before sending the request that causes the event.
+func (m *Manager) expect(match func(x11.Event) bool) *waiter {
+	w := &waiter{match: match, ch: make(chan x11.Event, 1)}
+	m.mu.Lock()
+	m.waiters = append(m.waiters, w)
+	m.mu.Unlock()
+	return w
+}
+
+// wait returns the event expected by w.
+func (m *Manager) wait(ctx context.Context, w *waiter) (x11.Event, error) {
+	select {
+	case ev := <-w.ch:
+		return ev, nil
+	case <-ctx.Done():
+		m.forget(w)
+		return nil, ctx.Err()
+	case <-m.done:
+		m.forget(w)
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if m.err != nil {
+			return nil, m.err
+		}
+		return nil, errClosed
+	}
+}
+
+func (m *Manager) forget(w *waiter) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, o := range m.waiters {
+		if o == w {
+			m.waiters = append(m.waiters[:i], m.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+// serverTime returns the current server time, obtained from the
+// PropertyNotify caused by appending nothing to a property.
+func (m *Manager) serverTime(ctx context.Context) (uint32, error) {
+	w := m.expect(func(ev x11.Event) bool {
+		e, ok := ev.(*x11.PropertyNotifyEvent)
+		return ok && e.Window == m.window.ID && e.Atom == m.timeProperty
+	})
+	err := m.c.ChangeProperty(x11.X11_PROP_MODE_APPEND, m.window.ID, m.timeProperty, x11.X11_ATOM_INTEGER, 32, nil)
+	if err != nil {
+		m.forget(w)
+		return 0, err
+	}
+	ev, err := m.wait(ctx, w)
+	if err != nil {
+		return 0, err
+	}
+	return ev.(*x11.PropertyNotifyEvent).Time, nil
+}
+
+// Selection is a named selection, such as CLIPBOARD.
+type Selection struct {
+	m    *Manager
+	atom uint32
+}
+
+// Write takes ownership of the selection, offering data as the given MIME
+// type. It replaces anything written before.
+func (s *Selection) Write(mime string, data []byte) error {
+	return s.WriteFormats(map[string][]byte{mime: data})
+}
+
+// WriteFormats takes ownership of the selection, offering the same content
+// in several formats, keyed by MIME type.
+func (s *Selection) WriteFormats(formats map[string][]byte) error {
+	m := s.m
+	cont, err := m.newContents(formats)
+	if err != nil {
+		return err
+	}
+	cont.time, err = m.serverTime(context.Background())
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.owned[s.atom] = cont
+	m.mu.Unlock()
+	if err := m.c.SetSelectionOwner(m.window.ID, s.atom, cont.time); err != nil {
+		return err
+	}
+	owner, err := m.c.GetSelectionOwner(s.atom)
+	if err != nil {
+		return err
+	}
+	if owner != m.window.ID {
+		m.mu.Lock()
+		delete(m.owned, s.atom)
+		m.mu.Unlock()
+		return ErrNotOwner
+	}
+	return nil
+}
+
+// Owned reports whether the application still owns the selection.
+func (s *Selection) Owned() bool {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	return s.m.owned[s.atom] != nil
+}
+
+// Clear gives up ownership of the selection, if the application owns it.
+func (s *Selection) Clear() error {
+	m := s.m
+	m.mu.Lock()
+	cont := m.owned[s.atom]
+	delete(m.owned, s.atom)
+	m.mu.Unlock()
+	if cont == nil {
+		return nil
+	}
+	return m.c.SetSelectionOwner(x11.X11_NONE, s.atom, cont.time)
+}
+
+// Read returns the selection converted to the given MIME type. Text types
+// fall back to UTF8_STRING and STRING for owners that do not offer MIME
+// types. It fails with ErrEmpty if the selection has no owner and with
+// ErrUnavailable if the owner cannot provide the type.
+func (s *Selection) Read(ctx context.Context, mime string) ([]byte, error) {
+	return s.ReadAtTime(ctx, mime, x11.X11_CURRENT_TIME)
+}
+
+// ReadAtTime is like Read, converting the selection as of time, the
+// timestamp of the event that asked for it, such as an XdndDrop.
+// X11_CURRENT_TIME stands for the current server time.
+func (s *Selection) ReadAtTime(ctx context.Context, mime string, time uint32) ([]byte, error) {
+	m := s.m
+	target, err := m.c.Atom(mime)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	cont := m.owned[s.atom]
+	m.mu.Unlock()
+	if cont != nil {
+		if item, ok := cont.items[target]; ok {
+			return item.data, nil
+		}
+		return nil, ErrUnavailable
+	}
+
+	targets := []uint32{target}
+	if isText(mime) {
+		targets = append(targets, m.utf8String, x11.X11_ATOM_STRING)
+	}
+	for _, target := range targets {
+		typ, data, err := m.convert(ctx, s.atom, target, time)
+		if err == ErrUnavailable {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if typ == x11.X11_ATOM_STRING {
+			data = fromLatin1(data)
+		}
+		return data, nil
+	}
+	return nil, ErrUnavailable
+}
+
+// Targets returns the MIME types and other targets the selection owner
+// offers.
+func (s *Selection) Targets(ctx context.Context) ([]string, error) {
+	m := s.m
+	_, data, err := m.convert(ctx, s.atom, m.targets, x11.X11_CURRENT_TIME)
+	if err != nil {
+		return nil, err
+	}
+	p := x11.Property{Format: 32, Value: data}
+	var names []string
+	for _, atom := range p.Uint32s() {
+		name, err := m.c.AtomName(atom)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// convert asks the owner of selection for target as of time, or the server
+// time for X11_CURRENT_TIME, and returns the property type and value it
+// stored.
+func (m *Manager) convert(ctx context.Context, selection, target, time uint32) (uint32, []byte, error) {
+	m.readMu.Lock()
+	defer m.readMu.Unlock()
+
+	owner, err := m.c.GetSelectionOwner(selection)
+	if err != nil {
+		return 0, nil, err
+	}
+	if owner == x11.X11_NONE {
+		return 0, nil, ErrEmpty
+	}
+
+	if time == x11.X11_CURRENT_TIME {
+		if time, err = m.serverTime(ctx); err != nil {
+			return 0, nil, err
+		}
+	}
+	w := m.expect(func(ev x11.Event) bool {
+		e, ok := ev.(*x11.SelectionNotifyEvent)
+		return ok && e.Requestor == m.window.ID && e.Selection == selection && e.Target == target &&
+			(e.Time == time || e.Time == x11.X11_CURRENT_TIME)
+	})
+	if err := m.c.ConvertSelection(m.window.ID, selection, target, m.property, time); err != nil {
+		m.forget(w)
+		return 0, nil, err
+	}
+	ev, err := m.wait(ctx, w)
+	if err != nil {
+		return 0, nil, err
+	}
+	if ev.(*x11.SelectionNotifyEvent).Property == x11.X11_NONE {
+		return 0, nil, ErrUnavailable
+	}
+
+	// Reading deletes the property, which tells an INCR owner to send
+	// the first chunk.
+	next := m.expectChunk()
+	typ, data, err := m.readProperty(m.property, m.MaxSize)
+	if err != nil || typ != m.incr {
+		m.forget(next)
+		if err == ErrTooLarge {
+			err = m.c.DeleteProperty(m.window.ID, m.property)
+			if err == nil {
+				err = ErrTooLarge
+			}
+		}
+		return typ, data, err
+	}
+	return m.readIncr(ctx, next, data)
+}
+
+// readProperty reads and deletes a whole property of the selection window.
+// It stops reading once more than limit bytes arrived and fails with
+// ErrTooLarge, leaving the property in place.
+func (m *Manager) readProperty(property uint32, limit int) (uint32, []byte, error) {
+	var (
+		data   []byte
+		offset uint32
+	)
+	for {
+		length := min(1<<20, (limit-len(data))/4+1) // in 4-byte units
+		p, err := m.c.GetProperty(false, m.window.ID, property, x11.X11_ATOM_NONE, offset, uint32(length))
+		if err != nil {
+			return 0, nil, err
+		}
+		data = append(data, p.Value...)
+		if len(data) > limit {
+			return 0, nil, ErrTooLarge
+		}
+		if p.BytesAfter == 0 {
+			return p.Type, data, m.c.DeleteProperty(m.window.ID, property)
+		}
+		offset += uint32(len(p.Value) / 4)
+	}
+}
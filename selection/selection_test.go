@@ -0,0 +1,151 @@
+package selection
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/dzeromsk/helloX11/internal/xtest"
+	"github.com/dzeromsk/helloX11/x11"
+)
+
+func TestLatin1(t *testing.T) {
+	if got := toLatin1([]byte("café €5")); !bytes.Equal(got, []byte("caf\xe9 ?5")) {
+		t.Errorf("toLatin1() = %q", got)
+	}
+	if got := fromLatin1([]byte("caf\xe9")); string(got) != "café" {
+		t.Errorf("fromLatin1() = %q", got)
+	}
+}
+
+func TestIsText(t *testing.T) {
+	for mime, want := range map[string]bool{
+		"text/plain":                true,
+		MimeText:                    true,
+		"text/plain;charset=latin1": true,
+		"text/html":                 false,
+		"text/plainish":             false,
+		"image/png":                 false,
+	} {
+		if got := isText(mime); got != want {
+			t.Errorf("isText(%q) = %v, want %v", mime, got, want)
+		}
+	}
+}
+
+func newTestManagers(t *testing.T) (owner, reader *Manager) {
+	s := xtest.NewServer(t)
+	s.MaxRequestLength = 1024
+	owner, err := NewManager(s.Dial())
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err = NewManager(s.Dial())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return owner, reader
+}
+
+func TestReadWrite(t *testing.T) {
+	owner, reader := newTestManagers(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := reader.Clipboard().Read(ctx, MimeText); err != ErrEmpty {
+		t.Fatalf("Read() of empty selection = %v, want ErrEmpty", err)
+	}
+	if err := owner.Clipboard().Write("text/plain", []byte("café")); err != nil {
+		t.Fatal(err)
+	}
+	got, err := reader.Clipboard().Read(ctx, MimeText)
+	if err != nil || string(got) != "café" {
+		t.Errorf("Read() = %q, %v", got, err)
+	}
+	if _, err := reader.Clipboard().Read(ctx, "image/png"); err != ErrUnavailable {
+		t.Errorf("Read(image/png) = %v, want ErrUnavailable", err)
+	}
+	targets, err := reader.Clipboard().Targets(ctx)
+	if err != nil || !slices.Contains(targets, "text/plain") || !slices.Contains(targets, "UTF8_STRING") {
+		t.Errorf("Targets() = %q, %v", targets, err)
+	}
+}
+
+func TestIncr(t *testing.T) {
+	owner, reader := newTestManagers(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), 10000)
+	if len(data) <= owner.chunkSize() {
+		t.Fatalf("%d bytes fit in a %d byte chunk", len(data), owner.chunkSize())
+	}
+	if err := owner.Clipboard().Write("application/octet-stream", data); err != nil {
+		t.Fatal(err)
+	}
+	got, err := reader.Clipboard().Read(ctx, "application/octet-stream")
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("Read() = %d bytes, %v, want %d bytes", len(got), err, len(data))
+	}
+
+	owner.mu.Lock()
+	n := len(owner.outgoing)
+	owner.mu.Unlock()
+	if n != 0 {
+		t.Errorf("%d transfers left after Read", n)
+	}
+
+	reader.MaxSize = len(data) / 2
+	if _, err := reader.Clipboard().Read(ctx, "application/octet-stream"); err != ErrTooLarge {
+		t.Errorf("Read() beyond MaxSize = %v, want ErrTooLarge", err)
+	}
+}
+
+func TestRequestorGone(t *testing.T) {
+	owner, reader := newTestManagers(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := owner.Clipboard().Write("text/plain", []byte("still here")); err != nil {
+		t.Fatal(err)
+	}
+	// A MULTIPLE request from a window destroyed before the owner reads
+	// its property
+	if err := reader.c.ConvertSelection(0xdead, owner.clipboard, owner.multiple, reader.property, x11.X11_CURRENT_TIME); err != nil {
+		t.Fatal(err)
+	}
+	got, err := reader.Clipboard().Read(ctx, MimeText)
+	if err != nil || string(got) != "still here" {
+		t.Errorf("Read() after a failed request = %q, %v", got, err)
+	}
+	owner.mu.Lock()
+	err = owner.err
+	owner.mu.Unlock()
+	if err != nil {
+		t.Errorf("Manager stopped: %v", err)
+	}
+}
+
+func TestMaxSize(t *testing.T) {
+	owner, reader := newTestManagers(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	data := bytes.Repeat([]byte("x"), 100)
+	if len(data) > owner.chunkSize() {
+		t.Fatalf("%d bytes need INCR", len(data))
+	}
+	if err := owner.Clipboard().Write("application/octet-stream", data); err != nil {
+		t.Fatal(err)
+	}
+	reader.MaxSize = 50
+	if _, err := reader.Clipboard().Read(ctx, "application/octet-stream"); err != ErrTooLarge {
+		t.Errorf("Read() beyond MaxSize = %v, want ErrTooLarge", err)
+	}
+	reader.MaxSize = 100
+	if got, err := reader.Clipboard().Read(ctx, "application/octet-stream"); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("Read() = %d bytes, %v, want %d bytes", len(got), err, len(data))
+	}
+}
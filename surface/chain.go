@@ -0,0 +1,246 @@
+package surface
+
+import (
+	"context"
+	"errors"
+	"image"
+	"sync"
+
+	"github.com/dzeromsk/helloX11/mitshm"
+	"github.com/dzeromsk/helloX11/x11"
+)
+
+// ErrForeignBuffer is returned by Present for a framebuffer that was not
+// acquired from the chain.
+var ErrForeignBuffer = errors.New("surface: framebuffer not acquired from the chain")
+
+// Chain is a ring of framebuffers shown in a window, for animation. A render
+// goroutine draws the next frame into a free buffer while the server still
+// reads the ones presented before. With MIT-SHM, a buffer is reused only
+// after the server's Completion event for it, so frames never tear; without
+// it, buffers are copied to the server when presented and free right away.
+//
+// Acquire, TryAcquire and Present may be called from any goroutine. Filter
+// and Expose belong on the dispatcher's.
+type Chain struct {
+	u    *uploader
+	free chan *buffer // buffers ready to be acquired
+
+	mu      sync.Mutex
+	offset  image.Point
+	buffers []*buffer
+	front   *buffer // last presented, redrawn on Expose
+	expose  Region  // in framebuffer coordinates
+}
+
+// buffer is a framebuffer of a Chain or Loop. It is free when the server does not
+// read it, it is not the front buffer and no one draws into it.
+type buffer struct {
+	fb      *x11.Framebuffer
+	seg     *mitshm.Segment // nil without MIT-SHM
+	pixmap  uint32          // over seg, for a Loop
+	pending int             // uploads the server has not finished reading
+
+	acquired, front, queued bool
+}
+
+// NewChain returns a chain of n width × height framebuffers for w, which
+// must use the root visual. Two buffers allow drawing one frame while the
+// other is shown, a third lets drawing continue while the server is slow.
+func NewChain(w *x11.Window, width, height, n int) (*Chain, error) {
+	u, err := newUploader(w)
+	if err != nil {
+		return nil, err
+	}
+	c := &Chain{u: u, free: make(chan *buffer, n)}
+	err = c.alloc(width, height, n)
+	if err != nil && u.shm != nil {
+		// Buffers are all shared or none is, the segments attached before
+		// one failed go.
+		if err = c.closeBuffers(); err == nil {
+			u.fallback()
+			err = c.alloc(width, height, n)
+		}
+	}
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	for _, b := range c.buffers {
+		release(c.free, b)
+	}
+	return c, nil
+}
+
+// alloc makes the n buffers of the chain.
+func (c *Chain) alloc(width, height, n int) error {
+	for range n {
+		fb, seg, err := c.u.alloc(width, height)
+		if err != nil {
+			return err
+		}
+		c.buffers = append(c.buffers, &buffer{fb: fb, seg: seg})
+	}
+	return nil
+}
+
+// Shared reports whether the framebuffers are shared with the server
+// through MIT-SHM.
+func (c *Chain) Shared() bool {
+	return c.u.shm != nil
+}
+
+// SetOffset sets the position of the framebuffers' origin in the window,
+// used from the next Present or Expose on.
+func (c *Chain) SetOffset(p image.Point) {
+	c.mu.Lock()
+	c.offset = p
+	c.mu.Unlock()
+}
+
+// Acquire returns a free framebuffer to draw the next frame into, waiting
+// until the server completes reading one if all are busy. The previous
+// contents of the framebuffer are undefined.
+func (c *Chain) Acquire(ctx context.Context) (*x11.Framebuffer, error) {
+	select {
+	case b := <-c.free:
+		return c.acquire(b), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// TryAcquire is like Acquire but returns false instead of waiting, so the
+// caller can skip a frame.
+func (c *Chain) TryAcquire() (*x11.Framebuffer, bool) {
+	select {
+	case b := <-c.free:
+		return c.acquire(b), true
+	default:
+		return nil, false
+	}
+}
+
+func (c *Chain) acquire(b *buffer) *x11.Framebuffer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b.queued, b.acquired = false, true
+	return b.fb
+}
+
+// Present shows the acquired framebuffer fb in the window and makes it the
+// front buffer. The previous front buffer becomes free once the server is
+// done with it.
+func (c *Chain) Present(fb *x11.Framebuffer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var b *buffer
+	for _, o := range c.buffers {
+		if o.fb == fb && o.acquired {
+			b = o
+		}
+	}
+	if b == nil {
+		return ErrForeignBuffer
+	}
+	b.acquired = false
+
+	old := c.front
+	c.front, b.front = b, true
+	if old != nil {
+		old.front = false
+		release(c.free, old)
+	}
+	return c.put(b, b.fb.Rect)
+}
+
+// Filter handles the Completion events of the chain's uploads. It is meant
+// for Dispatcher.Filter.
+func (c *Chain) Filter(ev x11.Event) (bool, error) {
+	e, ok := ev.(*mitshm.CompletionEvent)
+	if !ok || e.Drawable != c.u.window {
+		return false, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, b := range c.buffers {
+		if b.seg != nil && b.seg.ID == e.Segment && b.pending > 0 {
+			b.pending--
+			release(c.free, b)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Expose redraws the exposed part of the window from the front buffer,
+// once the last Expose event of a series, with a zero count, arrives.
+func (c *Chain) Expose(ev *x11.ExposeEvent) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expose.Add(exposed(ev).Sub(c.offset))
+	if ev.Count != 0 || c.front == nil {
+		return nil
+	}
+	defer c.expose.Clear()
+	for _, r := range c.expose.Rects() {
+		if err := c.put(c.front, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close frees the server resources of the chain. Presented frames must
+// have completed.
+func (c *Chain) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err := c.closeBuffers()
+	if gcErr := c.u.close(); err == nil {
+		err = gcErr
+	}
+	return err
+}
+
+// closeBuffers frees the segments of the buffers and forgets them.
+func (c *Chain) closeBuffers() error {
+	var err error
+	for _, b := range c.buffers {
+		if b.seg == nil {
+			continue
+		}
+		if segErr := b.seg.Close(); err == nil {
+			err = segErr
+		}
+	}
+	c.buffers = nil
+	return err
+}
+
+// put uploads the part r of b, asking for a Completion event if b is
+// shared. It is called with mu held.
+func (c *Chain) put(b *buffer, r image.Rectangle) error {
+	r = r.Intersect(b.fb.Rect)
+	if r.Empty() {
+		return nil
+	}
+	if err := c.u.put(c.u.window, b.fb, b.seg, r, r.Min.Add(c.offset), b.seg != nil); err != nil {
+		return err
+	}
+	if b.seg != nil {
+		b.pending++
+	}
+	return nil
+}
+
+// release queues b on free for Acquire if it became free. It is called
+// with the owner's mutex held, or before the owner is shared.
+func release(free chan *buffer, b *buffer) {
+	if b.pending > 0 || b.front || b.acquired || b.queued {
+		return
+	}
+	b.queued = true
+	free <- b
+}
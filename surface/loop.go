@@ -0,0 +1,246 @@
+package surface
+
+import (
+	"context"
+	"errors"
+	"image"
+	"sync"
+
+	"github.com/dzeromsk/helloX11/present"
+	"github.com/dzeromsk/helloX11/x11"
+)
+
+// ErrNoPresent is returned by NewLoop when the server cannot present shared
+// pixmaps: it lacks the Present extension or MIT-SHM pixmaps, or runs on
+// another machine. A Chain works there instead.
+var ErrNoPresent = errors.New("surface: server cannot present shared pixmaps")
+
+// Frame is the timing of a presented frame, as reported by the server.
+type Frame struct {
+	Serial uint32 // counts the frames presented, from 1
+	UST    uint64 // microseconds of the server's monotonic clock
+	MSC    uint64 // vertical blanks of the window's CRTC
+	Mode   uint8  // present.PRESENT_COMPLETE_MODE_*, SKIP if never shown
+}
+
+// Loop is a ring of framebuffers shown in a window with the Present
+// extension, one frame per vertical blank. Acquire waits until the previous
+// frame reached the screen, so a render goroutine calling Acquire and
+// Present in turn runs at the display's refresh rate without tearing.
+//
+// The framebuffers are MIT-SHM pixmaps, reused once the server reports
+// them idle. Acquire and Present may be called from any goroutine. Filter
+// and Expose belong on the dispatcher's.
+type Loop struct {
+	// Presented, if set, is called on the dispatcher goroutine with the
+	// timing of each frame once it is shown or skipped.
+	Presented func(Frame)
+
+	u    *uploader
+	p    *present.Present
+	eid  uint32        // event context of CompleteNotify and IdleNotify
+	free chan *buffer  // buffers ready to be acquired
+	turn chan struct{} // taken by Acquire until the frame completes
+
+	mu      sync.Mutex
+	offset  image.Point
+	buffers []*buffer
+	front   *buffer // last presented, shown again on Expose
+	serial  uint32  // of the last frame; repaints on Expose use 0
+}
+
+// NewLoop returns a loop of n width × height framebuffers for w, which
+// must use the root visual. It fails with ErrNoPresent if the server cannot
+// present them.
+func NewLoop(w *x11.Window, width, height, n int) (*Loop, error) {
+	u, err := newUploader(w)
+	if err != nil {
+		return nil, err
+	}
+	if u.shm == nil || !u.shm.SharedPixmaps || u.shm.PixmapFormat != x11.X11_IMAGE_FORMAT_Z_PIXMAP {
+		u.close()
+		return nil, ErrNoPresent
+	}
+	p, err := present.New(u.c)
+	if err != nil {
+		u.close()
+		return nil, ErrNoPresent
+	}
+
+	l := &Loop{u: u, p: p, free: make(chan *buffer, n), turn: make(chan struct{}, 1)}
+	for range n {
+		fb, seg, err := u.alloc(width, height)
+		if err != nil { // attaching failed, the server is remote
+			l.Close()
+			return nil, ErrNoPresent
+		}
+		b := &buffer{fb: fb, seg: seg}
+		l.buffers = append(l.buffers, b)
+		b.pixmap, err = u.shm.CreatePixmap(u.window, uint16(width), uint16(height), fb.Depth, seg.ID, 0)
+		if err != nil {
+			l.Close()
+			return nil, err
+		}
+		release(l.free, b)
+	}
+	l.eid, err = p.SelectInput(u.window, present.PRESENT_EVENT_MASK_COMPLETE_NOTIFY|present.PRESENT_EVENT_MASK_IDLE_NOTIFY)
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+	l.pass()
+	return l, nil
+}
+
+// SetOffset sets the position of the framebuffers' origin in the window,
+// used from the next Present or Expose on.
+func (l *Loop) SetOffset(p image.Point) {
+	l.mu.Lock()
+	l.offset = p
+	l.mu.Unlock()
+}
+
+// Acquire waits until the previous frame was shown and a framebuffer is
+// idle, and returns it to draw the next frame into. The previous contents
+// of the framebuffer are undefined.
+func (l *Loop) Acquire(ctx context.Context) (*x11.Framebuffer, error) {
+	select {
+	case <-l.turn:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	select {
+	case b := <-l.free:
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		b.queued, b.acquired = false, true
+		return b.fb, nil
+	case <-ctx.Done():
+		l.pass()
+		return nil, ctx.Err()
+	}
+}
+
+// Present shows the acquired framebuffer fb at the next vertical blank.
+func (l *Loop) Present(fb *x11.Framebuffer) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var b *buffer
+	for _, o := range l.buffers {
+		if o.fb == fb && o.acquired {
+			b = o
+		}
+	}
+	if b == nil {
+		return ErrForeignBuffer
+	}
+	b.acquired = false
+
+	old := l.front
+	l.front, b.front = b, true
+	if old != nil {
+		old.front = false
+		release(l.free, old)
+	}
+	if l.serial++; l.serial == 0 {
+		l.serial = 1
+	}
+	if err := l.present(b, l.serial); err != nil {
+		l.pass() // no CompleteNotify will come
+		return err
+	}
+	return nil
+}
+
+// Filter handles the Present events of the loop. It is meant for
+// Dispatcher.Filter.
+func (l *Loop) Filter(ev x11.Event) (bool, error) {
+	switch e := ev.(type) {
+	case *present.CompleteNotifyEvent:
+		if e.EventID != l.eid {
+			return false, nil
+		}
+		if e.Kind == present.PRESENT_COMPLETE_KIND_PIXMAP && e.Serial != 0 {
+			l.pass()
+			if l.Presented != nil {
+				l.Presented(Frame{Serial: e.Serial, UST: e.UST, MSC: e.MSC, Mode: e.Mode})
+			}
+		}
+		return true, nil
+
+	case *present.IdleNotifyEvent:
+		if e.EventID != l.eid {
+			return false, nil
+		}
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		for _, b := range l.buffers {
+			if b.pixmap == e.Pixmap && b.pending > 0 {
+				b.pending--
+				release(l.free, b)
+			}
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// Expose shows the front buffer again once the last Expose event of a
+// series, with a zero count, arrives.
+func (l *Loop) Expose(ev *x11.ExposeEvent) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if ev.Count != 0 || l.front == nil {
+		return nil
+	}
+	return l.present(l.front, 0)
+}
+
+// Close frees the server resources of the loop. Presented frames must have
+// completed.
+func (l *Loop) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var err error
+	if l.eid != 0 {
+		err = l.p.Deselect(l.eid, l.u.window)
+	}
+	for _, b := range l.buffers {
+		if b.pixmap != 0 {
+			if pixErr := l.u.c.FreePixmap(b.pixmap); err == nil {
+				err = pixErr
+			}
+		}
+		if b.seg != nil {
+			if segErr := b.seg.Close(); err == nil {
+				err = segErr
+			}
+		}
+	}
+	l.buffers = nil
+	if gcErr := l.u.close(); err == nil {
+		err = gcErr
+	}
+	return err
+}
+
+// pass lets the next Acquire go ahead.
+func (l *Loop) pass() {
+	select {
+	case l.turn <- struct{}{}:
+	default:
+	}
+}
+
+// present presents the pixmap of b at the next vertical blank. It is
+// called with mu held.
+func (l *Loop) present(b *buffer, serial uint32) error {
+	err := l.p.Pixmap(l.u.window, b.pixmap, serial, int16(l.offset.X), int16(l.offset.Y),
+		present.NextVBlank, present.PRESENT_OPTION_NONE)
+	if err != nil {
+		return err
+	}
+	b.pending++
+	return nil
+}
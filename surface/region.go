@@ -0,0 +1,110 @@
+package surface
+
+import "image"
+
+// maxRects bounds the rectangles of a Region. Beyond it, the region
+// becomes its bounding box, as one large upload beats many tiny ones.
+const maxRects = 32
+
+// Region is a set of pixels to redraw, kept as disjoint rectangles so no
+// pixel is sent twice. The zero value is an empty region.
+type Region struct {
+	rects []image.Rectangle
+}
+
+// Add adds r to the region.
+func (g *Region) Add(r image.Rectangle) {
+	if r.Empty() {
+		return
+	}
+	pieces := []image.Rectangle{r}
+	for _, e := range g.rects {
+		var rest []image.Rectangle
+		for _, p := range pieces {
+			rest = subtract(rest, p, e)
+		}
+		if pieces = rest; len(pieces) == 0 {
+			return
+		}
+	}
+	g.rects = append(g.rects, pieces...)
+	g.coalesce()
+
+	if len(g.rects) > maxRects {
+		g.rects = []image.Rectangle{g.Bounds()}
+	}
+}
+
+// Rects returns the disjoint rectangles making up the region.
+func (g *Region) Rects() []image.Rectangle {
+	return g.rects
+}
+
+// Bounds returns the smallest rectangle containing the region.
+func (g *Region) Bounds() image.Rectangle {
+	var b image.Rectangle
+	for _, r := range g.rects {
+		b = b.Union(r)
+	}
+	return b
+}
+
+// Empty reports whether the region contains no pixels.
+func (g *Region) Empty() bool {
+	return len(g.rects) == 0
+}
+
+// Clear empties the region.
+func (g *Region) Clear() {
+	g.rects = g.rects[:0]
+}
+
+// coalesce merges rectangles sharing a whole edge until none do.
+func (g *Region) coalesce() {
+	for merged := true; merged; {
+		merged = false
+		for i := 0; i < len(g.rects); i++ {
+			for j := i + 1; j < len(g.rects); j++ {
+				if u, ok := join(g.rects[i], g.rects[j]); ok {
+					g.rects[i] = u
+					g.rects = append(g.rects[:j], g.rects[j+1:]...)
+					merged = true
+					j--
+				}
+			}
+		}
+	}
+}
+
+// join returns the union of a and b if it is exactly the pixels of both,
+// that is if they share a whole edge.
+func join(a, b image.Rectangle) (image.Rectangle, bool) {
+	switch {
+	case a.Min.X == b.Min.X && a.Max.X == b.Max.X && (a.Max.Y == b.Min.Y || b.Max.Y == a.Min.Y):
+		return a.Union(b), true
+	case a.Min.Y == b.Min.Y && a.Max.Y == b.Max.Y && (a.Max.X == b.Min.X || b.Max.X == a.Min.X):
+		return a.Union(b), true
+	}
+	return image.Rectangle{}, false
+}
+
+// subtract appends the parts of r outside o to dst, as up to four bands.
+func subtract(dst []image.Rectangle, r, o image.Rectangle) []image.Rectangle {
+	if !r.Overlaps(o) {
+		return append(dst, r)
+	}
+	if o.Min.Y > r.Min.Y { // above
+		dst = append(dst, image.Rect(r.Min.X, r.Min.Y, r.Max.X, o.Min.Y))
+	}
+	if o.Max.Y < r.Max.Y { // below
+		dst = append(dst, image.Rect(r.Min.X, o.Max.Y, r.Max.X, r.Max.Y))
+	}
+	y0, y1 := max(r.Min.Y, o.Min.Y), min(r.Max.Y, o.Max.Y)
+	if o.Min.X > r.Min.X { // left
+		dst = append(dst, image.Rect(r.Min.X, y0, o.Min.X, y1))
+	}
+	if o.Max.X < r.Max.X { // right
+		dst = append(dst, image.Rect(o.Max.X, y0, r.Max.X, y1))
+	}
+	return dst
+}
@@ -0,0 +1,247 @@
+// Package surface shows framebuffers in windows. The pixels are shared with
+// the server through MIT-SHM when it runs on the same machine, and are sent
+// with core PutImage requests otherwise, over TCP or ssh forwarding for
+// instance, with identical results.
+//
+// A Surface is a single framebuffer, redrawn where it is damaged. A Chain
+// is a ring of framebuffers for animation, drawn by a render goroutine, and
+// a Loop paces such a goroutine to the display refresh with the Present
+// extension.
+package surface
+
+import (
+	"image"
+
+	"github.com/dzeromsk/helloX11/mitshm"
+	"github.com/dzeromsk/helloX11/x11"
+)
+
+// Surface is a framebuffer shown in a window. A copy of it lives on the
+// server in a pixmap, the back buffer, so exposed parts of the window are
+// redrawn with CopyArea rather than sent again. With MIT-SHM pixmaps, the
+// back buffer is the framebuffer's own memory and is never sent at all.
+type Surface struct {
+	// Offset is the position of the framebuffer's origin in the window.
+	Offset image.Point
+
+	u        *uploader
+	fb       *x11.Framebuffer
+	seg      *mitshm.Segment // nil without MIT-SHM
+	pixmap   uint32          // back buffer
+	shared   bool            // pixmap is over seg
+	scrollGC uint32          // with graphics exposures, for copies within the window
+
+	damage  Region // in framebuffer coordinates, to be sent by Flush
+	exposed Region // in framebuffer coordinates, to be copied from the back buffer
+}
+
+// New returns a width × height surface for w, which must use the root
+// visual, as windows do by default.
+func New(w *x11.Window, width, height int) (*Surface, error) {
+	u, err := newUploader(w)
+	if err != nil {
+		return nil, err
+	}
+	fb, seg, err := u.alloc(width, height)
+	if err != nil && u.shm != nil {
+		u.fallback()
+		fb, seg, err = u.alloc(width, height)
+	}
+	if err != nil {
+		u.close()
+		return nil, err
+	}
+	s := &Surface{u: u, fb: fb, seg: seg}
+
+	if seg != nil && u.shm.SharedPixmaps && u.shm.PixmapFormat == x11.X11_IMAGE_FORMAT_Z_PIXMAP {
+		if pixmap, err := u.shm.CreatePixmap(w.ID, uint16(width), uint16(height), fb.Depth, seg.ID, 0); err == nil {
+			s.pixmap, s.shared = pixmap, true
+		}
+	}
+	if !s.shared {
+		if s.pixmap, err = u.c.CreatePixmap(w.ID, fb.Depth, uint16(width), uint16(height)); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	if s.scrollGC, err = u.c.CreateGC(w.ID, 0); err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	// The back buffer starts out undefined
+	s.damage.Add(fb.Rect)
+	return s, nil
+}
+
+// Image returns the framebuffer to draw into.
+func (s *Surface) Image() *x11.Framebuffer {
+	return s.fb
+}
+
+// Shared reports whether the framebuffer is shared with the server through
+// MIT-SHM.
+func (s *Surface) Shared() bool {
+	return s.seg != nil
+}
+
+// Damage marks the part r of the framebuffer as changed, to be sent by the
+// next Flush.
+func (s *Surface) Damage(r image.Rectangle) {
+	s.damage.Add(r.Intersect(s.fb.Rect))
+}
+
+// Expose marks the exposed part of the window for redrawing, and redraws
+// once the last Expose event of a series, with a zero count, arrives.
+func (s *Surface) Expose(ev *x11.ExposeEvent) error {
+	s.exposed.Add(exposed(ev).Sub(s.Offset))
+	if ev.Count != 0 {
+		return nil
+	}
+	return s.repair()
+}
+
+// GraphicsExpose redraws the parts of the window that Scroll could not
+// copy, once the last GraphicsExposure event of a series arrives.
+func (s *Surface) GraphicsExpose(ev *x11.GraphicsExposureEvent) error {
+	r := image.Rect(int(ev.X), int(ev.Y), int(ev.X)+int(ev.Width), int(ev.Y)+int(ev.Height))
+	s.exposed.Add(r.Sub(s.Offset))
+	if ev.Count != 0 {
+		return nil
+	}
+	return s.repair()
+}
+
+// Flush sends the damaged parts of the framebuffer to the window, one
+// request per rectangle of the damage region. If one fails, the rectangles
+// not sent yet stay damaged.
+func (s *Surface) Flush() error {
+	rects := s.damage.Rects()
+	for i, r := range rects {
+		if err := s.Update(r); err != nil {
+			s.damage.rects = rects[i:]
+			return err
+		}
+	}
+	s.damage.Clear()
+	return nil
+}
+
+// Update copies the part r of the framebuffer to the back buffer and the
+// window right away.
+func (s *Surface) Update(r image.Rectangle) error {
+	r = r.Intersect(s.fb.Rect)
+	if r.Empty() {
+		return nil
+	}
+	if !s.shared {
+		if err := s.u.put(s.pixmap, s.fb, s.seg, r, r.Min, false); err != nil {
+			return err
+		}
+	}
+	return s.copy(r)
+}
+
+// Scroll moves the part r of the framebuffer by d, clipped to r, in the
+// framebuffer, the back buffer and the window, so scrolled content is not
+// sent again. The part of r left uncovered keeps its old pixels until it is
+// redrawn and marked with Damage. Pending damage is sent first.
+//
+// The window is scrolled with a CopyArea onto itself. Where the source was
+// obscured, the server reports GraphicsExposure events instead, for
+// GraphicsExpose.
+func (s *Surface) Scroll(r image.Rectangle, d image.Point) error {
+	r = r.Intersect(s.fb.Rect)
+	dst := r.Add(d).Intersect(r)
+	if dst.Empty() {
+		return nil
+	}
+	src := dst.Sub(d)
+
+	if err := s.Flush(); err != nil {
+		return err
+	}
+	if s.seg != nil {
+		// The server may still read the segment for the ShmPutImage or
+		// CopyArea requests just sent
+		if err := s.u.c.Sync(); err != nil {
+			return err
+		}
+	}
+	move(s.fb, dst, src.Min)
+	if !s.shared {
+		err := s.u.c.CopyArea(s.pixmap, s.pixmap, s.u.gc, int16(src.Min.X), int16(src.Min.Y),
+			int16(dst.Min.X), int16(dst.Min.Y), uint16(dst.Dx()), uint16(dst.Dy()))
+		if err != nil {
+			return err
+		}
+	}
+	src, dst = src.Add(s.Offset), dst.Add(s.Offset)
+	return s.u.c.CopyArea(s.u.window, s.u.window, s.scrollGC, int16(src.Min.X), int16(src.Min.Y),
+		int16(dst.Min.X), int16(dst.Min.Y), uint16(dst.Dx()), uint16(dst.Dy()))
+}
+
+// Close frees the server resources of the surface.
+func (s *Surface) Close() error {
+	var err error
+	if s.pixmap != 0 {
+		err = s.u.c.FreePixmap(s.pixmap)
+	}
+	if s.scrollGC != 0 {
+		if gcErr := s.u.c.FreeGC(s.scrollGC); err == nil {
+			err = gcErr
+		}
+	}
+	if s.seg != nil {
+		if segErr := s.seg.Close(); err == nil {
+			err = segErr
+		}
+	}
+	if gcErr := s.u.close(); err == nil {
+		err = gcErr
+	}
+	return err
+}
+
+// repair sends pending damage to the back buffer, then copies the exposed
+// parts of the window from it.
+func (s *Surface) repair() error {
+	if err := s.Flush(); err != nil {
+		return err
+	}
+	defer s.exposed.Clear()
+	for _, r := range s.exposed.Rects() {
+		if r = r.Intersect(s.fb.Rect); r.Empty() {
+			continue
+		}
+		if err := s.copy(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copy copies the part r of the back buffer to the window.
+func (s *Surface) copy(r image.Rectangle) error {
+	dst := r.Min.Add(s.Offset)
+	return s.u.c.CopyArea(s.pixmap, s.u.window, s.u.gc, int16(r.Min.X), int16(r.Min.Y),
+		int16(dst.X), int16(dst.Y), uint16(r.Dx()), uint16(r.Dy()))
+}
+
+// move copies the pixels of fb at sp to r, which may overlap them.
+func move(fb *x11.Framebuffer, r image.Rectangle, sp image.Point) {
+	n := r.Dx() * fb.BitsPerPixel / 8
+	y0, y1, dy := 0, r.Dy(), 1
+	if sp.Y < r.Min.Y { // moving down, start from the bottom
+		y0, y1, dy = r.Dy()-1, -1, -1
+	}
+	for y := y0; y != y1; y += dy {
+		d, s := fb.PixOffset(r.Min.X, r.Min.Y+y), fb.PixOffset(sp.X, sp.Y+y)
+		copy(fb.Pix[d:d+n], fb.Pix[s:s+n])
+	}
+}
+
+// exposed returns the rectangle of an Expose event.
+func exposed(ev *x11.ExposeEvent) image.Rectangle {
+	return image.Rect(int(ev.X), int(ev.Y), int(ev.X)+int(ev.Width), int(ev.Y)+int(ev.Height))
+}
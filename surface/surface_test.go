@@ -0,0 +1,323 @@
+package surface
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"slices"
+	"testing"
+
+	"github.com/dzeromsk/helloX11/internal/xtest"
+	"github.com/dzeromsk/helloX11/mitshm"
+	"github.com/dzeromsk/helloX11/present"
+	"github.com/dzeromsk/helloX11/x11"
+	"github.com/dzeromsk/helloX11/x11byte"
+)
+
+const fakeShmOpcode = 130
+
+// newShmConn returns a connection to a test server offering MIT-SHM. Every
+// request is passed to handle, in order, before the server answers it. A
+// reply or error handle returns is sent instead.
+func newShmConn(t *testing.T, handle func(req []byte) []byte) *x11.Conn {
+	s := xtest.NewServer(t)
+	s.Handle = func(req []byte) []byte {
+		if reply := handle(req); reply != nil {
+			return reply
+		}
+		var b x11byte.Builder
+		switch {
+		case req[0] == x11.X11_REQUEST_QUERY_EXTENSION:
+			b.AddUint8(1)             // present
+			b.AddUint8(fakeShmOpcode) // majorOpcode
+			b.AddUint8(90)            // firstEvent
+			b.AddUint8(150)           // firstError
+		case req[0] == fakeShmOpcode && req[1] == mitshm.SHM_REQUEST_QUERY_VERSION:
+			b.AddUint16(1) // majorVersion
+			b.AddUint16(1) // minorVersion
+		default:
+			return nil
+		}
+		return xtest.Reply(0, b.BytesOrPanic())
+	}
+	return s.Dial()
+}
+
+func TestRows(t *testing.T) {
+	visual := &x11.Visual{Class: x11.VISUAL_CLASS_TRUE_COLOR, RedMask: 0xf800, GreenMask: 0x07e0, BlueMask: 0x001f}
+	format := &x11.Format{Depth: 16, BitsPerPixel: 16, ScanlinePad: 32}
+	fb, err := x11.NewFramebuffer(make([]byte, format.Stride(4)*3), 4, 3, visual, 16, format, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := range 3 {
+		for x := range 4 {
+			fb.Set(x, y, color.RGBA{0, 0, uint8(y*4+x) << 3, 0xff})
+		}
+	}
+
+	u := &uploader{format: format}
+	data, stride := u.rows(fb, image.Rect(1, 1, 4, 3))
+	if stride != 8 {
+		t.Errorf("stride = %d, want 8", stride)
+	}
+	want := []byte{5, 0, 6, 0, 7, 0, 0, 0, 9, 0, 10, 0, 11, 0, 0, 0}
+	if !bytes.Equal(data, want) {
+		t.Errorf("rows = % x, want % x", data, want)
+	}
+}
+
+func area(rects []image.Rectangle) int {
+	n := 0
+	for _, r := range rects {
+		n += r.Dx() * r.Dy()
+	}
+	return n
+}
+
+func TestRegion(t *testing.T) {
+	var g Region
+	g.Add(image.Rect(0, 0, 10, 10))
+	g.Add(image.Rect(5, 5, 15, 15)) // overlapping
+	g.Add(image.Rect(2, 2, 4, 4))   // contained
+	g.Add(image.Rect(0, 0, 0, 5))   // empty
+	if got := area(g.Rects()); got != 175 {
+		t.Errorf("area = %d, want 175", got)
+	}
+	rects := g.Rects()
+	for i := range rects {
+		for j := i + 1; j < len(rects); j++ {
+			if rects[i].Overlaps(rects[j]) {
+				t.Errorf("%v overlaps %v", rects[i], rects[j])
+			}
+		}
+	}
+	if g.Bounds() != image.Rect(0, 0, 15, 15) {
+		t.Errorf("Bounds() = %v", g.Bounds())
+	}
+
+	g.Clear()
+	g.Add(image.Rect(0, 0, 10, 5))
+	g.Add(image.Rect(0, 5, 10, 10)) // shares an edge
+	if len(g.Rects()) != 1 || g.Rects()[0] != image.Rect(0, 0, 10, 10) {
+		t.Errorf("Rects() = %v, want one merged rectangle", g.Rects())
+	}
+
+	g.Clear()
+	for i := range maxRects + 1 {
+		g.Add(image.Rect(i*2, 0, i*2+1, 1))
+	}
+	if len(g.Rects()) != 1 || g.Rects()[0] != image.Rect(0, 0, maxRects*2+1, 1) {
+		t.Errorf("Rects() = %v, want the bounding box", g.Rects())
+	}
+}
+
+func TestChainRelease(t *testing.T) {
+	c := &Chain{u: &uploader{window: 1}, free: make(chan *buffer, 2)}
+	for i := range 2 {
+		b := &buffer{fb: &x11.Framebuffer{}, seg: &mitshm.Segment{ID: uint32(10 + i)}}
+		c.buffers = append(c.buffers, b)
+		release(c.free, b)
+	}
+
+	// Both acquired, then the second presented and still read by the server
+	a, _ := c.TryAcquire()
+	c.TryAcquire()
+	if _, ok := c.TryAcquire(); ok {
+		t.Fatal("acquired a third buffer out of two")
+	}
+	c.buffers[0].acquired, c.buffers[0].front = false, false
+	c.buffers[1].acquired, c.buffers[1].front, c.buffers[1].pending = false, true, 1
+	c.front = c.buffers[1]
+	release(c.free, c.buffers[0])
+	if fb, ok := c.TryAcquire(); !ok || fb != a {
+		t.Fatal("free buffer not released")
+	}
+
+	// The front buffer stays busy after its Completion event
+	ev := &mitshm.CompletionEvent{Drawable: 1, Segment: 11}
+	if handled, _ := c.Filter(ev); !handled {
+		t.Fatal("Completion event not handled")
+	}
+	if c.buffers[1].pending != 0 {
+		t.Errorf("pending = %d, want 0", c.buffers[1].pending)
+	}
+	if _, ok := c.TryAcquire(); ok {
+		t.Fatal("acquired the front buffer")
+	}
+	if handled, _ := c.Filter(ev); handled {
+		t.Error("handled an unexpected Completion event")
+	}
+	if handled, _ := c.Filter(&mitshm.CompletionEvent{Drawable: 2, Segment: 11}); handled {
+		t.Error("handled another window's Completion event")
+	}
+}
+
+func TestLoopFilter(t *testing.T) {
+	l := &Loop{u: &uploader{window: 1}, eid: 7, free: make(chan *buffer, 1), turn: make(chan struct{}, 1)}
+	b := &buffer{fb: &x11.Framebuffer{}, pixmap: 0x20, pending: 1}
+	l.buffers = []*buffer{b}
+
+	var frames []Frame
+	l.Presented = func(f Frame) { frames = append(frames, f) }
+
+	// A repaint on Expose does not count as a frame
+	l.Filter(&present.CompleteNotifyEvent{EventID: 7, Window: 1, Serial: 0})
+	if len(l.turn) != 0 || len(frames) != 0 {
+		t.Fatal("repaint completed a frame")
+	}
+	l.Filter(&present.CompleteNotifyEvent{EventID: 7, Window: 1, Serial: 3, UST: 1000, MSC: 60})
+	if len(l.turn) != 1 {
+		t.Error("Acquire not let through after CompleteNotify")
+	}
+	if len(frames) != 1 || frames[0] != (Frame{Serial: 3, UST: 1000, MSC: 60}) {
+		t.Errorf("frames = %+v", frames)
+	}
+
+	if handled, _ := l.Filter(&present.IdleNotifyEvent{EventID: 8, Pixmap: 0x20}); handled {
+		t.Error("handled another event context's IdleNotify")
+	}
+	l.Filter(&present.IdleNotifyEvent{EventID: 7, Window: 1, Pixmap: 0x20})
+	if fb, err := l.Acquire(context.Background()); err != nil || fb != b.fb {
+		t.Errorf("Acquire() = %p, %v, want the idle buffer", fb, err)
+	}
+}
+
+func TestMove(t *testing.T) {
+	visual := &x11.Visual{Class: x11.VISUAL_CLASS_TRUE_COLOR, RedMask: 0xff0000, GreenMask: 0x00ff00, BlueMask: 0x0000ff}
+	format := &x11.Format{Depth: 24, BitsPerPixel: 32, ScanlinePad: 32}
+	fb, err := x11.NewFramebuffer(make([]byte, format.Stride(3)*4), 3, 4, visual, 24, format, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := range 4 {
+		for x := range 3 {
+			fb.Set(x, y, color.RGBA{uint8(y), uint8(x), 0, 0xff})
+		}
+	}
+
+	// Scroll down by one row, over the rows it copies from
+	move(fb, image.Rect(0, 1, 3, 4), image.Pt(0, 0))
+	for y, want := range []uint8{0, 0, 1, 2} {
+		if r, _, _, _ := fb.At(1, y).RGBA(); uint8(r>>8) != want {
+			t.Errorf("row %d holds row %d, want %d", y, r>>8, want)
+		}
+	}
+
+	// And left by one column
+	move(fb, image.Rect(0, 0, 2, 4), image.Pt(1, 0))
+	if _, g, _, _ := fb.At(0, 2).RGBA(); g>>8 != 1 {
+		t.Errorf("column 0 holds column %d, want 1", g>>8)
+	}
+}
+
+func TestScrollUnsharedSegment(t *testing.T) {
+	visual := &x11.Visual{Class: x11.VISUAL_CLASS_TRUE_COLOR, RedMask: 0xff0000, GreenMask: 0x00ff00, BlueMask: 0x0000ff}
+	format := &x11.Format{Depth: 24, BitsPerPixel: 32, ScanlinePad: 32}
+	seg := &mitshm.Segment{ID: 5, Data: make([]byte, format.Stride(2)*4)}
+	fb, err := x11.NewFramebuffer(seg.Data, 2, 4, visual, 24, format, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := range 4 {
+		for x := range 2 {
+			fb.Set(x, y, color.RGBA{uint8(y), 0, 0, 0xff})
+		}
+	}
+	want := bytes.Clone(seg.Data)
+
+	// The server reads the segment of a ShmPutImage only by the time it
+	// handles the next request
+	var read []byte
+	pending := false
+	c := newShmConn(t, func(req []byte) []byte {
+		if req[0] == fakeShmOpcode && req[1] == mitshm.SHM_REQUEST_PUT_IMAGE {
+			pending = true
+		} else if pending {
+			read, pending = bytes.Clone(seg.Data), false
+		}
+		return nil
+	})
+	shm, err := mitshm.New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Surface{u: &uploader{c: c, window: 1, gc: 2, format: format, shm: shm}, fb: fb, seg: seg, pixmap: 3, scrollGC: 4}
+	s.damage.Add(fb.Rect)
+
+	if err := s.Scroll(fb.Rect, image.Pt(0, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(read, want) {
+		t.Errorf("server read % x, want % x", read, want)
+	}
+}
+
+func TestFlushFails(t *testing.T) {
+	s := xtest.NewServer(t)
+	s.MaxRequestLength = 16 // too short for a row of 10 pixels
+	c := s.Dial()
+	visual := &x11.Visual{Class: x11.VISUAL_CLASS_TRUE_COLOR, RedMask: 0xff0000, GreenMask: 0x00ff00, BlueMask: 0x0000ff}
+	format := &x11.Format{Depth: 24, BitsPerPixel: 32, ScanlinePad: 32}
+	fb, err := x11.NewFramebuffer(make([]byte, format.Stride(20)*4), 20, 4, visual, 24, format, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sf := &Surface{u: &uploader{c: c, window: 1, gc: 2, format: format}, fb: fb, pixmap: 3}
+	sent, unsent := image.Rect(0, 0, 2, 2), image.Rect(0, 2, 20, 4)
+	sf.Damage(sent)
+	sf.Damage(unsent)
+
+	if err := sf.Flush(); err == nil {
+		t.Fatal("Flush succeeded")
+	}
+	if rects := sf.damage.Rects(); !slices.Equal(rects, []image.Rectangle{unsent}) {
+		t.Errorf("damage = %v, want %v", rects, unsent)
+	}
+}
+
+func TestChainSegmentFails(t *testing.T) {
+	// The second segment fails, as when the server runs out of shared memory
+	var attached, detached int
+	c := newShmConn(t, func(req []byte) []byte {
+		if req[0] != fakeShmOpcode {
+			return nil
+		}
+		switch req[1] {
+		case mitshm.SHM_REQUEST_ATTACH:
+			if attached++; attached == 2 {
+				return xtest.Error(x11.X11_ERROR_BAD_ALLOC, 0, fakeShmOpcode)
+			}
+		case mitshm.SHM_REQUEST_DETACH:
+			detached++
+		}
+		return nil
+	})
+	w, err := c.CreateWindow(xtest.Root, 4, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain, err := NewChain(w, 4, 4, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer chain.Close()
+	if err := c.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if chain.Shared() || attached != 2 || detached != 1 {
+		t.Errorf("Shared() = %v after %d attaches and %d detaches, want false, 2 and 1", chain.Shared(), attached, detached)
+	}
+
+	// Every buffer is uploaded with core PutImage
+	for range 3 {
+		fb, ok := chain.TryAcquire()
+		if !ok {
+			t.Fatal("no free buffer")
+		}
+		if err := chain.Present(fb); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
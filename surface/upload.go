@@ -0,0 +1,121 @@
+package surface
+
+import (
+	"image"
+
+	"github.com/dzeromsk/helloX11/mitshm"
+	"github.com/dzeromsk/helloX11/x11"
+)
+
+// uploader sends framebuffers to a window, with MIT-SHM when the server can
+// access the client's shared memory and core PutImage otherwise.
+type uploader struct {
+	c      *x11.Conn
+	window uint32
+	gc     uint32
+	format *x11.Format
+	shm    *mitshm.Shm // nil without MIT-SHM
+
+	buf []byte // rows of partial-width core uploads
+}
+
+func newUploader(w *x11.Window) (*uploader, error) {
+	c := w.Conn()
+	// No NoExposure events for copies from the back buffer
+	gc, err := c.CreateGC(w.ID, x11.X11_GC_FLAG_GRAPHICS_EXPOSURES, 0)
+	if err != nil {
+		return nil, err
+	}
+	u := &uploader{
+		c:      c,
+		window: w.ID,
+		gc:     gc,
+		format: c.Setup().Format(c.Screen().RootDepth),
+	}
+	if u.shm, err = mitshm.New(c); err != nil {
+		u.fallback()
+	}
+	return u, nil
+}
+
+// fallback switches to core PutImage. It is called before any framebuffer
+// in a segment is used, as all of them must be uploaded the same way.
+func (u *uploader) fallback() {
+	u.shm = nil
+	// Larger strips, if the server allows them
+	u.c.EnableBigRequests()
+}
+
+// alloc returns a width × height framebuffer, in a segment shared with the
+// server when using MIT-SHM. The segment is nil otherwise. It fails if the
+// server cannot attach a segment, as when it is remote or out of shared
+// memory.
+func (u *uploader) alloc(width, height int) (*x11.Framebuffer, *mitshm.Segment, error) {
+	size := u.c.FramebufferSize(width, height)
+	var (
+		seg *mitshm.Segment
+		pix []byte
+	)
+	if u.shm != nil {
+		var err error
+		if seg, err = u.shm.NewSegment(size); err != nil {
+			return nil, nil, err
+		}
+		pix = seg.Data
+	} else {
+		pix = make([]byte, size)
+	}
+	fb, err := u.c.NewFramebuffer(pix, width, height)
+	if err != nil {
+		if seg != nil {
+			seg.Close()
+		}
+		return nil, nil, err
+	}
+	return fb, seg, nil
+}
+
+// put copies the part r of fb to drawable at dst. Fb is stored in seg,
+// unless seg is nil. With sendEvent, the server reports a Completion event
+// once it no longer reads the segment.
+func (u *uploader) put(drawable uint32, fb *x11.Framebuffer, seg *mitshm.Segment, r image.Rectangle, dst image.Point, sendEvent bool) error {
+	if seg != nil {
+		img := mitshm.Image{
+			Segment: seg.ID,
+			Width:   uint16(fb.Stride * 8 / fb.BitsPerPixel),
+			Height:  uint16(fb.Rect.Dy()),
+			Depth:   fb.Depth,
+			Format:  x11.X11_IMAGE_FORMAT_Z_PIXMAP,
+		}
+		return u.shm.PutImage(drawable, u.gc, img,
+			uint16(r.Min.X), uint16(r.Min.Y), uint16(r.Dx()), uint16(r.Dy()),
+			int16(dst.X), int16(dst.Y), sendEvent)
+	}
+
+	// Core PutImage takes whole scanlines, padded for the image's width.
+	data, stride := fb.Pix[fb.PixOffset(r.Min.X, r.Min.Y):], fb.Stride
+	if r.Dx() != fb.Rect.Dx() {
+		data, stride = u.rows(fb, r)
+	}
+	return u.c.PutImage(x11.X11_IMAGE_FORMAT_Z_PIXMAP, drawable, u.gc, fb.Depth,
+		uint16(r.Dx()), uint16(r.Dy()), int16(dst.X), int16(dst.Y), stride, data)
+}
+
+// rows copies the part r of fb into scanlines of their own.
+func (u *uploader) rows(fb *x11.Framebuffer, r image.Rectangle) ([]byte, int) {
+	stride := u.format.Stride(r.Dx())
+	n := r.Dx() * fb.BitsPerPixel / 8
+	if need := stride * r.Dy(); cap(u.buf) < need {
+		u.buf = make([]byte, need)
+	}
+	buf := u.buf[:stride*r.Dy()]
+	for y := range r.Dy() {
+		i := fb.PixOffset(r.Min.X, r.Min.Y+y)
+		copy(buf[y*stride:y*stride+n], fb.Pix[i:i+n])
+	}
+	return buf, stride
+}
+
+func (u *uploader) close() error {
+	return u.c.FreeGC(u.gc)
+}
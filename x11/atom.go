@@ -0,0 +1,120 @@
+package x11
+
+import (
+	"sync"
+
+	"github.com/dzeromsk/helloX11/x11byte"
+)
+
+type atomCache struct {
+	mu    sync.Mutex
+	atoms map[string]uint32
+	names map[uint32]string
+}
+
+func (a *atomCache) lookup(name string) (uint32, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	atom, ok := a.atoms[name]
+	return atom, ok
+}
+
+func (a *atomCache) store(name string, atom uint32) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.atoms == nil {
+		a.atoms = make(map[string]uint32)
+		a.names = make(map[uint32]string)
+	}
+	a.atoms[name] = atom
+	a.names[atom] = name
+}
+
+func (a *atomCache) name(atom uint32) (string, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	name, ok := a.names[atom]
+	return name, ok
+}
+
+// Atom returns the atom for name, interning it if necessary. Results are
+// cached for the lifetime of the connection.
+func (c *Conn) Atom(name string) (uint32, error) {
+	atoms, err := c.Atoms(name)
+	if err != nil {
+		return 0, err
+	}
+	return atoms[0], nil
+}
+
+// Atoms interns several atoms with a single round trip.
+func (c *Conn) Atoms(names ...string) ([]uint32, error) {
+	atoms := make([]uint32, len(names))
+	cookies := make([]*Cookie, len(names))
+	for i, name := range names {
+		if atom, ok := c.atoms.lookup(name); ok {
+			atoms[i] = atom
+			continue
+		}
+
+		var b x11byte.Builder
+		b.AddUint8(X11_REQUEST_INTERN_ATOM)      // opcode
+		b.AddUint8(0)                            // onlyIfExists
+		b.AddUint16(uint16(2 + (len(name)+3)/4)) // requestLength
+		b.AddUint16(uint16(len(name)))           // nameLength
+		b.AddUint16(0)                           // unused
+		b.AddBytes([]byte(name))                 // name
+		b.AddBytes(make([]byte, pad(len(name)))) // padding
+		cookies[i] = c.SendRequest(b.BytesOrPanic())
+	}
+
+	for i, ck := range cookies {
+		if ck == nil {
+			continue
+		}
+		reply, err := ck.Reply()
+		if err != nil {
+			return nil, err
+		}
+		reply.Skip(1) // reply
+		reply.Skip(1) // unused
+		reply.Skip(2) // sequenceNumber
+		reply.Skip(4) // replyLength
+		reply.ReadUint32(&atoms[i])
+		c.atoms.store(names[i], atoms[i])
+	}
+	return atoms, nil
+}
+
+// AtomName returns the name of an atom.
+func (c *Conn) AtomName(atom uint32) (string, error) {
+	if name, ok := c.atoms.name(atom); ok {
+		return name, nil
+	}
+
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_GET_ATOM_NAME) // opcode
+	b.AddUint8(0)                         // unused
+	b.AddUint16(2)                        // requestLength
+	b.AddUint32(atom)                     // atom
+
+	reply, err := c.Request(b.BytesOrPanic())
+	if err != nil {
+		return "", err
+	}
+
+	var (
+		nameLength uint16
+		name       []byte
+	)
+	reply.Skip(1) // reply
+	reply.Skip(1) // unused
+	reply.Skip(2) // sequenceNumber
+	reply.Skip(4) // replyLength
+	reply.ReadUint16(&nameLength)
+	reply.Skip(22) // unused
+	reply.ReadBytes(&name, int(nameLength))
+
+	c.atoms.store(string(name), atom)
+	return string(name), nil
+}
@@ -0,0 +1,37 @@
+package x11
+
+import "github.com/dzeromsk/helloX11/x11byte"
+
+// EnableBigRequests enables the BIG-REQUESTS extension, raising
+// MaxRequestLength from 256KiB to whatever the server allows, usually 16MiB.
+// Requests longer than the core limit are then encoded automatically.
+func (c *Conn) EnableBigRequests() error {
+	if c.bigRequestLength.Load() != 0 {
+		return nil
+	}
+
+	ext, err := c.RequireExtension("BIG-REQUESTS")
+	if err != nil {
+		return err
+	}
+
+	var b x11byte.Builder
+	b.AddUint8(ext.MajorOpcode) // opcode
+	b.AddUint8(0)               // extension-minor, Enable
+	b.AddUint16(1)              // requestLength
+
+	reply, err := c.Request(b.BytesOrPanic())
+	if err != nil {
+		return err
+	}
+
+	var maximumRequestLength uint32
+	reply.Skip(1) // reply
+	reply.Skip(1) // unused
+	reply.Skip(2) // sequenceNumber
+	reply.Skip(4) // replyLength
+	reply.ReadUint32(&maximumRequestLength)
+
+	c.bigRequestLength.Store(maximumRequestLength)
+	return nil
+}
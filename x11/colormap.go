@@ -0,0 +1,183 @@
+package x11
+
+import (
+	"errors"
+	"image/color"
+
+	"github.com/dzeromsk/helloX11/x11byte"
+)
+
+var errColormapFull = errors.New("x11: no room for a color cube in the colormap")
+
+// AllocColor allocates a read-only entry for the closest color the
+// colormap's visual can show, with 16-bit channels, and returns its pixel
+// and the color actually stored.
+func (c *Conn) AllocColor(cmap uint32, red, green, blue uint16) (uint32, color.RGBA64, error) {
+	return c.allocColor(cmap, red, green, blue).reply()
+}
+
+type allocColorCookie struct{ *Cookie }
+
+func (c *Conn) allocColor(cmap uint32, red, green, blue uint16) allocColorCookie {
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_ALLOC_COLOR) // opcode
+	b.AddUint8(0)                       // unused
+	b.AddUint16(4)                      // requestLength
+	b.AddUint32(cmap)                   // cmap
+	b.AddUint16(red)                    // red
+	b.AddUint16(green)                  // green
+	b.AddUint16(blue)                   // blue
+	b.AddUint16(0)                      // unused
+	return allocColorCookie{c.SendRequest(b.BytesOrPanic())}
+}
+
+func (ck allocColorCookie) reply() (uint32, color.RGBA64, error) {
+	reply, err := ck.Reply()
+	if err != nil {
+		return 0, color.RGBA64{}, err
+	}
+
+	var (
+		pixel uint32
+		rgb   = color.RGBA64{A: 0xffff}
+	)
+	reply.Skip(1) // reply
+	reply.Skip(1) // unused
+	reply.Skip(2) // sequenceNumber
+	reply.Skip(4) // replyLength
+	reply.ReadUint16(&rgb.R)
+	reply.ReadUint16(&rgb.G)
+	reply.ReadUint16(&rgb.B)
+	reply.Skip(2) // unused
+	reply.ReadUint32(&pixel)
+	return pixel, rgb, nil
+}
+
+// FreeColors frees colormap entries allocated with AllocColor.
+func (c *Conn) FreeColors(cmap, planeMask uint32, pixels ...uint32) error {
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_FREE_COLORS)  // opcode
+	b.AddUint8(0)                        // unused
+	b.AddUint16(uint16(3 + len(pixels))) // requestLength
+	b.AddUint32(cmap)                    // cmap
+	b.AddUint32(planeMask)               // planeMask
+	for _, p := range pixels {
+		b.AddUint32(p) // pixels
+	}
+	return c.Send(b.BytesOrPanic())
+}
+
+// QueryColors returns the colors stored in cmap for pixels, with 16-bit
+// channels.
+func (c *Conn) QueryColors(cmap uint32, pixels ...uint32) ([]color.RGBA64, error) {
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_QUERY_COLORS) // opcode
+	b.AddUint8(0)                        // unused
+	b.AddUint16(uint16(2 + len(pixels))) // requestLength
+	b.AddUint32(cmap)                    // cmap
+	for _, p := range pixels {
+		b.AddUint32(p) // pixels
+	}
+
+	reply, err := c.Request(b.BytesOrPanic())
+	if err != nil {
+		return nil, err
+	}
+
+	var n uint16
+	reply.Skip(1) // reply
+	reply.Skip(1) // unused
+	reply.Skip(2) // sequenceNumber
+	reply.Skip(4) // replyLength
+	reply.ReadUint16(&n)
+	reply.Skip(22) // unused
+	colors := make([]color.RGBA64, n)
+	for i := range colors {
+		colors[i].A = 0xffff
+		reply.ReadUint16(&colors[i].R)
+		reply.ReadUint16(&colors[i].G)
+		reply.ReadUint16(&colors[i].B)
+		reply.Skip(2) // unused
+	}
+	return colors, nil
+}
+
+// ColorCube is a grid of Levels × Levels × Levels colors allocated in a
+// colormap, which framebuffers for PseudoColor visuals draw with.
+type ColorCube struct {
+	Colormap uint32
+	Levels   int
+	// Pixels holds the pixel of red level r, green level g and blue level
+	// b at index (r*Levels+g)*Levels+b.
+	Pixels []uint32
+
+	colors map[uint32]color.RGBA // the colors actually stored, by pixel
+}
+
+// AllocColorCube allocates a color cube in cmap with as many levels per
+// channel as fit, up to levels, and at least two.
+func (c *Conn) AllocColorCube(cmap uint32, levels int) (*ColorCube, error) {
+	for ; levels >= 2; levels-- {
+		cube, err := c.allocColorCube(cmap, levels)
+		if err == nil {
+			return cube, nil
+		}
+		if xerr, ok := err.(*Error); !ok || xerr.Code != X11_ERROR_BAD_ALLOC {
+			return nil, err
+		}
+	}
+	return nil, errColormapFull
+}
+
+func (c *Conn) allocColorCube(cmap uint32, levels int) (*ColorCube, error) {
+	// All requests in flight at once, rather than a round trip per color
+	cookies := make([]allocColorCookie, 0, levels*levels*levels)
+	for r := range levels {
+		for g := range levels {
+			for b := range levels {
+				cookies = append(cookies, c.allocColor(cmap, cubeLevel(r, levels), cubeLevel(g, levels), cubeLevel(b, levels)))
+			}
+		}
+	}
+
+	cube := &ColorCube{Colormap: cmap, Levels: levels, colors: make(map[uint32]color.RGBA)}
+	var firstErr error
+	for _, ck := range cookies {
+		pixel, rgb, err := ck.reply()
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		cube.Pixels = append(cube.Pixels, pixel)
+		cube.colors[pixel] = color.RGBA{uint8(rgb.R >> 8), uint8(rgb.G >> 8), uint8(rgb.B >> 8), 0xff}
+	}
+	if firstErr != nil {
+		c.FreeColors(cmap, 0, cube.Pixels...)
+		return nil, firstErr
+	}
+	return cube, nil
+}
+
+// cubeLevel returns the 16-bit intensity of level i out of n.
+func cubeLevel(i, n int) uint16 {
+	return uint16(i * 0xffff / (n - 1))
+}
+
+// DefaultColorCube returns a color cube in the default colormap of the
+// screen, allocated on first use and shared by all framebuffers of the
+// connection.
+func (c *Conn) DefaultColorCube() (*ColorCube, error) {
+	c.cubemu.Lock()
+	defer c.cubemu.Unlock()
+	if c.cube != nil {
+		return c.cube, nil
+	}
+	cube, err := c.AllocColorCube(c.Screen().DefaultColormap, 6)
+	if err != nil {
+		return nil, err
+	}
+	c.cube = cube
+	return cube, nil
+}
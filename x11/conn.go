@@ -0,0 +1,517 @@
+// Package x11 speaks the X11 core protocol directly over a UNIX or TCP socket,
+// without going through Xlib or XCB.
+package x11
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dzeromsk/helloX11/x11byte"
+)
+
+var (
+	errClosed            = errors.New("x11: connection closed")
+	errNoReply           = errors.New("x11: request produced no reply")
+	errRequestTooLong    = errors.New("x11: request exceeds maximum request length")
+	errInvalidDisplay    = errors.New("x11: invalid display name")
+	errResourceExhausted = errors.New("x11: resource ids exhausted")
+)
+
+// Conn is a connection to an X server.
+//
+// Requests may be sent from any goroutine. A background goroutine reads
+// everything the server sends, hands replies to the Cookie that is waiting for
+// them and queues events and errors for WaitForEvent and PollForEvent.
+type Conn struct {
+	conn   net.Conn
+	setup  *Setup
+	screen int
+
+	wmu sync.Mutex    // serializes writes
+	seq atomic.Uint32 // sequence number of the last request written
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending []*Cookie // cookies waiting for completion, in sequence order
+	events  []Event
+	fds     []int // received file descriptors, for the replies that carry them
+	err     error
+
+	idmu   sync.Mutex
+	lastID uint32
+
+	atoms atomCache
+
+	bigRequestLength atomic.Uint32 // set once BIG-REQUESTS is enabled
+
+	extmu      sync.Mutex
+	extensions map[string]*Extension
+
+	cubemu sync.Mutex
+	cube   *ColorCube // allocated in the default colormap by DefaultColorCube
+
+	decmu           sync.Mutex
+	eventDecoders   map[uint8]func(x11byte.String) Event
+	genericDecoders map[uint8]func(x11byte.String) Event
+}
+
+// Dial connects to the X server named by display, in the same format as the
+// DISPLAY environment variable (for example ":0", "unix:1" or
+// "127.0.0.1:0.0"). An empty display uses $DISPLAY, or ":0" if that is not
+// set either.
+func Dial(display string) (*Conn, error) {
+	if display == "" {
+		display = os.Getenv("DISPLAY")
+	}
+	if display == "" {
+		display = ":0"
+	}
+	network, address, screen, err := parseDisplay(display)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+	c, err := NewConn(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if screen >= len(c.setup.Screens) {
+		c.Close()
+		return nil, fmt.Errorf("x11: screen %d does not exist", screen)
+	}
+	c.screen = screen
+	return c, nil
+}
+
+func parseDisplay(display string) (network, address string, screen int, err error) {
+	i := strings.LastIndexByte(display, ':')
+	if i < 0 {
+		return "", "", 0, errInvalidDisplay
+	}
+	host, rest := display[:i], display[i+1:]
+	number, screenStr, _ := strings.Cut(rest, ".")
+	n, err := strconv.Atoi(number)
+	if err != nil {
+		return "", "", 0, errInvalidDisplay
+	}
+	if screenStr != "" {
+		if screen, err = strconv.Atoi(screenStr); err != nil {
+			return "", "", 0, errInvalidDisplay
+		}
+	}
+	if host == "" || host == "unix" {
+		return "unix", "/tmp/.X11-unix/X" + number, screen, nil
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	return "tcp", net.JoinHostPort(host, strconv.Itoa(6000+n)), screen, nil
+}
+
+// NewConn performs the connection setup on an already established stream and
+// starts reading from it.
+func NewConn(conn net.Conn) (*Conn, error) {
+	setup, err := authenticate(conn)
+	if err != nil {
+		return nil, err
+	}
+	c := &Conn{
+		conn:            conn,
+		setup:           setup,
+		extensions:      make(map[string]*Extension),
+		eventDecoders:   make(map[uint8]func(x11byte.String) Event),
+		genericDecoders: make(map[uint8]func(x11byte.String) Event),
+	}
+	c.cond = sync.NewCond(&c.mu)
+	var r io.Reader = conn
+	if uc, ok := conn.(*net.UnixConn); ok {
+		r = &fdReader{conn: uc, c: c}
+	}
+	go c.readLoop(bufio.NewReader(r))
+	return c, nil
+}
+
+// Close closes the connection. Resources created by the client are freed by
+// the server.
+func (c *Conn) Close() error {
+	err := c.conn.Close()
+	c.mu.Lock()
+	c.closeFds()
+	c.mu.Unlock()
+	return err
+}
+
+// Setup returns the connection setup information.
+func (c *Conn) Setup() *Setup {
+	return c.setup
+}
+
+// Screen returns the screen selected when the connection was opened.
+func (c *Conn) Screen() *Screen {
+	return &c.setup.Screens[c.screen]
+}
+
+// NewID allocates a new resource id for windows, pixmaps, GCs and the like.
+func (c *Conn) NewID() (uint32, error) {
+	c.idmu.Lock()
+	defer c.idmu.Unlock()
+
+	mask := c.setup.ResourceIDMask
+	inc := mask & -mask
+	if c.lastID > mask-inc {
+		return 0, errResourceExhausted
+	}
+	id := c.lastID | c.setup.ResourceIDBase
+	c.lastID += inc
+	return id, nil
+}
+
+// MaxRequestLength returns the largest request the server accepts, in bytes.
+// It grows once EnableBigRequests succeeds.
+func (c *Conn) MaxRequestLength() int {
+	if length := c.bigRequestLength.Load(); length != 0 {
+		return int(length) * 4
+	}
+	return int(c.setup.MaximumRequestLength) * 4
+}
+
+// A Cookie tracks a request that is waiting for its reply or error.
+type Cookie struct {
+	seq   uint32
+	reply bool
+	nfds  int // file descriptors carried by the reply
+	done  chan struct{}
+	data  x11byte.String
+	fds   []int
+	err   error
+}
+
+// Reply blocks until the server answers the request and returns the reply
+// data, starting with the 32-byte reply header. X errors are returned as
+// *Error.
+func (ck *Cookie) Reply() (x11byte.String, error) {
+	<-ck.done
+	return ck.data, ck.err
+}
+
+// Send writes a request that has no reply. Errors caused by the request are
+// delivered as *Error events.
+//
+// The request length field is filled in by Send, so requests may be built
+// with any value in it.
+func (c *Conn) Send(req []byte) error {
+	_, err := c.send(req, nil, nil)
+	return err
+}
+
+// SendRequest writes a request that generates a reply and returns a cookie
+// to wait for it, so several requests can be in flight at once.
+func (c *Conn) SendRequest(req []byte) *Cookie {
+	ck, err := c.send(req, nil, &Cookie{reply: true})
+	if err != nil {
+		ck = &Cookie{done: make(chan struct{}), err: err}
+		close(ck.done)
+	}
+	return ck
+}
+
+// Request writes a request that generates a reply and waits for it.
+func (c *Conn) Request(req []byte) (x11byte.String, error) {
+	return c.SendRequest(req).Reply()
+}
+
+// RequestFds is like Request for requests whose reply carries nfds file
+// descriptors, which the caller must close.
+func (c *Conn) RequestFds(req []byte, nfds int) (x11byte.String, []int, error) {
+	ck, err := c.send(req, nil, &Cookie{reply: true, nfds: nfds})
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := ck.Reply()
+	return data, ck.fds, err
+}
+
+// SendChecked writes a request that has no reply and waits until the server
+// has processed it, returning the error it caused, if any.
+func (c *Conn) SendChecked(req []byte) error {
+	return c.SendCheckedFds(req)
+}
+
+// SendCheckedFds is like SendChecked, passing the file descriptors fds
+// along with the request. The server receives duplicates, the caller still
+// owns fds. It needs a UNIX socket, see FdPassing.
+func (c *Conn) SendCheckedFds(req []byte, fds ...int) error {
+	ck, err := c.send(req, fds, &Cookie{})
+	if err != nil {
+		return err
+	}
+	if err := c.Sync(); err != nil {
+		return err
+	}
+	_, err = ck.Reply()
+	return err
+}
+
+// Sync waits until the server has processed every request sent so far.
+func (c *Conn) Sync() error {
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_GET_INPUT_FOCUS) // opcode
+	b.AddUint8(0)                           // unused
+	b.AddUint16(1)                          // requestLength
+	_, err := c.Request(b.BytesOrPanic())
+	return err
+}
+
+// send writes req with fds. Unless ck is nil, it is set up to track the
+// request and returned.
+func (c *Conn) send(req []byte, fds []int, ck *Cookie) (*Cookie, error) {
+	if len(req) < 4 || len(req)%4 != 0 {
+		return nil, fmt.Errorf("x11: malformed request of %d bytes", len(req))
+	}
+	if len(fds) > 0 && !c.FdPassing() {
+		return nil, errNoFdPassing
+	}
+	size := len(req)
+	if size/4 > 0xffff {
+		size += 4 // BIG-REQUESTS length
+	}
+	if size > c.MaxRequestLength() {
+		return nil, errRequestTooLong
+	}
+	if length := len(req) / 4; length > 0xffff {
+		// BIG-REQUESTS encoding: a zero length followed by the real
+		// length, which counts the extra 4 bytes
+		big := make([]byte, 0, len(req)+4)
+		big = append(big, req[0], req[1], 0, 0)
+		big = append(big, byte(length+1), byte((length+1)>>8), byte((length+1)>>16), byte((length+1)>>24))
+		req = append(big, req[4:]...)
+	} else {
+		req[2], req[3] = byte(length), byte(length>>8)
+	}
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	seq := c.seq.Add(1)
+	if ck != nil {
+		ck.seq, ck.done = seq, make(chan struct{})
+		c.mu.Lock()
+		if c.err != nil {
+			c.mu.Unlock()
+			return nil, c.err
+		}
+		c.pending = append(c.pending, ck)
+		c.mu.Unlock()
+	}
+	if err := c.write(req, fds); err != nil {
+		return nil, err
+	}
+	return ck, nil
+}
+
+func (c *Conn) readLoop(r io.Reader) {
+	for {
+		buf := make([]byte, 32)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			c.fail(err)
+			return
+		}
+		code := buf[0] & 0x7f
+		if code == 1 || code == X11_EVENT_GENERIC_EVENT {
+			length := uint32(buf[4]) | uint32(buf[5])<<8 | uint32(buf[6])<<16 | uint32(buf[7])<<24
+			if length > 0 {
+				buf = append(buf, make([]byte, length*4)...)
+				if _, err := io.ReadFull(r, buf[32:]); err != nil {
+					c.fail(err)
+					return
+				}
+			}
+		}
+
+		switch code {
+		case 0:
+			e := decodeError(buf)
+			if !c.complete(e.Sequence, nil, e) {
+				c.queue(e)
+			}
+		case 1:
+			seq := uint16(buf[2]) | uint16(buf[3])<<8
+			c.complete(seq, buf, nil)
+		default:
+			if code != 11 { // KeymapNotify carries no sequence number
+				c.complete(uint16(buf[2])|uint16(buf[3])<<8, nil, nil)
+			}
+			c.queue(c.decodeEvent(buf))
+		}
+	}
+}
+
+// complete finishes the pending cookies up to the given sequence number and
+// reports whether one of them was waiting for exactly that request.
+func (c *Conn) complete(seq uint16, data []byte, err error) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	full := c.widen(seq)
+	found := false
+	for len(c.pending) > 0 {
+		ck := c.pending[0]
+		if ck.seq > full {
+			break
+		}
+		if ck.seq == full {
+			if data == nil && err == nil {
+				// an event carrying the sequence number of a request that
+				// is still waiting for its reply
+				break
+			}
+			ck.data, ck.err = data, err
+			if data != nil && ck.nfds > 0 {
+				ck.fds = c.claimFds(data, ck.nfds)
+			}
+			found = true
+		} else if ck.reply {
+			ck.err = errNoReply
+		}
+		c.pending = c.pending[1:]
+		close(ck.done)
+	}
+	return found
+}
+
+// widen extends a 16-bit sequence number from the wire to the full sequence
+// number of the request it refers to.
+func (c *Conn) widen(seq uint16) uint32 {
+	last := c.seq.Load()
+	full := last&^0xffff | uint32(seq)
+	if full > last {
+		full -= 0x10000
+	}
+	return full
+}
+
+func (c *Conn) queue(ev Event) {
+	c.mu.Lock()
+	c.events = append(c.events, ev)
+	c.mu.Unlock()
+	c.cond.Broadcast()
+}
+
+func (c *Conn) fail(err error) {
+	if errors.Is(err, net.ErrClosed) || err == io.EOF {
+		err = errClosed
+	}
+	c.mu.Lock()
+	c.err = err
+	for _, ck := range c.pending {
+		ck.err = err
+		close(ck.done)
+	}
+	c.pending = nil
+	c.closeFds() // no reply is left to claim them
+	c.mu.Unlock()
+	c.cond.Broadcast()
+}
+
+// WaitForEvent blocks until an event or error arrives. X protocol errors
+// caused by requests sent with Send are returned as *Error events; the error
+// result reports a broken connection.
+func (c *Conn) WaitForEvent() (Event, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.events) == 0 && c.err == nil {
+		c.cond.Wait()
+	}
+	if len(c.events) == 0 {
+		return nil, c.err
+	}
+	ev := c.events[0]
+	c.events = c.events[1:]
+	return ev, nil
+}
+
+// PollForEvent returns the next queued event without blocking, or nil if
+// there is none.
+func (c *Conn) PollForEvent() (Event, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.events) == 0 {
+		return nil, c.err
+	}
+	ev := c.events[0]
+	c.events = c.events[1:]
+	return ev, nil
+}
+
+// PeekEvent returns the next queued event without removing it from the
+// queue, or nil if there is none.
+func (c *Conn) PeekEvent() Event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.events) == 0 {
+		return nil
+	}
+	return c.events[0]
+}
+
+// PeekEventWithin is like PeekEvent, but waits up to d for an event when
+// none is queued, as events the server sent together may still be on
+// their way.
+func (c *Conn) PeekEventWithin(d time.Duration) Event {
+	deadline := time.Now().Add(d)
+	t := time.AfterFunc(d, func() {
+		c.mu.Lock()
+		c.cond.Broadcast()
+		c.mu.Unlock()
+	})
+	defer t.Stop()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.events) == 0 && c.err == nil && time.Now().Before(deadline) {
+		c.cond.Wait()
+	}
+	if len(c.events) == 0 {
+		return nil
+	}
+	return c.events[0]
+}
+
+// FindEventWithin returns the first queued event for which match reports
+// true, leaving it in the queue, and waits up to d for one to be queued.
+// It returns nil if none was. Match is called with the queue locked and
+// must not use c.
+func (c *Conn) FindEventWithin(d time.Duration, match func(Event) bool) Event {
+	deadline := time.Now().Add(d)
+	t := time.AfterFunc(d, func() {
+		c.mu.Lock()
+		c.cond.Broadcast()
+		c.mu.Unlock()
+	})
+	defer t.Stop()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for seen := 0; ; {
+		for ; seen < len(c.events); seen++ {
+			if match(c.events[seen]) {
+				return c.events[seen]
+			}
+		}
+		if c.err != nil || !time.Now().Before(deadline) {
+			return nil
+		}
+		c.cond.Wait()
+	}
+}
@@ -0,0 +1,323 @@
+package x11
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/dzeromsk/helloX11/x11byte"
+)
+
+// fakeServer is the server end of a Conn created by newTestConn.
+type fakeServer struct {
+	t    *testing.T
+	conn net.Conn
+	seq  uint16
+}
+
+func testSetup() []byte {
+	var b x11byte.Builder
+	b.AddUint32(0)          // releaseNumber
+	b.AddUint32(0x00400000) // resourceIDBase
+	b.AddUint32(0x001fffff) // resourceIDMask
+	b.AddUint32(0)          // motionBufferSize
+	b.AddUint16(4)          // lengthOfVendor
+	b.AddUint16(0xffff)     // maximumRequestLength
+	b.AddUint8(1)           // numberOfScreensInRoot
+	b.AddUint8(1)           // numberOfFormats
+	b.AddUint8(0)           // imageByteOrder
+	b.AddUint8(0)           // bitmapFormatBitOrder
+	b.AddUint8(32)          // bitmapFormatScanlineUnit
+	b.AddUint8(32)          // bitmapFormatScanlinePad
+	b.AddUint8(8)           // minKeycode
+	b.AddUint8(255)         // maxKeyCode
+	b.AddUint32(0)          // unused
+	b.AddBytes([]byte("test"))
+
+	b.AddUint8(24)              // depth
+	b.AddUint8(32)              // bitsPerPixel
+	b.AddUint8(32)              // scanlinePad
+	b.AddBytes(make([]byte, 5)) // unused
+
+	b.AddUint32(0x123)    // root
+	b.AddUint32(0x20)     // defaultColormap
+	b.AddUint32(0xffffff) // whitePixel
+	b.AddUint32(0)        // blackPixel
+	b.AddUint32(0)        // currentInputMask
+	b.AddUint16(1920)     // widthInPixels
+	b.AddUint16(1080)     // heightInPixels
+	b.AddUint16(508)      // widthInMillimeters
+	b.AddUint16(285)      // heightInMillimeters
+	b.AddUint16(1)        // minInstalledMaps
+	b.AddUint16(1)        // maxInstalledMaps
+	b.AddUint32(0x21)     // rootVisual
+	b.AddUint8(0)         // backingStores
+	b.AddUint8(0)         // saveUnders
+	b.AddUint8(24)        // rootDepth
+	b.AddUint8(1)         // allowedDepthsLen
+
+	b.AddUint8(24) // depth
+	b.AddUint8(0)  // unused
+	b.AddUint16(1) // visualsLen
+	b.AddUint32(0) // unused
+
+	b.AddUint32(0x21)     // visualID
+	b.AddUint8(4)         // class, TrueColor
+	b.AddUint8(8)         // bitsPerRGBValue
+	b.AddUint16(256)      // colormapEntries
+	b.AddUint32(0xff0000) // redMask
+	b.AddUint32(0x00ff00) // greenMask
+	b.AddUint32(0x0000ff) // blueMask
+	b.AddUint32(0)        // unused
+
+	body := b.BytesOrPanic()
+
+	var h x11byte.Builder
+	h.AddUint8(1)                      // status
+	h.AddUint8(0)                      // unused
+	h.AddUint16(11)                    // majorVersion
+	h.AddUint16(0)                     // minorVersion
+	h.AddUint16(uint16(len(body) / 4)) // replyLength
+	h.AddBytes(body)
+	return h.BytesOrPanic()
+}
+
+func newTestConn(t *testing.T) (*Conn, *fakeServer) {
+	t.Helper()
+	client, server := net.Pipe()
+	s := &fakeServer{t: t, conn: server}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		io.ReadFull(server, make([]byte, 12))
+		server.Write(testSetup())
+	}()
+
+	c, err := NewConn(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	t.Cleanup(func() {
+		c.Close()
+		server.Close()
+	})
+	return c, s
+}
+
+// readRequest reads the next request sent by the client.
+func (s *fakeServer) readRequest() x11byte.String {
+	s.t.Helper()
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(s.conn, header); err != nil {
+		s.t.Fatal(err)
+	}
+	length := int(header[2]) | int(header[3])<<8
+	req := make([]byte, length*4)
+	copy(req, header)
+	if _, err := io.ReadFull(s.conn, req[4:]); err != nil {
+		s.t.Fatal(err)
+	}
+	s.seq++
+	return req
+}
+
+// reply answers the last request read with a reply carrying body after the
+// 8-byte header.
+func (s *fakeServer) reply(data uint8, body []byte) {
+	s.t.Helper()
+	if len(body) < 24 {
+		body = append(body, make([]byte, 24-len(body))...)
+	}
+	var b x11byte.Builder
+	b.AddUint8(1)                             // reply
+	b.AddUint8(data)                          // data
+	b.AddUint16(s.seq)                        // sequenceNumber
+	b.AddUint32(uint32((len(body) - 24) / 4)) // replyLength
+	b.AddBytes(body)
+	s.write(b.BytesOrPanic())
+}
+
+func (s *fakeServer) write(data []byte) {
+	s.t.Helper()
+	if _, err := s.conn.Write(data); err != nil {
+		s.t.Fatal(err)
+	}
+}
+
+func TestSetup(t *testing.T) {
+	c, _ := newTestConn(t)
+	setup := c.Setup()
+	if setup.Vendor != "test" || setup.MinKeycode != 8 || setup.MaxKeycode != 255 {
+		t.Errorf("setup = %+v", setup)
+	}
+	screen := c.Screen()
+	if screen.Root != 0x123 || screen.WidthInPixels != 1920 || screen.RootDepth != 24 {
+		t.Errorf("screen = %+v", screen)
+	}
+	v, depth := screen.Visual(screen.RootVisual)
+	if v == nil || depth != 24 || v.RedMask != 0xff0000 {
+		t.Errorf("Visual() = %+v, %d", v, depth)
+	}
+	if f := setup.Format(24); f == nil || f.BitsPerPixel != 32 {
+		t.Errorf("Format(24) = %+v", f)
+	}
+}
+
+func TestNewID(t *testing.T) {
+	c, _ := newTestConn(t)
+	for _, want := range []uint32{0x00400000, 0x00400001, 0x00400002} {
+		got, err := c.NewID()
+		if err != nil || got != want {
+			t.Errorf("NewID() = %#x, %v, want %#x", got, err, want)
+		}
+	}
+}
+
+func TestParseDisplay(t *testing.T) {
+	for _, tt := range []struct {
+		display, network, address string
+		screen                    int
+	}{
+		{":0", "unix", "/tmp/.X11-unix/X0", 0},
+		{"unix:1.1", "unix", "/tmp/.X11-unix/X1", 1},
+		{"127.0.0.1:2", "tcp", "127.0.0.1:6002", 0},
+		{"[::1]:0.0", "tcp", "[::1]:6000", 0},
+	} {
+		network, address, screen, err := parseDisplay(tt.display)
+		if err != nil || network != tt.network || address != tt.address || screen != tt.screen {
+			t.Errorf("parseDisplay(%q) = %q, %q, %d, %v", tt.display, network, address, screen, err)
+		}
+	}
+	if _, _, _, err := parseDisplay("nonsense"); err == nil {
+		t.Error("parseDisplay(nonsense) succeeded")
+	}
+}
+
+func TestRepliesAndEvents(t *testing.T) {
+	c, s := newTestConn(t)
+
+	result := make(chan []uint32)
+	go func() {
+		atoms, err := c.Atoms("FOO", "BAR")
+		if err != nil {
+			t.Error(err)
+		}
+		result <- atoms
+	}()
+
+	s.readRequest()
+	s.readRequest()
+
+	// an event sent before the replies is queued
+	var ev x11byte.Builder
+	ev.AddUint8(X11_EVENT_EXPOSE) // eventCode
+	ev.AddUint8(0)                // unused
+	ev.AddUint16(0)               // sequenceNumber
+	ev.AddUint32(7)               // window
+	ev.AddBytes(make([]byte, 24))
+	s.write(ev.BytesOrPanic())
+
+	s.seq--
+	s.reply(0, []byte{100, 0, 0, 0})
+	s.seq++
+	s.reply(0, []byte{101, 0, 0, 0})
+
+	if got := <-result; got[0] != 100 || got[1] != 101 {
+		t.Errorf("Atoms() = %v, want [100 101]", got)
+	}
+	if atom, err := c.Atom("BAR"); err != nil || atom != 101 {
+		t.Errorf("cached Atom(BAR) = %d, %v", atom, err)
+	}
+
+	e, err := c.WaitForEvent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expose, ok := e.(*ExposeEvent); !ok || expose.Window != 7 {
+		t.Errorf("WaitForEvent() = %#v", e)
+	}
+}
+
+func TestSendChecked(t *testing.T) {
+	c, s := newTestConn(t)
+
+	result := make(chan error)
+	go func() {
+		result <- c.SendChecked([]byte{X11_REQUEST_MAP_WINDOW, 0, 2, 0, 1, 0, 0, 0})
+	}()
+
+	s.readRequest()
+	seq := s.seq
+	s.readRequest() // GetInputFocus
+
+	var e x11byte.Builder
+	e.AddUint8(0)                      // error
+	e.AddUint8(X11_ERROR_BAD_WINDOW)   // code
+	e.AddUint16(seq)                   // sequenceNumber
+	e.AddUint32(1)                     // badValue
+	e.AddUint16(0)                     // minorOpcode
+	e.AddUint8(X11_REQUEST_MAP_WINDOW) // majorOpcode
+	e.AddBytes(make([]byte, 21))
+	s.write(e.BytesOrPanic())
+	s.reply(0, nil)
+
+	err := <-result
+	if xerr, ok := err.(*Error); !ok || xerr.Code != X11_ERROR_BAD_WINDOW {
+		t.Errorf("SendChecked() = %v, want BadWindow", err)
+	}
+}
+
+func TestChangeState(t *testing.T) {
+	c, s := newTestConn(t)
+	c.atoms.store("_NET_WM_STATE", 300)
+	c.atoms.store(NetWMStateFullscreen, 301)
+	c.atoms.store(NetWMStateAbove, 302)
+
+	w := &Window{c: c, ID: 0x00400001}
+
+	go w.ChangeState(NET_WM_STATE_ADD, NetWMStateFullscreen, NetWMStateAbove)
+	req := s.readRequest()
+	var want x11byte.Builder
+	want.AddUint8(X11_REQUEST_CHANGE_PROPERTY) // opcode
+	want.AddUint8(X11_PROP_MODE_REPLACE)       // mode
+	want.AddUint16(8)                          // requestLength
+	want.AddUint32(w.ID)                       // window
+	want.AddUint32(300)                        // property
+	want.AddUint32(X11_ATOM_ATOM)              // type
+	want.AddUint8(32)                          // format
+	want.AddUint24(0)                          // unused
+	want.AddUint32(2)                          // dataLength
+	want.AddUint32(301)                        // data
+	want.AddUint32(302)                        // data
+	if !bytes.Equal(req, want.BytesOrPanic()) {
+		t.Errorf("unmapped ChangeState sent\n%v, want\n%v", []byte(req), want.BytesOrPanic())
+	}
+
+	w.mu.Lock()
+	w.mapped = true
+	w.mu.Unlock()
+	go w.SetFullscreen(false)
+	req = s.readRequest()
+	var msg x11byte.Builder
+	msg.AddUint8(X11_REQUEST_SEND_EVENT) // opcode
+	msg.AddUint8(0)                      // propagate
+	msg.AddUint16(11)                    // requestLength
+	msg.AddUint32(0x123)                 // destination
+	msg.AddUint32(X11_EVENT_FLAG_SUBSTRUCTURE_REDIRECT | X11_EVENT_FLAG_SUBSTRUCTURE_NOTIFY)
+	msg.AddUint8(X11_EVENT_CLIENT_MESSAGE) // eventCode
+	msg.AddUint8(32)                       // format
+	msg.AddUint16(0)                       // sequenceNumber
+	msg.AddUint32(w.ID)                    // window
+	msg.AddUint32(300)                     // type
+	msg.AddUint32(NET_WM_STATE_REMOVE)     // action
+	msg.AddUint32(301)                     // first
+	msg.AddUint32(0)                       // second
+	msg.AddUint32(sourceIndication)        // source
+	msg.AddUint32(0)                       // unused
+	if !bytes.Equal(req, msg.BytesOrPanic()) {
+		t.Errorf("mapped ChangeState sent\n%v, want\n%v", []byte(req), msg.BytesOrPanic())
+	}
+}
@@ -0,0 +1,191 @@
+package x11
+
+import (
+	"image/color"
+
+	"github.com/dzeromsk/helloX11/x11byte"
+)
+
+// Shapes of the standard "cursor" font, for CreateFontCursor. Each glyph is
+// followed by its mask.
+const (
+	X11_CURSOR_X_CURSOR            = 0
+	X11_CURSOR_ARROW               = 2
+	X11_CURSOR_BOTTOM_LEFT_CORNER  = 12
+	X11_CURSOR_BOTTOM_RIGHT_CORNER = 14
+	X11_CURSOR_BOTTOM_SIDE         = 16
+	X11_CURSOR_CIRCLE              = 24
+	X11_CURSOR_CROSS               = 30
+	X11_CURSOR_CROSSHAIR           = 34
+	X11_CURSOR_FLEUR               = 52 // move
+	X11_CURSOR_HAND1               = 58
+	X11_CURSOR_HAND2               = 60 // pointing hand, for links
+	X11_CURSOR_LEFT_PTR            = 68 // the usual arrow
+	X11_CURSOR_LEFT_SIDE           = 70
+	X11_CURSOR_PLUS                = 90
+	X11_CURSOR_QUESTION_ARROW      = 92
+	X11_CURSOR_RIGHT_SIDE          = 96
+	X11_CURSOR_SB_H_DOUBLE_ARROW   = 108 // horizontal resize
+	X11_CURSOR_SB_V_DOUBLE_ARROW   = 116 // vertical resize
+	X11_CURSOR_TCROSS              = 130
+	X11_CURSOR_TOP_LEFT_CORNER     = 134
+	X11_CURSOR_TOP_RIGHT_CORNER    = 136
+	X11_CURSOR_TOP_SIDE            = 138
+	X11_CURSOR_WATCH               = 150 // busy
+	X11_CURSOR_XTERM               = 152 // text I-beam
+)
+
+// OpenFont loads the named server font.
+func (c *Conn) OpenFont(name string) (uint32, error) {
+	fontID, err := c.NewID()
+	if err != nil {
+		return 0, err
+	}
+
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_OPEN_FONT)        // opcode
+	b.AddUint8(0)                            // unused
+	b.AddUint16(uint16(3 + (len(name)+3)/4)) // requestLength
+	b.AddUint32(fontID)                      // fid
+	b.AddUint16(uint16(len(name)))           // nameLength
+	b.AddUint16(0)                           // unused
+	b.AddBytes([]byte(name))                 // name
+	b.AddBytes(make([]byte, pad(len(name)))) // padding
+
+	if err := c.SendChecked(b.BytesOrPanic()); err != nil {
+		return 0, err
+	}
+	return fontID, nil
+}
+
+// CloseFont releases a font. Cursors created from it remain valid.
+func (c *Conn) CloseFont(font uint32) error {
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_CLOSE_FONT) // opcode
+	b.AddUint8(0)                      // unused
+	b.AddUint16(2)                     // requestLength
+	b.AddUint32(font)                  // font
+	return c.Send(b.BytesOrPanic())
+}
+
+// CreateGlyphCursor creates a cursor from font glyphs. The mask glyph
+// selects the pixels shown, the source glyph which of them use the
+// foreground color. A mask font of X11_NONE shows all source pixels.
+func (c *Conn) CreateGlyphCursor(sourceFont, maskFont uint32, sourceChar, maskChar uint16, fore, back color.Color) (uint32, error) {
+	cursorID, err := c.NewID()
+	if err != nil {
+		return 0, err
+	}
+
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_CREATE_GLYPH_CURSOR) // opcode
+	b.AddUint8(0)                               // unused
+	b.AddUint16(8)                              // requestLength
+	b.AddUint32(cursorID)                       // cid
+	b.AddUint32(sourceFont)                     // sourceFont
+	b.AddUint32(maskFont)                       // maskFont
+	b.AddUint16(sourceChar)                     // sourceChar
+	b.AddUint16(maskChar)                       // maskChar
+	addCursorColors(&b, fore, back)
+
+	if err := c.Send(b.BytesOrPanic()); err != nil {
+		return 0, err
+	}
+	return cursorID, nil
+}
+
+// CreateFontCursor creates a black and white cursor with one of the
+// X11_CURSOR_* shapes of the standard cursor font.
+func (c *Conn) CreateFontCursor(shape uint16) (uint32, error) {
+	font, err := c.OpenFont("cursor")
+	if err != nil {
+		return 0, err
+	}
+	defer c.CloseFont(font) // the cursor does not need it
+	return c.CreateGlyphCursor(font, font, shape, shape+1, color.Black, color.White)
+}
+
+// CreateCursor creates a cursor from depth 1 pixmaps, with the hotspot at
+// x, y. Source bits select the foreground color and mask bits the pixels
+// shown. A mask of X11_NONE shows all pixels.
+func (c *Conn) CreateCursor(source, mask uint32, fore, back color.Color, x, y uint16) (uint32, error) {
+	cursorID, err := c.NewID()
+	if err != nil {
+		return 0, err
+	}
+
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_CREATE_CURSOR) // opcode
+	b.AddUint8(0)                         // unused
+	b.AddUint16(8)                        // requestLength
+	b.AddUint32(cursorID)                 // cid
+	b.AddUint32(source)                   // source
+	b.AddUint32(mask)                     // mask
+	addCursorColors(&b, fore, back)
+	b.AddUint16(x) // x
+	b.AddUint16(y) // y
+
+	if err := c.Send(b.BytesOrPanic()); err != nil {
+		return 0, err
+	}
+	return cursorID, nil
+}
+
+// CreateBlankCursor creates an invisible cursor, for hiding the pointer.
+func (c *Conn) CreateBlankCursor() (uint32, error) {
+	root := c.Screen().Root
+	pixmap, err := c.CreatePixmap(root, 1, 1, 1)
+	if err != nil {
+		return 0, err
+	}
+	defer c.FreePixmap(pixmap) // the cursor keeps a copy
+	gc, err := c.CreateGC(pixmap, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer c.FreeGC(gc)
+	stride := int(c.setup.BitmapFormatScanlinePad) / 8
+	err = c.PutImage(X11_IMAGE_FORMAT_XY_PIXMAP, pixmap, gc, 1, 1, 1, 0, 0, stride, make([]byte, stride))
+	if err != nil {
+		return 0, err
+	}
+	return c.CreateCursor(pixmap, pixmap, color.Black, color.Black, 0, 0)
+}
+
+// FreeCursor frees a cursor once no window uses it anymore.
+func (c *Conn) FreeCursor(cursor uint32) error {
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_FREE_CURSOR) // opcode
+	b.AddUint8(0)                       // unused
+	b.AddUint16(2)                      // requestLength
+	b.AddUint32(cursor)                 // cursor
+	return c.Send(b.BytesOrPanic())
+}
+
+// DefineCursor sets the cursor shown while the pointer is in the window.
+// X11_NONE makes the window use its parent's cursor again.
+func (w *Window) DefineCursor(cursor uint32) error {
+	return w.changeAttributes(X11_FLAG_CURSOR, cursor)
+}
+
+// HideCursor makes the pointer invisible inside the window. DefineCursor
+// shows it again.
+func (w *Window) HideCursor() error {
+	cursor, err := w.c.CreateBlankCursor()
+	if err != nil {
+		return err
+	}
+	if err := w.DefineCursor(cursor); err != nil {
+		return err
+	}
+	return w.c.FreeCursor(cursor)
+}
+
+func addCursorColors(b *x11byte.Builder, fore, back color.Color) {
+	for _, col := range []color.Color{fore, back} {
+		r, g, bl, _ := col.RGBA()
+		b.AddUint16(uint16(r))  // red
+		b.AddUint16(uint16(g))  // green
+		b.AddUint16(uint16(bl)) // blue
+	}
+}
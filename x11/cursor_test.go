@@ -0,0 +1,71 @@
+package x11
+
+import "testing"
+
+func TestCreateFontCursor(t *testing.T) {
+	c, s := newTestConn(t)
+
+	type result struct {
+		cursor uint32
+		err    error
+	}
+	done := make(chan result)
+	go func() {
+		cursor, err := c.CreateFontCursor(X11_CURSOR_HAND2)
+		done <- result{cursor, err}
+	}()
+
+	req := s.readRequest()
+	if string(req[12:18]) != "cursor" {
+		t.Errorf("OpenFont sent %q", req[12:18])
+	}
+	var font uint32
+	req.Skip(4)
+	req.ReadUint32(&font)
+	s.readRequest() // GetInputFocus of SendChecked
+	s.reply(0, nil)
+
+	req = s.readRequest()
+	var (
+		opcode                     uint8
+		cursor, source, mask       uint32
+		sourceChar, maskChar, fore uint16
+	)
+	raw := req
+	req.ReadUint8(&opcode)
+	req.Skip(3)
+	req.ReadUint32(&cursor)
+	req.ReadUint32(&source)
+	req.ReadUint32(&mask)
+	req.ReadUint16(&sourceChar)
+	req.ReadUint16(&maskChar)
+	req.ReadUint16(&fore)
+	if opcode != X11_REQUEST_CREATE_GLYPH_CURSOR || source != font || mask != font ||
+		sourceChar != X11_CURSOR_HAND2 || maskChar != X11_CURSOR_HAND2+1 || fore != 0 {
+		t.Errorf("CreateGlyphCursor sent % x", raw)
+	}
+
+	req = s.readRequest()
+	if req[0] != X11_REQUEST_CLOSE_FONT {
+		t.Errorf("got request %d, want CloseFont", req[0])
+	}
+	if r := <-done; r.err != nil || r.cursor != cursor {
+		t.Errorf("CreateFontCursor() = %#x, %v, want %#x", r.cursor, r.err, cursor)
+	}
+
+	w := &Window{c: c, ID: 5}
+	go func() {
+		if err := w.DefineCursor(cursor); err != nil {
+			t.Error(err)
+		}
+	}()
+	req = s.readRequest()
+	var window, valueMask, value uint32
+	req.Skip(4)
+	req.ReadUint32(&window)
+	req.ReadUint32(&valueMask)
+	req.ReadUint32(&value)
+	if window != 5 || valueMask != X11_FLAG_CURSOR || value != cursor {
+		t.Errorf("DefineCursor sent window %d, mask %#x, cursor %#x", window, valueMask, value)
+	}
+}
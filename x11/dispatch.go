@@ -0,0 +1,365 @@
+package x11
+
+import "sync"
+
+// WindowEvent is implemented by events that are reported to a particular
+// window. Extension packages implement it on their own events so the
+// Dispatcher can route them.
+type WindowEvent interface {
+	EventWindow() uint32
+}
+
+func (e *KeyEvent) EventWindow() uint32              { return e.Event }
+func (e *ButtonEvent) EventWindow() uint32           { return e.Event }
+func (e *MotionEvent) EventWindow() uint32           { return e.Event }
+func (e *CrossingEvent) EventWindow() uint32         { return e.Event }
+func (e *ScrollEvent) EventWindow() uint32           { return e.Event }
+func (e *FocusEvent) EventWindow() uint32            { return e.Event }
+func (e *ExposeEvent) EventWindow() uint32           { return e.Window }
+func (e *GraphicsExposureEvent) EventWindow() uint32 { return e.Drawable }
+func (e *NoExposureEvent) EventWindow() uint32       { return e.Drawable }
+func (e *CreateNotifyEvent) EventWindow() uint32     { return e.Parent }
+func (e *ReparentNotifyEvent) EventWindow() uint32   { return e.Event }
+func (e *CirculateNotifyEvent) EventWindow() uint32  { return e.Event }
+func (e *DestroyNotifyEvent) EventWindow() uint32    { return e.Event }
+func (e *UnmapNotifyEvent) EventWindow() uint32      { return e.Event }
+func (e *MapNotifyEvent) EventWindow() uint32        { return e.Event }
+func (e *ConfigureNotifyEvent) EventWindow() uint32  { return e.Event }
+func (e *PropertyNotifyEvent) EventWindow() uint32   { return e.Window }
+func (e *ClientMessageEvent) EventWindow() uint32    { return e.Window }
+func (e *SelectionClearEvent) EventWindow() uint32   { return e.Owner }
+func (e *SelectionRequestEvent) EventWindow() uint32 { return e.Owner }
+func (e *SelectionNotifyEvent) EventWindow() uint32  { return e.Requestor }
+
+// WindowHandler holds the callbacks for one window. Nil callbacks are
+// skipped. All callbacks run on the goroutine calling Dispatcher.Run.
+type WindowHandler struct {
+	Key            func(*KeyEvent)
+	Button         func(*ButtonEvent)
+	Scroll         func(*ScrollEvent) // wheel buttons 4 to 7, if set
+	Motion         func(*MotionEvent)
+	Enter          func(*CrossingEvent)
+	Leave          func(*CrossingEvent)
+	Focus          func(*FocusEvent)
+	Expose         func(*ExposeEvent)
+	GraphicsExpose func(*GraphicsExposureEvent) // after CopyArea from the window
+	NoExpose       func(*NoExposureEvent)
+	Configure      func(*ConfigureNotifyEvent)
+	Map            func(*MapNotifyEvent)
+	Unmap          func(*UnmapNotifyEvent)
+	PropertyNotify func(*PropertyNotifyEvent)
+	ClientMessage  func(*ClientMessageEvent)
+	StateChange    func() // _NET_WM_STATE changed, see Window.State
+	Destroy        func() // the window is gone and its handler removed
+	Event          func(Event)
+
+	// Close is called when the window manager asks to close the window
+	// with WM_DELETE_WINDOW. If nil, the window is destroyed.
+	Close func()
+}
+
+// Dispatcher routes events to handlers registered per window, so one
+// connection can drive several top-level windows and their children.
+type Dispatcher struct {
+	c *Conn
+
+	// Error is called for protocol errors caused by requests sent without
+	// waiting for a reply, and by Run for those of requests made while
+	// dispatching, such as reading a property of a window that is being
+	// destroyed. They are ignored if it is nil.
+	Error func(*Error)
+
+	// Unhandled is called for events no registered window handles.
+	Unhandled func(Event)
+
+	// Filter, if set, sees every event before it is routed. Events it
+	// reports as handled go no further. Extension packages provide filters
+	// that track server state, such as xkb.Keyboard.Filter.
+	Filter func(Event) (bool, error)
+
+	// Keyboard, if set, is updated when the keyboard or modifier mapping
+	// changes.
+	Keyboard *Keyboard
+
+	// Repeat, if set, marks auto-repeated key presses and drops the
+	// releases between them.
+	Repeat *RepeatDetector
+
+	// CompressMotion coalesces consecutive queued MotionNotify events for a
+	// window, so only the latest position is delivered, to Filter as well.
+	CompressMotion bool
+
+	mu        sync.Mutex
+	windows   map[uint32]*dispatchWindow
+	toplevels int
+}
+
+type dispatchWindow struct {
+	w        *Window
+	h        *WindowHandler
+	toplevel bool
+}
+
+// NewDispatcher returns a Dispatcher reading events from c.
+func NewDispatcher(c *Conn) *Dispatcher {
+	return &Dispatcher{
+		c:       c,
+		windows: make(map[uint32]*dispatchWindow),
+	}
+}
+
+// Register routes events for w to h. Children of the root window count as
+// top-level windows and keep Run going until they are destroyed. The window
+// should select StructureNotify, as CreateWindow does by default, so its
+// destruction is noticed.
+func (d *Dispatcher) Register(w *Window, h *WindowHandler) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if old, ok := d.windows[w.ID]; ok && old.toplevel {
+		d.toplevels--
+	}
+	dw := &dispatchWindow{w: w, h: h, toplevel: w.parent() == d.c.Screen().Root}
+	if dw.toplevel {
+		d.toplevels++
+	}
+	d.windows[w.ID] = dw
+}
+
+// Unregister stops routing events to the window's handler.
+func (d *Dispatcher) Unregister(w *Window) {
+	d.unregister(w.ID)
+}
+
+func (d *Dispatcher) unregister(id uint32) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if dw, ok := d.windows[id]; ok {
+		if dw.toplevel {
+			d.toplevels--
+		}
+		delete(d.windows, id)
+	}
+}
+
+func (d *Dispatcher) lookup(id uint32) *dispatchWindow {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.windows[id]
+}
+
+// reparented updates whether a window is top-level once the server
+// reparented it. The parent the client gave it counts, not the event's, so
+// window manager frames leave top-level windows top-level.
+func (d *Dispatcher) reparented(dw *dispatchWindow) {
+	toplevel := dw.w.parent() == d.c.Screen().Root
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.windows[dw.w.ID] != dw || dw.toplevel == toplevel {
+		return
+	}
+	dw.toplevel = toplevel
+	if toplevel {
+		d.toplevels++
+	} else {
+		d.toplevels--
+	}
+}
+
+// Toplevels returns the number of registered top-level windows.
+func (d *Dispatcher) Toplevels() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.toplevels
+}
+
+// Run dispatches events until the last top-level window is destroyed or the
+// connection fails. Protocol errors returned by Dispatch go to Error and
+// dispatching goes on; other errors end Run.
+func (d *Dispatcher) Run() error {
+	for d.Toplevels() > 0 {
+		ev, err := d.c.WaitForEvent()
+		if err != nil {
+			return err
+		}
+		err = d.Dispatch(ev)
+		if e, ok := err.(*Error); ok {
+			if d.Error != nil {
+				d.Error(e)
+			}
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Dispatch delivers a single event to the handler of the window it was
+// reported to.
+func (d *Dispatcher) Dispatch(ev Event) error {
+	if e, ok := ev.(*Error); ok {
+		if d.Error != nil {
+			d.Error(e)
+		}
+		return nil
+	}
+
+	// Before filtering, so filters see the motion handlers see
+	if e, ok := ev.(*MotionEvent); ok && d.CompressMotion {
+		ev = d.compressMotion(e)
+	}
+
+	if d.Filter != nil {
+		if handled, err := d.Filter(ev); handled || err != nil {
+			return err
+		}
+	}
+
+	if e, ok := ev.(*MappingNotifyEvent); ok && d.Keyboard != nil {
+		return d.Keyboard.Update(e)
+	}
+
+	if d.Repeat != nil && d.Repeat.Filter(ev) {
+		return nil
+	}
+
+	we, ok := ev.(WindowEvent)
+	if !ok {
+		d.unhandled(ev)
+		return nil
+	}
+	dw := d.lookup(we.EventWindow())
+	if dw == nil {
+		d.unhandled(ev)
+		return nil
+	}
+	h := dw.h
+
+	switch ev := ev.(type) {
+	case *KeyEvent:
+		if h.Key != nil {
+			h.Key(ev)
+			return nil
+		}
+	case *ButtonEvent:
+		if h.Scroll != nil && ev.IsScroll() {
+			if scroll := ev.Scroll(); scroll != nil {
+				h.Scroll(scroll)
+			}
+			return nil
+		}
+		if h.Button != nil {
+			h.Button(ev)
+			return nil
+		}
+	case *MotionEvent:
+		if h.Motion != nil {
+			h.Motion(ev)
+			return nil
+		}
+	case *CrossingEvent:
+		if ev.Enter && h.Enter != nil {
+			h.Enter(ev)
+			return nil
+		}
+		if !ev.Enter && h.Leave != nil {
+			h.Leave(ev)
+			return nil
+		}
+	case *FocusEvent:
+		if h.Focus != nil {
+			h.Focus(ev)
+			return nil
+		}
+	case *ExposeEvent:
+		if h.Expose != nil {
+			h.Expose(ev)
+			return nil
+		}
+	case *GraphicsExposureEvent:
+		if h.GraphicsExpose != nil {
+			h.GraphicsExpose(ev)
+			return nil
+		}
+	case *NoExposureEvent:
+		if h.NoExpose != nil {
+			h.NoExpose(ev)
+			return nil
+		}
+	case *ConfigureNotifyEvent:
+		if h.Configure != nil {
+			h.Configure(ev)
+			return nil
+		}
+	case *MapNotifyEvent:
+		if h.Map != nil {
+			h.Map(ev)
+			return nil
+		}
+	case *UnmapNotifyEvent:
+		if h.Unmap != nil {
+			h.Unmap(ev)
+			return nil
+		}
+	case *PropertyNotifyEvent:
+		changed, err := dw.w.UpdateState(ev)
+		if err != nil {
+			return err
+		}
+		if changed && h.StateChange != nil {
+			h.StateChange()
+		}
+		if h.PropertyNotify != nil {
+			h.PropertyNotify(ev)
+			return nil
+		}
+	case *ClientMessageEvent:
+		if dw.w.IsDeleteWindow(ev) {
+			if h.Close != nil {
+				h.Close()
+				return nil
+			}
+			return dw.w.Destroy()
+		}
+		if h.ClientMessage != nil {
+			h.ClientMessage(ev)
+			return nil
+		}
+	case *ReparentNotifyEvent:
+		if ev.Window == ev.Event {
+			d.reparented(dw)
+		}
+	case *DestroyNotifyEvent:
+		if ev.Window != ev.Event {
+			break
+		}
+		d.unregister(ev.Window)
+		if h.Destroy != nil {
+			h.Destroy()
+		}
+		return nil
+	}
+
+	if h.Event != nil {
+		h.Event(ev)
+	}
+	return nil
+}
+
+// compressMotion skips ahead to the last of the motion events for the same
+// window at the head of the queue.
+func (d *Dispatcher) compressMotion(ev *MotionEvent) *MotionEvent {
+	for {
+		next, ok := d.c.PeekEvent().(*MotionEvent)
+		if !ok || next.Event != ev.Event {
+			return ev
+		}
+		d.c.PollForEvent()
+		ev = next
+	}
+}
+
+func (d *Dispatcher) unhandled(ev Event) {
+	if d.Unhandled != nil {
+		d.Unhandled(ev)
+	}
+}
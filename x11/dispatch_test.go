@@ -0,0 +1,172 @@
+package x11
+
+import (
+	"testing"
+
+	"github.com/dzeromsk/helloX11/x11byte"
+)
+
+func TestDispatcher(t *testing.T) {
+	c, s := newTestConn(t)
+	c.atoms.store("WM_PROTOCOLS", 400)
+	c.atoms.store("WM_DELETE_WINDOW", 401)
+
+	root := c.Screen().Root
+	a := &Window{c: c, ID: 1, Parent: root}
+	b := &Window{c: c, ID: 2, Parent: root}
+	child := &Window{c: c, ID: 3, Parent: a.ID}
+
+	var exposed []uint32
+	closed := false
+	d := NewDispatcher(c)
+	d.Register(a, &WindowHandler{
+		Expose: func(ev *ExposeEvent) { exposed = append(exposed, ev.Window) },
+	})
+	d.Register(b, &WindowHandler{
+		Expose: func(ev *ExposeEvent) { exposed = append(exposed, ev.Window) },
+		Close:  func() { closed = true },
+	})
+	d.Register(child, &WindowHandler{
+		Expose: func(ev *ExposeEvent) { exposed = append(exposed, ev.Window) },
+	})
+	var unhandled []Event
+	d.Unhandled = func(ev Event) { unhandled = append(unhandled, ev) }
+
+	if n := d.Toplevels(); n != 2 {
+		t.Fatalf("Toplevels() = %d, want 2", n)
+	}
+
+	for _, id := range []uint32{2, 3, 1, 99} {
+		d.Dispatch(&ExposeEvent{Window: id})
+	}
+	if len(exposed) != 3 || exposed[0] != 2 || exposed[1] != 3 || exposed[2] != 1 {
+		t.Errorf("exposed = %v, want [2 3 1]", exposed)
+	}
+	if len(unhandled) != 1 {
+		t.Errorf("unhandled = %v, want the event for window 99", unhandled)
+	}
+
+	deleteWindow := func(id uint32) *ClientMessageEvent {
+		ev := &ClientMessageEvent{Format: 32, Window: id, Type: 400}
+		ev.Data[0], ev.Data[1] = 401&0xff, 401>>8
+		return ev
+	}
+
+	d.Dispatch(deleteWindow(2))
+	if !closed {
+		t.Error("Close handler not called")
+	}
+
+	// without a Close handler the window is destroyed
+	go d.Dispatch(deleteWindow(1))
+	req := s.readRequest()
+	if req[0] != X11_REQUEST_DESTROY_WINDOW || req[4] != 1 {
+		t.Errorf("sent %v, want DestroyWindow(1)", []byte(req))
+	}
+
+	d.Dispatch(&DestroyNotifyEvent{Event: 3, Window: 3})
+	d.Dispatch(&DestroyNotifyEvent{Event: 1, Window: 1})
+	if n := d.Toplevels(); n != 1 {
+		t.Errorf("Toplevels() = %d after destroying a window, want 1", n)
+	}
+	d.Dispatch(&DestroyNotifyEvent{Event: 2, Window: 2})
+	if n := d.Toplevels(); n != 0 {
+		t.Errorf("Toplevels() = %d after destroying all windows, want 0", n)
+	}
+	if err := d.Run(); err != nil {
+		t.Errorf("Run() = %v with no windows left", err)
+	}
+}
+
+func TestDispatcherReparent(t *testing.T) {
+	c, s := newTestConn(t)
+	root := c.Screen().Root
+	a := &Window{c: c, ID: 1, Parent: root}
+	child := &Window{c: c, ID: 2, Parent: a.ID}
+	d := NewDispatcher(c)
+	d.Register(a, &WindowHandler{})
+	d.Register(child, &WindowHandler{})
+
+	// Toplevels changes only once the server reports the reparenting
+	reparent := func(w *Window, parent uint32) {
+		t.Helper()
+		before := d.Toplevels()
+		done := make(chan error)
+		go func() { done <- w.Reparent(parent, 0, 0) }()
+		if req := s.readRequest(); req[0] != X11_REQUEST_REPARENT_WINDOW {
+			t.Fatalf("sent %v, want ReparentWindow", []byte(req))
+		}
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+		if n := d.Toplevels(); n != before {
+			t.Errorf("Toplevels() before ReparentNotify = %d, want %d", n, before)
+		}
+		d.Dispatch(&ReparentNotifyEvent{Event: w.ID, Window: w.ID, Parent: parent})
+	}
+
+	reparent(child, root)
+	if n := d.Toplevels(); n != 2 {
+		t.Errorf("Toplevels() after reparenting to the root = %d, want 2", n)
+	}
+
+	// A window manager frame keeps the window top-level
+	d.Dispatch(&ReparentNotifyEvent{Event: a.ID, Window: a.ID, Parent: 0x50})
+	if n := d.Toplevels(); n != 2 {
+		t.Errorf("Toplevels() after framing = %d, want 2", n)
+	}
+
+	reparent(a, child.ID)
+	if n := d.Toplevels(); n != 1 {
+		t.Errorf("Toplevels() after reparenting away from the root = %d, want 1", n)
+	}
+}
+
+func TestRunProtocolError(t *testing.T) {
+	c, s := newTestConn(t)
+	c.atoms.store("_NET_WM_STATE", 300)
+	w := &Window{c: c, ID: 1, Parent: c.Screen().Root}
+	d := NewDispatcher(c)
+	d.Register(w, &WindowHandler{})
+	var errs []*Error
+	d.Error = func(e *Error) { errs = append(errs, e) }
+	done := make(chan error)
+	go func() { done <- d.Run() }()
+
+	// The window is destroyed while its state is read
+	var ev x11byte.Builder
+	ev.AddUint8(X11_EVENT_PROPERTY_NOTIFY) // code
+	ev.AddBytes(make([]byte, 3))           // unused, sequenceNumber
+	ev.AddUint32(w.ID)                     // window
+	ev.AddUint32(300)                      // atom
+	ev.AddUint32(0)                        // time
+	ev.AddBytes(make([]byte, 16))          // state, unused
+	s.write(ev.BytesOrPanic())
+	if req := s.readRequest(); req[0] != X11_REQUEST_GET_PROPERTY {
+		t.Fatalf("sent %v, want GetProperty", []byte(req))
+	}
+	var e x11byte.Builder
+	e.AddUint8(0)                        // error
+	e.AddUint8(X11_ERROR_BAD_WINDOW)     // code
+	e.AddUint16(s.seq)                   // sequenceNumber
+	e.AddUint32(w.ID)                    // badValue
+	e.AddUint16(0)                       // minorOpcode
+	e.AddUint8(X11_REQUEST_GET_PROPERTY) // majorOpcode
+	e.AddBytes(make([]byte, 21))
+	s.write(e.BytesOrPanic())
+
+	var destroy x11byte.Builder
+	destroy.AddUint8(X11_EVENT_DESTROY_NOTIFY) // code
+	destroy.AddBytes(make([]byte, 3))          // unused, sequenceNumber
+	destroy.AddUint32(w.ID)                    // event
+	destroy.AddUint32(w.ID)                    // window
+	destroy.AddBytes(make([]byte, 20))         // unused
+	s.write(destroy.BytesOrPanic())
+
+	if err := <-done; err != nil {
+		t.Errorf("Run() = %v, want nil once the window is destroyed", err)
+	}
+	if len(errs) != 1 || errs[0].Code != X11_ERROR_BAD_WINDOW {
+		t.Errorf("errors = %v, want BadWindow", errs)
+	}
+}
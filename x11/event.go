@@ -0,0 +1,696 @@
+package x11
+
+import (
+	"fmt"
+
+	"github.com/dzeromsk/helloX11/x11byte"
+)
+
+// Event is an event or protocol error read from the server. It is one of the
+// *...Event types in this package, an *Error, an event type registered by an
+// extension, or RawEvent for anything else.
+type Event interface{}
+
+// RawEvent holds the bytes of an event nothing knows how to decode.
+type RawEvent []byte
+
+// Error is a protocol error reported by the server.
+type Error struct {
+	Code        uint8
+	Sequence    uint16
+	BadValue    uint32
+	MinorOpcode uint16
+	MajorOpcode uint8
+}
+
+var errorNames = [...]string{
+	1:  "BadRequest",
+	2:  "BadValue",
+	3:  "BadWindow",
+	4:  "BadPixmap",
+	5:  "BadAtom",
+	6:  "BadCursor",
+	7:  "BadFont",
+	8:  "BadMatch",
+	9:  "BadDrawable",
+	10: "BadAccess",
+	11: "BadAlloc",
+	12: "BadColormap",
+	13: "BadGContext",
+	14: "BadIDChoice",
+	15: "BadName",
+	16: "BadLength",
+	17: "BadImplementation",
+}
+
+func (e *Error) Error() string {
+	name := fmt.Sprintf("error %d", e.Code)
+	if int(e.Code) < len(errorNames) && errorNames[e.Code] != "" {
+		name = errorNames[e.Code]
+	}
+	return fmt.Sprintf("x11: %s (sequence %d, value 0x%x, opcode %d.%d)",
+		name, e.Sequence, e.BadValue, e.MajorOpcode, e.MinorOpcode)
+}
+
+const (
+	X11_ERROR_BAD_VALUE  = 2
+	X11_ERROR_BAD_WINDOW = 3
+	X11_ERROR_BAD_MATCH  = 8
+	X11_ERROR_BAD_ACCESS = 10
+	X11_ERROR_BAD_ALLOC  = 11
+)
+
+func decodeError(buf x11byte.String) *Error {
+	var e Error
+	buf.Skip(1) // response
+	buf.ReadUint8(&e.Code)
+	buf.ReadUint16(&e.Sequence)
+	buf.ReadUint32(&e.BadValue)
+	buf.ReadUint16(&e.MinorOpcode)
+	buf.ReadUint8(&e.MajorOpcode)
+	return &e
+}
+
+// KeyEvent reports that a key was pressed or released while the window had
+// the keyboard focus.
+type KeyEvent struct {
+	Pressed        bool
+	Keycode        uint8
+	Time           uint32
+	Root           uint32
+	Event          uint32
+	Child          uint32
+	RootX, RootY   int16
+	EventX, EventY int16
+	State          KeyButMask // modifiers and buttons before the event
+	SameScreen     bool
+	Repeat         bool // auto-repeated press, set by RepeatDetector
+}
+
+// ButtonEvent reports that a pointer button was pressed or released. Wheel
+// scrolling arrives as presses of buttons 4 to 7, see ScrollEvent.
+type ButtonEvent struct {
+	Pressed        bool
+	Button         uint8
+	Time           uint32
+	Root           uint32
+	Event          uint32
+	Child          uint32
+	RootX, RootY   int16
+	EventX, EventY int16
+	State          KeyButMask // modifiers and buttons before the event
+	SameScreen     bool
+}
+
+// MotionEvent reports that the pointer moved.
+type MotionEvent struct {
+	IsHint         bool // selected with PointerMotionHint, query the position
+	Time           uint32
+	Root           uint32
+	Event          uint32
+	Child          uint32
+	RootX, RootY   int16
+	EventX, EventY int16
+	State          KeyButMask
+	SameScreen     bool
+}
+
+// Modes of Enter, Leave, FocusIn and FocusOut events.
+const (
+	X11_NOTIFY_MODE_NORMAL        = 0
+	X11_NOTIFY_MODE_GRAB          = 1
+	X11_NOTIFY_MODE_UNGRAB        = 2
+	X11_NOTIFY_MODE_WHILE_GRABBED = 3 // focus events only
+)
+
+// Details of Enter, Leave, FocusIn and FocusOut events, describing where the
+// pointer or focus moved relative to the window.
+const (
+	X11_NOTIFY_DETAIL_ANCESTOR          = 0
+	X11_NOTIFY_DETAIL_VIRTUAL           = 1
+	X11_NOTIFY_DETAIL_INFERIOR          = 2
+	X11_NOTIFY_DETAIL_NONLINEAR         = 3
+	X11_NOTIFY_DETAIL_NONLINEAR_VIRTUAL = 4
+	X11_NOTIFY_DETAIL_POINTER           = 5
+	X11_NOTIFY_DETAIL_POINTER_ROOT      = 6
+	X11_NOTIFY_DETAIL_NONE              = 7
+)
+
+// CrossingEvent reports that the pointer entered or left a window.
+type CrossingEvent struct {
+	Enter          bool
+	Detail         uint8
+	Time           uint32
+	Root           uint32
+	Event          uint32
+	Child          uint32
+	RootX, RootY   int16
+	EventX, EventY int16
+	State          KeyButMask
+	Mode           uint8 // X11_NOTIFY_MODE_*
+	SameScreen     bool
+	Focus          bool // the window is or contains the focus window
+}
+
+// FocusEvent reports that a window gained or lost the keyboard focus.
+type FocusEvent struct {
+	In     bool
+	Detail uint8 // X11_NOTIFY_DETAIL_*
+	Event  uint32
+	Mode   uint8 // X11_NOTIFY_MODE_*
+}
+
+// ExposeEvent reports a region of a window whose contents were lost.
+type ExposeEvent struct {
+	Window uint32
+	X, Y   uint16
+	Width  uint16
+	Height uint16
+	Count  uint16 // number of Expose events that follow for the window
+}
+
+// GraphicsExposureEvent reports a region of a CopyArea or CopyPlane
+// destination that could not be filled because the source was obscured or
+// out of bounds, so it has to be redrawn.
+type GraphicsExposureEvent struct {
+	Drawable    uint32
+	X, Y        uint16
+	Width       uint16
+	Height      uint16
+	MinorOpcode uint16
+	Count       uint16 // number of GraphicsExposure events that follow
+	MajorOpcode uint8  // X11_REQUEST_COPY_AREA or X11_REQUEST_COPY_PLANE
+}
+
+// NoExposureEvent reports that a CopyArea or CopyPlane filled all of its
+// destination.
+type NoExposureEvent struct {
+	Drawable    uint32
+	MinorOpcode uint16
+	MajorOpcode uint8
+}
+
+// CreateNotifyEvent reports that a child window was created.
+type CreateNotifyEvent struct {
+	Parent           uint32
+	Window           uint32
+	X, Y             int16
+	Width, Height    uint16
+	BorderWidth      uint16
+	OverrideRedirect bool
+}
+
+// DestroyNotifyEvent reports that a window was destroyed.
+type DestroyNotifyEvent struct {
+	Event  uint32
+	Window uint32
+}
+
+// UnmapNotifyEvent reports that a window was unmapped.
+type UnmapNotifyEvent struct {
+	Event         uint32
+	Window        uint32
+	FromConfigure bool
+}
+
+// MapNotifyEvent reports that a window was mapped.
+type MapNotifyEvent struct {
+	Event            uint32
+	Window           uint32
+	OverrideRedirect bool
+}
+
+// ReparentNotifyEvent reports that a window moved to a new parent.
+type ReparentNotifyEvent struct {
+	Event            uint32
+	Window           uint32
+	Parent           uint32
+	X, Y             int16
+	OverrideRedirect bool
+}
+
+// ConfigureNotifyEvent reports a change to a window's size, position,
+// border or stacking order.
+type ConfigureNotifyEvent struct {
+	Event            uint32
+	Window           uint32
+	AboveSibling     uint32
+	X, Y             int16
+	Width, Height    uint16
+	BorderWidth      uint16
+	OverrideRedirect bool
+}
+
+// CirculateNotifyEvent reports that a window was restacked by
+// CirculateWindow.
+type CirculateNotifyEvent struct {
+	Event  uint32
+	Window uint32
+	OnTop  bool // placed on top of its siblings rather than at the bottom
+}
+
+// PropertyNotifyEvent reports that a window property changed or was deleted.
+type PropertyNotifyEvent struct {
+	Window  uint32
+	Atom    uint32
+	Time    uint32
+	Deleted bool
+}
+
+// SelectionClearEvent tells the owner of a selection that it lost it.
+type SelectionClearEvent struct {
+	Time      uint32
+	Owner     uint32
+	Selection uint32
+}
+
+// SelectionRequestEvent asks the owner of a selection to convert it to
+// Target and store the result in Property of Requestor.
+type SelectionRequestEvent struct {
+	Time      uint32
+	Owner     uint32
+	Requestor uint32
+	Selection uint32
+	Target    uint32
+	Property  uint32 // X11_NONE from obsolete clients
+}
+
+// SelectionNotifyEvent answers ConvertSelection. Property is X11_NONE if
+// the conversion failed.
+type SelectionNotifyEvent struct {
+	Time      uint32
+	Requestor uint32
+	Selection uint32
+	Target    uint32
+	Property  uint32
+}
+
+// ClientMessageEvent is a message sent by another client, usually the window
+// manager, with SendEvent.
+type ClientMessageEvent struct {
+	Format uint8
+	Window uint32
+	Type   uint32
+	Data   [20]byte
+}
+
+// Data32 returns the message data as five 32-bit values.
+func (e *ClientMessageEvent) Data32() [5]uint32 {
+	var v [5]uint32
+	s := x11byte.String(e.Data[:])
+	for i := range v {
+		s.ReadUint32(&v[i])
+	}
+	return v
+}
+
+// Requests reported by MappingNotify.
+const (
+	X11_MAPPING_MODIFIER = 0
+	X11_MAPPING_KEYBOARD = 1
+	X11_MAPPING_POINTER  = 2
+)
+
+// MappingNotifyEvent reports that the modifier, keyboard or pointer mapping
+// changed, for instance after setxkbmap. It is sent to all clients.
+type MappingNotifyEvent struct {
+	Request      uint8 // X11_MAPPING_*
+	FirstKeycode uint8
+	Count        uint8
+}
+
+// RegisterEventDecoder installs a decoder for events with the given code, as
+// assigned to an extension by QueryExtension.
+func (c *Conn) RegisterEventDecoder(code uint8, decode func(x11byte.String) Event) {
+	c.decmu.Lock()
+	defer c.decmu.Unlock()
+	c.eventDecoders[code] = decode
+}
+
+// RegisterGenericEventDecoder installs a decoder for GenericEvents sent by the
+// extension with the given major opcode.
+func (c *Conn) RegisterGenericEventDecoder(opcode uint8, decode func(x11byte.String) Event) {
+	c.decmu.Lock()
+	defer c.decmu.Unlock()
+	c.genericDecoders[opcode] = decode
+}
+
+func (c *Conn) decodeEvent(buf x11byte.String) Event {
+	code := buf[0] & 0x7f
+
+	c.decmu.Lock()
+	decode, ok := c.eventDecoders[code]
+	if code == X11_EVENT_GENERIC_EVENT {
+		decode, ok = c.genericDecoders[buf[1]]
+	}
+	c.decmu.Unlock()
+	if ok {
+		if ev := decode(buf); ev != nil {
+			return ev
+		}
+		return RawEvent(buf)
+	}
+
+	switch code {
+	case X11_EVENT_KEY_PRESS, X11_EVENT_KEY_RELEASE:
+		var (
+			e              KeyEvent
+			rootX, rootY   uint16
+			eventX, eventY uint16
+			sameScreen     uint8
+		)
+		buf.Skip(1) // eventCode
+		buf.ReadUint8(&e.Keycode)
+		buf.Skip(2) // sequenceNumber
+		buf.ReadUint32(&e.Time)
+		buf.ReadUint32(&e.Root)
+		buf.ReadUint32(&e.Event)
+		buf.ReadUint32(&e.Child)
+		buf.ReadUint16(&rootX)
+		buf.ReadUint16(&rootY)
+		buf.ReadUint16(&eventX)
+		buf.ReadUint16(&eventY)
+		buf.ReadUint16((*uint16)(&e.State))
+		buf.ReadUint8(&sameScreen)
+		e.Pressed = code == X11_EVENT_KEY_PRESS
+		e.RootX, e.RootY = int16(rootX), int16(rootY)
+		e.EventX, e.EventY = int16(eventX), int16(eventY)
+		e.SameScreen = sameScreen != 0
+		return &e
+
+	case X11_EVENT_BUTTON_PRESS, X11_EVENT_BUTTON_RELEASE:
+		var (
+			e              ButtonEvent
+			rootX, rootY   uint16
+			eventX, eventY uint16
+			sameScreen     uint8
+		)
+		buf.Skip(1) // eventCode
+		buf.ReadUint8(&e.Button)
+		buf.Skip(2) // sequenceNumber
+		buf.ReadUint32(&e.Time)
+		buf.ReadUint32(&e.Root)
+		buf.ReadUint32(&e.Event)
+		buf.ReadUint32(&e.Child)
+		buf.ReadUint16(&rootX)
+		buf.ReadUint16(&rootY)
+		buf.ReadUint16(&eventX)
+		buf.ReadUint16(&eventY)
+		buf.ReadUint16((*uint16)(&e.State))
+		buf.ReadUint8(&sameScreen)
+		e.Pressed = code == X11_EVENT_BUTTON_PRESS
+		e.RootX, e.RootY = int16(rootX), int16(rootY)
+		e.EventX, e.EventY = int16(eventX), int16(eventY)
+		e.SameScreen = sameScreen != 0
+		return &e
+
+	case X11_EVENT_MOTION_NOTIFY:
+		var (
+			e              MotionEvent
+			isHint         uint8
+			rootX, rootY   uint16
+			eventX, eventY uint16
+			sameScreen     uint8
+		)
+		buf.Skip(1) // eventCode
+		buf.ReadUint8(&isHint)
+		buf.Skip(2) // sequenceNumber
+		buf.ReadUint32(&e.Time)
+		buf.ReadUint32(&e.Root)
+		buf.ReadUint32(&e.Event)
+		buf.ReadUint32(&e.Child)
+		buf.ReadUint16(&rootX)
+		buf.ReadUint16(&rootY)
+		buf.ReadUint16(&eventX)
+		buf.ReadUint16(&eventY)
+		buf.ReadUint16((*uint16)(&e.State))
+		buf.ReadUint8(&sameScreen)
+		e.IsHint = isHint != 0
+		e.RootX, e.RootY = int16(rootX), int16(rootY)
+		e.EventX, e.EventY = int16(eventX), int16(eventY)
+		e.SameScreen = sameScreen != 0
+		return &e
+
+	case X11_EVENT_ENTER_NOTIFY, X11_EVENT_LEAVE_NOTIFY:
+		var (
+			e              CrossingEvent
+			rootX, rootY   uint16
+			eventX, eventY uint16
+			flags          uint8
+		)
+		buf.Skip(1) // eventCode
+		buf.ReadUint8(&e.Detail)
+		buf.Skip(2) // sequenceNumber
+		buf.ReadUint32(&e.Time)
+		buf.ReadUint32(&e.Root)
+		buf.ReadUint32(&e.Event)
+		buf.ReadUint32(&e.Child)
+		buf.ReadUint16(&rootX)
+		buf.ReadUint16(&rootY)
+		buf.ReadUint16(&eventX)
+		buf.ReadUint16(&eventY)
+		buf.ReadUint16((*uint16)(&e.State))
+		buf.ReadUint8(&e.Mode)
+		buf.ReadUint8(&flags)
+		e.Enter = code == X11_EVENT_ENTER_NOTIFY
+		e.RootX, e.RootY = int16(rootX), int16(rootY)
+		e.EventX, e.EventY = int16(eventX), int16(eventY)
+		e.SameScreen = flags&0x02 != 0
+		e.Focus = flags&0x01 != 0
+		return &e
+
+	case X11_EVENT_FOCUS_IN, X11_EVENT_FOCUS_OUT:
+		var e FocusEvent
+		buf.Skip(1) // eventCode
+		buf.ReadUint8(&e.Detail)
+		buf.Skip(2) // sequenceNumber
+		buf.ReadUint32(&e.Event)
+		buf.ReadUint8(&e.Mode)
+		e.In = code == X11_EVENT_FOCUS_IN
+		return &e
+
+	case X11_EVENT_EXPOSE:
+		var e ExposeEvent
+		buf.Skip(1) // eventCode
+		buf.Skip(1) // unused
+		buf.Skip(2) // sequenceNumber
+		buf.ReadUint32(&e.Window)
+		buf.ReadUint16(&e.X)
+		buf.ReadUint16(&e.Y)
+		buf.ReadUint16(&e.Width)
+		buf.ReadUint16(&e.Height)
+		buf.ReadUint16(&e.Count)
+		return &e
+
+	case X11_EVENT_GRAPHICS_EXPOSURE:
+		var e GraphicsExposureEvent
+		buf.Skip(1) // eventCode
+		buf.Skip(1) // unused
+		buf.Skip(2) // sequenceNumber
+		buf.ReadUint32(&e.Drawable)
+		buf.ReadUint16(&e.X)
+		buf.ReadUint16(&e.Y)
+		buf.ReadUint16(&e.Width)
+		buf.ReadUint16(&e.Height)
+		buf.ReadUint16(&e.MinorOpcode)
+		buf.ReadUint16(&e.Count)
+		buf.ReadUint8(&e.MajorOpcode)
+		return &e
+
+	case X11_EVENT_NO_EXPOSURE:
+		var e NoExposureEvent
+		buf.Skip(1) // eventCode
+		buf.Skip(1) // unused
+		buf.Skip(2) // sequenceNumber
+		buf.ReadUint32(&e.Drawable)
+		buf.ReadUint16(&e.MinorOpcode)
+		buf.ReadUint8(&e.MajorOpcode)
+		return &e
+
+	case X11_EVENT_CREATE_NOTIFY:
+		var (
+			e                CreateNotifyEvent
+			x, y             uint16
+			overrideRedirect uint8
+		)
+		buf.Skip(1) // eventCode
+		buf.Skip(1) // unused
+		buf.Skip(2) // sequenceNumber
+		buf.ReadUint32(&e.Parent)
+		buf.ReadUint32(&e.Window)
+		buf.ReadUint16(&x)
+		buf.ReadUint16(&y)
+		buf.ReadUint16(&e.Width)
+		buf.ReadUint16(&e.Height)
+		buf.ReadUint16(&e.BorderWidth)
+		buf.ReadUint8(&overrideRedirect)
+		e.X, e.Y = int16(x), int16(y)
+		e.OverrideRedirect = overrideRedirect != 0
+		return &e
+
+	case X11_EVENT_DESTROY_NOTIFY:
+		var e DestroyNotifyEvent
+		buf.Skip(1) // eventCode
+		buf.Skip(1) // unused
+		buf.Skip(2) // sequenceNumber
+		buf.ReadUint32(&e.Event)
+		buf.ReadUint32(&e.Window)
+		return &e
+
+	case X11_EVENT_UNMAP_NOTIFY:
+		var (
+			e             UnmapNotifyEvent
+			fromConfigure uint8
+		)
+		buf.Skip(1) // eventCode
+		buf.Skip(1) // unused
+		buf.Skip(2) // sequenceNumber
+		buf.ReadUint32(&e.Event)
+		buf.ReadUint32(&e.Window)
+		buf.ReadUint8(&fromConfigure)
+		e.FromConfigure = fromConfigure != 0
+		return &e
+
+	case X11_EVENT_MAP_NOTIFY:
+		var (
+			e                MapNotifyEvent
+			overrideRedirect uint8
+		)
+		buf.Skip(1) // eventCode
+		buf.Skip(1) // unused
+		buf.Skip(2) // sequenceNumber
+		buf.ReadUint32(&e.Event)
+		buf.ReadUint32(&e.Window)
+		buf.ReadUint8(&overrideRedirect)
+		e.OverrideRedirect = overrideRedirect != 0
+		return &e
+
+	case X11_EVENT_REPARENT_NOTIFY:
+		var (
+			e                ReparentNotifyEvent
+			x, y             uint16
+			overrideRedirect uint8
+		)
+		buf.Skip(1) // eventCode
+		buf.Skip(1) // unused
+		buf.Skip(2) // sequenceNumber
+		buf.ReadUint32(&e.Event)
+		buf.ReadUint32(&e.Window)
+		buf.ReadUint32(&e.Parent)
+		buf.ReadUint16(&x)
+		buf.ReadUint16(&y)
+		buf.ReadUint8(&overrideRedirect)
+		e.X, e.Y = int16(x), int16(y)
+		e.OverrideRedirect = overrideRedirect != 0
+		return &e
+
+	case X11_EVENT_CONFIGURE_NOTIFY:
+		var (
+			e                ConfigureNotifyEvent
+			x, y             uint16
+			overrideRedirect uint8
+		)
+		buf.Skip(1) // eventCode
+		buf.Skip(1) // unused
+		buf.Skip(2) // sequenceNumber
+		buf.ReadUint32(&e.Event)
+		buf.ReadUint32(&e.Window)
+		buf.ReadUint32(&e.AboveSibling)
+		buf.ReadUint16(&x)
+		buf.ReadUint16(&y)
+		buf.ReadUint16(&e.Width)
+		buf.ReadUint16(&e.Height)
+		buf.ReadUint16(&e.BorderWidth)
+		buf.ReadUint8(&overrideRedirect)
+		e.X, e.Y = int16(x), int16(y)
+		e.OverrideRedirect = overrideRedirect != 0
+		return &e
+
+	case X11_EVENT_CIRCULATE_NOTIFY:
+		var (
+			e     CirculateNotifyEvent
+			place uint8
+		)
+		buf.Skip(1) // eventCode
+		buf.Skip(1) // unused
+		buf.Skip(2) // sequenceNumber
+		buf.ReadUint32(&e.Event)
+		buf.ReadUint32(&e.Window)
+		buf.Skip(4) // unused
+		buf.ReadUint8(&place)
+		e.OnTop = place == 0
+		return &e
+
+	case X11_EVENT_PROPERTY_NOTIFY:
+		var (
+			e     PropertyNotifyEvent
+			state uint8
+		)
+		buf.Skip(1) // eventCode
+		buf.Skip(1) // unused
+		buf.Skip(2) // sequenceNumber
+		buf.ReadUint32(&e.Window)
+		buf.ReadUint32(&e.Atom)
+		buf.ReadUint32(&e.Time)
+		buf.ReadUint8(&state)
+		e.Deleted = state == 1
+		return &e
+
+	case X11_EVENT_SELECTION_CLEAR:
+		var e SelectionClearEvent
+		buf.Skip(1) // eventCode
+		buf.Skip(1) // unused
+		buf.Skip(2) // sequenceNumber
+		buf.ReadUint32(&e.Time)
+		buf.ReadUint32(&e.Owner)
+		buf.ReadUint32(&e.Selection)
+		return &e
+
+	case X11_EVENT_SELECTION_REQUEST:
+		var e SelectionRequestEvent
+		buf.Skip(1) // eventCode
+		buf.Skip(1) // unused
+		buf.Skip(2) // sequenceNumber
+		buf.ReadUint32(&e.Time)
+		buf.ReadUint32(&e.Owner)
+		buf.ReadUint32(&e.Requestor)
+		buf.ReadUint32(&e.Selection)
+		buf.ReadUint32(&e.Target)
+		buf.ReadUint32(&e.Property)
+		return &e
+
+	case X11_EVENT_SELECTION_NOTIFY:
+		var e SelectionNotifyEvent
+		buf.Skip(1) // eventCode
+		buf.Skip(1) // unused
+		buf.Skip(2) // sequenceNumber
+		buf.ReadUint32(&e.Time)
+		buf.ReadUint32(&e.Requestor)
+		buf.ReadUint32(&e.Selection)
+		buf.ReadUint32(&e.Target)
+		buf.ReadUint32(&e.Property)
+		return &e
+
+	case X11_EVENT_CLIENT_MESSAGE:
+		var e ClientMessageEvent
+		buf.Skip(1) // eventCode
+		buf.ReadUint8(&e.Format)
+		buf.Skip(2) // sequenceNumber
+		buf.ReadUint32(&e.Window)
+		buf.ReadUint32(&e.Type)
+		buf.CopyBytes(e.Data[:])
+		return &e
+
+	case X11_EVENT_MAPPING_NOTIFY:
+		var e MappingNotifyEvent
+		buf.Skip(1) // eventCode
+		buf.Skip(1) // unused
+		buf.Skip(2) // sequenceNumber
+		buf.ReadUint8(&e.Request)
+		buf.ReadUint8(&e.FirstKeycode)
+		buf.ReadUint8(&e.Count)
+		return &e
+	}
+
+	return RawEvent(buf)
+}
@@ -0,0 +1,253 @@
+package x11
+
+import "slices"
+
+// _NET_WM_STATE actions, see the Extended Window Manager Hints specification.
+const (
+	NET_WM_STATE_REMOVE = 0
+	NET_WM_STATE_ADD    = 1
+	NET_WM_STATE_TOGGLE = 2
+)
+
+// _NET_WM_STATE atoms understood by most window managers.
+const (
+	NetWMStateModal            = "_NET_WM_STATE_MODAL"
+	NetWMStateSticky           = "_NET_WM_STATE_STICKY"
+	NetWMStateMaximizedVert    = "_NET_WM_STATE_MAXIMIZED_VERT"
+	NetWMStateMaximizedHorz    = "_NET_WM_STATE_MAXIMIZED_HORZ"
+	NetWMStateShaded           = "_NET_WM_STATE_SHADED"
+	NetWMStateSkipTaskbar      = "_NET_WM_STATE_SKIP_TASKBAR"
+	NetWMStateSkipPager        = "_NET_WM_STATE_SKIP_PAGER"
+	NetWMStateHidden           = "_NET_WM_STATE_HIDDEN"
+	NetWMStateFullscreen       = "_NET_WM_STATE_FULLSCREEN"
+	NetWMStateAbove            = "_NET_WM_STATE_ABOVE"
+	NetWMStateBelow            = "_NET_WM_STATE_BELOW"
+	NetWMStateDemandsAttention = "_NET_WM_STATE_DEMANDS_ATTENTION"
+)
+
+// sourceIndication tells the window manager the request comes from a
+// normal application rather than a pager.
+const sourceIndication = 1
+
+// WithState sets the initial _NET_WM_STATE of the window, for example
+// WithState(NetWMStateFullscreen) for a kiosk window.
+func WithState(states ...string) WindowOption {
+	return WithProperty(func(w *Window) error {
+		return w.ChangeState(NET_WM_STATE_ADD, states...)
+	})
+}
+
+// ChangeState adds, removes or toggles up to two _NET_WM_STATE atoms.
+//
+// Before the window is mapped the _NET_WM_STATE property is written
+// directly, which is how the initial state is passed to the window manager.
+// Afterwards the window manager owns the property and the change is
+// requested with a ClientMessage sent to the root window.
+func (w *Window) ChangeState(action uint32, states ...string) error {
+	atoms, err := w.c.Atoms(append([]string{"_NET_WM_STATE"}, states...)...)
+	if err != nil {
+		return err
+	}
+	netWMState, atoms := atoms[0], atoms[1:]
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.mapped {
+		for _, atom := range atoms {
+			has := slices.Contains(w.state, atom)
+			switch {
+			case action == NET_WM_STATE_REMOVE, action == NET_WM_STATE_TOGGLE && has:
+				w.state = slices.DeleteFunc(w.state, func(a uint32) bool { return a == atom })
+			case !has:
+				w.state = append(w.state, atom)
+			}
+		}
+		if len(w.state) == 0 {
+			return w.c.DeleteProperty(w.ID, netWMState)
+		}
+		return w.c.ChangePropertyUint32(w.ID, netWMState, X11_ATOM_ATOM, w.state...)
+	}
+
+	root := w.c.Screen().Root
+	mask := uint32(X11_EVENT_FLAG_SUBSTRUCTURE_REDIRECT | X11_EVENT_FLAG_SUBSTRUCTURE_NOTIFY)
+	for len(atoms) > 0 {
+		first, second := atoms[0], uint32(0)
+		if len(atoms) > 1 {
+			second = atoms[1]
+		}
+		atoms = atoms[min(len(atoms), 2):]
+		if err := w.c.SendClientMessage(root, mask, w.ID, netWMState, action, first, second, sourceIndication); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *Window) setState(on bool, states ...string) error {
+	action := uint32(NET_WM_STATE_REMOVE)
+	if on {
+		action = NET_WM_STATE_ADD
+	}
+	return w.ChangeState(action, states...)
+}
+
+// SetFullscreen makes the window cover the whole monitor without decorations.
+func (w *Window) SetFullscreen(on bool) error {
+	return w.setState(on, NetWMStateFullscreen)
+}
+
+// SetMaximized maximizes the window both horizontally and vertically.
+func (w *Window) SetMaximized(on bool) error {
+	return w.setState(on, NetWMStateMaximizedVert, NetWMStateMaximizedHorz)
+}
+
+// SetAbove keeps the window on top of normal windows.
+func (w *Window) SetAbove(on bool) error {
+	return w.setState(on, NetWMStateAbove)
+}
+
+// SetSticky shows the window on all virtual desktops.
+func (w *Window) SetSticky(on bool) error {
+	return w.setState(on, NetWMStateSticky)
+}
+
+// SetSkipTaskbar hides the window from taskbars.
+func (w *Window) SetSkipTaskbar(on bool) error {
+	return w.setState(on, NetWMStateSkipTaskbar)
+}
+
+// HasState reports whether the window is known to be in the given state, as
+// set before mapping or last reported by the window manager.
+func (w *Window) HasState(state string) bool {
+	atom, ok := w.c.atoms.lookup(state)
+	if !ok {
+		return false
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return slices.Contains(w.state, atom)
+}
+
+// State returns the names of the _NET_WM_STATE atoms currently set on the
+// window.
+func (w *Window) State() ([]string, error) {
+	w.mu.Lock()
+	state := slices.Clone(w.state)
+	w.mu.Unlock()
+
+	names := make([]string, len(state))
+	for i, atom := range state {
+		name, err := w.c.AtomName(atom)
+		if err != nil {
+			return nil, err
+		}
+		names[i] = name
+	}
+	return names, nil
+}
+
+// UpdateState refreshes the window state after a PropertyNotify event and
+// reports whether ev was a change of _NET_WM_STATE on this window. Window
+// managers update the property whenever they apply a state change, whether
+// we asked for it or not.
+func (w *Window) UpdateState(ev *PropertyNotifyEvent) (bool, error) {
+	if ev.Window != w.ID {
+		return false, nil
+	}
+	netWMState, err := w.c.Atom("_NET_WM_STATE")
+	if err != nil || ev.Atom != netWMState {
+		return false, err
+	}
+
+	var state []uint32
+	if !ev.Deleted {
+		state, err = w.c.GetPropertyUint32(w.ID, netWMState, X11_ATOM_ATOM)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.state = state
+	return true, nil
+}
+
+// _NET_WM_WINDOW_TYPE atoms, in the order window managers should prefer them.
+const (
+	NetWMWindowTypeDesktop      = "_NET_WM_WINDOW_TYPE_DESKTOP"
+	NetWMWindowTypeDock         = "_NET_WM_WINDOW_TYPE_DOCK"
+	NetWMWindowTypeToolbar      = "_NET_WM_WINDOW_TYPE_TOOLBAR"
+	NetWMWindowTypeMenu         = "_NET_WM_WINDOW_TYPE_MENU"
+	NetWMWindowTypeUtility      = "_NET_WM_WINDOW_TYPE_UTILITY"
+	NetWMWindowTypeSplash       = "_NET_WM_WINDOW_TYPE_SPLASH"
+	NetWMWindowTypeDialog       = "_NET_WM_WINDOW_TYPE_DIALOG"
+	NetWMWindowTypeDropdownMenu = "_NET_WM_WINDOW_TYPE_DROPDOWN_MENU"
+	NetWMWindowTypePopupMenu    = "_NET_WM_WINDOW_TYPE_POPUP_MENU"
+	NetWMWindowTypeTooltip      = "_NET_WM_WINDOW_TYPE_TOOLTIP"
+	NetWMWindowTypeNotification = "_NET_WM_WINDOW_TYPE_NOTIFICATION"
+	NetWMWindowTypeCombo        = "_NET_WM_WINDOW_TYPE_COMBO"
+	NetWMWindowTypeDND          = "_NET_WM_WINDOW_TYPE_DND"
+	NetWMWindowTypeNormal       = "_NET_WM_WINDOW_TYPE_NORMAL"
+)
+
+// WithWindowType sets _NET_WM_WINDOW_TYPE. Several types may be given, most
+// specific first, so that window managers unaware of a newer type can fall
+// back to an older one.
+func WithWindowType(types ...string) WindowOption {
+	return WithProperty(func(w *Window) error {
+		return w.SetWindowType(types...)
+	})
+}
+
+// SetWindowType sets _NET_WM_WINDOW_TYPE. Window managers only read it when
+// the window is mapped.
+func (w *Window) SetWindowType(types ...string) error {
+	atoms, err := w.c.Atoms(append([]string{"_NET_WM_WINDOW_TYPE"}, types...)...)
+	if err != nil {
+		return err
+	}
+	return w.c.ChangePropertyUint32(w.ID, atoms[0], X11_ATOM_ATOM, atoms[1:]...)
+}
+
+// Strut reserves space at the edges of the screen for a dock or panel. Each
+// edge is the thickness in pixels reserved from that edge of the root
+// window, and the start and end fields limit the reservation to the part of
+// the edge the window actually covers, for multi-monitor setups.
+type Strut struct {
+	Left, Right, Top, Bottom uint32
+
+	LeftStartY, LeftEndY     uint32
+	RightStartY, RightEndY   uint32
+	TopStartX, TopEndX       uint32
+	BottomStartX, BottomEndX uint32
+}
+
+// WithStrut reserves screen space for the window, see SetStrut.
+func WithStrut(strut Strut) WindowOption {
+	return WithProperty(func(w *Window) error {
+		return w.SetStrut(strut)
+	})
+}
+
+// SetStrut sets _NET_WM_STRUT_PARTIAL, and _NET_WM_STRUT for window managers
+// predating it, so maximized windows do not cover a dock.
+func (w *Window) SetStrut(strut Strut) error {
+	atoms, err := w.c.Atoms("_NET_WM_STRUT_PARTIAL", "_NET_WM_STRUT")
+	if err != nil {
+		return err
+	}
+	err = w.c.ChangePropertyUint32(w.ID, atoms[0], X11_ATOM_CARDINAL,
+		strut.Left, strut.Right, strut.Top, strut.Bottom,
+		strut.LeftStartY, strut.LeftEndY,
+		strut.RightStartY, strut.RightEndY,
+		strut.TopStartX, strut.TopEndX,
+		strut.BottomStartX, strut.BottomEndX,
+	)
+	if err != nil {
+		return err
+	}
+	return w.c.ChangePropertyUint32(w.ID, atoms[1], X11_ATOM_CARDINAL,
+		strut.Left, strut.Right, strut.Top, strut.Bottom)
+}
@@ -0,0 +1,71 @@
+package x11
+
+import (
+	"fmt"
+
+	"github.com/dzeromsk/helloX11/x11byte"
+)
+
+// Extension describes an extension as reported by QueryExtension.
+type Extension struct {
+	Present     bool
+	MajorOpcode uint8
+	FirstEvent  uint8
+	FirstError  uint8
+}
+
+// Extension queries the server for the named extension. Results are cached.
+func (c *Conn) Extension(name string) (*Extension, error) {
+	c.extmu.Lock()
+	ext, ok := c.extensions[name]
+	c.extmu.Unlock()
+	if ok {
+		return ext, nil
+	}
+
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_QUERY_EXTENSION)  // opcode
+	b.AddUint8(0)                            // unused
+	b.AddUint16(uint16(2 + (len(name)+3)/4)) // requestLength
+	b.AddUint16(uint16(len(name)))           // nameLength
+	b.AddUint16(0)                           // unused
+	b.AddBytes([]byte(name))                 // name
+	b.AddBytes(make([]byte, pad(len(name)))) // padding
+
+	reply, err := c.Request(b.BytesOrPanic())
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		present uint8
+		e       Extension
+	)
+	reply.Skip(1) // reply
+	reply.Skip(1) // unused
+	reply.Skip(2) // sequenceNumber
+	reply.Skip(4) // replyLength
+	reply.ReadUint8(&present)
+	reply.ReadUint8(&e.MajorOpcode)
+	reply.ReadUint8(&e.FirstEvent)
+	reply.ReadUint8(&e.FirstError)
+	e.Present = present != 0
+
+	c.extmu.Lock()
+	c.extensions[name] = &e
+	c.extmu.Unlock()
+	return &e, nil
+}
+
+// RequireExtension is like Extension but fails if the server does not
+// support the extension.
+func (c *Conn) RequireExtension(name string) (*Extension, error) {
+	ext, err := c.Extension(name)
+	if err != nil {
+		return nil, err
+	}
+	if !ext.Present {
+		return nil, fmt.Errorf("x11: extension %s not supported by server", name)
+	}
+	return ext, nil
+}
@@ -0,0 +1,103 @@
+package x11
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+var errNoFdPassing = errors.New("x11: connection cannot pass file descriptors")
+
+// maxFds bounds the file descriptors received with one read.
+const maxFds = 16
+
+// FdPassing reports whether file descriptors can be passed over the
+// connection, which needs a UNIX socket, for SendCheckedFds and RequestFds.
+func (c *Conn) FdPassing() bool {
+	_, ok := c.conn.(*net.UnixConn)
+	return ok
+}
+
+// write writes req, with fds as SCM_RIGHTS ancillary data. It is called
+// with wmu held.
+func (c *Conn) write(req []byte, fds []int) error {
+	if len(fds) == 0 {
+		_, err := c.conn.Write(req)
+		return err
+	}
+	uc := c.conn.(*net.UnixConn)
+	n, _, err := uc.WriteMsgUnix(req, syscall.UnixRights(fds...), nil)
+	if err == nil && n < len(req) {
+		// The descriptors went with the first part
+		_, err = uc.Write(req[n:])
+	}
+	return err
+}
+
+// takeFds removes the first n received file descriptors, fewer if the
+// server sent fewer. It is called with mu held.
+func (c *Conn) takeFds(n int) []int {
+	n = min(n, len(c.fds))
+	fds := c.fds[:n:n]
+	c.fds = c.fds[n:]
+	return fds
+}
+
+// claimFds removes the file descriptors carried by reply, whose second
+// byte counts them as libxcb expects, and returns the first n. The others
+// are closed, so none is left over for the next reply. It is called with
+// mu held.
+func (c *Conn) claimFds(reply []byte, n int) []int {
+	fds := c.takeFds(int(reply[1]))
+	n = min(n, len(fds))
+	closeEach(fds[n:])
+	return fds[:n:n]
+}
+
+// closeFds closes the received file descriptors no reply claimed. It is
+// called with mu held.
+func (c *Conn) closeFds() {
+	closeEach(c.fds)
+	c.fds = nil
+}
+
+func closeEach(fds []int) {
+	for _, fd := range fds {
+		syscall.Close(fd)
+	}
+}
+
+// fdReader reads from a UNIX socket, collecting the file descriptors sent
+// along with the data. They arrive no later than the first byte of the
+// reply carrying them, so they are queued by the time it is completed.
+type fdReader struct {
+	conn *net.UnixConn
+	c    *Conn
+	oob  []byte
+}
+
+func (r *fdReader) Read(p []byte) (int, error) {
+	if r.oob == nil {
+		r.oob = make([]byte, syscall.CmsgSpace(maxFds*4))
+	}
+	n, oobn, _, _, err := r.conn.ReadMsgUnix(p, r.oob)
+	if err != nil {
+		return max(n, 0), err
+	}
+	if oobn > 0 {
+		msgs, err := syscall.ParseSocketControlMessage(r.oob[:oobn])
+		if err != nil {
+			return n, err
+		}
+		for i := range msgs {
+			fds, err := syscall.ParseUnixRights(&msgs[i])
+			if err != nil {
+				continue
+			}
+			r.c.mu.Lock()
+			r.c.fds = append(r.c.fds, fds...)
+			r.c.mu.Unlock()
+		}
+	}
+	return n, nil
+}
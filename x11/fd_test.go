@@ -0,0 +1,202 @@
+package x11
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/dzeromsk/helloX11/x11byte"
+)
+
+// newUnixTestConn is newTestConn over a UNIX socket pair, which can pass
+// file descriptors.
+func newUnixTestConn(t *testing.T) (*Conn, *net.UnixConn) {
+	t.Helper()
+	pair, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conns := make([]*net.UnixConn, 2)
+	for i, fd := range pair {
+		f := os.NewFile(uintptr(fd), "socketpair")
+		conn, err := net.FileConn(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		conns[i] = conn.(*net.UnixConn)
+	}
+	client, server := conns[0], conns[1]
+
+	go func() {
+		io.ReadFull(server, make([]byte, 12))
+		server.Write(testSetup())
+	}()
+	c, err := NewConn(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		c.Close()
+		server.Close()
+	})
+	return c, server
+}
+
+func TestRequestFds(t *testing.T) {
+	c, server := newUnixTestConn(t)
+	if !c.FdPassing() {
+		t.Fatal("FdPassing() = false over a UNIX socket")
+	}
+
+	f, err := os.CreateTemp(t.TempDir(), "fd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.WriteString("shared")
+
+	type result struct {
+		fds []int
+		err error
+	}
+	done := make(chan result)
+	go func() {
+		_, fds, err := c.RequestFds([]byte{200, 7, 1, 0}, 1)
+		done <- result{fds, err}
+	}()
+
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(server, req); err != nil {
+		t.Fatal(err)
+	}
+	var reply x11byte.Builder
+	reply.AddUint8(1)                // reply
+	reply.AddUint8(1)                // nfd
+	reply.AddUint16(1)               // sequenceNumber
+	reply.AddUint32(0)               // replyLength
+	reply.AddBytes(make([]byte, 24)) // unused
+	if _, _, err := server.WriteMsgUnix(reply.BytesOrPanic(), syscall.UnixRights(int(f.Fd())), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	r := <-done
+	if r.err != nil || len(r.fds) != 1 {
+		t.Fatalf("RequestFds() = %v, %v, want one fd", r.fds, r.err)
+	}
+	got := os.NewFile(uintptr(r.fds[0]), "received")
+	defer got.Close()
+	data := make([]byte, 6)
+	if _, err := got.ReadAt(data, 0); err != nil || !bytes.Equal(data, []byte("shared")) {
+		t.Errorf("received fd reads %q, %v", data, err)
+	}
+}
+
+// closed reports whether the write end of the pipe r reads from is closed
+// everywhere, waiting a little for it.
+func closed(t *testing.T, r *os.File) bool {
+	t.Helper()
+	r.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err := r.Read(make([]byte, 1))
+	return err == io.EOF
+}
+
+func TestUnclaimedFds(t *testing.T) {
+	c, server := newUnixTestConn(t)
+	var pipes, ends [3]*os.File // read ends, and write ends sent by the server
+	for i := range pipes {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		pipes[i], ends[i] = r, w
+	}
+	// reply answers request seq with the write ends, then closes them on
+	// the server side
+	reply := func(seq uint16, ends ...*os.File) {
+		t.Helper()
+		io.ReadFull(server, make([]byte, 4))
+		var b x11byte.Builder
+		b.AddUint8(1)                // reply
+		b.AddUint8(uint8(len(ends))) // nfd
+		b.AddUint16(seq)             // sequenceNumber
+		b.AddUint32(0)               // replyLength
+		b.AddBytes(make([]byte, 24)) // unused
+		var fds []int
+		for _, w := range ends {
+			fds = append(fds, int(w.Fd()))
+		}
+		if _, _, err := server.WriteMsgUnix(b.BytesOrPanic(), syscall.UnixRights(fds...), nil); err != nil {
+			t.Fatal(err)
+		}
+		for _, w := range ends {
+			w.Close()
+		}
+	}
+
+	// A reply carrying more than asked for
+	done := make(chan []int)
+	go func() {
+		_, fds, _ := c.RequestFds([]byte{200, 7, 1, 0}, 1)
+		done <- fds
+	}()
+	reply(1, ends[0], ends[1])
+	got := <-done
+	if len(got) != 1 {
+		t.Fatalf("got %d fds, want 1", len(got))
+	}
+	syscall.Close(got[0])
+	if !closed(t, pipes[0]) || !closed(t, pipes[1]) {
+		t.Error("the fd not asked for is still open")
+	}
+
+	// A reply to a request not expecting any, left over until Close
+	go func() {
+		c.Request([]byte{200, 8, 1, 0})
+		done <- nil
+	}()
+	reply(2, ends[2])
+	<-done
+	c.Close()
+	if !closed(t, pipes[2]) {
+		t.Error("the fd left over is still open after Close")
+	}
+}
+
+func TestSendFds(t *testing.T) {
+	c, server := newUnixTestConn(t)
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	go c.SendCheckedFds([]byte{200, 6, 1, 0}, int(w.Fd()))
+
+	buf, oob := make([]byte, 4), make([]byte, syscall.CmsgSpace(4))
+	n, oobn, _, _, err := server.ReadMsgUnix(buf, oob)
+	if err != nil || n != 4 {
+		t.Fatalf("ReadMsgUnix() = %d, %v", n, err)
+	}
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("control messages = %v, %v", msgs, err)
+	}
+	fds, err := syscall.ParseUnixRights(&msgs[0])
+	if err != nil || len(fds) != 1 {
+		t.Fatalf("fds = %v, %v", fds, err)
+	}
+	passed := os.NewFile(uintptr(fds[0]), "passed")
+	defer passed.Close()
+	passed.Write([]byte("x"))
+	if _, err := r.Read(buf[:1]); err != nil || buf[0] != 'x' {
+		t.Errorf("pipe read %q, %v through the passed fd", buf[:1], err)
+	}
+}
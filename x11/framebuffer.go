@@ -0,0 +1,297 @@
+package x11
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"math/bits"
+)
+
+var (
+	errFramebufferVisual = errors.New("x11: framebuffers need a TrueColor, DirectColor or PseudoColor visual")
+	errFramebufferFormat = errors.New("x11: unsupported framebuffer pixel format")
+	errFramebufferSize   = errors.New("x11: framebuffer memory too small")
+)
+
+// Framebuffer is an image whose pixels are laid out the way the server
+// expects them for a visual, so its memory, such as a MIT-SHM segment, can
+// be shown without conversion. It implements draw.Image, so any Go drawing
+// code can render into it.
+//
+// Colors are converted with the visual's channel masks, or for PseudoColor
+// visuals to the nearest entry of a color cube. On visuals with fewer than
+// 8 bits per channel, an ordered dither hides the banding.
+type Framebuffer struct {
+	// Pix holds the pixels in Z-pixmap format. The pixel at (x, y) starts
+	// at Pix[(y-Rect.Min.Y)*Stride+(x-Rect.Min.X)*BitsPerPixel/8].
+	Pix []byte
+	// Stride is the distance in bytes between vertically adjacent pixels.
+	Stride int
+	// Rect is the image's bounds.
+	Rect image.Rectangle
+
+	Visual       *Visual
+	Depth        uint8
+	BitsPerPixel int
+	ByteOrder    uint8 // the server's image byte order, 0 for LSBFirst
+
+	// Cube holds the colors of a PseudoColor visual, which has no channel
+	// masks. It must be set for such visuals.
+	Cube *ColorCube
+	// Dither enables ordered dithering in Set and SetRGBA.
+	Dither bool
+}
+
+// nearest is the dither threshold that rounds to the nearest level. Those
+// of the dither matrix are odd, in 32nds.
+const nearest = 16
+
+// bayer is a 4 × 4 ordered dither matrix.
+var bayer = [4][4]uint8{
+	{0, 8, 2, 10},
+	{12, 4, 14, 6},
+	{3, 11, 1, 9},
+	{15, 7, 13, 5},
+}
+
+// Stride returns the length of a Z-pixmap scanline of width pixels in this
+// format, including padding.
+func (f *Format) Stride(width int) int {
+	return scanlineBytes(width, int(f.BitsPerPixel), int(f.ScanlinePad))
+}
+
+// NewFramebuffer returns a width × height framebuffer for the visual, of the
+// given depth and pixmap format, over pix. Pix must hold at least
+// format.Stride(width)*height bytes.
+func NewFramebuffer(pix []byte, width, height int, visual *Visual, depth uint8, format *Format, byteOrder uint8) (*Framebuffer, error) {
+	switch visual.Class {
+	case VISUAL_CLASS_TRUE_COLOR, VISUAL_CLASS_DIRECT_COLOR, VISUAL_CLASS_PSEUDO_COLOR:
+	default:
+		return nil, errFramebufferVisual
+	}
+	switch format.BitsPerPixel {
+	case 8, 16, 24, 32:
+	default:
+		return nil, errFramebufferFormat
+	}
+	stride := format.Stride(width)
+	if len(pix) < stride*height {
+		return nil, errFramebufferSize
+	}
+	return &Framebuffer{
+		Pix:          pix[:stride*height],
+		Stride:       stride,
+		Rect:         image.Rect(0, 0, width, height),
+		Visual:       visual,
+		Depth:        depth,
+		BitsPerPixel: int(format.BitsPerPixel),
+		ByteOrder:    byteOrder,
+	}, nil
+}
+
+// NewFramebuffer returns a framebuffer over pix for the root visual of the
+// screen, in the pixmap format the server lists for its depth. For a
+// PseudoColor visual it draws with the DefaultColorCube. Dithering is on
+// when the visual has fewer than 8 bits per channel. See FramebufferSize for
+// the memory needed.
+func (c *Conn) NewFramebuffer(pix []byte, width, height int) (*Framebuffer, error) {
+	screen := c.Screen()
+	visual, depth := screen.Visual(screen.RootVisual)
+	format := c.setup.Format(depth)
+	if visual == nil || format == nil {
+		return nil, errFramebufferFormat
+	}
+	fb, err := NewFramebuffer(pix, width, height, visual, depth, format, c.setup.ImageByteOrder)
+	if err != nil {
+		return nil, err
+	}
+	if visual.Class == VISUAL_CLASS_PSEUDO_COLOR {
+		if fb.Cube, err = c.DefaultColorCube(); err != nil {
+			return nil, err
+		}
+	}
+	fb.Dither = fb.Cube != nil || bits.OnesCount32(visual.RedMask) < 8 ||
+		bits.OnesCount32(visual.GreenMask) < 8 || bits.OnesCount32(visual.BlueMask) < 8
+	return fb, nil
+}
+
+// FramebufferSize returns the number of bytes of a width × height
+// framebuffer for the root visual of the screen.
+func (c *Conn) FramebufferSize(width, height int) int {
+	format := c.setup.Format(c.Screen().RootDepth)
+	if format == nil {
+		return 0
+	}
+	return format.Stride(width) * height
+}
+
+// ColorModel returns a model that rounds colors to the precision of the
+// visual.
+func (f *Framebuffer) ColorModel() color.Model {
+	return color.ModelFunc(func(c color.Color) color.Color {
+		return f.decode(f.encode(c))
+	})
+}
+
+func (f *Framebuffer) Bounds() image.Rectangle { return f.Rect }
+
+// PixOffset returns the index of the first byte of the pixel at (x, y) in
+// Pix.
+func (f *Framebuffer) PixOffset(x, y int) int {
+	return (y-f.Rect.Min.Y)*f.Stride + (x-f.Rect.Min.X)*f.BitsPerPixel/8
+}
+
+func (f *Framebuffer) At(x, y int) color.Color {
+	return f.RGBAAt(x, y)
+}
+
+// RGBAAt returns the opaque color of the pixel at (x, y).
+func (f *Framebuffer) RGBAAt(x, y int) color.RGBA {
+	if !(image.Point{x, y}.In(f.Rect)) {
+		return color.RGBA{}
+	}
+	return f.decode(f.PixelAt(x, y))
+}
+
+// PixelAt returns the pixel value at (x, y).
+func (f *Framebuffer) PixelAt(x, y int) uint32 {
+	if !(image.Point{x, y}.In(f.Rect)) {
+		return 0
+	}
+	return getPixel(f.Pix[f.PixOffset(x, y):], f.BitsPerPixel, f.ByteOrder)
+}
+
+// Set stores the color at (x, y). Alpha is ignored, as windows are opaque.
+func (f *Framebuffer) Set(x, y int, c color.Color) {
+	if !(image.Point{x, y}.In(f.Rect)) {
+		return
+	}
+	putPixel(f.Pix[f.PixOffset(x, y):], 0, f.BitsPerPixel, f.ByteOrder, f.pixel(toRGBA(c), f.threshold(x, y)))
+}
+
+// SetRGBA is Set without the conversion to color.RGBA.
+func (f *Framebuffer) SetRGBA(x, y int, c color.RGBA) {
+	if !(image.Point{x, y}.In(f.Rect)) {
+		return
+	}
+	putPixel(f.Pix[f.PixOffset(x, y):], 0, f.BitsPerPixel, f.ByteOrder, f.pixel(c, f.threshold(x, y)))
+}
+
+// SubImage returns the part of the framebuffer inside r, sharing its
+// pixels.
+func (f *Framebuffer) SubImage(r image.Rectangle) image.Image {
+	r = r.Intersect(f.Rect)
+	sub := *f
+	sub.Rect = r
+	if r.Empty() {
+		sub.Pix = nil
+	} else {
+		sub.Pix = f.Pix[f.PixOffset(r.Min.X, r.Min.Y):]
+	}
+	return &sub
+}
+
+// Pixel returns the pixel value of a color in the visual, undithered.
+func (f *Framebuffer) Pixel(c color.Color) uint32 {
+	return f.encode(c)
+}
+
+func (f *Framebuffer) encode(c color.Color) uint32 {
+	return f.pixel(toRGBA(c), nearest)
+}
+
+// threshold returns the dither threshold of the pixel at (x, y).
+func (f *Framebuffer) threshold(x, y int) int {
+	if !f.Dither {
+		return nearest
+	}
+	return 2*int(bayer[y&3][x&3]) + 1
+}
+
+// pixel converts c to a pixel value, rounding channels up from threshold t,
+// in 32nds of a level.
+func (f *Framebuffer) pixel(c color.RGBA, t int) uint32 {
+	if cube := f.Cube; cube != nil {
+		n := cube.Levels
+		r, g, b := quantize(c.R, n, t), quantize(c.G, n, t), quantize(c.B, n, t)
+		return cube.Pixels[(r*n+g)*n+b]
+	}
+	v := f.Visual
+	if t == nearest {
+		return packChannel(c.R, v.RedMask) | packChannel(c.G, v.GreenMask) | packChannel(c.B, v.BlueMask)
+	}
+	return ditherChannel(c.R, v.RedMask, t) | ditherChannel(c.G, v.GreenMask, t) | ditherChannel(c.B, v.BlueMask, t)
+}
+
+func (f *Framebuffer) decode(p uint32) color.RGBA {
+	if f.Cube != nil {
+		if c, ok := f.Cube.colors[p]; ok {
+			return c
+		}
+		return color.RGBA{A: 0xff}
+	}
+	v := f.Visual
+	return color.RGBA{unpackChannel(p, v.RedMask), unpackChannel(p, v.GreenMask), unpackChannel(p, v.BlueMask), 0xff}
+}
+
+func toRGBA(c color.Color) color.RGBA {
+	if rgba, ok := c.(color.RGBA); ok {
+		return rgba
+	}
+	r, g, b, _ := c.RGBA()
+	return color.RGBA{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), 0xff}
+}
+
+// ditherChannel is packChannel for threshold t. Channels of 8 bits or more
+// need no dithering.
+func ditherChannel(v uint8, mask uint32, t int) uint32 {
+	width := bits.OnesCount32(mask)
+	if width >= 8 {
+		return packChannel(v, mask)
+	}
+	return uint32(quantize(v, 1<<width, t)) << bits.TrailingZeros32(mask)
+}
+
+// quantize maps v to one of n levels, rounding up when the remainder
+// reaches threshold t, in 32nds of a level.
+func quantize(v uint8, n, t int) int {
+	scaled := int(v) * (n - 1)
+	level, rest := scaled/255, scaled%255
+	if rest*32 >= t*255 {
+		level++
+	}
+	return level
+}
+
+// unpackChannel extracts a channel from a pixel and scales it to 8 bits,
+// the inverse of packChannel.
+func unpackChannel(p, mask uint32) uint8 {
+	if mask == 0 {
+		return 0
+	}
+	width := bits.OnesCount32(mask)
+	x := (p & mask) >> bits.TrailingZeros32(mask)
+	if width >= 8 {
+		return uint8(x >> (width - 8))
+	}
+	// Repeat the bits, so the largest value maps to 0xff.
+	v := x << (8 - width)
+	for s := width; s < 8; s += width {
+		v |= x << (8 - width) >> s
+	}
+	return uint8(v)
+}
+
+// getPixel loads the first pixel of row, stored in the given byte order.
+func getPixel(row []byte, bitsPerPixel int, byteOrder uint8) uint32 {
+	n := bitsPerPixel / 8
+	var v uint32
+	for i, b := range row[:n] {
+		if byteOrder == 0 { // LSBFirst
+			v |= uint32(b) << (8 * i)
+		} else {
+			v |= uint32(b) << (8 * (n - 1 - i))
+		}
+	}
+	return v
+}
@@ -0,0 +1,182 @@
+package x11
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/dzeromsk/helloX11/x11byte"
+)
+
+func TestFramebufferBGRX(t *testing.T) {
+	c, _ := newTestConn(t)
+	pix := make([]byte, c.FramebufferSize(3, 2))
+	fb, err := c.NewFramebuffer(pix, 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fb.Stride != 12 || len(fb.Pix) != 24 {
+		t.Fatalf("Stride = %d, len(Pix) = %d", fb.Stride, len(fb.Pix))
+	}
+
+	var _ draw.Image = fb
+	draw.Draw(fb, image.Rect(1, 1, 3, 2), image.NewUniform(color.RGBA{0x11, 0x22, 0x33, 0xff}), image.Point{}, draw.Src)
+	fb.Set(0, 0, color.NRGBA{0xff, 0x00, 0x80, 0xff})
+	want := []byte{
+		0x80, 0x00, 0xff, 0x00, 0, 0, 0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0x33, 0x22, 0x11, 0x00, 0x33, 0x22, 0x11, 0x00,
+	}
+	if !bytes.Equal(pix, want) {
+		t.Errorf("Pix = %x, want %x", pix, want)
+	}
+	if got := fb.At(2, 1); got != (color.RGBA{0x11, 0x22, 0x33, 0xff}) {
+		t.Errorf("At(2, 1) = %v", got)
+	}
+
+	sub := fb.SubImage(image.Rect(1, 1, 5, 5)).(*Framebuffer)
+	if sub.Bounds() != image.Rect(1, 1, 3, 2) || sub.RGBAAt(1, 1) != fb.RGBAAt(1, 1) {
+		t.Errorf("SubImage() = %v, %v", sub.Bounds(), sub.RGBAAt(1, 1))
+	}
+}
+
+func TestFramebufferRGB565MSBFirst(t *testing.T) {
+	visual := &Visual{Class: VISUAL_CLASS_TRUE_COLOR, RedMask: 0xf800, GreenMask: 0x07e0, BlueMask: 0x001f}
+	format := &Format{Depth: 16, BitsPerPixel: 16, ScanlinePad: 32}
+	pix := make([]byte, format.Stride(3)*1)
+	fb, err := NewFramebuffer(pix, 3, 1, visual, 16, format, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fb.Stride != 8 {
+		t.Errorf("Stride = %d, want 8", fb.Stride)
+	}
+
+	fb.Set(1, 0, color.RGBA{0xff, 0x84, 0x00, 0xff})
+	if pix[2] != 0xfc || pix[3] != 0x20 {
+		t.Errorf("pixel bytes = %x", pix[2:4])
+	}
+	if got := fb.RGBAAt(1, 0); got != (color.RGBA{0xff, 0x86, 0x00, 0xff}) {
+		t.Errorf("RGBAAt(1, 0) = %v", got)
+	}
+	if got := fb.ColorModel().Convert(color.White); got != (color.RGBA{0xff, 0xff, 0xff, 0xff}) {
+		t.Errorf("ColorModel().Convert(White) = %v", got)
+	}
+
+	if _, err := NewFramebuffer(pix[:4], 3, 1, visual, 16, format, 1); err == nil {
+		t.Error("NewFramebuffer accepted too little memory")
+	}
+}
+
+func TestFramebuffer30Bit(t *testing.T) {
+	visual := &Visual{Class: VISUAL_CLASS_TRUE_COLOR, RedMask: 0x3ff00000, GreenMask: 0x000ffc00, BlueMask: 0x000003ff}
+	format := &Format{Depth: 30, BitsPerPixel: 32, ScanlinePad: 32}
+	pix := make([]byte, format.Stride(1))
+	fb, err := NewFramebuffer(pix, 1, 1, visual, 30, format, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fb.Set(0, 0, color.RGBA{0xff, 0x80, 0x01, 0xff})
+	if p := fb.Pixel(color.RGBA{0xff, 0x80, 0x01, 0xff}); p != 0x3ff<<20|0x202<<10|0x004 {
+		t.Errorf("Pixel() = %#x", p)
+	}
+	if got := fb.RGBAAt(0, 0); got != (color.RGBA{0xff, 0x80, 0x01, 0xff}) {
+		t.Errorf("RGBAAt(0, 0) = %v", got)
+	}
+}
+
+func TestFramebufferDither(t *testing.T) {
+	visual := &Visual{Class: VISUAL_CLASS_TRUE_COLOR, RedMask: 0xf800, GreenMask: 0x07e0, BlueMask: 0x001f}
+	format := &Format{Depth: 16, BitsPerPixel: 16, ScanlinePad: 32}
+	fb, err := NewFramebuffer(make([]byte, format.Stride(4)*4), 4, 4, visual, 16, format, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fb.Dither = true
+
+	// A shade between two 5-bit levels averages out over the dither matrix
+	gray := color.RGBA{0x84, 0x84, 0x84, 0xff}
+	draw.Draw(fb, fb.Bounds(), image.NewUniform(gray), image.Point{}, draw.Src)
+	levels := map[uint8]int{}
+	sum := 0
+	for y := range 4 {
+		for x := range 4 {
+			r := fb.RGBAAt(x, y).R
+			levels[r]++
+			sum += int(r)
+		}
+	}
+	if len(levels) != 2 {
+		t.Errorf("red levels = %v, want two", levels)
+	}
+	if avg := sum / 16; avg < 0x82 || avg > 0x86 {
+		t.Errorf("average red = %#x, want about %#x", avg, gray.R)
+	}
+
+	// Exact levels are kept
+	fb.Set(1, 2, color.RGBA{0xff, 0x00, 0xff, 0xff})
+	if got := fb.RGBAAt(1, 2); got != (color.RGBA{0xff, 0x00, 0xff, 0xff}) {
+		t.Errorf("RGBAAt(1, 2) = %v", got)
+	}
+}
+
+func TestFramebufferPseudoColor(t *testing.T) {
+	visual := &Visual{Class: VISUAL_CLASS_PSEUDO_COLOR, BitsPerRGBValue: 8, ColormapEntries: 256}
+	format := &Format{Depth: 8, BitsPerPixel: 8, ScanlinePad: 32}
+	pix := make([]byte, format.Stride(2))
+	fb, err := NewFramebuffer(pix, 2, 1, visual, 8, format, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cube := &ColorCube{Levels: 2, colors: make(map[uint32]color.RGBA)}
+	for i := range 8 {
+		pixel := uint32(100 + i)
+		cube.Pixels = append(cube.Pixels, pixel)
+		cube.colors[pixel] = color.RGBA{uint8(i>>2&1) * 0xff, uint8(i>>1&1) * 0xff, uint8(i&1) * 0xff, 0xff}
+	}
+	fb.Cube = cube
+
+	fb.Set(0, 0, color.RGBA{0xf0, 0x10, 0xc0, 0xff})
+	fb.Set(1, 0, color.White)
+	if pix[0] != 105 || pix[1] != 107 {
+		t.Errorf("Pix = %v, want [105 107]", pix[:2])
+	}
+	if got := fb.RGBAAt(0, 0); got != (color.RGBA{0xff, 0x00, 0xff, 0xff}) {
+		t.Errorf("RGBAAt(0, 0) = %v", got)
+	}
+
+	if _, err := NewFramebuffer(pix, 2, 1, &Visual{Class: VISUAL_CLASS_STATIC_GRAY}, 8, format, 0); err == nil {
+		t.Error("NewFramebuffer accepted a StaticGray visual")
+	}
+}
+
+func TestQueryColors(t *testing.T) {
+	c, s := newTestConn(t)
+	type result struct {
+		colors []color.RGBA64
+		err    error
+	}
+	done := make(chan result)
+	go func() {
+		colors, err := c.QueryColors(0x20, 3, 7)
+		done <- result{colors, err}
+	}()
+
+	req := s.readRequest()
+	if req[0] != X11_REQUEST_QUERY_COLORS || len(req) != 16 || req[12] != 7 {
+		t.Fatalf("request = % x", []byte(req))
+	}
+	var body x11byte.Builder
+	body.AddUint16(2)               // colorsLen
+	body.AddBytes(make([]byte, 22)) // unused
+	body.AddBytes([]byte{0, 0xff, 0, 0, 0, 0, 0, 0})
+	body.AddBytes([]byte{0, 0, 0, 0x80, 0xff, 0xff, 0, 0})
+	s.reply(0, body.BytesOrPanic())
+
+	r := <-done
+	want := []color.RGBA64{{0xff00, 0, 0, 0xffff}, {0, 0x8000, 0xffff, 0xffff}}
+	if r.err != nil || len(r.colors) != 2 || r.colors[0] != want[0] || r.colors[1] != want[1] {
+		t.Errorf("QueryColors() = %v, %v, want %v", r.colors, r.err, want)
+	}
+}
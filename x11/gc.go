@@ -0,0 +1,81 @@
+package x11
+
+import "github.com/dzeromsk/helloX11/x11byte"
+
+// CreateGC creates a graphics context for drawable. The values are given in
+// the order of the bits set in valueMask.
+func (c *Conn) CreateGC(drawable, valueMask uint32, values ...uint32) (uint32, error) {
+	gcID, err := c.NewID()
+	if err != nil {
+		return 0, err
+	}
+
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_CREATE_GC)    // opcode
+	b.AddUint8(0)                        // unused
+	b.AddUint16(uint16(4 + len(values))) // requestLength
+	b.AddUint32(gcID)                    // cid
+	b.AddUint32(drawable)                // drawable
+	b.AddUint32(valueMask)               // gcValueMask
+	for _, v := range values {
+		b.AddUint32(v) // gcValues
+	}
+
+	if err := c.Send(b.BytesOrPanic()); err != nil {
+		return 0, err
+	}
+	return gcID, nil
+}
+
+// FreeGC destroys a graphics context.
+func (c *Conn) FreeGC(gc uint32) error {
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_FREE_GC) // opcode
+	b.AddUint8(0)                   // unused
+	b.AddUint16(2)                  // requestLength
+	b.AddUint32(gc)                 // gc
+	return c.Send(b.BytesOrPanic())
+}
+
+// CopyArea copies the width × height rectangle at srcX, srcY of src to dst
+// at dstX, dstY, on the server. Both drawables must have the same root and
+// depth. If gc has graphics exposures, as by default, the server reports
+// the parts of dst it could not fill from src with GraphicsExposure events,
+// or sends a NoExposure event.
+func (c *Conn) CopyArea(src, dst, gc uint32, srcX, srcY, dstX, dstY int16, width, height uint16) error {
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_COPY_AREA) // opcode
+	b.AddUint8(0)                     // unused
+	b.AddUint16(7)                    // requestLength
+	b.AddUint32(src)                  // srcDrawable
+	b.AddUint32(dst)                  // dstDrawable
+	b.AddUint32(gc)                   // gc
+	b.AddUint16(uint16(srcX))         // srcX
+	b.AddUint16(uint16(srcY))         // srcY
+	b.AddUint16(uint16(dstX))         // dstX
+	b.AddUint16(uint16(dstY))         // dstY
+	b.AddUint16(width)                // width
+	b.AddUint16(height)               // height
+	return c.Send(b.BytesOrPanic())
+}
+
+// CopyPlane is like CopyArea for one bit plane of src, drawn into dst in
+// the foreground color of gc where the bit is set and the background color
+// where it is not. Src may have any depth, bitPlane has a single bit set.
+func (c *Conn) CopyPlane(src, dst, gc uint32, srcX, srcY, dstX, dstY int16, width, height uint16, bitPlane uint32) error {
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_COPY_PLANE) // opcode
+	b.AddUint8(0)                      // unused
+	b.AddUint16(8)                     // requestLength
+	b.AddUint32(src)                   // srcDrawable
+	b.AddUint32(dst)                   // dstDrawable
+	b.AddUint32(gc)                    // gc
+	b.AddUint16(uint16(srcX))          // srcX
+	b.AddUint16(uint16(srcY))          // srcY
+	b.AddUint16(uint16(dstX))          // dstX
+	b.AddUint16(uint16(dstY))          // dstY
+	b.AddUint16(width)                 // width
+	b.AddUint16(height)                // height
+	b.AddUint32(bitPlane)              // bitPlane
+	return c.Send(b.BytesOrPanic())
+}
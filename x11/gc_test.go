@@ -0,0 +1,56 @@
+package x11
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dzeromsk/helloX11/x11byte"
+)
+
+func TestCopyArea(t *testing.T) {
+	c, s := newTestConn(t)
+
+	go c.CopyArea(5, 6, 7, 0, 16, -8, 0, 100, 50)
+
+	var want x11byte.Builder
+	want.AddUint8(X11_REQUEST_COPY_AREA) // opcode
+	want.AddUint8(0)                     // unused
+	want.AddUint16(7)                    // requestLength
+	want.AddUint32(5)                    // srcDrawable
+	want.AddUint32(6)                    // dstDrawable
+	want.AddUint32(7)                    // gc
+	want.AddUint16(0)                    // srcX
+	want.AddUint16(16)                   // srcY
+	want.AddUint16(0xfff8)               // dstX
+	want.AddUint16(0)                    // dstY
+	want.AddUint16(100)                  // width
+	want.AddUint16(50)                   // height
+	if req := s.readRequest(); !bytes.Equal(req, want.BytesOrPanic()) {
+		t.Errorf("CopyArea sent\n%v, want\n%v", []byte(req), want.BytesOrPanic())
+	}
+
+	// the server reports the part it could not copy
+	var ev x11byte.Builder
+	ev.AddUint8(X11_EVENT_GRAPHICS_EXPOSURE) // eventCode
+	ev.AddUint8(0)                           // unused
+	ev.AddUint16(1)                          // sequenceNumber
+	ev.AddUint32(6)                          // drawable
+	ev.AddUint16(0)                          // x
+	ev.AddUint16(40)                         // y
+	ev.AddUint16(100)                        // width
+	ev.AddUint16(10)                         // height
+	ev.AddUint16(0)                          // minorOpcode
+	ev.AddUint16(0)                          // count
+	ev.AddUint8(X11_REQUEST_COPY_AREA)       // majorOpcode
+	ev.AddBytes(make([]byte, 11))            // unused
+	s.write(ev.BytesOrPanic())
+
+	e, err := c.WaitForEvent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantEv := GraphicsExposureEvent{Drawable: 6, Y: 40, Width: 100, Height: 10, MajorOpcode: X11_REQUEST_COPY_AREA}
+	if gev, ok := e.(*GraphicsExposureEvent); !ok || *gev != wantEv {
+		t.Errorf("WaitForEvent() = %#v", e)
+	}
+}
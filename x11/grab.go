@@ -0,0 +1,297 @@
+package x11
+
+import (
+	"fmt"
+
+	"github.com/dzeromsk/helloX11/x11byte"
+)
+
+// X11_CURRENT_TIME stands for the server's current time in requests that
+// take a timestamp.
+const X11_CURRENT_TIME = 0
+
+// Focus targets and revert-to values for SetInputFocus.
+const (
+	X11_INPUT_FOCUS_NONE         = 0
+	X11_INPUT_FOCUS_POINTER_ROOT = 1
+	X11_INPUT_FOCUS_PARENT       = 2
+)
+
+// Grab modes. Synchronous grabs freeze event processing until AllowEvents.
+const (
+	X11_GRAB_MODE_SYNC  = 0
+	X11_GRAB_MODE_ASYNC = 1
+)
+
+// Wildcards for passive grabs.
+const (
+	X11_ANY_KEY      = 0
+	X11_ANY_BUTTON   = 0
+	X11_ANY_MODIFIER = 0x8000
+)
+
+// Modes for AllowEvents.
+const (
+	X11_ALLOW_ASYNC_POINTER   = 0
+	X11_ALLOW_SYNC_POINTER    = 1
+	X11_ALLOW_REPLAY_POINTER  = 2
+	X11_ALLOW_ASYNC_KEYBOARD  = 3
+	X11_ALLOW_SYNC_KEYBOARD   = 4
+	X11_ALLOW_REPLAY_KEYBOARD = 5
+	X11_ALLOW_ASYNC_BOTH      = 6
+	X11_ALLOW_SYNC_BOTH       = 7
+)
+
+// GrabStatus is the error returned when an active grab fails.
+type GrabStatus uint8
+
+// Grab statuses.
+const (
+	X11_GRAB_STATUS_SUCCESS         GrabStatus = 0
+	X11_GRAB_STATUS_ALREADY_GRABBED GrabStatus = 1
+	X11_GRAB_STATUS_INVALID_TIME    GrabStatus = 2
+	X11_GRAB_STATUS_NOT_VIEWABLE    GrabStatus = 3
+	X11_GRAB_STATUS_FROZEN          GrabStatus = 4
+)
+
+var grabStatusNames = [...]string{
+	"success",
+	"already grabbed",
+	"invalid time",
+	"not viewable",
+	"frozen",
+}
+
+func (s GrabStatus) Error() string {
+	if int(s) < len(grabStatusNames) {
+		return "x11: grab failed: " + grabStatusNames[s]
+	}
+	return fmt.Sprintf("x11: grab failed: status %d", uint8(s))
+}
+
+// InputFocus is the result of GetInputFocus.
+type InputFocus struct {
+	Focus    uint32 // window, X11_INPUT_FOCUS_NONE or X11_INPUT_FOCUS_POINTER_ROOT
+	RevertTo uint8
+}
+
+// SetInputFocus moves the keyboard focus to focus. If the focus window
+// becomes unviewable the focus reverts as revertTo, one of X11_INPUT_FOCUS_*.
+func (c *Conn) SetInputFocus(focus uint32, revertTo uint8, time uint32) error {
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_SET_INPUT_FOCUS) // opcode
+	b.AddUint8(revertTo)                    // revertTo
+	b.AddUint16(3)                          // requestLength
+	b.AddUint32(focus)                      // focus
+	b.AddUint32(time)                       // time
+
+	return c.Send(b.BytesOrPanic())
+}
+
+// GetInputFocus returns the window that has the keyboard focus.
+func (c *Conn) GetInputFocus() (*InputFocus, error) {
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_GET_INPUT_FOCUS) // opcode
+	b.AddUint8(0)                           // unused
+	b.AddUint16(1)                          // requestLength
+
+	reply, err := c.Request(b.BytesOrPanic())
+	if err != nil {
+		return nil, err
+	}
+
+	var f InputFocus
+	reply.Skip(1) // reply
+	reply.ReadUint8(&f.RevertTo)
+	reply.Skip(2) // sequenceNumber
+	reply.Skip(4) // replyLength
+	reply.ReadUint32(&f.Focus)
+	return &f, nil
+}
+
+// Focus gives the window the keyboard focus, reverting to its parent if it
+// becomes unviewable.
+func (w *Window) Focus() error {
+	return w.c.SetInputFocus(w.ID, X11_INPUT_FOCUS_PARENT, X11_CURRENT_TIME)
+}
+
+// HasFocus reports whether the window has the keyboard focus.
+func (w *Window) HasFocus() (bool, error) {
+	f, err := w.c.GetInputFocus()
+	if err != nil {
+		return false, err
+	}
+	return f.Focus == w.ID, nil
+}
+
+// PointerGrab describes an active or passive pointer grab.
+type PointerGrab struct {
+	OwnerEvents  bool   // report events to this client's windows as usual
+	EventMask    uint16 // pointer events to report, X11_EVENT_FLAG_*
+	PointerMode  uint8  // X11_GRAB_MODE_*
+	KeyboardMode uint8  // X11_GRAB_MODE_*
+	ConfineTo    uint32 // window to confine the pointer to, or X11_NONE
+	Cursor       uint32 // cursor to show during the grab, or X11_NONE
+}
+
+// GrabPointer actively grabs the pointer, so all pointer events are reported
+// relative to window. It returns a GrabStatus error if the grab fails.
+func (c *Conn) GrabPointer(window uint32, g PointerGrab, time uint32) error {
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_GRAB_POINTER) // opcode
+	b.AddUint8(boolByte(g.OwnerEvents))  // ownerEvents
+	b.AddUint16(6)                       // requestLength
+	b.AddUint32(window)                  // grabWindow
+	b.AddUint16(g.EventMask)             // eventMask
+	b.AddUint8(g.PointerMode)            // pointerMode
+	b.AddUint8(g.KeyboardMode)           // keyboardMode
+	b.AddUint32(g.ConfineTo)             // confineTo
+	b.AddUint32(g.Cursor)                // cursor
+	b.AddUint32(time)                    // time
+
+	return c.grabRequest(b.BytesOrPanic())
+}
+
+// UngrabPointer releases an active pointer grab.
+func (c *Conn) UngrabPointer(time uint32) error {
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_UNGRAB_POINTER) // opcode
+	b.AddUint8(0)                          // unused
+	b.AddUint16(2)                         // requestLength
+	b.AddUint32(time)                      // time
+
+	return c.Send(b.BytesOrPanic())
+}
+
+// GrabButton establishes a passive grab: pressing button with modifiers
+// while the pointer is in window starts an active pointer grab.
+func (c *Conn) GrabButton(window uint32, button uint8, modifiers uint16, g PointerGrab) error {
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_GRAB_BUTTON) // opcode
+	b.AddUint8(boolByte(g.OwnerEvents)) // ownerEvents
+	b.AddUint16(6)                      // requestLength
+	b.AddUint32(window)                 // grabWindow
+	b.AddUint16(g.EventMask)            // eventMask
+	b.AddUint8(g.PointerMode)           // pointerMode
+	b.AddUint8(g.KeyboardMode)          // keyboardMode
+	b.AddUint32(g.ConfineTo)            // confineTo
+	b.AddUint32(g.Cursor)               // cursor
+	b.AddUint8(button)                  // button
+	b.AddUint8(0)                       // unused
+	b.AddUint16(modifiers)              // modifiers
+
+	return c.SendChecked(b.BytesOrPanic())
+}
+
+// UngrabButton releases a passive button grab.
+func (c *Conn) UngrabButton(window uint32, button uint8, modifiers uint16) error {
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_UNGRAB_BUTTON) // opcode
+	b.AddUint8(button)                    // button
+	b.AddUint16(3)                        // requestLength
+	b.AddUint32(window)                   // grabWindow
+	b.AddUint16(modifiers)                // modifiers
+	b.AddUint16(0)                        // unused
+
+	return c.Send(b.BytesOrPanic())
+}
+
+// GrabKeyboard actively grabs the keyboard, so all key events are reported
+// relative to window. It returns a GrabStatus error if the grab fails.
+func (c *Conn) GrabKeyboard(window uint32, ownerEvents bool, pointerMode, keyboardMode uint8, time uint32) error {
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_GRAB_KEYBOARD) // opcode
+	b.AddUint8(boolByte(ownerEvents))     // ownerEvents
+	b.AddUint16(4)                        // requestLength
+	b.AddUint32(window)                   // grabWindow
+	b.AddUint32(time)                     // time
+	b.AddUint8(pointerMode)               // pointerMode
+	b.AddUint8(keyboardMode)              // keyboardMode
+	b.AddUint16(0)                        // unused
+
+	return c.grabRequest(b.BytesOrPanic())
+}
+
+// UngrabKeyboard releases an active keyboard grab.
+func (c *Conn) UngrabKeyboard(time uint32) error {
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_UNGRAB_KEYBOARD) // opcode
+	b.AddUint8(0)                           // unused
+	b.AddUint16(2)                          // requestLength
+	b.AddUint32(time)                       // time
+
+	return c.Send(b.BytesOrPanic())
+}
+
+// GrabKey establishes a passive grab: pressing key with modifiers while
+// window or one of its descendants has the focus starts an active keyboard
+// grab. Grabbing on the root window makes a global hotkey. The modifiers
+// must match exactly, so hotkeys are usually grabbed once more for each
+// combination with Lock and Num Lock. It fails with BadAccess if another
+// client holds the same grab.
+func (c *Conn) GrabKey(window uint32, key uint8, modifiers uint16, ownerEvents bool, pointerMode, keyboardMode uint8) error {
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_GRAB_KEY)  // opcode
+	b.AddUint8(boolByte(ownerEvents)) // ownerEvents
+	b.AddUint16(4)                    // requestLength
+	b.AddUint32(window)               // grabWindow
+	b.AddUint16(modifiers)            // modifiers
+	b.AddUint8(key)                   // key
+	b.AddUint8(pointerMode)           // pointerMode
+	b.AddUint8(keyboardMode)          // keyboardMode
+	b.AddUint24(0)                    // unused
+
+	return c.SendChecked(b.BytesOrPanic())
+}
+
+// UngrabKey releases a passive key grab.
+func (c *Conn) UngrabKey(window uint32, key uint8, modifiers uint16) error {
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_UNGRAB_KEY) // opcode
+	b.AddUint8(key)                    // key
+	b.AddUint16(3)                     // requestLength
+	b.AddUint32(window)                // grabWindow
+	b.AddUint16(modifiers)             // modifiers
+	b.AddUint16(0)                     // unused
+
+	return c.Send(b.BytesOrPanic())
+}
+
+// AllowEvents releases events frozen by a synchronous grab, as selected by
+// mode, one of X11_ALLOW_*.
+func (c *Conn) AllowEvents(mode uint8, time uint32) error {
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_ALLOW_EVENTS) // opcode
+	b.AddUint8(mode)                     // mode
+	b.AddUint16(2)                       // requestLength
+	b.AddUint32(time)                    // time
+
+	return c.Send(b.BytesOrPanic())
+}
+
+func (c *Conn) grabRequest(req []byte) error {
+	reply, err := c.Request(req)
+	if err != nil {
+		return err
+	}
+	var status uint8
+	reply.Skip(1) // reply
+	reply.ReadUint8(&status)
+	if status != 0 {
+		return GrabStatus(status)
+	}
+	return nil
+}
+
+// RootWindow returns the root window of the screen, for instance to
+// register a handler for events of passive grabs on it.
+func (c *Conn) RootWindow() *Window {
+	return &Window{c: c, ID: c.Screen().Root}
+}
+
+func boolByte(v bool) uint8 {
+	if v {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,74 @@
+package x11
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/dzeromsk/helloX11/x11byte"
+)
+
+func TestGrabPointer(t *testing.T) {
+	c, s := newTestConn(t)
+
+	done := make(chan error)
+	grab := PointerGrab{
+		EventMask:    X11_EVENT_FLAG_BUTTON_RELEASE | X11_EVENT_FLAG_POINTER_MOTION,
+		PointerMode:  X11_GRAB_MODE_ASYNC,
+		KeyboardMode: X11_GRAB_MODE_ASYNC,
+		ConfineTo:    5,
+	}
+	go func() { done <- c.GrabPointer(5, grab, X11_CURRENT_TIME) }()
+
+	req := s.readRequest()
+	var (
+		window, confineTo uint32
+		mask              uint16
+	)
+	req.Skip(4)
+	req.ReadUint32(&window)
+	req.ReadUint16(&mask)
+	req.Skip(2)
+	req.ReadUint32(&confineTo)
+	if window != 5 || mask != 0x48 || confineTo != 5 {
+		t.Errorf("GrabPointer sent window %d, mask %#x, confineTo %d", window, mask, confineTo)
+	}
+	s.reply(uint8(X11_GRAB_STATUS_ALREADY_GRABBED), nil)
+
+	var status GrabStatus
+	if err := <-done; !errors.As(err, &status) || status != X11_GRAB_STATUS_ALREADY_GRABBED {
+		t.Errorf("GrabPointer() = %v, want already grabbed", err)
+	}
+}
+
+func TestFocus(t *testing.T) {
+	c, s := newTestConn(t)
+
+	var b x11byte.Builder
+	b.AddUint8(X11_EVENT_FOCUS_OUT)         // eventCode
+	b.AddUint8(X11_NOTIFY_DETAIL_NONLINEAR) // detail
+	b.AddUint16(1)                          // sequenceNumber
+	b.AddUint32(5)                          // event
+	b.AddUint8(X11_NOTIFY_MODE_GRAB)        // mode
+	b.AddBytes(make([]byte, 23))            // unused
+	ev, ok := c.decodeEvent(b.BytesOrPanic()).(*FocusEvent)
+	if !ok || ev.In || ev.Event != 5 || ev.Detail != X11_NOTIFY_DETAIL_NONLINEAR || ev.Mode != X11_NOTIFY_MODE_GRAB {
+		t.Errorf("decoded %+v", ev)
+	}
+
+	w := &Window{c: c, ID: 5}
+	result := make(chan bool)
+	go func() {
+		focused, err := w.HasFocus()
+		if err != nil {
+			t.Error(err)
+		}
+		result <- focused
+	}()
+	s.readRequest()
+	var body x11byte.Builder
+	body.AddUint32(5) // focus
+	s.reply(X11_INPUT_FOCUS_PARENT, body.BytesOrPanic())
+	if !<-result {
+		t.Error("HasFocus() = false")
+	}
+}
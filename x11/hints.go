@@ -0,0 +1,59 @@
+package x11
+
+// Bits of the flags field of _MOTIF_WM_HINTS.
+const (
+	MWM_HINTS_FUNCTIONS   = 1 << 0
+	MWM_HINTS_DECORATIONS = 1 << 1
+)
+
+// WithoutDecorations asks the window manager not to draw a title bar or
+// borders around the window, see SetDecorated.
+func WithoutDecorations() WindowOption {
+	return WithProperty(func(w *Window) error {
+		return w.SetDecorated(false)
+	})
+}
+
+// SetDecorated sets _MOTIF_WM_HINTS to turn window manager decorations on or
+// off. Nearly every window manager honors this Motif-era property, as EWMH
+// has no equivalent.
+func (w *Window) SetDecorated(decorated bool) error {
+	motifWMHints, err := w.c.Atom("_MOTIF_WM_HINTS")
+	if err != nil {
+		return err
+	}
+	var decorations uint32
+	if decorated {
+		decorations = 1
+	}
+	return w.c.ChangePropertyUint32(w.ID, motifWMHints, motifWMHints,
+		MWM_HINTS_DECORATIONS, // flags
+		0,                     // functions
+		decorations,           // decorations
+		0,                     // inputMode
+		0,                     // status
+	)
+}
+
+// WithTransientFor marks the window as a dialog belonging to parent, see
+// SetTransientFor.
+func WithTransientFor(parent uint32) WindowOption {
+	return WithProperty(func(w *Window) error {
+		return w.SetTransientFor(parent)
+	})
+}
+
+// SetTransientFor sets WM_TRANSIENT_FOR, so the window manager keeps the
+// window above parent and may center it over it.
+func (w *Window) SetTransientFor(parent uint32) error {
+	return w.c.ChangePropertyUint32(w.ID, X11_ATOM_WM_TRANSIENT_FOR, X11_ATOM_WINDOW, parent)
+}
+
+// WithOverrideRedirect creates a window the window manager does not manage
+// at all: it is not decorated, moved or given focus. Use it for tooltips,
+// menus and overlays that the application positions itself.
+func WithOverrideRedirect() WindowOption {
+	return func(cfg *windowConfig) {
+		cfg.overrideRedirect = true
+	}
+}
@@ -0,0 +1,83 @@
+package x11
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dzeromsk/helloX11/x11byte"
+)
+
+// changePropertyRequest returns the ChangeProperty request replacing a
+// property with 32-bit values.
+func changePropertyRequest(window, property, typ uint32, values ...uint32) []byte {
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_CHANGE_PROPERTY) // opcode
+	b.AddUint8(X11_PROP_MODE_REPLACE)       // mode
+	b.AddUint16(uint16(6 + len(values)))    // requestLength
+	b.AddUint32(window)                     // window
+	b.AddUint32(property)                   // property
+	b.AddUint32(typ)                        // type
+	b.AddUint8(32)                          // format
+	b.AddUint24(0)                          // unused
+	b.AddUint32(uint32(len(values)))        // dataLength
+	for _, v := range values {
+		b.AddUint32(v) // data
+	}
+	return b.BytesOrPanic()
+}
+
+func TestWindowHints(t *testing.T) {
+	const window = 0x00400001
+	for _, tt := range []struct {
+		name string
+		set  func(w *Window) error
+		want [][]byte
+	}{
+		{
+			"_NET_WM_WINDOW_TYPE",
+			func(w *Window) error { return w.SetWindowType(NetWMWindowTypeDialog, NetWMWindowTypeNormal) },
+			[][]byte{changePropertyRequest(window, 300, X11_ATOM_ATOM, 301, 302)},
+		},
+		{
+			"_NET_WM_STRUT_PARTIAL",
+			func(w *Window) error {
+				return w.SetStrut(Strut{Top: 30, TopStartX: 0, TopEndX: 1919, BottomStartX: 5, BottomEndX: 6})
+			},
+			[][]byte{
+				changePropertyRequest(window, 303, X11_ATOM_CARDINAL, 0, 0, 30, 0, 0, 0, 0, 0, 0, 1919, 5, 6),
+				changePropertyRequest(window, 304, X11_ATOM_CARDINAL, 0, 0, 30, 0),
+			},
+		},
+		{
+			"_MOTIF_WM_HINTS decorated",
+			func(w *Window) error { return w.SetDecorated(true) },
+			[][]byte{changePropertyRequest(window, 305, 305, MWM_HINTS_DECORATIONS, 0, 1, 0, 0)},
+		},
+		{
+			"_MOTIF_WM_HINTS undecorated",
+			func(w *Window) error { return w.SetDecorated(false) },
+			[][]byte{changePropertyRequest(window, 305, 305, MWM_HINTS_DECORATIONS, 0, 0, 0, 0)},
+		},
+		{
+			"WM_TRANSIENT_FOR",
+			func(w *Window) error { return w.SetTransientFor(0x00400002) },
+			[][]byte{changePropertyRequest(window, X11_ATOM_WM_TRANSIENT_FOR, X11_ATOM_WINDOW, 0x00400002)},
+		},
+	} {
+		c, s := newTestConn(t)
+		c.atoms.store("_NET_WM_WINDOW_TYPE", 300)
+		c.atoms.store(NetWMWindowTypeDialog, 301)
+		c.atoms.store(NetWMWindowTypeNormal, 302)
+		c.atoms.store("_NET_WM_STRUT_PARTIAL", 303)
+		c.atoms.store("_NET_WM_STRUT", 304)
+		c.atoms.store("_MOTIF_WM_HINTS", 305)
+
+		w := &Window{c: c, ID: window}
+		go tt.set(w)
+		for i, want := range tt.want {
+			if req := s.readRequest(); !bytes.Equal(req, want) {
+				t.Errorf("%s: request %d is\n%v, want\n%v", tt.name, i, []byte(req), want)
+			}
+		}
+	}
+}
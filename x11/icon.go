@@ -0,0 +1,207 @@
+package x11
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"math/bits"
+
+	"github.com/dzeromsk/helloX11/x11byte"
+)
+
+var (
+	errIconVisual = errors.New("x11: icon pixmaps need a TrueColor or DirectColor root visual")
+	errEmptyIcon  = errors.New("x11: empty icon image")
+)
+
+// WM_HINTS flags.
+const (
+	WM_HINTS_INPUT       = 1 << 0
+	WM_HINTS_STATE       = 1 << 1
+	WM_HINTS_ICON_PIXMAP = 1 << 2
+	WM_HINTS_ICON_WINDOW = 1 << 3
+	WM_HINTS_ICON_POS    = 1 << 4
+	WM_HINTS_ICON_MASK   = 1 << 5
+	WM_HINTS_GROUP       = 1 << 6
+	WM_HINTS_URGENCY     = 1 << 8
+)
+
+// WithIcon sets the window icon, see SetIcon.
+func WithIcon(icons ...image.Image) WindowOption {
+	return WithProperty(func(w *Window) error {
+		return w.SetIcon(icons...)
+	})
+}
+
+// SetIcon sets _NET_WM_ICON, the icon shown in taskbars and task switchers.
+// Pass the same icon at several sizes (for example 16, 32, 48 and 256 pixels)
+// and the window manager picks the best one for each place it is shown.
+//
+// Large icons exceed the core request size limit. BIG-REQUESTS is enabled to
+// send them in one piece when the server supports it; otherwise the property
+// is written in several chunks.
+func (w *Window) SetIcon(icons ...image.Image) error {
+	netWMIcon, err := w.c.Atom("_NET_WM_ICON")
+	if err != nil {
+		return err
+	}
+	data := netWMIconData(icons)
+	if 28+len(data) > w.c.MaxRequestLength() {
+		// failure is fine, ChangeProperty falls back to chunks
+		w.c.EnableBigRequests()
+	}
+	return w.c.ChangeProperty(X11_PROP_MODE_REPLACE, w.ID, netWMIcon, X11_ATOM_CARDINAL, 32, data)
+}
+
+// netWMIconData encodes icons as _NET_WM_ICON CARDINALs: width, height and
+// then width*height non-premultiplied ARGB pixels, row by row, for each icon.
+func netWMIconData(icons []image.Image) []byte {
+	var b x11byte.Builder
+	for _, icon := range icons {
+		r := icon.Bounds()
+		b.AddUint32(uint32(r.Dx())) // width
+		b.AddUint32(uint32(r.Dy())) // height
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				c := color.NRGBAModel.Convert(icon.At(x, y)).(color.NRGBA)
+				b.AddUint32(uint32(c.A)<<24 | uint32(c.R)<<16 | uint32(c.G)<<8 | uint32(c.B))
+			}
+		}
+	}
+	return b.BytesOrPanic()
+}
+
+// SetIconPixmap sets the legacy WM_HINTS icon pixmap and mask, for window
+// managers and docks that predate _NET_WM_ICON. Fully transparent pixels are
+// masked out, partially transparent ones are drawn opaque. The other hints
+// already set, such as the initial state, are kept.
+func (w *Window) SetIconPixmap(icon image.Image) error {
+	c := w.c
+	screen := c.Screen()
+	visual, depth := screen.Visual(screen.RootVisual)
+	format := c.setup.Format(depth)
+	if visual == nil || format == nil || (visual.Class != VISUAL_CLASS_TRUE_COLOR && visual.Class != VISUAL_CLASS_DIRECT_COLOR) {
+		return errIconVisual
+	}
+
+	r := icon.Bounds()
+	if r.Empty() {
+		return errEmptyIcon
+	}
+	width, height := r.Dx(), r.Dy()
+
+	stride := scanlineBytes(width, int(format.BitsPerPixel), int(format.ScanlinePad))
+	pixels := make([]byte, stride*height)
+	maskStride := scanlineBytes(width, 1, int(c.setup.BitmapFormatScanlinePad))
+	mask := make([]byte, maskStride*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			col := color.NRGBAModel.Convert(icon.At(r.Min.X+x, r.Min.Y+y)).(color.NRGBA)
+			v := packChannel(col.R, visual.RedMask) | packChannel(col.G, visual.GreenMask) | packChannel(col.B, visual.BlueMask)
+			putPixel(pixels[y*stride:], x, int(format.BitsPerPixel), c.setup.ImageByteOrder, v)
+			if col.A != 0 {
+				bit := uint(x % 8)
+				if c.setup.BitmapFormatBitOrder != 0 { // MSBFirst
+					bit = 7 - bit
+				}
+				mask[y*maskStride+x/8] |= 1 << bit
+			}
+		}
+	}
+
+	current, err := c.GetPropertyUint32(w.ID, X11_ATOM_WM_HINTS, X11_ATOM_WM_HINTS)
+	if err != nil {
+		return err
+	}
+	var hints [9]uint32 // flags, input, initialState, iconPixmap, iconWindow, iconX, iconY, iconMask, windowGroup
+	copy(hints[:], current)
+
+	var pixmaps []uint32 // freed unless they end up in WM_HINTS
+	defer func() {
+		for _, p := range pixmaps {
+			c.FreePixmap(p)
+		}
+	}()
+	pixmap, err := c.CreatePixmap(screen.Root, depth, uint16(width), uint16(height))
+	if err != nil {
+		return err
+	}
+	pixmaps = append(pixmaps, pixmap)
+	maskPixmap, err := c.CreatePixmap(screen.Root, 1, uint16(width), uint16(height))
+	if err != nil {
+		return err
+	}
+	pixmaps = append(pixmaps, maskPixmap)
+	if err := c.putPixmap(pixmap, depth, width, height, stride, pixels); err != nil {
+		return err
+	}
+	if err := c.putPixmap(maskPixmap, 1, width, height, maskStride, mask); err != nil {
+		return err
+	}
+
+	if hints[0]&WM_HINTS_INPUT == 0 {
+		hints[1] = 1 // input
+	}
+	hints[0] |= WM_HINTS_INPUT | WM_HINTS_ICON_PIXMAP | WM_HINTS_ICON_MASK
+	hints[3], hints[7] = pixmap, maskPixmap
+	if err := c.ChangePropertyUint32(w.ID, X11_ATOM_WM_HINTS, X11_ATOM_WM_HINTS, hints[:]...); err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	old := w.iconPixmaps
+	w.iconPixmaps, pixmaps = pixmaps, nil
+	w.mu.Unlock()
+	for _, p := range old {
+		if err := c.FreePixmap(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// putPixmap fills a whole pixmap with a Z format image.
+func (c *Conn) putPixmap(pixmap uint32, depth uint8, width, height, stride int, data []byte) error {
+	gc, err := c.CreateGC(pixmap, 0)
+	if err != nil {
+		return err
+	}
+	defer c.FreeGC(gc)
+	return c.PutImage(X11_IMAGE_FORMAT_Z_PIXMAP, pixmap, gc, depth, uint16(width), uint16(height), 0, 0, stride, data)
+}
+
+// scanlineBytes returns the length of a scanline of width pixels, padded to
+// a multiple of pad bits.
+func scanlineBytes(width, bitsPerPixel, pad int) int {
+	return (width*bitsPerPixel + pad - 1) / pad * pad / 8
+}
+
+// packChannel scales an 8-bit channel to the width of a visual's channel mask
+// and shifts it into place.
+func packChannel(v uint8, mask uint32) uint32 {
+	if mask == 0 {
+		return 0
+	}
+	shift := bits.TrailingZeros32(mask)
+	width := bits.OnesCount32(mask)
+	x := uint32(v)
+	if width <= 8 {
+		x >>= 8 - width
+	} else {
+		x = x<<(width-8) | x>>(16-width)
+	}
+	return x << shift
+}
+
+// putPixel stores pixel x of a scanline in the server's image byte order.
+func putPixel(row []byte, x, bitsPerPixel int, byteOrder uint8, v uint32) {
+	n := bitsPerPixel / 8
+	p := row[x*n : x*n+n]
+	for i := range p {
+		if byteOrder == 0 { // LSBFirst
+			p[i] = byte(v >> (8 * i))
+		} else {
+			p[i] = byte(v >> (8 * (n - 1 - i)))
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package x11
+
+import (
+	"image"
+	"image/color"
+	"io"
+	"testing"
+
+	"github.com/dzeromsk/helloX11/x11byte"
+)
+
+func TestNetWMIconData(t *testing.T) {
+	small := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	small.Set(0, 0, color.NRGBA{0x11, 0x22, 0x33, 0x80})
+	small.Set(1, 0, color.NRGBA{0xff, 0x00, 0x00, 0xff})
+	big := image.NewRGBA(image.Rect(5, 5, 6, 6))
+	big.Set(5, 5, color.RGBA{0x40, 0x00, 0x00, 0x80}) // premultiplied
+
+	s := x11byte.String(netWMIconData([]image.Image{small, big}))
+	want := []uint32{
+		2, 1, 0x80112233, 0xffff0000,
+		1, 1, 0x807f0000,
+	}
+	for i, w := range want {
+		var got uint32
+		if !s.ReadUint32(&got) || got != w {
+			t.Errorf("value %d = %#x, want %#x", i, got, w)
+		}
+	}
+	if !s.Empty() {
+		t.Errorf("%d trailing bytes", len(s))
+	}
+}
+
+func TestPackChannel(t *testing.T) {
+	for _, tt := range []struct {
+		v    uint8
+		mask uint32
+		want uint32
+	}{
+		{0xff, 0xff0000, 0xff0000},
+		{0x80, 0x0000ff, 0x000080},
+		{0xff, 0xf800, 0xf800},         // RGB565 red
+		{0x84, 0x07e0, 0x0420},         // RGB565 green
+		{0xff, 0x3ff00000, 0x3ff00000}, // 10-bit red
+		{0x00, 0, 0},
+	} {
+		if got := packChannel(tt.v, tt.mask); got != tt.want {
+			t.Errorf("packChannel(%#x, %#x) = %#x, want %#x", tt.v, tt.mask, got, tt.want)
+		}
+	}
+}
+
+func TestChangePropertyChunked(t *testing.T) {
+	c, s := newTestConn(t)
+	c.setup.MaximumRequestLength = 11 // 44 bytes, 16 bytes of data per request
+
+	data := make([]byte, 40)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	go c.ChangeProperty(X11_PROP_MODE_REPLACE, 1, 2, X11_ATOM_CARDINAL, 32, data)
+
+	for i, want := range []struct {
+		mode   uint8
+		values int
+	}{
+		{X11_PROP_MODE_REPLACE, 4},
+		{X11_PROP_MODE_APPEND, 4},
+		{X11_PROP_MODE_APPEND, 2},
+	} {
+		req := s.readRequest()
+		if req[1] != want.mode {
+			t.Errorf("chunk %d mode = %d, want %d", i, req[1], want.mode)
+		}
+		var n uint32
+		req.Skip(20)
+		req.ReadUint32(&n)
+		if int(n) != want.values || req[0] != byte(i*16) {
+			t.Errorf("chunk %d has %d values starting at %d", i, n, req[0])
+		}
+	}
+}
+
+func TestBigRequest(t *testing.T) {
+	c, s := newTestConn(t)
+	c.bigRequestLength.Store(1 << 20)
+
+	data := make([]byte, 0x10000*4)
+	go c.Send(append([]byte{X11_REQUEST_CHANGE_PROPERTY, 0, 0, 0}, data...))
+
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(s.conn, header); err != nil {
+		t.Fatal(err)
+	}
+	length := x11byte.String(header[4:])
+	var n uint32
+	length.ReadUint32(&n)
+	if header[2] != 0 || header[3] != 0 || n != 0x10000+2 {
+		t.Errorf("header = %v, want zero length and %d", header, 0x10000+2)
+	}
+
+	// The extended length counts against the maximum
+	full := make([]byte, c.MaxRequestLength())
+	full[0] = X11_REQUEST_CHANGE_PROPERTY
+	if err := c.Send(full); err != errRequestTooLong {
+		t.Errorf("Send() of %d bytes = %v, want errRequestTooLong", len(full), err)
+	}
+}
+
+func TestSetIconPixmap(t *testing.T) {
+	c, s := newTestConn(t)
+	w := &Window{c: c, ID: 0x00400001}
+	if err := w.SetIconPixmap(image.NewNRGBA(image.Rect(0, 0, 0, 16))); err != errEmptyIcon {
+		t.Errorf("SetIconPixmap() of empty image = %v, want errEmptyIcon", err)
+	}
+
+	icon := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	icon.Set(0, 0, color.NRGBA{0xff, 0, 0, 0xff})
+	done := make(chan error)
+	go func() { done <- w.SetIconPixmap(icon) }()
+
+	// Hints set before, to keep: not accepting input, starting iconic,
+	// urgent and in a group
+	flags := uint32(WM_HINTS_INPUT | WM_HINTS_STATE | WM_HINTS_URGENCY | WM_HINTS_GROUP)
+	var current x11byte.Builder
+	current.AddUint32(X11_ATOM_WM_HINTS) // type
+	current.AddUint32(0)                 // bytesAfter
+	current.AddUint32(9)                 // valueLength
+	current.AddBytes(make([]byte, 12))   // unused
+	current.AddUint32(flags)             // flags
+	current.AddUint32(0)                 // input
+	current.AddUint32(3)                 // initialState, Iconic
+	current.AddBytes(make([]byte, 20))   // iconPixmap, iconWindow, iconX, iconY, iconMask
+	current.AddUint32(0x00400002)        // windowGroup
+
+	var (
+		pixmaps, gcs []uint32
+		req          x11byte.String
+	)
+	for req = s.readRequest(); req[0] != X11_REQUEST_CHANGE_PROPERTY; req = s.readRequest() {
+		var id uint32
+		v := req[4:]
+		v.ReadUint32(&id)
+		switch req[0] {
+		case X11_REQUEST_GET_PROPERTY:
+			s.reply(32, current.BytesOrPanic())
+		case X11_REQUEST_GET_INPUT_FOCUS:
+			s.reply(0, nil)
+		case X11_REQUEST_CREATE_PIXMAP:
+			pixmaps = append(pixmaps, id)
+		case X11_REQUEST_CREATE_GC:
+			gcs = append(gcs, id)
+		case X11_REQUEST_FREE_GC:
+			if len(gcs) == 0 || gcs[len(gcs)-1] != id {
+				t.Errorf("FreeGC(%#x) of unknown GC", id)
+			}
+		}
+	}
+
+	var hints [9]uint32
+	values := req[24:]
+	for i := range hints {
+		values.ReadUint32(&hints[i])
+	}
+	if len(pixmaps) != 2 || len(gcs) != 2 {
+		t.Fatalf("created pixmaps %#x and GCs %#x", pixmaps, gcs)
+	}
+	want := [9]uint32{
+		flags | WM_HINTS_ICON_PIXMAP | WM_HINTS_ICON_MASK, 0, 3, pixmaps[0], 0, 0, 0, pixmaps[1], 0x00400002,
+	}
+	if hints != want {
+		t.Errorf("WM_HINTS = %#x, want %#x", hints, want)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
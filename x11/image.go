@@ -0,0 +1,131 @@
+package x11
+
+import (
+	"errors"
+
+	"github.com/dzeromsk/helloX11/x11byte"
+)
+
+var (
+	errRowTooLong = errors.New("x11: image row exceeds maximum request length")
+	errStride     = errors.New("x11: image stride is not positive")
+)
+
+// CreatePixmap creates an off-screen drawable of the given depth on the
+// same screen as drawable.
+func (c *Conn) CreatePixmap(drawable uint32, depth uint8, width, height uint16) (uint32, error) {
+	pixmapID, err := c.NewID()
+	if err != nil {
+		return 0, err
+	}
+
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_CREATE_PIXMAP) // opcode
+	b.AddUint8(depth)                     // depth
+	b.AddUint16(4)                        // requestLength
+	b.AddUint32(pixmapID)                 // pid
+	b.AddUint32(drawable)                 // drawable
+	b.AddUint16(width)                    // width
+	b.AddUint16(height)                   // height
+
+	if err := c.Send(b.BytesOrPanic()); err != nil {
+		return 0, err
+	}
+	return pixmapID, nil
+}
+
+// FreePixmap frees a pixmap once the server no longer references it.
+func (c *Conn) FreePixmap(pixmap uint32) error {
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_FREE_PIXMAP) // opcode
+	b.AddUint8(0)                       // unused
+	b.AddUint16(2)                      // requestLength
+	b.AddUint32(pixmap)                 // pixmap
+	return c.Send(b.BytesOrPanic())
+}
+
+// PutImage uploads an image to drawable at dstX, dstY. Rows are stride bytes
+// apart in data and must already be laid out for the format and depth, with
+// scanlines padded as the server's pixmap formats require. Images larger
+// than a single request are sent as several horizontal strips. An image
+// without rows sends nothing.
+func (c *Conn) PutImage(format uint8, drawable, gc uint32, depth uint8, width, height uint16, dstX, dstY int16, stride int, data []byte) error {
+	if height == 0 {
+		return nil
+	}
+	if stride <= 0 {
+		return errStride
+	}
+	rows := (c.MaxRequestLength() - 28) / stride // 24 bytes of header, 4 of BIG-REQUESTS length
+	if rows == 0 {
+		return errRowTooLong
+	}
+
+	for y := 0; y < int(height); y += rows {
+		n := min(rows, int(height)-y)
+		strip := data[y*stride : (y+n)*stride]
+
+		var b x11byte.Builder
+		b.AddUint8(X11_REQUEST_PUT_IMAGE)         // opcode
+		b.AddUint8(format)                        // format
+		b.AddUint16(uint16(6 + len(strip)/4))     // requestLength
+		b.AddUint32(drawable)                     // drawable
+		b.AddUint32(gc)                           // gc
+		b.AddUint16(width)                        // width
+		b.AddUint16(uint16(n))                    // height
+		b.AddUint16(uint16(dstX))                 // dstX
+		b.AddUint16(uint16(int(dstY) + y))        // dstY
+		b.AddUint8(0)                             // leftPad
+		b.AddUint8(depth)                         // depth
+		b.AddUint16(0)                            // unused
+		b.AddBytes(strip)                         // data
+		b.AddBytes(make([]byte, pad(len(strip)))) // padding
+
+		if err := c.Send(b.BytesOrPanic()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ImageData is the result of GetImage.
+type ImageData struct {
+	Depth  uint8
+	Visual uint32 // X11_NONE for pixmaps
+	Data   []byte // scanlines padded as for PutImage
+}
+
+// GetImage reads back the width × height rectangle at x, y of drawable,
+// in the given format, keeping the bits of planeMask. A window must be
+// viewable and the rectangle on screen; obscured parts are undefined
+// unless the window has backing store.
+func (c *Conn) GetImage(format uint8, drawable uint32, x, y int16, width, height uint16, planeMask uint32) (*ImageData, error) {
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_GET_IMAGE) // opcode
+	b.AddUint8(format)                // format
+	b.AddUint16(5)                    // requestLength
+	b.AddUint32(drawable)             // drawable
+	b.AddUint16(uint16(x))            // x
+	b.AddUint16(uint16(y))            // y
+	b.AddUint16(width)                // width
+	b.AddUint16(height)               // height
+	b.AddUint32(planeMask)            // planeMask
+
+	reply, err := c.Request(b.BytesOrPanic())
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		img    ImageData
+		length uint32
+	)
+	reply.Skip(1) // reply
+	reply.ReadUint8(&img.Depth)
+	reply.Skip(2) // sequenceNumber
+	reply.ReadUint32(&length)
+	reply.ReadUint32(&img.Visual)
+	reply.Skip(20) // unused
+	reply.ReadBytes(&img.Data, int(length)*4)
+	return &img, nil
+}
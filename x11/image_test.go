@@ -0,0 +1,46 @@
+package x11
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dzeromsk/helloX11/x11byte"
+)
+
+func TestGetImage(t *testing.T) {
+	c, s := newTestConn(t)
+
+	result := make(chan *ImageData)
+	go func() {
+		img, err := c.GetImage(X11_IMAGE_FORMAT_Z_PIXMAP, 5, 0, 0, 2, 1, 0xffffffff)
+		if err != nil {
+			t.Error(err)
+		}
+		result <- img
+	}()
+
+	req := s.readRequest()
+	if req[0] != X11_REQUEST_GET_IMAGE || req[1] != X11_IMAGE_FORMAT_Z_PIXMAP || len(req) != 20 {
+		t.Errorf("GetImage sent %v", []byte(req))
+	}
+	var body x11byte.Builder
+	body.AddUint32(0x21)                          // visual
+	body.AddBytes(make([]byte, 20))               // unused
+	body.AddBytes([]byte{1, 2, 3, 0, 4, 5, 6, 0}) // data
+	s.reply(24, body.BytesOrPanic())
+
+	img := <-result
+	if img.Depth != 24 || img.Visual != 0x21 || !bytes.Equal(img.Data, []byte{1, 2, 3, 0, 4, 5, 6, 0}) {
+		t.Errorf("GetImage() = %+v", img)
+	}
+}
+
+func TestPutImageEmpty(t *testing.T) {
+	c, _ := newTestConn(t)
+	if err := c.PutImage(X11_IMAGE_FORMAT_Z_PIXMAP, 1, 2, 24, 0, 0, 0, 0, 0, nil); err != nil {
+		t.Errorf("PutImage() without rows = %v", err)
+	}
+	if err := c.PutImage(X11_IMAGE_FORMAT_Z_PIXMAP, 1, 2, 24, 1, 1, 0, 0, 0, nil); err != errStride {
+		t.Errorf("PutImage() with zero stride = %v, want errStride", err)
+	}
+}
@@ -0,0 +1,382 @@
+package x11
+
+import (
+	"sync"
+	"sync/atomic"
+	"unicode"
+
+	"github.com/dzeromsk/helloX11/x11byte"
+)
+
+// Modifier masks in the State of input events.
+const (
+	X11_MOD_MASK_SHIFT   = 0x0001
+	X11_MOD_MASK_LOCK    = 0x0002
+	X11_MOD_MASK_CONTROL = 0x0004
+	X11_MOD_MASK_1       = 0x0008
+	X11_MOD_MASK_2       = 0x0010
+	X11_MOD_MASK_3       = 0x0020
+	X11_MOD_MASK_4       = 0x0040
+	X11_MOD_MASK_5       = 0x0080
+)
+
+// Pointer button masks in the State of input events.
+const (
+	X11_BUTTON_MASK_1 = 0x0100
+	X11_BUTTON_MASK_2 = 0x0200
+	X11_BUTTON_MASK_3 = 0x0400
+	X11_BUTTON_MASK_4 = 0x0800
+	X11_BUTTON_MASK_5 = 0x1000
+)
+
+// KeyButMask is the state of the modifiers and pointer buttons reported with
+// input events, a combination of X11_MOD_MASK_* and X11_BUTTON_MASK_*.
+type KeyButMask uint16
+
+// Has reports whether all modifiers and buttons in mask are down.
+func (s KeyButMask) Has(mask KeyButMask) bool {
+	return s&mask == mask
+}
+
+// Button reports whether pointer button 1 to 5 is down.
+func (s KeyButMask) Button(button uint8) bool {
+	return button >= 1 && button <= 5 && s&(X11_BUTTON_MASK_1<<(button-1)) != 0
+}
+
+// Modifiers returns the modifier bits without the buttons.
+func (s KeyButMask) Modifiers() KeyButMask {
+	return s & 0xff
+}
+
+// GetKeyboardMapping returns the keysyms of count keycodes starting at first,
+// keysymsPerKeycode entries per keycode.
+func (c *Conn) GetKeyboardMapping(first, count uint8) (keysymsPerKeycode int, keysyms []uint32, err error) {
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_GET_KEYBOARD_MAPPING) // opcode
+	b.AddUint8(0)                                // unused
+	b.AddUint16(2)                               // requestLength
+	b.AddUint8(first)                            // firstKeycode
+	b.AddUint8(count)                            // count
+	b.AddUint16(0)                               // unused
+
+	reply, err := c.Request(b.BytesOrPanic())
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var (
+		perKeycode uint8
+		length     uint32
+	)
+	reply.Skip(1) // reply
+	reply.ReadUint8(&perKeycode)
+	reply.Skip(2) // sequenceNumber
+	reply.ReadUint32(&length)
+	reply.Skip(24) // unused
+	keysyms = make([]uint32, length)
+	for i := range keysyms {
+		reply.ReadUint32(&keysyms[i])
+	}
+	return int(perKeycode), keysyms, nil
+}
+
+// GetModifierMapping returns the keycodes bound to each of the eight
+// modifiers, Shift, Lock, Control and Mod1 to Mod5.
+func (c *Conn) GetModifierMapping() ([8][]uint8, error) {
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_GET_MODIFIER_MAPPING) // opcode
+	b.AddUint8(0)                                // unused
+	b.AddUint16(1)                               // requestLength
+
+	var mods [8][]uint8
+	reply, err := c.Request(b.BytesOrPanic())
+	if err != nil {
+		return mods, err
+	}
+
+	var perModifier uint8
+	reply.Skip(1) // reply
+	reply.ReadUint8(&perModifier)
+	reply.Skip(2)  // sequenceNumber
+	reply.Skip(4)  // replyLength
+	reply.Skip(24) // unused
+	for i := range mods {
+		for range perModifier {
+			var keycode uint8
+			if reply.ReadUint8(&keycode) && keycode != 0 {
+				mods[i] = append(mods[i], keycode)
+			}
+		}
+	}
+	return mods, nil
+}
+
+// Keymap translates keycodes to keysyms. It is never modified after it is
+// built, so it can be shared freely.
+type Keymap struct {
+	minKeycode uint8
+	perKeycode int
+	keysyms    []uint32
+	modifiers  [8][]uint8
+
+	modeSwitch KeyButMask // modifier mask of Mode_switch
+	numLock    KeyButMask // modifier mask of Num_Lock
+	lock       uint32     // XK_Caps_Lock, XK_Shift_Lock or NoSymbol
+}
+
+// LoadKeymap fetches the keyboard and modifier mappings for all keycodes.
+func (c *Conn) LoadKeymap() (*Keymap, error) {
+	setup := c.Setup()
+	perKeycode, keysyms, err := c.GetKeyboardMapping(setup.MinKeycode, setup.MaxKeycode-setup.MinKeycode+1)
+	if err != nil {
+		return nil, err
+	}
+	mods, err := c.GetModifierMapping()
+	if err != nil {
+		return nil, err
+	}
+	return newKeymap(setup.MinKeycode, perKeycode, keysyms, mods), nil
+}
+
+func newKeymap(minKeycode uint8, perKeycode int, keysyms []uint32, modifiers [8][]uint8) *Keymap {
+	m := &Keymap{
+		minKeycode: minKeycode,
+		perKeycode: perKeycode,
+		keysyms:    keysyms,
+		modifiers:  modifiers,
+	}
+	for i, keycodes := range modifiers {
+		for _, keycode := range keycodes {
+			for _, ks := range m.row(keycode) {
+				switch {
+				case ks == XK_Mode_switch:
+					m.modeSwitch |= 1 << i
+				case ks == XK_Num_Lock:
+					m.numLock |= 1 << i
+				case i == 1 && ks == XK_Caps_Lock:
+					m.lock = XK_Caps_Lock
+				case i == 1 && ks == XK_Shift_Lock && m.lock == NoSymbol:
+					m.lock = XK_Shift_Lock
+				}
+			}
+		}
+	}
+	return m
+}
+
+// withKeysyms returns a copy of m with the keysyms of count keycodes starting
+// at first replaced.
+func (m *Keymap) withKeysyms(first uint8, perKeycode int, keysyms []uint32) *Keymap {
+	per := max(m.perKeycode, perKeycode)
+	rows := len(m.keysyms) / max(m.perKeycode, 1)
+	if first >= m.minKeycode && perKeycode > 0 {
+		rows = max(rows, int(first-m.minKeycode)+len(keysyms)/perKeycode)
+	}
+
+	merged := make([]uint32, rows*per)
+	for i := range rows {
+		copy(merged[i*per:], m.row(m.minKeycode+uint8(i)))
+	}
+	for i := 0; perKeycode > 0 && i+perKeycode <= len(keysyms); i += perKeycode {
+		keycode := int(first) + i/perKeycode
+		if keycode < int(m.minKeycode) {
+			continue
+		}
+		row := merged[(keycode-int(m.minKeycode))*per:][:per]
+		clear(row)
+		copy(row, keysyms[i:i+perKeycode])
+	}
+	return newKeymap(m.minKeycode, per, merged, m.modifiers)
+}
+
+// row returns the keysyms of keycode, or nil if it is out of range.
+func (m *Keymap) row(keycode uint8) []uint32 {
+	if keycode < m.minKeycode || m.perKeycode == 0 {
+		return nil
+	}
+	i := int(keycode-m.minKeycode) * m.perKeycode
+	if i+m.perKeycode > len(m.keysyms) {
+		return nil
+	}
+	return m.keysyms[i : i+m.perKeycode]
+}
+
+// Keysyms returns the keysyms bound to keycode, with trailing NoSymbol
+// entries removed.
+func (m *Keymap) Keysyms(keycode uint8) []uint32 {
+	row := m.row(keycode)
+	for len(row) > 0 && row[len(row)-1] == NoSymbol {
+		row = row[:len(row)-1]
+	}
+	return row
+}
+
+// Keycode returns a keycode that produces ks, for instance to grab it with
+// GrabKey, and false if no key does.
+func (m *Keymap) Keycode(ks uint32) (uint8, bool) {
+	for i := range len(m.keysyms) / max(m.perKeycode, 1) {
+		keycode := m.minKeycode + uint8(i)
+		for _, k := range m.row(keycode) {
+			if k == ks {
+				return keycode, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// Modifiers returns the keycodes bound to each modifier.
+func (m *Keymap) Modifiers() [8][]uint8 {
+	return m.modifiers
+}
+
+// Keysym returns the keysym produced by keycode with the given modifier
+// state, following the rules of the core protocol: Mode_switch selects the
+// second group, Num_Lock selects keypad digits, Shift selects the second
+// keysym of a group, and Lock acts as Caps Lock or Shift Lock depending on
+// the keysyms bound to it.
+func (m *Keymap) Keysym(keycode uint8, state KeyButMask) uint32 {
+	var k [4]uint32
+	switch syms := m.Keysyms(keycode); len(syms) {
+	case 0:
+		return NoSymbol
+	case 1:
+		k = [4]uint32{syms[0], NoSymbol, syms[0], NoSymbol}
+	case 2:
+		k = [4]uint32{syms[0], syms[1], syms[0], syms[1]}
+	case 3:
+		k = [4]uint32{syms[0], syms[1], syms[2], NoSymbol}
+	default:
+		copy(k[:], syms)
+	}
+
+	group := k[0:2]
+	if state&m.modeSwitch != 0 && (k[2] != NoSymbol || k[3] != NoSymbol) {
+		group = k[2:4]
+	}
+	k1, k2 := group[0], group[1]
+	if k2 == NoSymbol {
+		lower, upper := ConvertCase(k1)
+		if lower != upper {
+			k1, k2 = lower, upper
+		} else {
+			k2 = k1
+		}
+	}
+
+	shift := state&X11_MOD_MASK_SHIFT != 0
+	lock := state&X11_MOD_MASK_LOCK != 0
+	switch {
+	case state&m.numLock != 0 && IsKeypadKey(k2):
+		if shift || lock && m.lock == XK_Shift_Lock {
+			return k1
+		}
+		return k2
+	case !shift && (!lock || m.lock == NoSymbol):
+		return k1
+	case !shift && m.lock == XK_Caps_Lock:
+		_, upper := ConvertCase(k1)
+		return upper
+	case shift && lock && m.lock == XK_Caps_Lock:
+		_, upper := ConvertCase(k2)
+		return upper
+	default:
+		return k2
+	}
+}
+
+// Lookup returns the keysym produced by a key event.
+func (m *Keymap) Lookup(ev *KeyEvent) uint32 {
+	return m.Keysym(ev.Keycode, ev.State)
+}
+
+// Text returns the text typed by a key event, or "" if the key produces
+// none. With Control held it returns control characters, see ControlRune.
+func (m *Keymap) Text(ev *KeyEvent) string {
+	r := KeysymToRune(m.Lookup(ev))
+	if r < 0 {
+		return ""
+	}
+	if ev.State&X11_MOD_MASK_CONTROL != 0 {
+		r = ControlRune(r)
+	}
+	return string(r)
+}
+
+// ControlRune returns the control character typed by r with Control held:
+// letters and @[\]^_ map to 0x00-0x1f, and ? to DEL. Other runes are
+// returned unchanged.
+func ControlRune(r rune) rune {
+	switch {
+	case r >= '@' && r <= '_', r >= 'a' && r <= 'z':
+		return unicode.ToUpper(r) & 0x1f
+	case r == '?':
+		return 0x7f
+	case r == ' ', r == '2':
+		return 0
+	}
+	return r
+}
+
+// Keyboard keeps a Keymap up to date as MappingNotify events arrive. The
+// current Keymap is replaced as a whole, so key handlers running on other
+// goroutines always see either the old or the new mapping.
+type Keyboard struct {
+	c      *Conn
+	mu     sync.Mutex // serializes updates
+	keymap atomic.Pointer[Keymap]
+}
+
+// NewKeyboard loads the keymap and returns a Keyboard tracking it.
+func (c *Conn) NewKeyboard() (*Keyboard, error) {
+	m, err := c.LoadKeymap()
+	if err != nil {
+		return nil, err
+	}
+	k := &Keyboard{c: c}
+	k.keymap.Store(m)
+	return k, nil
+}
+
+// Keymap returns the current keymap.
+func (k *Keyboard) Keymap() *Keymap {
+	return k.keymap.Load()
+}
+
+// Lookup returns the keysym produced by a key event with the current keymap.
+func (k *Keyboard) Lookup(ev *KeyEvent) uint32 {
+	return k.Keymap().Lookup(ev)
+}
+
+// Text returns the text typed by a key event with the current keymap.
+func (k *Keyboard) Text(ev *KeyEvent) string {
+	return k.Keymap().Text(ev)
+}
+
+// Update applies a MappingNotify event. A keyboard change re-fetches only
+// the keycodes it names, and a modifier change only the modifier mapping.
+// Pointer mapping changes do not affect the keymap.
+func (k *Keyboard) Update(ev *MappingNotifyEvent) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	old := k.keymap.Load()
+	switch ev.Request {
+	case X11_MAPPING_MODIFIER:
+		mods, err := k.c.GetModifierMapping()
+		if err != nil {
+			return err
+		}
+		k.keymap.Store(newKeymap(old.minKeycode, old.perKeycode, old.keysyms, mods))
+	case X11_MAPPING_KEYBOARD:
+		if ev.Count == 0 {
+			return nil
+		}
+		perKeycode, keysyms, err := k.c.GetKeyboardMapping(ev.FirstKeycode, ev.Count)
+		if err != nil {
+			return err
+		}
+		k.keymap.Store(old.withKeysyms(ev.FirstKeycode, perKeycode, keysyms))
+	}
+	return nil
+}
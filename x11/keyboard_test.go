@@ -0,0 +1,307 @@
+package x11
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dzeromsk/helloX11/x11byte"
+)
+
+// testKeymap is a small layout with Shift on 10, Caps Lock on 11, Num Lock on
+// 12 (Mod2) and Mode_switch on 13 (Mod5).
+func testKeymap() *Keymap {
+	keysyms := []uint32{
+		XK_Shift_L, 0, 0, 0, // 10
+		XK_Caps_Lock, 0, 0, 0, // 11
+		XK_Num_Lock, 0, 0, 0, // 12
+		XK_Mode_switch, 0, 0, 0, // 13
+		'a', 0, 0, 0, // 14
+		'1', '!', 0, 0, // 15
+		XK_KP_End, XK_KP_0 + 1, 0, 0, // 16
+		'e', 'E', XK_EuroSign, 0, // 17
+		0x6c1, 0x6e1, 0, 0, // 18, Cyrillic a
+		0, 0, 0, 0, // 19
+	}
+	var mods [8][]uint8
+	mods[0] = []uint8{10}
+	mods[1] = []uint8{11}
+	mods[4] = []uint8{12}
+	mods[7] = []uint8{13}
+	return newKeymap(10, 4, keysyms, mods)
+}
+
+func TestKeysym(t *testing.T) {
+	m := testKeymap()
+	const (
+		shift = X11_MOD_MASK_SHIFT
+		lock  = X11_MOD_MASK_LOCK
+		num   = X11_MOD_MASK_2
+		mode  = X11_MOD_MASK_5
+	)
+	for _, tt := range []struct {
+		keycode uint8
+		state   KeyButMask
+		want    uint32
+	}{
+		{14, 0, 'a'},
+		{14, shift, 'A'},
+		{14, lock, 'A'},
+		{14, shift | lock, 'A'},
+		{14, mode, 'a'}, // empty second group falls back to the first
+		{15, 0, '1'},
+		{15, shift, '!'},
+		{15, lock, '1'},
+		{16, 0, XK_KP_End},
+		{16, num, XK_KP_0 + 1},
+		{16, num | shift, XK_KP_End},
+		{17, mode, XK_EuroSign},
+		{17, mode | shift, XK_EuroSign},
+		{18, lock, 0x6e1},
+		{19, 0, NoSymbol},
+		{9, 0, NoSymbol},
+		{200, 0, NoSymbol},
+	} {
+		if got := m.Keysym(tt.keycode, tt.state); got != tt.want {
+			t.Errorf("Keysym(%d, %#x) = %#x, want %#x", tt.keycode, tt.state, got, tt.want)
+		}
+	}
+	if kc, ok := m.Keycode('!'); !ok || kc != 15 {
+		t.Errorf("Keycode('!') = %d, %v, want 15", kc, ok)
+	}
+	if _, ok := m.Keycode(XK_F1); ok {
+		t.Error("Keycode(F1) found a key")
+	}
+}
+
+func TestKeysymToRune(t *testing.T) {
+	for _, tt := range []struct {
+		ks   uint32
+		want rune
+	}{
+		{'a', 'a'},
+		{0xe9, 'é'},
+		{0x1b3, 'ł'},
+		{0x6c1, 'а'},
+		{0x6b3, 'Ё'},
+		{0x7e1, 'α'},
+		{0x7f3, 'ς'},
+		{0xce0, 'א'},
+		{XK_EuroSign, '€'},
+		{0x010020ac, '€'},
+		{XK_Return, '\r'},
+		{XK_KP_0 + 7, '7'},
+		{XK_Shift_L, -1},
+		{XK_F1, -1},
+	} {
+		if got := KeysymToRune(tt.ks); got != tt.want {
+			t.Errorf("KeysymToRune(%#x) = %q, want %q", tt.ks, got, tt.want)
+		}
+	}
+
+	if lower, upper := ConvertCase(0x1b3); lower != 0x1b3 || upper != 0x1a3 {
+		t.Errorf("ConvertCase(lstroke) = %#x, %#x", lower, upper)
+	}
+	if ks := RuneToKeysym('Ж'); ks != 0x6f6 {
+		t.Errorf("RuneToKeysym('Ж') = %#x, want 0x6f6", ks)
+	}
+}
+
+func TestKeyText(t *testing.T) {
+	m := testKeymap()
+	for _, tt := range []struct {
+		keycode uint8
+		state   KeyButMask
+		want    string
+	}{
+		{14, 0, "a"},
+		{14, X11_MOD_MASK_CONTROL, "\x01"},
+		{17, X11_MOD_MASK_5, "€"},
+		{10, 0, ""},
+	} {
+		ev := &KeyEvent{Pressed: true, Keycode: tt.keycode, State: tt.state}
+		if got := m.Text(ev); got != tt.want {
+			t.Errorf("Text(%d, %#x) = %q, want %q", tt.keycode, tt.state, got, tt.want)
+		}
+	}
+}
+
+func TestLoadKeymap(t *testing.T) {
+	c, s := newTestConn(t)
+
+	result := make(chan *Keymap)
+	go func() {
+		m, err := c.LoadKeymap()
+		if err != nil {
+			t.Error(err)
+		}
+		result <- m
+	}()
+
+	req := s.readRequest()
+	if req[0] != X11_REQUEST_GET_KEYBOARD_MAPPING || req[4] != 8 || req[5] != 248 {
+		t.Errorf("sent %v, want GetKeyboardMapping(8, 248)", []byte(req))
+	}
+	var body x11byte.Builder
+	body.AddBytes(make([]byte, 24)) // unused
+	for i := range 248 * 2 {
+		body.AddUint32(uint32('a' + i%26))
+	}
+	s.reply(2, body.BytesOrPanic())
+
+	req = s.readRequest()
+	if req[0] != X11_REQUEST_GET_MODIFIER_MAPPING {
+		t.Errorf("sent %v, want GetModifierMapping", []byte(req))
+	}
+	body = x11byte.Builder{}
+	body.AddBytes(make([]byte, 24)) // unused
+	body.AddBytes([]byte{50, 62, 66, 0, 37, 105, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0})
+	s.reply(2, body.BytesOrPanic())
+
+	m := <-result
+	if m == nil {
+		t.FailNow()
+	}
+	if got := m.Keysyms(9); len(got) != 2 || got[0] != 'c' || got[1] != 'd' {
+		t.Errorf("Keysyms(9) = %v, want [c d]", got)
+	}
+	if mods := m.Modifiers(); len(mods[0]) != 2 || len(mods[1]) != 1 || len(mods[2]) != 2 {
+		t.Errorf("Modifiers() = %v", mods)
+	}
+}
+
+func TestKeyboardUpdate(t *testing.T) {
+	c, s := newTestConn(t)
+	k := &Keyboard{c: c}
+	k.keymap.Store(testKeymap())
+	old := k.Keymap()
+
+	var ev [32]byte
+	ev[0] = X11_EVENT_MAPPING_NOTIFY
+	ev[4], ev[5], ev[6] = X11_MAPPING_KEYBOARD, 14, 2
+	mapping, ok := c.decodeEvent(x11byte.String(ev[:])).(*MappingNotifyEvent)
+	if !ok || mapping.FirstKeycode != 14 || mapping.Count != 2 {
+		t.Fatalf("decoded %+v", mapping)
+	}
+
+	done := make(chan error)
+	go func() { done <- k.Update(mapping) }()
+	req := s.readRequest()
+	if req[0] != X11_REQUEST_GET_KEYBOARD_MAPPING || req[4] != 14 || req[5] != 2 {
+		t.Errorf("sent %v, want GetKeyboardMapping(14, 2)", []byte(req))
+	}
+	var body x11byte.Builder
+	body.AddBytes(make([]byte, 24)) // unused
+	for _, ks := range []uint32{'b', 0, 0, 0, 0, 0, '2', '@', 0, 0, 0, 0} {
+		body.AddUint32(ks)
+	}
+	s.reply(6, body.BytesOrPanic())
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	m := k.Keymap()
+	if m == old {
+		t.Fatal("keymap not replaced")
+	}
+	if got := m.Keysym(14, X11_MOD_MASK_SHIFT); got != 'B' {
+		t.Errorf("Keysym(14, Shift) = %#x, want 'B'", got)
+	}
+	if got := m.Keysym(15, X11_MOD_MASK_SHIFT); got != '@' {
+		t.Errorf("Keysym(15, Shift) = %#x, want '@'", got)
+	}
+	if got := m.Keysym(17, X11_MOD_MASK_5); got != XK_EuroSign {
+		t.Errorf("Keysym(17, Mod5) = %#x, want EuroSign after update", got)
+	}
+	if got := old.Keysym(15, X11_MOD_MASK_SHIFT); got != '!' {
+		t.Errorf("old keymap changed, Keysym(15, Shift) = %#x", got)
+	}
+
+	// dropping Mode_switch from Mod5 disables the second group
+	go func() { done <- k.Update(&MappingNotifyEvent{Request: X11_MAPPING_MODIFIER}) }()
+	s.readRequest()
+	body = x11byte.Builder{}
+	body.AddBytes(make([]byte, 24)) // unused
+	body.AddBytes([]byte{10, 11, 0, 0, 12, 0, 0, 0})
+	s.reply(1, body.BytesOrPanic())
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if got := k.Keymap().Keysym(17, X11_MOD_MASK_5); got != 'e' {
+		t.Errorf("Keysym(17, Mod5) = %#x, want 'e' without Mode_switch", got)
+	}
+}
+
+func TestRepeatDetector(t *testing.T) {
+	c, s := newTestConn(t)
+	r := NewRepeatDetector(c)
+	key := func(pressed bool, time uint32) *KeyEvent {
+		return &KeyEvent{Pressed: pressed, Keycode: 30, Time: time}
+	}
+
+	if first := key(true, 1); r.Filter(first) || first.Repeat {
+		t.Error("first press marked as repeat")
+	}
+	// a synthetic release is followed by a press with the same time
+	repeat := key(true, 5)
+	c.queue(repeat)
+	if !r.Filter(key(false, 5)) {
+		t.Error("release before a repeat not dropped")
+	}
+	if ev, _ := c.PollForEvent(); r.Filter(ev) || !repeat.Repeat {
+		t.Error("repeated press not marked")
+	}
+	if r.Filter(key(false, 9)) || r.Down(30) {
+		t.Error("final release dropped")
+	}
+
+	// other events may be queued between the release and the press
+	r.Filter(key(true, 7))
+	c.queue(&MotionEvent{Time: 8})
+	c.queue(&KeyEvent{Pressed: true, Keycode: 31, Time: 8})
+	repeat = key(true, 8)
+	c.queue(repeat)
+	if !r.Filter(key(false, 8)) {
+		t.Error("release before a repeat behind other events not dropped")
+	}
+	for range 3 {
+		ev, _ := c.PollForEvent()
+		r.Filter(ev)
+	}
+	if !repeat.Repeat {
+		t.Error("repeated press behind other events not marked")
+	}
+	r.Filter(key(false, 8))
+	r.Filter(&KeyEvent{Keycode: 31, Time: 8})
+
+	// the press of a repeat read only after Filter saw the release
+	r.Filter(key(true, 9))
+	r.Delay = time.Second
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		var b x11byte.Builder
+		b.AddUint8(X11_EVENT_KEY_PRESS) // code
+		b.AddUint8(30)                  // detail
+		b.AddUint16(0)                  // sequenceNumber
+		b.AddUint32(9)                  // time
+		b.AddBytes(make([]byte, 24))    // root, event, child, positions, state, sameScreen
+		s.write(b.BytesOrPanic())
+	}()
+	if !r.Filter(key(false, 9)) {
+		t.Error("release before a late repeat not dropped")
+	}
+	if ev, _ := c.WaitForEvent(); r.Filter(ev) || !ev.(*KeyEvent).Repeat {
+		t.Error("late repeated press not marked")
+	}
+	r.Delay = 0
+	r.Filter(key(false, 9))
+
+	r.Detectable = true
+	r.Filter(key(true, 10))
+	if again := key(true, 11); r.Filter(again) || !again.Repeat {
+		t.Error("detectable repeat not marked")
+	}
+	c.queue(key(true, 12))
+	if r.Filter(key(false, 12)) || r.Down(30) {
+		t.Error("release dropped with detectable auto-repeat")
+	}
+}
@@ -0,0 +1,505 @@
+package x11
+
+import (
+	"slices"
+	"sync"
+	"unicode"
+)
+
+// NoSymbol is the keysym of keys and groups without a symbol.
+const NoSymbol = 0
+
+// Keysyms of common keys, named as in X11/keysymdef.h. Printable ASCII and
+// Latin-1 keysyms equal their character codes, and any Unicode character c
+// has the keysym 0x01000000 + c.
+const (
+	XK_BackSpace   = 0xff08
+	XK_Tab         = 0xff09
+	XK_Linefeed    = 0xff0a
+	XK_Clear       = 0xff0b
+	XK_Return      = 0xff0d
+	XK_Pause       = 0xff13
+	XK_Scroll_Lock = 0xff14
+	XK_Sys_Req     = 0xff15
+	XK_Escape      = 0xff1b
+	XK_Multi_key   = 0xff20
+	XK_Delete      = 0xffff
+
+	XK_Home      = 0xff50
+	XK_Left      = 0xff51
+	XK_Up        = 0xff52
+	XK_Right     = 0xff53
+	XK_Down      = 0xff54
+	XK_Page_Up   = 0xff55
+	XK_Page_Down = 0xff56
+	XK_End       = 0xff57
+	XK_Begin     = 0xff58
+
+	XK_Select  = 0xff60
+	XK_Print   = 0xff61
+	XK_Execute = 0xff62
+	XK_Insert  = 0xff63
+	XK_Undo    = 0xff65
+	XK_Redo    = 0xff66
+	XK_Menu    = 0xff67
+	XK_Find    = 0xff68
+	XK_Cancel  = 0xff69
+	XK_Help    = 0xff6a
+	XK_Break   = 0xff6b
+
+	XK_Mode_switch = 0xff7e
+	XK_Num_Lock    = 0xff7f
+
+	XK_KP_Space     = 0xff80
+	XK_KP_Tab       = 0xff89
+	XK_KP_Enter     = 0xff8d
+	XK_KP_Home      = 0xff95
+	XK_KP_Left      = 0xff96
+	XK_KP_Up        = 0xff97
+	XK_KP_Right     = 0xff98
+	XK_KP_Down      = 0xff99
+	XK_KP_Page_Up   = 0xff9a
+	XK_KP_Page_Down = 0xff9b
+	XK_KP_End       = 0xff9c
+	XK_KP_Begin     = 0xff9d
+	XK_KP_Insert    = 0xff9e
+	XK_KP_Delete    = 0xff9f
+	XK_KP_Equal     = 0xffbd
+	XK_KP_Multiply  = 0xffaa
+	XK_KP_Add       = 0xffab
+	XK_KP_Separator = 0xffac
+	XK_KP_Subtract  = 0xffad
+	XK_KP_Decimal   = 0xffae
+	XK_KP_Divide    = 0xffaf
+	XK_KP_0         = 0xffb0
+	XK_KP_9         = 0xffb9
+
+	XK_F1  = 0xffbe
+	XK_F2  = 0xffbf
+	XK_F3  = 0xffc0
+	XK_F4  = 0xffc1
+	XK_F5  = 0xffc2
+	XK_F6  = 0xffc3
+	XK_F7  = 0xffc4
+	XK_F8  = 0xffc5
+	XK_F9  = 0xffc6
+	XK_F10 = 0xffc7
+	XK_F11 = 0xffc8
+	XK_F12 = 0xffc9
+
+	XK_Shift_L    = 0xffe1
+	XK_Shift_R    = 0xffe2
+	XK_Control_L  = 0xffe3
+	XK_Control_R  = 0xffe4
+	XK_Caps_Lock  = 0xffe5
+	XK_Shift_Lock = 0xffe6
+	XK_Meta_L     = 0xffe7
+	XK_Meta_R     = 0xffe8
+	XK_Alt_L      = 0xffe9
+	XK_Alt_R      = 0xffea
+	XK_Super_L    = 0xffeb
+	XK_Super_R    = 0xffec
+	XK_Hyper_L    = 0xffed
+	XK_Hyper_R    = 0xffee
+
+	XK_ISO_Level3_Shift = 0xfe03
+	XK_ISO_Level5_Shift = 0xfe11
+	XK_ISO_Left_Tab     = 0xfe20
+
+	XK_space = 0x0020
+	XK_0     = 0x0030
+	XK_9     = 0x0039
+	XK_A     = 0x0041
+	XK_Z     = 0x005a
+	XK_a     = 0x0061
+	XK_z     = 0x007a
+
+	XK_EuroSign = 0x20ac
+)
+
+// IsKeypadKey reports whether ks is on the numeric keypad.
+func IsKeypadKey(ks uint32) bool {
+	return ks >= XK_KP_Space && ks <= XK_KP_Equal
+}
+
+// IsModifierKey reports whether ks is a modifier such as Shift or Alt.
+func IsModifierKey(ks uint32) bool {
+	return ks >= XK_Shift_L && ks <= XK_Hyper_R ||
+		ks >= XK_ISO_Level3_Shift && ks <= 0xfe13 ||
+		ks == XK_Mode_switch || ks == XK_Num_Lock
+}
+
+// keypadRunes maps keypad and function keysyms that produce text.
+var keypadRunes = map[uint32]rune{
+	XK_BackSpace:    '\b',
+	XK_Tab:          '\t',
+	XK_Linefeed:     '\n',
+	XK_Return:       '\r',
+	XK_Escape:       0x1b,
+	XK_Delete:       0x7f,
+	XK_KP_Space:     ' ',
+	XK_KP_Tab:       '\t',
+	XK_KP_Enter:     '\r',
+	XK_KP_Equal:     '=',
+	XK_KP_Multiply:  '*',
+	XK_KP_Add:       '+',
+	XK_KP_Separator: ',',
+	XK_KP_Subtract:  '-',
+	XK_KP_Decimal:   '.',
+	XK_KP_Divide:    '/',
+}
+
+// legacyRunes maps keysyms from the pre-Unicode character sets that are
+// still used by common layouts. Latin-1 keysyms and Unicode keysyms are
+// handled arithmetically.
+var legacyRunes = map[uint32]rune{
+	// Latin-2
+	0x1a1: 0x0104, // Ą
+	0x1a2: 0x02d8, // ˘
+	0x1a3: 0x0141, // Ł
+	0x1a5: 0x013d, // Ľ
+	0x1a6: 0x015a, // Ś
+	0x1a9: 0x0160, // Š
+	0x1aa: 0x015e, // Ş
+	0x1ab: 0x0164, // Ť
+	0x1ac: 0x0179, // Ź
+	0x1ae: 0x017d, // Ž
+	0x1af: 0x017b, // Ż
+	0x1b1: 0x0105, // ą
+	0x1b2: 0x02db, // ˛
+	0x1b3: 0x0142, // ł
+	0x1b5: 0x013e, // ľ
+	0x1b6: 0x015b, // ś
+	0x1b7: 0x02c7, // ˇ
+	0x1b9: 0x0161, // š
+	0x1ba: 0x015f, // ş
+	0x1bb: 0x0165, // ť
+	0x1bc: 0x017a, // ź
+	0x1bd: 0x02dd, // ˝
+	0x1be: 0x017e, // ž
+	0x1bf: 0x017c, // ż
+	0x1c0: 0x0154, // Ŕ
+	0x1c3: 0x0102, // Ă
+	0x1c5: 0x0139, // Ĺ
+	0x1c6: 0x0106, // Ć
+	0x1c8: 0x010c, // Č
+	0x1ca: 0x0118, // Ę
+	0x1cc: 0x011a, // Ě
+	0x1cf: 0x010e, // Ď
+	0x1d0: 0x0110, // Đ
+	0x1d1: 0x0143, // Ń
+	0x1d2: 0x0147, // Ň
+	0x1d5: 0x0150, // Ő
+	0x1d8: 0x0158, // Ř
+	0x1d9: 0x016e, // Ů
+	0x1db: 0x0170, // Ű
+	0x1de: 0x0162, // Ţ
+	0x1e0: 0x0155, // ŕ
+	0x1e3: 0x0103, // ă
+	0x1e5: 0x013a, // ĺ
+	0x1e6: 0x0107, // ć
+	0x1e8: 0x010d, // č
+	0x1ea: 0x0119, // ę
+	0x1ec: 0x011b, // ě
+	0x1ef: 0x010f, // ď
+	0x1f0: 0x0111, // đ
+	0x1f1: 0x0144, // ń
+	0x1f2: 0x0148, // ň
+	0x1f5: 0x0151, // ő
+	0x1f8: 0x0159, // ř
+	0x1f9: 0x016f, // ů
+	0x1fb: 0x0171, // ű
+	0x1fe: 0x0163, // ţ
+	0x1ff: 0x02d9, // ˙
+	// Latin-3
+	0x2a1: 0x0126, // Ħ
+	0x2a2: 0x02d8, // ˘
+	0x2a6: 0x0124, // Ĥ
+	0x2a9: 0x0130, // İ
+	0x2aa: 0x015e, // Ş
+	0x2ab: 0x011e, // Ğ
+	0x2ac: 0x0134, // Ĵ
+	0x2af: 0x017b, // Ż
+	0x2b1: 0x0127, // ħ
+	0x2b6: 0x0125, // ĥ
+	0x2b9: 0x0131, // ı
+	0x2ba: 0x015f, // ş
+	0x2bb: 0x011f, // ğ
+	0x2bc: 0x0135, // ĵ
+	0x2bf: 0x017c, // ż
+	0x2c5: 0x010a, // Ċ
+	0x2c6: 0x0108, // Ĉ
+	0x2d5: 0x0120, // Ġ
+	0x2d8: 0x011c, // Ĝ
+	0x2dd: 0x016c, // Ŭ
+	0x2de: 0x015c, // Ŝ
+	0x2e5: 0x010b, // ċ
+	0x2e6: 0x0109, // ĉ
+	0x2f5: 0x0121, // ġ
+	0x2f8: 0x011d, // ĝ
+	0x2fd: 0x016d, // ŭ
+	0x2fe: 0x015d, // ŝ
+	// Latin-4
+	0x3a2: 0x0138, // ĸ
+	0x3a3: 0x0156, // Ŗ
+	0x3a5: 0x0128, // Ĩ
+	0x3a6: 0x013b, // Ļ
+	0x3a9: 0x0160, // Š
+	0x3aa: 0x0112, // Ē
+	0x3ab: 0x0122, // Ģ
+	0x3ac: 0x0166, // Ŧ
+	0x3ae: 0x017d, // Ž
+	0x3b1: 0x0105, // ą
+	0x3b2: 0x02db, // ˛
+	0x3b3: 0x0157, // ŗ
+	0x3b5: 0x0129, // ĩ
+	0x3b6: 0x013c, // ļ
+	0x3b7: 0x02c7, // ˇ
+	0x3b9: 0x0161, // š
+	0x3ba: 0x0113, // ē
+	0x3bb: 0x0123, // ģ
+	0x3bc: 0x0167, // ŧ
+	0x3bd: 0x014a, // Ŋ
+	0x3be: 0x017e, // ž
+	0x3bf: 0x014b, // ŋ
+	0x3c0: 0x0100, // Ā
+	0x3c7: 0x012e, // Į
+	0x3c8: 0x010c, // Č
+	0x3ca: 0x0118, // Ę
+	0x3cc: 0x0116, // Ė
+	0x3cf: 0x012a, // Ī
+	0x3d0: 0x0110, // Đ
+	0x3d1: 0x0145, // Ņ
+	0x3d2: 0x014c, // Ō
+	0x3d3: 0x0136, // Ķ
+	0x3d9: 0x0172, // Ų
+	0x3dd: 0x0168, // Ũ
+	0x3de: 0x016a, // Ū
+	0x3e0: 0x0101, // ā
+	0x3e7: 0x012f, // į
+	0x3e8: 0x010d, // č
+	0x3ea: 0x0119, // ę
+	0x3ec: 0x0117, // ė
+	0x3ef: 0x012b, // ī
+	0x3f0: 0x0111, // đ
+	0x3f1: 0x0146, // ņ
+	0x3f2: 0x014d, // ō
+	0x3f3: 0x0137, // ķ
+	0x3f9: 0x0173, // ų
+	0x3fd: 0x0169, // ũ
+	0x3fe: 0x016b, // ū
+	// Cyrillic
+	0x6c0: 0x044e, // ю
+	0x6c1: 0x0430, // а
+	0x6c2: 0x0431, // б
+	0x6c3: 0x0446, // ц
+	0x6c4: 0x0434, // д
+	0x6c5: 0x0435, // е
+	0x6c6: 0x0444, // ф
+	0x6c7: 0x0433, // г
+	0x6c8: 0x0445, // х
+	0x6c9: 0x0438, // и
+	0x6ca: 0x0439, // й
+	0x6cb: 0x043a, // к
+	0x6cc: 0x043b, // л
+	0x6cd: 0x043c, // м
+	0x6ce: 0x043d, // н
+	0x6cf: 0x043e, // о
+	0x6d0: 0x043f, // п
+	0x6d1: 0x044f, // я
+	0x6d2: 0x0440, // р
+	0x6d3: 0x0441, // с
+	0x6d4: 0x0442, // т
+	0x6d5: 0x0443, // у
+	0x6d6: 0x0436, // ж
+	0x6d7: 0x0432, // в
+	0x6d8: 0x044c, // ь
+	0x6d9: 0x044b, // ы
+	0x6da: 0x0437, // з
+	0x6db: 0x0448, // ш
+	0x6dc: 0x044d, // э
+	0x6dd: 0x0449, // щ
+	0x6de: 0x0447, // ч
+	0x6df: 0x044a, // ъ
+	0x6e0: 0x042e, // Ю
+	0x6e1: 0x0410, // А
+	0x6e2: 0x0411, // Б
+	0x6e3: 0x0426, // Ц
+	0x6e4: 0x0414, // Д
+	0x6e5: 0x0415, // Е
+	0x6e6: 0x0424, // Ф
+	0x6e7: 0x0413, // Г
+	0x6e8: 0x0425, // Х
+	0x6e9: 0x0418, // И
+	0x6ea: 0x0419, // Й
+	0x6eb: 0x041a, // К
+	0x6ec: 0x041b, // Л
+	0x6ed: 0x041c, // М
+	0x6ee: 0x041d, // Н
+	0x6ef: 0x041e, // О
+	0x6f0: 0x041f, // П
+	0x6f1: 0x042f, // Я
+	0x6f2: 0x0420, // Р
+	0x6f3: 0x0421, // С
+	0x6f4: 0x0422, // Т
+	0x6f5: 0x0423, // У
+	0x6f6: 0x0416, // Ж
+	0x6f7: 0x0412, // В
+	0x6f8: 0x042c, // Ь
+	0x6f9: 0x042b, // Ы
+	0x6fa: 0x0417, // З
+	0x6fb: 0x0428, // Ш
+	0x6fc: 0x042d, // Э
+	0x6fd: 0x0429, // Щ
+	0x6fe: 0x0427, // Ч
+	0x6ff: 0x042a, // Ъ
+	0x6a1: 0x0452, // ђ
+	0x6a2: 0x0453, // ѓ
+	0x6a3: 0x0451, // ё
+	0x6a4: 0x0454, // є
+	0x6a5: 0x0455, // ѕ
+	0x6a6: 0x0456, // і
+	0x6a7: 0x0457, // ї
+	0x6a8: 0x0458, // ј
+	0x6a9: 0x0459, // љ
+	0x6aa: 0x045a, // њ
+	0x6ab: 0x045b, // ћ
+	0x6ac: 0x045c, // ќ
+	0x6ad: 0x0491, // ґ
+	0x6ae: 0x045e, // ў
+	0x6af: 0x045f, // џ
+	0x6b0: 0x2116, // №
+	0x6b1: 0x0402, // Ђ
+	0x6b2: 0x0403, // Ѓ
+	0x6b3: 0x0401, // Ё
+	0x6b4: 0x0404, // Є
+	0x6b5: 0x0405, // Ѕ
+	0x6b6: 0x0406, // І
+	0x6b7: 0x0407, // Ї
+	0x6b8: 0x0408, // Ј
+	0x6b9: 0x0409, // Љ
+	0x6ba: 0x040a, // Њ
+	0x6bb: 0x040b, // Ћ
+	0x6bc: 0x040c, // Ќ
+	0x6bd: 0x0490, // Ґ
+	0x6be: 0x040e, // Ў
+	0x6bf: 0x040f, // Џ
+	// Greek
+	0x7a1: 0x0386, // Ά
+	0x7a2: 0x0388, // Έ
+	0x7a3: 0x0389, // Ή
+	0x7a4: 0x038a, // Ί
+	0x7a5: 0x03aa, // Ϊ
+	0x7a7: 0x038c, // Ό
+	0x7a8: 0x038e, // Ύ
+	0x7a9: 0x03ab, // Ϋ
+	0x7ab: 0x038f, // Ώ
+	0x7ae: 0x0385, // ΅
+	0x7af: 0x2015, // ―
+	0x7b1: 0x03ac, // ά
+	0x7b2: 0x03ad, // έ
+	0x7b3: 0x03ae, // ή
+	0x7b4: 0x03af, // ί
+	0x7b5: 0x03ca, // ϊ
+	0x7b6: 0x0390, // ΐ
+	0x7b7: 0x03cc, // ό
+	0x7b8: 0x03cd, // ύ
+	0x7b9: 0x03cb, // ϋ
+	0x7ba: 0x03b0, // ΰ
+	0x7bb: 0x03ce, // ώ
+	0x7d2: 0x03a3, // Σ
+	0x7f2: 0x03c3, // σ
+	0x7f3: 0x03c2, // ς
+	// Latin-9
+	0x13bc:      0x0152, // Œ
+	0x13bd:      0x0153, // œ
+	0x13be:      0x0178, // Ÿ
+	XK_EuroSign: 0x20ac, // €
+}
+
+func init() {
+	// Greek letters other than sigma are in alphabetical order
+	for ks := uint32(0x7c1); ks <= 0x7d9; ks++ {
+		if ks == 0x7d2 || ks == 0x7d3 {
+			continue
+		}
+		r := rune(ks - 0x7c1 + 0x391)
+		legacyRunes[ks] = r
+		legacyRunes[ks+0x20] = r + 0x20
+	}
+	// Hebrew and Thai are ISO 8859-8 and TIS-620 at an offset
+	for ks := uint32(0xce0); ks <= 0xcfa; ks++ {
+		legacyRunes[ks] = rune(ks - 0xce0 + 0x5d0)
+	}
+	for ks := uint32(0xda1); ks <= 0xdf9; ks++ {
+		legacyRunes[ks] = rune(ks - 0xda1 + 0xe01)
+	}
+}
+
+var (
+	legacyKeysymsOnce sync.Once
+	legacyKeysyms     map[rune]uint32
+)
+
+// KeysymToRune returns the character produced by a keysym, or -1 if it
+// produces none.
+func KeysymToRune(ks uint32) rune {
+	switch {
+	case ks >= 0x20 && ks <= 0x7e, ks >= 0xa0 && ks <= 0xff:
+		return rune(ks)
+	case ks >= 0x01000100 && ks <= 0x0110ffff:
+		return rune(ks - 0x01000000)
+	}
+	if r, ok := keypadRunes[ks]; ok {
+		return r
+	}
+	if ks >= XK_KP_0 && ks <= XK_KP_9 {
+		return rune('0' + ks - XK_KP_0)
+	}
+	if r, ok := legacyRunes[ks]; ok {
+		return r
+	}
+	return -1
+}
+
+// RuneToKeysym returns the keysym for a character, preferring the legacy
+// keysyms layouts use over Unicode keysyms.
+func RuneToKeysym(r rune) uint32 {
+	if r >= 0x20 && r <= 0x7e || r >= 0xa0 && r <= 0xff {
+		return uint32(r)
+	}
+	legacyKeysymsOnce.Do(func() {
+		keysyms := make([]uint32, 0, len(legacyRunes))
+		for ks := range legacyRunes {
+			keysyms = append(keysyms, ks)
+		}
+		slices.Sort(keysyms)
+		legacyKeysyms = make(map[rune]uint32, len(keysyms))
+		for _, ks := range keysyms {
+			if _, ok := legacyKeysyms[legacyRunes[ks]]; !ok {
+				legacyKeysyms[legacyRunes[ks]] = ks
+			}
+		}
+	})
+	if ks, ok := legacyKeysyms[r]; ok {
+		return ks
+	}
+	return 0x01000000 + uint32(r)
+}
+
+// ConvertCase returns the lowercase and uppercase forms of a keysym. Both
+// are ks itself if it has no case.
+func ConvertCase(ks uint32) (lower, upper uint32) {
+	r := KeysymToRune(ks)
+	if r < 0 || !unicode.IsLetter(r) {
+		return ks, ks
+	}
+	lower, upper = ks, ks
+	if l := unicode.ToLower(r); l != r {
+		lower = RuneToKeysym(l)
+	}
+	if u := unicode.ToUpper(r); u != r {
+		upper = RuneToKeysym(u)
+	}
+	return lower, upper
+}
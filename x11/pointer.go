@@ -0,0 +1,128 @@
+package x11
+
+import "github.com/dzeromsk/helloX11/x11byte"
+
+// Pointer buttons. Buttons 4 to 7 are the scroll wheel.
+const (
+	X11_BUTTON_LEFT         = 1
+	X11_BUTTON_MIDDLE       = 2
+	X11_BUTTON_RIGHT        = 3
+	X11_BUTTON_SCROLL_UP    = 4
+	X11_BUTTON_SCROLL_DOWN  = 5
+	X11_BUTTON_SCROLL_LEFT  = 6
+	X11_BUTTON_SCROLL_RIGHT = 7
+)
+
+// ScrollEvent reports one step of the scroll wheel. DY is negative when
+// scrolling up and DX negative when scrolling left.
+type ScrollEvent struct {
+	DX, DY         int
+	Time           uint32
+	Event          uint32
+	EventX, EventY int16
+	State          KeyButMask
+}
+
+// Scroll returns the scroll step of a press of buttons 4 to 7, or nil for
+// other buttons and for releases.
+func (e *ButtonEvent) Scroll() *ScrollEvent {
+	if !e.Pressed {
+		return nil
+	}
+	s := &ScrollEvent{Time: e.Time, Event: e.Event, EventX: e.EventX, EventY: e.EventY, State: e.State}
+	switch e.Button {
+	case X11_BUTTON_SCROLL_UP:
+		s.DY = -1
+	case X11_BUTTON_SCROLL_DOWN:
+		s.DY = 1
+	case X11_BUTTON_SCROLL_LEFT:
+		s.DX = -1
+	case X11_BUTTON_SCROLL_RIGHT:
+		s.DX = 1
+	default:
+		return nil
+	}
+	return s
+}
+
+// IsScroll reports whether the event is for a scroll wheel button.
+func (e *ButtonEvent) IsScroll() bool {
+	return e.Button >= X11_BUTTON_SCROLL_UP && e.Button <= X11_BUTTON_SCROLL_RIGHT
+}
+
+// Pointer is the result of QueryPointer.
+type Pointer struct {
+	Root         uint32
+	Child        uint32 // child of the window containing the pointer, if any
+	RootX, RootY int16
+	WinX, WinY   int16 // relative to the queried window
+	State        KeyButMask
+	SameScreen   bool // false if the pointer is on another screen
+}
+
+// QueryPointer returns the pointer position relative to window and the
+// state of the modifiers and buttons.
+func (c *Conn) QueryPointer(window uint32) (*Pointer, error) {
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_QUERY_POINTER) // opcode
+	b.AddUint8(0)                         // unused
+	b.AddUint16(2)                        // requestLength
+	b.AddUint32(window)                   // window
+
+	reply, err := c.Request(b.BytesOrPanic())
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		p            Pointer
+		sameScreen   uint8
+		rootX, rootY uint16
+		winX, winY   uint16
+	)
+	reply.Skip(1) // reply
+	reply.ReadUint8(&sameScreen)
+	reply.Skip(2) // sequenceNumber
+	reply.Skip(4) // replyLength
+	reply.ReadUint32(&p.Root)
+	reply.ReadUint32(&p.Child)
+	reply.ReadUint16(&rootX)
+	reply.ReadUint16(&rootY)
+	reply.ReadUint16(&winX)
+	reply.ReadUint16(&winY)
+	reply.ReadUint16((*uint16)(&p.State))
+	p.SameScreen = sameScreen != 0
+	p.RootX, p.RootY = int16(rootX), int16(rootY)
+	p.WinX, p.WinY = int16(winX), int16(winY)
+	return &p, nil
+}
+
+// QueryPointer returns the pointer position relative to the window.
+func (w *Window) QueryPointer() (*Pointer, error) {
+	return w.c.QueryPointer(w.ID)
+}
+
+// WarpPointer moves the pointer to dstX, dstY relative to dst, or by that
+// offset if dst is X11_NONE. If src is not X11_NONE, the pointer only moves
+// while it is inside the given rectangle of src.
+func (c *Conn) WarpPointer(src, dst uint32, srcX, srcY int16, srcWidth, srcHeight uint16, dstX, dstY int16) error {
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_WARP_POINTER) // opcode
+	b.AddUint8(0)                        // unused
+	b.AddUint16(6)                       // requestLength
+	b.AddUint32(src)                     // srcWindow
+	b.AddUint32(dst)                     // dstWindow
+	b.AddUint16(uint16(srcX))            // srcX
+	b.AddUint16(uint16(srcY))            // srcY
+	b.AddUint16(srcWidth)                // srcWidth
+	b.AddUint16(srcHeight)               // srcHeight
+	b.AddUint16(uint16(dstX))            // dstX
+	b.AddUint16(uint16(dstY))            // dstY
+
+	return c.Send(b.BytesOrPanic())
+}
+
+// WarpPointer moves the pointer to x, y in the window.
+func (w *Window) WarpPointer(x, y int16) error {
+	return w.c.WarpPointer(X11_NONE, w.ID, 0, 0, 0, 0, x, y)
+}
@@ -0,0 +1,115 @@
+package x11
+
+import (
+	"testing"
+
+	"github.com/dzeromsk/helloX11/x11byte"
+)
+
+func TestPointerEvents(t *testing.T) {
+	c, _ := newTestConn(t)
+
+	var b x11byte.Builder
+	b.AddUint8(X11_EVENT_BUTTON_PRESS) // eventCode
+	b.AddUint8(X11_BUTTON_SCROLL_DOWN) // detail
+	b.AddUint16(7)                     // sequenceNumber
+	b.AddUint32(1000)                  // time
+	b.AddUint32(0x123)                 // root
+	b.AddUint32(5)                     // event
+	b.AddUint32(0)                     // child
+	b.AddUint16(300)                   // rootX
+	b.AddUint16(200)                   // rootY
+	b.AddUint16(0xfffe)                // eventX
+	b.AddUint16(20)                    // eventY
+	b.AddUint16(X11_MOD_MASK_CONTROL | X11_BUTTON_MASK_1)
+	b.AddUint8(1) // sameScreen
+	b.AddUint8(0) // unused
+
+	ev, ok := c.decodeEvent(b.BytesOrPanic()).(*ButtonEvent)
+	if !ok {
+		t.Fatal("ButtonPress not decoded")
+	}
+	if !ev.Pressed || ev.Button != 5 || ev.EventX != -2 || ev.EventY != 20 || !ev.SameScreen {
+		t.Errorf("decoded %+v", ev)
+	}
+	if !ev.State.Has(X11_MOD_MASK_CONTROL) || !ev.State.Button(1) || ev.State.Button(2) || ev.State.Modifiers() != X11_MOD_MASK_CONTROL {
+		t.Errorf("State = %#x", ev.State)
+	}
+
+	d := NewDispatcher(c)
+	var scrolls, buttons int
+	d.Register(&Window{c: c, ID: 5, Parent: 0x123}, &WindowHandler{
+		Scroll: func(e *ScrollEvent) {
+			if e.DY != 1 || e.DX != 0 || e.EventX != -2 {
+				t.Errorf("scroll %+v", e)
+			}
+			scrolls++
+		},
+		Button: func(*ButtonEvent) { buttons++ },
+	})
+	d.Dispatch(ev)
+	d.Dispatch(&ButtonEvent{Button: X11_BUTTON_SCROLL_DOWN, Event: 5})
+	d.Dispatch(&ButtonEvent{Pressed: true, Button: X11_BUTTON_LEFT, Event: 5})
+	if scrolls != 1 || buttons != 1 {
+		t.Errorf("%d scrolls and %d buttons, want 1 and 1", scrolls, buttons)
+	}
+}
+
+func TestCompressMotion(t *testing.T) {
+	c, _ := newTestConn(t)
+	d := NewDispatcher(c)
+	d.CompressMotion = true
+
+	var got, filtered []int16
+	d.Register(&Window{c: c, ID: 5, Parent: 0x123}, &WindowHandler{
+		Motion: func(e *MotionEvent) { got = append(got, e.EventX) },
+	})
+	d.Filter = func(ev Event) (bool, error) {
+		if e, ok := ev.(*MotionEvent); ok {
+			filtered = append(filtered, e.EventX)
+		}
+		return false, nil
+	}
+	c.queue(&MotionEvent{Event: 5, EventX: 2})
+	c.queue(&MotionEvent{Event: 5, EventX: 3})
+	c.queue(&MotionEvent{Event: 6, EventX: 4})
+
+	d.Dispatch(&MotionEvent{Event: 5, EventX: 1})
+	if len(got) != 1 || got[0] != 3 || len(filtered) != 1 || filtered[0] != 3 {
+		t.Errorf("delivered %v and filtered %v, want [3]", got, filtered)
+	}
+	if ev, _ := c.PollForEvent(); ev.(*MotionEvent).Event != 6 {
+		t.Errorf("motion for another window consumed")
+	}
+}
+
+func TestQueryPointer(t *testing.T) {
+	c, s := newTestConn(t)
+
+	result := make(chan *Pointer)
+	go func() {
+		p, err := c.QueryPointer(5)
+		if err != nil {
+			t.Error(err)
+		}
+		result <- p
+	}()
+
+	if req := s.readRequest(); req[0] != X11_REQUEST_QUERY_POINTER || req[4] != 5 {
+		t.Errorf("sent %v, want QueryPointer(5)", []byte(req))
+	}
+	var body x11byte.Builder
+	body.AddUint32(0x123)             // root
+	body.AddUint32(0)                 // child
+	body.AddUint16(100)               // rootX
+	body.AddUint16(50)                // rootY
+	body.AddUint16(0xfff6)            // winX
+	body.AddUint16(10)                // winY
+	body.AddUint16(X11_BUTTON_MASK_3) // mask
+	s.reply(1, body.BytesOrPanic())
+
+	p := <-result
+	if p.RootX != 100 || p.WinX != -10 || p.WinY != 10 || !p.State.Button(3) || !p.SameScreen {
+		t.Errorf("QueryPointer() = %+v", p)
+	}
+}
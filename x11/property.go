@@ -0,0 +1,159 @@
+package x11
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/dzeromsk/helloX11/x11byte"
+)
+
+// Property is the value of a window property as returned by GetProperty.
+type Property struct {
+	Type       uint32
+	Format     uint8 // 8, 16 or 32
+	BytesAfter uint32
+	Value      []byte
+}
+
+// Uint32s decodes a format 32 property value.
+func (p *Property) Uint32s() []uint32 {
+	if p.Format != 32 {
+		return nil
+	}
+	s := x11byte.String(p.Value)
+	v := make([]uint32, len(p.Value)/4)
+	for i := range v {
+		s.ReadUint32(&v[i])
+	}
+	return v
+}
+
+// ChangeProperty sets, prepends to or appends to a window property. The data
+// length must be a multiple of format/8.
+//
+// Data that does not fit in a single request is sent in chunks, the first
+// one with the given mode and the rest appended (or prepended in reverse
+// order), so other clients may briefly see a partial value.
+func (c *Conn) ChangeProperty(mode uint8, window, property, typ uint32, format uint8, data []byte) error {
+	if format != 8 && format != 16 && format != 32 {
+		return fmt.Errorf("x11: invalid property format %d", format)
+	}
+
+	// 24 bytes of header, and 4 more with BIG-REQUESTS
+	limit := (c.MaxRequestLength() - 28) &^ 3
+	var chunks [][]byte
+	for len(data) > limit {
+		chunks = append(chunks, data[:limit])
+		data = data[limit:]
+	}
+	chunks = append(chunks, data)
+
+	if mode == X11_PROP_MODE_PREPEND {
+		slices.Reverse(chunks)
+	}
+	for _, chunk := range chunks {
+		if err := c.changeProperty(mode, window, property, typ, format, chunk); err != nil {
+			return err
+		}
+		if mode == X11_PROP_MODE_REPLACE {
+			mode = X11_PROP_MODE_APPEND
+		}
+	}
+	return nil
+}
+
+func (c *Conn) changeProperty(mode uint8, window, property, typ uint32, format uint8, data []byte) error {
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_CHANGE_PROPERTY)        // opcode
+	b.AddUint8(mode)                               // mode
+	b.AddUint16(uint16(6 + (len(data)+3)/4))       // requestLength
+	b.AddUint32(window)                            // windowID
+	b.AddUint32(property)                          // property
+	b.AddUint32(typ)                               // type
+	b.AddUint8(format)                             // format
+	b.AddUint24(0)                                 // unused
+	b.AddUint32(uint32(len(data) / int(format/8))) // dataLength
+	b.AddBytes(data)                               // data
+	b.AddBytes(make([]byte, pad(len(data))))       // padding
+
+	return c.Send(b.BytesOrPanic())
+}
+
+// ChangePropertyUint32 replaces a format 32 property, such as a list of
+// atoms, windows or cardinals.
+func (c *Conn) ChangePropertyUint32(window, property, typ uint32, values ...uint32) error {
+	var b x11byte.Builder
+	for _, v := range values {
+		b.AddUint32(v)
+	}
+	return c.ChangeProperty(X11_PROP_MODE_REPLACE, window, property, typ, 32, b.BytesOrPanic())
+}
+
+// ChangePropertyString replaces a format 8 property holding text of the
+// given type, usually STRING or UTF8_STRING.
+func (c *Conn) ChangePropertyString(window, property, typ uint32, value string) error {
+	return c.ChangeProperty(X11_PROP_MODE_REPLACE, window, property, typ, 8, []byte(value))
+}
+
+// DeleteProperty removes a property from a window.
+func (c *Conn) DeleteProperty(window, property uint32) error {
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_DELETE_PROPERTY) // opcode
+	b.AddUint8(0)                           // unused
+	b.AddUint16(3)                          // requestLength
+	b.AddUint32(window)                     // window
+	b.AddUint32(property)                   // property
+	return c.Send(b.BytesOrPanic())
+}
+
+// GetProperty reads up to length 32-bit units of a property, starting at
+// offset 32-bit units. A type of 0 (AnyPropertyType) matches any type. If
+// the property does not exist the returned Property has Type 0.
+func (c *Conn) GetProperty(delete bool, window, property, typ, offset, length uint32) (*Property, error) {
+	var del uint8
+	if delete {
+		del = 1
+	}
+
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_GET_PROPERTY) // opcode
+	b.AddUint8(del)                      // delete
+	b.AddUint16(6)                       // requestLength
+	b.AddUint32(window)                  // window
+	b.AddUint32(property)                // property
+	b.AddUint32(typ)                     // type
+	b.AddUint32(offset)                  // longOffset
+	b.AddUint32(length)                  // longLength
+
+	reply, err := c.Request(b.BytesOrPanic())
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		p           Property
+		valueLength uint32
+	)
+	reply.Skip(1) // reply
+	reply.ReadUint8(&p.Format)
+	reply.Skip(2) // sequenceNumber
+	reply.Skip(4) // replyLength
+	reply.ReadUint32(&p.Type)
+	reply.ReadUint32(&p.BytesAfter)
+	reply.ReadUint32(&valueLength)
+	reply.Skip(12) // unused
+	if p.Format != 0 {
+		reply.ReadBytes(&p.Value, int(valueLength)*int(p.Format/8))
+	}
+	return &p, nil
+}
+
+// GetPropertyUint32 reads a whole format 32 property, such as a list of
+// atoms, windows or cardinals. A missing property yields an empty slice.
+func (c *Conn) GetPropertyUint32(window, property, typ uint32) ([]uint32, error) {
+	p, err := c.GetProperty(false, window, property, typ, 0, 1<<20)
+	if err != nil {
+		return nil, err
+	}
+	return p.Uint32s(), nil
+}
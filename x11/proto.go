@@ -0,0 +1,183 @@
+package x11
+
+const (
+	X11_FLAG_BACKGROUND_PIXMAP = 0x00000001
+	X11_FLAG_BACKGROUND_PIXEL  = 0x00000002
+	X11_FLAG_BORDER_PIXEL      = 0x00000008
+	X11_FLAG_OVERRIDE_REDIRECT = 0x00000200
+	X11_FLAG_WIN_EVENT         = 0x00000800
+	X11_FLAG_COLORMAP          = 0x00002000
+	X11_FLAG_CURSOR            = 0x00004000
+)
+
+const (
+	WINDOWCLASS_COPYFROMPARENT = 0
+	WINDOWCLASS_INPUTOUTPUT    = 1
+	WINDOWCLASS_INPUTONLY      = 2
+)
+
+const (
+	X11_EVENT_FLAG_KEY_PRESS             = 0x00000001
+	X11_EVENT_FLAG_KEY_RELEASE           = 0x00000002
+	X11_EVENT_FLAG_BUTTON_PRESS          = 0x00000004
+	X11_EVENT_FLAG_BUTTON_RELEASE        = 0x00000008
+	X11_EVENT_FLAG_ENTER_WINDOW          = 0x00000010
+	X11_EVENT_FLAG_LEAVE_WINDOW          = 0x00000020
+	X11_EVENT_FLAG_POINTER_MOTION        = 0x00000040
+	X11_EVENT_FLAG_POINTER_MOTION_HINT   = 0x00000080
+	X11_EVENT_FLAG_BUTTON_MOTION         = 0x00002000
+	X11_EVENT_FLAG_EXPOSURE              = 0x00008000
+	X11_EVENT_FLAG_STRUCTURE_NOTIFY      = 0x00020000
+	X11_EVENT_FLAG_SUBSTRUCTURE_NOTIFY   = 0x00080000
+	X11_EVENT_FLAG_SUBSTRUCTURE_REDIRECT = 0x00100000
+	X11_EVENT_FLAG_FOCUS_CHANGE          = 0x00200000
+	X11_EVENT_FLAG_PROPERTY_CHANGE       = 0x00400000
+)
+
+const (
+	X11_GC_FLAG_FOREGROUND         = 0x00000004
+	X11_GC_FLAG_BACKGROUND         = 0x00000008
+	X11_GC_FLAG_GRAPHICS_EXPOSURES = 0x00010000
+)
+
+const (
+	X11_REQUEST_CREATE_WINDOW            = 1
+	X11_REQUEST_CHANGE_WINDOW_ATTRIBUTES = 2
+	X11_REQUEST_DESTROY_WINDOW           = 4
+	X11_REQUEST_DESTROY_SUBWINDOWS       = 5
+	X11_REQUEST_REPARENT_WINDOW          = 7
+	X11_REQUEST_MAP_WINDOW               = 8
+	X11_REQUEST_MAP_SUBWINDOWS           = 9
+	X11_REQUEST_UNMAP_WINDOW             = 10
+	X11_REQUEST_UNMAP_SUBWINDOWS         = 11
+	X11_REQUEST_CONFIGURE_WINDOW         = 12
+	X11_REQUEST_CIRCULATE_WINDOW         = 13
+	X11_REQUEST_GET_GEOMETRY             = 14
+	X11_REQUEST_QUERY_TREE               = 15
+	X11_REQUEST_INTERN_ATOM              = 16
+	X11_REQUEST_GET_ATOM_NAME            = 17
+	X11_REQUEST_CHANGE_PROPERTY          = 18
+	X11_REQUEST_DELETE_PROPERTY          = 19
+	X11_REQUEST_GET_PROPERTY             = 20
+	X11_REQUEST_SET_SELECTION_OWNER      = 22
+	X11_REQUEST_GET_SELECTION_OWNER      = 23
+	X11_REQUEST_CONVERT_SELECTION        = 24
+	X11_REQUEST_SEND_EVENT               = 25
+	X11_REQUEST_GRAB_POINTER             = 26
+	X11_REQUEST_UNGRAB_POINTER           = 27
+	X11_REQUEST_GRAB_BUTTON              = 28
+	X11_REQUEST_UNGRAB_BUTTON            = 29
+	X11_REQUEST_GRAB_KEYBOARD            = 31
+	X11_REQUEST_UNGRAB_KEYBOARD          = 32
+	X11_REQUEST_GRAB_KEY                 = 33
+	X11_REQUEST_UNGRAB_KEY               = 34
+	X11_REQUEST_ALLOW_EVENTS             = 35
+	X11_REQUEST_QUERY_POINTER            = 38
+	X11_REQUEST_TRANSLATE_COORDINATES    = 40
+	X11_REQUEST_WARP_POINTER             = 41
+	X11_REQUEST_SET_INPUT_FOCUS          = 42
+	X11_REQUEST_GET_INPUT_FOCUS          = 43
+	X11_REQUEST_OPEN_FONT                = 45
+	X11_REQUEST_CLOSE_FONT               = 46
+	X11_REQUEST_CREATE_PIXMAP            = 53
+	X11_REQUEST_FREE_PIXMAP              = 54
+	X11_REQUEST_CREATE_GC                = 55
+	X11_REQUEST_FREE_GC                  = 60
+	X11_REQUEST_CLEAR_AREA               = 61
+	X11_REQUEST_COPY_AREA                = 62
+	X11_REQUEST_COPY_PLANE               = 63
+	X11_REQUEST_PUT_IMAGE                = 72
+	X11_REQUEST_GET_IMAGE                = 73
+	X11_REQUEST_ALLOC_COLOR              = 84
+	X11_REQUEST_FREE_COLORS              = 88
+	X11_REQUEST_QUERY_COLORS             = 91
+	X11_REQUEST_CREATE_CURSOR            = 93
+	X11_REQUEST_CREATE_GLYPH_CURSOR      = 94
+	X11_REQUEST_FREE_CURSOR              = 95
+	X11_REQUEST_QUERY_EXTENSION          = 98
+	X11_REQUEST_GET_KEYBOARD_MAPPING     = 101
+	X11_REQUEST_GET_MODIFIER_MAPPING     = 119
+)
+
+const (
+	X11_EVENT_KEY_PRESS         = 2
+	X11_EVENT_KEY_RELEASE       = 3
+	X11_EVENT_BUTTON_PRESS      = 4
+	X11_EVENT_BUTTON_RELEASE    = 5
+	X11_EVENT_MOTION_NOTIFY     = 6
+	X11_EVENT_ENTER_NOTIFY      = 7
+	X11_EVENT_LEAVE_NOTIFY      = 8
+	X11_EVENT_FOCUS_IN          = 9
+	X11_EVENT_FOCUS_OUT         = 10
+	X11_EVENT_EXPOSE            = 12
+	X11_EVENT_GRAPHICS_EXPOSURE = 13
+	X11_EVENT_NO_EXPOSURE       = 14
+	X11_EVENT_CREATE_NOTIFY     = 16
+	X11_EVENT_DESTROY_NOTIFY    = 17
+	X11_EVENT_UNMAP_NOTIFY      = 18
+	X11_EVENT_MAP_NOTIFY        = 19
+	X11_EVENT_REPARENT_NOTIFY   = 21
+	X11_EVENT_CONFIGURE_NOTIFY  = 22
+	X11_EVENT_CIRCULATE_NOTIFY  = 26
+	X11_EVENT_PROPERTY_NOTIFY   = 28
+	X11_EVENT_SELECTION_CLEAR   = 29
+	X11_EVENT_SELECTION_REQUEST = 30
+	X11_EVENT_SELECTION_NOTIFY  = 31
+	X11_EVENT_CLIENT_MESSAGE    = 33
+	X11_EVENT_MAPPING_NOTIFY    = 34
+	X11_EVENT_GENERIC_EVENT     = 35
+)
+
+// X11_NONE stands for no window, pixmap, cursor or other resource.
+const X11_NONE = 0
+
+// Predefined atoms from the core protocol.
+const (
+	X11_ATOM_NONE             = 0
+	X11_ATOM_PRIMARY          = 1
+	X11_ATOM_SECONDARY        = 2
+	X11_ATOM_ATOM             = 4
+	X11_ATOM_CARDINAL         = 6
+	X11_ATOM_INTEGER          = 19
+	X11_ATOM_PIXMAP           = 20
+	X11_ATOM_STRING           = 31
+	X11_ATOM_WINDOW           = 33
+	X11_ATOM_WM_HINTS         = 35
+	X11_ATOM_WM_NAME          = 39
+	X11_ATOM_WM_TRANSIENT_FOR = 68
+)
+
+const (
+	X11_PROP_MODE_REPLACE = 0
+	X11_PROP_MODE_PREPEND = 1
+	X11_PROP_MODE_APPEND  = 2
+)
+
+const (
+	X11_IMAGE_FORMAT_XY_BITMAP = 0
+	X11_IMAGE_FORMAT_XY_PIXMAP = 1
+	X11_IMAGE_FORMAT_Z_PIXMAP  = 2
+)
+
+const (
+	X11_CONFIG_WINDOW_X            = 0x0001
+	X11_CONFIG_WINDOW_Y            = 0x0002
+	X11_CONFIG_WINDOW_WIDTH        = 0x0004
+	X11_CONFIG_WINDOW_HEIGHT       = 0x0008
+	X11_CONFIG_WINDOW_BORDER_WIDTH = 0x0010
+	X11_CONFIG_WINDOW_SIBLING      = 0x0020
+	X11_CONFIG_WINDOW_STACK_MODE   = 0x0040
+)
+
+const (
+	X11_STACK_MODE_ABOVE     = 0
+	X11_STACK_MODE_BELOW     = 1
+	X11_STACK_MODE_TOP_IF    = 2
+	X11_STACK_MODE_BOTTOM_IF = 3
+	X11_STACK_MODE_OPPOSITE  = 4
+)
+
+const (
+	X11_CIRCULATE_RAISE_LOWEST  = 0
+	X11_CIRCULATE_LOWER_HIGHEST = 1
+)
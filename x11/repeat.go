@@ -0,0 +1,73 @@
+package x11
+
+import (
+	"sync"
+	"time"
+)
+
+// RepeatDetector tells auto-repeated key presses from real ones and sets
+// KeyEvent.Repeat on them.
+//
+// Servers with detectable auto-repeat enabled, see
+// xkb.Keyboard.SetDetectableAutoRepeat, send repeated presses without the
+// releases in between, so a press of a key that is already down is a
+// repeat. Other servers send a release and a press with the same time for
+// each repeat. The detector then searches the event queue and drops the
+// release when the matching press is queued behind it, possibly after
+// other events, waiting up to Delay for the press to be read.
+type RepeatDetector struct {
+	c *Conn
+
+	// Detectable is set when the server does not send releases between
+	// repeated presses.
+	Detectable bool
+
+	// Delay is how long a release may be held back waiting for the press
+	// of a repeat, 10 milliseconds by default.
+	Delay time.Duration
+
+	mu   sync.Mutex
+	down [256]bool
+}
+
+// NewRepeatDetector returns a RepeatDetector peeking at c's event queue.
+func NewRepeatDetector(c *Conn) *RepeatDetector {
+	return &RepeatDetector{c: c, Delay: 10 * time.Millisecond}
+}
+
+// Filter updates the key state for ev and marks repeated presses. It
+// reports the synthetic releases of repeats as handled so they can be
+// dropped.
+func (r *RepeatDetector) Filter(ev Event) bool {
+	e, ok := ev.(*KeyEvent)
+	if !ok {
+		return false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if e.Pressed {
+		e.Repeat = r.down[e.Keycode]
+		r.down[e.Keycode] = true
+		return false
+	}
+	if !r.Detectable {
+		press := r.c.FindEventWithin(r.Delay, func(ev Event) bool {
+			next, ok := ev.(*KeyEvent)
+			return ok && next.Pressed && next.Keycode == e.Keycode && next.Time == e.Time
+		})
+		if press != nil {
+			return true
+		}
+	}
+	r.down[e.Keycode] = false
+	return false
+}
+
+// Down reports whether the key with the given keycode is held down, as far
+// as the events seen by Filter tell.
+func (r *RepeatDetector) Down(keycode uint8) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.down[keycode]
+}
@@ -0,0 +1,73 @@
+package x11
+
+import "github.com/dzeromsk/helloX11/x11byte"
+
+// SetSelectionOwner makes owner the owner of selection as of time, or
+// clears the selection if owner is X11_NONE. Ownership is not changed if
+// time is older than the current owner's. ICCCM asks owners not to use
+// X11_CURRENT_TIME.
+func (c *Conn) SetSelectionOwner(owner, selection, time uint32) error {
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_SET_SELECTION_OWNER) // opcode
+	b.AddUint8(0)                               // unused
+	b.AddUint16(4)                              // requestLength
+	b.AddUint32(owner)                          // owner
+	b.AddUint32(selection)                      // selection
+	b.AddUint32(time)                           // time
+
+	return c.Send(b.BytesOrPanic())
+}
+
+// GetSelectionOwner returns the window owning selection, or X11_NONE.
+func (c *Conn) GetSelectionOwner(selection uint32) (uint32, error) {
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_GET_SELECTION_OWNER) // opcode
+	b.AddUint8(0)                               // unused
+	b.AddUint16(2)                              // requestLength
+	b.AddUint32(selection)                      // selection
+
+	reply, err := c.Request(b.BytesOrPanic())
+	if err != nil {
+		return 0, err
+	}
+
+	var owner uint32
+	reply.Skip(1) // reply
+	reply.Skip(1) // unused
+	reply.Skip(2) // sequenceNumber
+	reply.Skip(4) // replyLength
+	reply.ReadUint32(&owner)
+	return owner, nil
+}
+
+// ConvertSelection asks the owner of selection to store it as target in
+// property of requestor. A SelectionNotify event reports the outcome.
+func (c *Conn) ConvertSelection(requestor, selection, target, property, time uint32) error {
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_CONVERT_SELECTION) // opcode
+	b.AddUint8(0)                             // unused
+	b.AddUint16(6)                            // requestLength
+	b.AddUint32(requestor)                    // requestor
+	b.AddUint32(selection)                    // selection
+	b.AddUint32(target)                       // target
+	b.AddUint32(property)                     // property
+	b.AddUint32(time)                         // time
+
+	return c.Send(b.BytesOrPanic())
+}
+
+// SendSelectionNotify answers a SelectionRequest. Property is X11_NONE if
+// the selection could not be converted.
+func (c *Conn) SendSelectionNotify(ev *SelectionRequestEvent, property uint32) error {
+	var b x11byte.Builder
+	b.AddUint8(X11_EVENT_SELECTION_NOTIFY) // eventCode
+	b.AddUint8(0)                          // unused
+	b.AddUint16(0)                         // sequenceNumber
+	b.AddUint32(ev.Time)                   // time
+	b.AddUint32(ev.Requestor)              // requestor
+	b.AddUint32(ev.Selection)              // selection
+	b.AddUint32(ev.Target)                 // target
+	b.AddUint32(property)                  // property
+	b.AddBytes(make([]byte, 8))            // unused
+	return c.SendEvent(false, ev.Requestor, 0, b.BytesOrPanic())
+}
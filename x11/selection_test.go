@@ -0,0 +1,46 @@
+package x11
+
+import (
+	"testing"
+
+	"github.com/dzeromsk/helloX11/x11byte"
+)
+
+func TestSelectionRequest(t *testing.T) {
+	c, s := newTestConn(t)
+
+	var b x11byte.Builder
+	b.AddUint8(X11_EVENT_SELECTION_REQUEST) // eventCode
+	b.AddUint8(0)                           // unused
+	b.AddUint16(1)                          // sequenceNumber
+	b.AddUint32(1000)                       // time
+	b.AddUint32(5)                          // owner
+	b.AddUint32(7)                          // requestor
+	b.AddUint32(X11_ATOM_PRIMARY)           // selection
+	b.AddUint32(X11_ATOM_STRING)            // target
+	b.AddUint32(0x100)                      // property
+	b.AddBytes(make([]byte, 4))             // unused
+	ev, ok := c.decodeEvent(b.BytesOrPanic()).(*SelectionRequestEvent)
+	want := SelectionRequestEvent{1000, 5, 7, X11_ATOM_PRIMARY, X11_ATOM_STRING, 0x100}
+	if !ok || *ev != want {
+		t.Fatalf("decoded %+v, want %+v", ev, want)
+	}
+	if ev.EventWindow() != 5 {
+		t.Errorf("EventWindow() = %d, want owner", ev.EventWindow())
+	}
+
+	go func() {
+		if err := c.SendSelectionNotify(ev, 0x100); err != nil {
+			t.Error(err)
+		}
+	}()
+	req := s.readRequest()
+	var destination uint32
+	req.Skip(4)
+	req.ReadUint32(&destination)
+	req.Skip(4) // eventMask
+	notify, ok := c.decodeEvent(req).(*SelectionNotifyEvent)
+	if destination != 7 || !ok || *notify != (SelectionNotifyEvent{1000, 7, X11_ATOM_PRIMARY, X11_ATOM_STRING, 0x100}) {
+		t.Errorf("SendSelectionNotify sent %+v to %d", notify, destination)
+	}
+}
@@ -0,0 +1,258 @@
+package x11
+
+import (
+	"errors"
+	"io"
+
+	"github.com/dzeromsk/helloX11/x11byte"
+)
+
+var (
+	errResponseStateFailed       = errors.New("RESPONSE_STATE_FAILED")
+	errResponseStateAuthenticate = errors.New("RESPONSE_STATE_AUTHENTICATE")
+	errResponseStateUnknown      = errors.New("RESPONSE_STATE_UNKNOWN")
+)
+
+// Setup is the connection setup reply sent by the server.
+type Setup struct {
+	ReleaseNumber            uint32
+	ResourceIDBase           uint32
+	ResourceIDMask           uint32
+	MotionBufferSize         uint32
+	Vendor                   string
+	MaximumRequestLength     uint16
+	ImageByteOrder           uint8
+	BitmapFormatBitOrder     uint8
+	BitmapFormatScanlineUnit uint8
+	BitmapFormatScanlinePad  uint8
+	MinKeycode               uint8
+	MaxKeycode               uint8
+	Formats                  []Format
+	Screens                  []Screen
+}
+
+// Format describes how images of a given depth are laid out in ZPixmap format.
+type Format struct {
+	Depth        uint8
+	BitsPerPixel uint8
+	ScanlinePad  uint8
+}
+
+// Screen describes a root window and the depths and visuals it supports.
+type Screen struct {
+	Root                uint32
+	DefaultColormap     uint32
+	WhitePixel          uint32
+	BlackPixel          uint32
+	CurrentInputMasks   uint32
+	WidthInPixels       uint16
+	HeightInPixels      uint16
+	WidthInMillimeters  uint16
+	HeightInMillimeters uint16
+	MinInstalledMaps    uint16
+	MaxInstalledMaps    uint16
+	RootVisual          uint32
+	BackingStores       uint8
+	SaveUnders          uint8
+	RootDepth           uint8
+	Depths              []Depth
+}
+
+// Depth lists the visuals available at a given depth.
+type Depth struct {
+	Depth   uint8
+	Visuals []Visual
+}
+
+// Visual classes.
+const (
+	VISUAL_CLASS_STATIC_GRAY  = 0
+	VISUAL_CLASS_GRAY_SCALE   = 1
+	VISUAL_CLASS_STATIC_COLOR = 2
+	VISUAL_CLASS_PSEUDO_COLOR = 3
+	VISUAL_CLASS_TRUE_COLOR   = 4
+	VISUAL_CLASS_DIRECT_COLOR = 5
+)
+
+// Visual describes how pixel values map to colors.
+type Visual struct {
+	ID              uint32
+	Class           uint8
+	BitsPerRGBValue uint8
+	ColormapEntries uint16
+	RedMask         uint32
+	GreenMask       uint32
+	BlueMask        uint32
+}
+
+// Visual returns the visual with the given id and its depth, or nil if the
+// screen does not support it.
+func (s *Screen) Visual(id uint32) (*Visual, uint8) {
+	for i := range s.Depths {
+		d := &s.Depths[i]
+		for j := range d.Visuals {
+			if d.Visuals[j].ID == id {
+				return &d.Visuals[j], d.Depth
+			}
+		}
+	}
+	return nil, 0
+}
+
+// Format returns the pixmap format for the given depth, or nil if the server
+// does not list one.
+func (s *Setup) Format(depth uint8) *Format {
+	for i := range s.Formats {
+		if s.Formats[i].Depth == depth {
+			return &s.Formats[i]
+		}
+	}
+	return nil
+}
+
+func authenticate(conn io.ReadWriter) (*Setup, error) {
+	var b x11byte.Builder
+	b.AddUint8('l') // byte-order
+	b.AddUint8(0)   // unused
+	b.AddUint16(11) // protocol-major-version
+	b.AddUint16(0)  // protocol-minor-version
+	b.AddUint16(0)  // authorization-protocol-name-length
+	b.AddUint16(0)  // authorization-protocol-data-length
+	b.AddUint16(0)  // protocol-minor-version
+	if _, err := conn.Write(b.BytesOrPanic()); err != nil {
+		return nil, err
+	}
+
+	header := x11byte.String(make([]byte, 8))
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, err
+	}
+
+	var (
+		status       uint8
+		replayLength uint16
+	)
+	header.ReadUint8(&status)
+	header.Skip(1) // unused
+	header.Skip(2) // majorVersion
+	header.Skip(2) // minorVersion
+	header.ReadUint16(&replayLength)
+
+	switch status {
+	case 0:
+		return nil, errResponseStateFailed
+	case 1:
+		// RESPONSE_STATE_SUCCESS
+	case 2:
+		return nil, errResponseStateAuthenticate
+	default:
+		return nil, errResponseStateUnknown
+	}
+
+	replay := x11byte.String(make([]byte, int(replayLength)*4))
+	if _, err := io.ReadFull(conn, replay); err != nil {
+		return nil, err
+	}
+
+	return parseSetup(replay)
+}
+
+var errMalformedSetup = errors.New("x11: malformed setup reply")
+
+func parseSetup(replay x11byte.String) (*Setup, error) {
+	var (
+		s               Setup
+		lengthOfVendor  uint16
+		numberOfScreens uint8
+		numberOfFormats uint8
+	)
+	replay.ReadUint32(&s.ReleaseNumber)
+	replay.ReadUint32(&s.ResourceIDBase)
+	replay.ReadUint32(&s.ResourceIDMask)
+	replay.ReadUint32(&s.MotionBufferSize)
+	replay.ReadUint16(&lengthOfVendor)
+	replay.ReadUint16(&s.MaximumRequestLength)
+	replay.ReadUint8(&numberOfScreens)
+	replay.ReadUint8(&numberOfFormats)
+	replay.ReadUint8(&s.ImageByteOrder)
+	replay.ReadUint8(&s.BitmapFormatBitOrder)
+	replay.ReadUint8(&s.BitmapFormatScanlineUnit)
+	replay.ReadUint8(&s.BitmapFormatScanlinePad)
+	replay.ReadUint8(&s.MinKeycode)
+	replay.ReadUint8(&s.MaxKeycode)
+	replay.Skip(4) // unused
+
+	var vendor []byte
+	if !replay.ReadBytes(&vendor, int(lengthOfVendor)) {
+		return nil, errMalformedSetup
+	}
+	s.Vendor = string(vendor)
+	replay.Skip(pad(int(lengthOfVendor))) // padding
+
+	s.Formats = make([]Format, numberOfFormats)
+	for i := range s.Formats {
+		f := &s.Formats[i]
+		replay.ReadUint8(&f.Depth)
+		replay.ReadUint8(&f.BitsPerPixel)
+		replay.ReadUint8(&f.ScanlinePad)
+		replay.Skip(5) // unused
+	}
+
+	s.Screens = make([]Screen, numberOfScreens)
+	for i := range s.Screens {
+		sc := &s.Screens[i]
+		var allowedDepthsLen uint8
+		replay.ReadUint32(&sc.Root)
+		replay.ReadUint32(&sc.DefaultColormap)
+		replay.ReadUint32(&sc.WhitePixel)
+		replay.ReadUint32(&sc.BlackPixel)
+		replay.ReadUint32(&sc.CurrentInputMasks)
+		replay.ReadUint16(&sc.WidthInPixels)
+		replay.ReadUint16(&sc.HeightInPixels)
+		replay.ReadUint16(&sc.WidthInMillimeters)
+		replay.ReadUint16(&sc.HeightInMillimeters)
+		replay.ReadUint16(&sc.MinInstalledMaps)
+		replay.ReadUint16(&sc.MaxInstalledMaps)
+		replay.ReadUint32(&sc.RootVisual)
+		replay.ReadUint8(&sc.BackingStores)
+		replay.ReadUint8(&sc.SaveUnders)
+		replay.ReadUint8(&sc.RootDepth)
+		if !replay.ReadUint8(&allowedDepthsLen) {
+			return nil, errMalformedSetup
+		}
+
+		sc.Depths = make([]Depth, allowedDepthsLen)
+		for j := range sc.Depths {
+			d := &sc.Depths[j]
+			var visualsLen uint16
+			replay.ReadUint8(&d.Depth)
+			replay.Skip(1) // unused
+			replay.ReadUint16(&visualsLen)
+			if !replay.Skip(4) { // unused
+				return nil, errMalformedSetup
+			}
+
+			d.Visuals = make([]Visual, visualsLen)
+			for k := range d.Visuals {
+				v := &d.Visuals[k]
+				replay.ReadUint32(&v.ID)
+				replay.ReadUint8(&v.Class)
+				replay.ReadUint8(&v.BitsPerRGBValue)
+				replay.ReadUint16(&v.ColormapEntries)
+				replay.ReadUint32(&v.RedMask)
+				replay.ReadUint32(&v.GreenMask)
+				replay.ReadUint32(&v.BlueMask)
+				if !replay.Skip(4) { // unused
+					return nil, errMalformedSetup
+				}
+			}
+		}
+	}
+
+	return &s, nil
+}
+
+// pad returns the number of bytes needed to pad n to a multiple of four.
+func pad(n int) int {
+	return (4 - n%4) % 4
+}
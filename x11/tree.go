@@ -0,0 +1,347 @@
+package x11
+
+import "github.com/dzeromsk/helloX11/x11byte"
+
+// CreateChild creates an unmapped subwindow of w, positioned relative to w
+// with WithPosition. Child windows are clipped to their parent and are not
+// managed by the window manager.
+func (w *Window) CreateChild(width, height uint16, opts ...WindowOption) (*Window, error) {
+	return w.c.CreateWindow(w.ID, width, height, opts...)
+}
+
+// SetBackground changes the background pixel. It takes effect the next time
+// the window is exposed or cleared with ClearArea.
+func (w *Window) SetBackground(pixel uint32) error {
+	return w.changeAttributes(X11_FLAG_BACKGROUND_PIXEL, pixel)
+}
+
+// SetEventMask replaces the set of events selected on the window.
+func (w *Window) SetEventMask(mask uint32) error {
+	return w.changeAttributes(X11_FLAG_WIN_EVENT, mask)
+}
+
+func (w *Window) changeAttributes(valueMask uint32, values ...uint32) error {
+	return w.c.ChangeWindowAttributes(w.ID, valueMask, values...)
+}
+
+// ChangeWindowAttributes changes attributes of any window, including those
+// of other clients. The values are given in the order of the bits set in
+// valueMask. Event masks are kept per client, so selecting events on
+// another client's window does not disturb it.
+func (c *Conn) ChangeWindowAttributes(window, valueMask uint32, values ...uint32) error {
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_CHANGE_WINDOW_ATTRIBUTES) // opcode
+	b.AddUint8(0)                                    // unused
+	b.AddUint16(uint16(3 + len(values)))             // requestLength
+	b.AddUint32(window)                              // window
+	b.AddUint32(valueMask)                           // valueMask
+	for _, v := range values {
+		b.AddUint32(v) // values
+	}
+	return c.Send(b.BytesOrPanic())
+}
+
+// ClearArea fills a rectangle of the window with its background. A zero
+// width or height extends the rectangle to the edge of the window. If
+// exposures is set, Expose events are generated for the cleared area.
+func (w *Window) ClearArea(exposures bool, x, y int16, width, height uint16) error {
+	var e uint8
+	if exposures {
+		e = 1
+	}
+
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_CLEAR_AREA) // opcode
+	b.AddUint8(e)                      // exposures
+	b.AddUint16(4)                     // requestLength
+	b.AddUint32(w.ID)                  // window
+	b.AddUint16(uint16(x))             // x
+	b.AddUint16(uint16(y))             // y
+	b.AddUint16(width)                 // width
+	b.AddUint16(height)                // height
+	return w.c.Send(b.BytesOrPanic())
+}
+
+// Reparent moves the window to a new parent at position x, y within it. A
+// mapped window is unmapped and mapped again by the server.
+func (w *Window) Reparent(parent uint32, x, y int16) error {
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_REPARENT_WINDOW) // opcode
+	b.AddUint8(0)                           // unused
+	b.AddUint16(4)                          // requestLength
+	b.AddUint32(w.ID)                       // window
+	b.AddUint32(parent)                     // parent
+	b.AddUint16(uint16(x))                  // x
+	b.AddUint16(uint16(y))                  // y
+
+	if err := w.c.Send(b.BytesOrPanic()); err != nil {
+		return err
+	}
+	w.mu.Lock()
+	w.Parent = parent
+	w.mu.Unlock()
+	return nil
+}
+
+// parent returns w.Parent, which Reparent may change.
+func (w *Window) parent() uint32 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.Parent
+}
+
+// WindowChanges describes a ConfigureWindow request. Only the fields whose
+// X11_CONFIG_WINDOW_* bit is set in Mask are changed.
+type WindowChanges struct {
+	Mask        uint16
+	X, Y        int16
+	Width       uint16
+	Height      uint16
+	BorderWidth uint16
+	Sibling     uint32
+	StackMode   uint8 // one of X11_STACK_MODE_*
+}
+
+// Configure changes the position, size, border width or stacking order of
+// the window. For top-level windows the window manager may intercept the
+// request and apply something else; the outcome is reported by
+// ConfigureNotify.
+func (w *Window) Configure(changes WindowChanges) error {
+	var values []uint32
+	for _, v := range []struct {
+		bit   uint16
+		value uint32
+	}{
+		{X11_CONFIG_WINDOW_X, uint32(int32(changes.X))},
+		{X11_CONFIG_WINDOW_Y, uint32(int32(changes.Y))},
+		{X11_CONFIG_WINDOW_WIDTH, uint32(changes.Width)},
+		{X11_CONFIG_WINDOW_HEIGHT, uint32(changes.Height)},
+		{X11_CONFIG_WINDOW_BORDER_WIDTH, uint32(changes.BorderWidth)},
+		{X11_CONFIG_WINDOW_SIBLING, changes.Sibling},
+		{X11_CONFIG_WINDOW_STACK_MODE, uint32(changes.StackMode)},
+	} {
+		if changes.Mask&v.bit != 0 {
+			values = append(values, v.value)
+		}
+	}
+
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_CONFIGURE_WINDOW) // opcode
+	b.AddUint8(0)                            // unused
+	b.AddUint16(uint16(3 + len(values)))     // requestLength
+	b.AddUint32(w.ID)                        // window
+	b.AddUint16(changes.Mask)                // valueMask
+	b.AddUint16(0)                           // unused
+	for _, v := range values {
+		b.AddUint32(v) // values
+	}
+	return w.c.Send(b.BytesOrPanic())
+}
+
+// Move moves the window relative to its parent.
+func (w *Window) Move(x, y int16) error {
+	return w.Configure(WindowChanges{
+		Mask: X11_CONFIG_WINDOW_X | X11_CONFIG_WINDOW_Y,
+		X:    x,
+		Y:    y,
+	})
+}
+
+// Resize changes the size of the window, not including its border.
+func (w *Window) Resize(width, height uint16) error {
+	return w.Configure(WindowChanges{
+		Mask:   X11_CONFIG_WINDOW_WIDTH | X11_CONFIG_WINDOW_HEIGHT,
+		Width:  width,
+		Height: height,
+	})
+}
+
+// MoveResize moves and resizes the window in a single request.
+func (w *Window) MoveResize(x, y int16, width, height uint16) error {
+	return w.Configure(WindowChanges{
+		Mask:   X11_CONFIG_WINDOW_X | X11_CONFIG_WINDOW_Y | X11_CONFIG_WINDOW_WIDTH | X11_CONFIG_WINDOW_HEIGHT,
+		X:      x,
+		Y:      y,
+		Width:  width,
+		Height: height,
+	})
+}
+
+// Raise puts the window on top of its siblings.
+func (w *Window) Raise() error {
+	return w.Configure(WindowChanges{
+		Mask:      X11_CONFIG_WINDOW_STACK_MODE,
+		StackMode: X11_STACK_MODE_ABOVE,
+	})
+}
+
+// Lower puts the window below its siblings.
+func (w *Window) Lower() error {
+	return w.Configure(WindowChanges{
+		Mask:      X11_CONFIG_WINDOW_STACK_MODE,
+		StackMode: X11_STACK_MODE_BELOW,
+	})
+}
+
+// CirculateSubwindows rotates the stacking order of the window's mapped
+// children: X11_CIRCULATE_RAISE_LOWEST raises the lowest occluded child to
+// the top, X11_CIRCULATE_LOWER_HIGHEST lowers the highest occluding child to
+// the bottom.
+func (w *Window) CirculateSubwindows(direction uint8) error {
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_CIRCULATE_WINDOW) // opcode
+	b.AddUint8(direction)                    // direction
+	b.AddUint16(2)                           // requestLength
+	b.AddUint32(w.ID)                        // window
+	return w.c.Send(b.BytesOrPanic())
+}
+
+// MapSubwindows maps all unmapped children of the window, top to bottom.
+func (w *Window) MapSubwindows() error {
+	return w.subwindows(X11_REQUEST_MAP_SUBWINDOWS)
+}
+
+// UnmapSubwindows unmaps all mapped children of the window, bottom to top.
+func (w *Window) UnmapSubwindows() error {
+	return w.subwindows(X11_REQUEST_UNMAP_SUBWINDOWS)
+}
+
+// DestroySubwindows destroys all children of the window, bottom to top.
+func (w *Window) DestroySubwindows() error {
+	return w.subwindows(X11_REQUEST_DESTROY_SUBWINDOWS)
+}
+
+func (w *Window) subwindows(opcode uint8) error {
+	var b x11byte.Builder
+	b.AddUint8(opcode) // opcode
+	b.AddUint8(0)      // unused
+	b.AddUint16(2)     // requestLength
+	b.AddUint32(w.ID)  // window
+	return w.c.Send(b.BytesOrPanic())
+}
+
+// Geometry is the result of GetGeometry.
+type Geometry struct {
+	Root          uint32
+	Depth         uint8
+	X, Y          int16 // of a window, relative to its parent
+	Width, Height uint16
+	BorderWidth   uint16
+}
+
+// GetGeometry returns the size and depth of a window or pixmap, and the
+// position of a window within its parent.
+func (c *Conn) GetGeometry(drawable uint32) (*Geometry, error) {
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_GET_GEOMETRY) // opcode
+	b.AddUint8(0)                        // unused
+	b.AddUint16(2)                       // requestLength
+	b.AddUint32(drawable)                // drawable
+
+	reply, err := c.Request(b.BytesOrPanic())
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		g    Geometry
+		x, y uint16
+	)
+	reply.Skip(1) // reply
+	reply.ReadUint8(&g.Depth)
+	reply.Skip(2) // sequenceNumber
+	reply.Skip(4) // replyLength
+	reply.ReadUint32(&g.Root)
+	reply.ReadUint16(&x)
+	reply.ReadUint16(&y)
+	reply.ReadUint16(&g.Width)
+	reply.ReadUint16(&g.Height)
+	reply.ReadUint16(&g.BorderWidth)
+	g.X, g.Y = int16(x), int16(y)
+	return &g, nil
+}
+
+// Tree is the result of QueryTree.
+type Tree struct {
+	Root     uint32
+	Parent   uint32
+	Children []uint32 // in stacking order, bottom first
+}
+
+// QueryTree returns the root, parent and children of any window.
+func (c *Conn) QueryTree(window uint32) (*Tree, error) {
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_QUERY_TREE) // opcode
+	b.AddUint8(0)                      // unused
+	b.AddUint16(2)                     // requestLength
+	b.AddUint32(window)                // window
+
+	reply, err := c.Request(b.BytesOrPanic())
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		t           Tree
+		numChildren uint16
+	)
+	reply.Skip(1) // reply
+	reply.Skip(1) // unused
+	reply.Skip(2) // sequenceNumber
+	reply.Skip(4) // replyLength
+	reply.ReadUint32(&t.Root)
+	reply.ReadUint32(&t.Parent)
+	reply.ReadUint16(&numChildren)
+	reply.Skip(14) // unused
+	t.Children = make([]uint32, numChildren)
+	for i := range t.Children {
+		reply.ReadUint32(&t.Children[i])
+	}
+	return &t, nil
+}
+
+// QueryTree returns the root, parent and children of the window.
+func (w *Window) QueryTree() (*Tree, error) {
+	return w.c.QueryTree(w.ID)
+}
+
+// Translation is the result of TranslateCoordinates.
+type Translation struct {
+	SameScreen bool   // false if the windows are on different screens
+	Child      uint32 // child of the destination window containing the point, or X11_NONE
+	DstX, DstY int16
+}
+
+// TranslateCoordinates converts srcX, srcY relative to src into coordinates
+// relative to dst, and finds the child of dst containing the point.
+func (c *Conn) TranslateCoordinates(src, dst uint32, srcX, srcY int16) (*Translation, error) {
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_TRANSLATE_COORDINATES) // opcode
+	b.AddUint8(0)                                 // unused
+	b.AddUint16(4)                                // requestLength
+	b.AddUint32(src)                              // srcWindow
+	b.AddUint32(dst)                              // dstWindow
+	b.AddUint16(uint16(srcX))                     // srcX
+	b.AddUint16(uint16(srcY))                     // srcY
+
+	reply, err := c.Request(b.BytesOrPanic())
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		t          Translation
+		sameScreen uint8
+		dstX, dstY uint16
+	)
+	reply.Skip(1) // reply
+	reply.ReadUint8(&sameScreen)
+	reply.Skip(2) // sequenceNumber
+	reply.Skip(4) // replyLength
+	reply.ReadUint32(&t.Child)
+	reply.ReadUint16(&dstX)
+	reply.ReadUint16(&dstY)
+	t.SameScreen = sameScreen != 0
+	t.DstX, t.DstY = int16(dstX), int16(dstY)
+	return &t, nil
+}
@@ -0,0 +1,99 @@
+package x11
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dzeromsk/helloX11/x11byte"
+)
+
+func TestConfigure(t *testing.T) {
+	c, s := newTestConn(t)
+	w := &Window{c: c, ID: 5}
+
+	go w.Configure(WindowChanges{
+		Mask:      X11_CONFIG_WINDOW_X | X11_CONFIG_WINDOW_HEIGHT | X11_CONFIG_WINDOW_STACK_MODE,
+		X:         -10,
+		Y:         20, // not in mask
+		Height:    300,
+		StackMode: X11_STACK_MODE_BELOW,
+	})
+
+	var want x11byte.Builder
+	want.AddUint8(X11_REQUEST_CONFIGURE_WINDOW) // opcode
+	want.AddUint8(0)                            // unused
+	want.AddUint16(6)                           // requestLength
+	want.AddUint32(5)                           // window
+	want.AddUint16(0x49)                        // valueMask
+	want.AddUint16(0)                           // unused
+	want.AddUint32(0xfffffff6)                  // x
+	want.AddUint32(300)                         // height
+	want.AddUint32(X11_STACK_MODE_BELOW)        // stackMode
+	if req := s.readRequest(); !bytes.Equal(req, want.BytesOrPanic()) {
+		t.Errorf("Configure sent\n%v, want\n%v", []byte(req), want.BytesOrPanic())
+	}
+}
+
+func TestQueryTree(t *testing.T) {
+	c, s := newTestConn(t)
+
+	result := make(chan *Tree)
+	go func() {
+		tree, err := c.QueryTree(5)
+		if err != nil {
+			t.Error(err)
+		}
+		result <- tree
+	}()
+
+	s.readRequest()
+	var body x11byte.Builder
+	body.AddUint32(0x123)           // root
+	body.AddUint32(0x123)           // parent
+	body.AddUint16(2)               // numChildren
+	body.AddBytes(make([]byte, 14)) // unused
+	body.AddUint32(7)               // children
+	body.AddUint32(8)               // children
+	s.reply(0, body.BytesOrPanic())
+
+	tree := <-result
+	if tree.Root != 0x123 || tree.Parent != 0x123 || len(tree.Children) != 2 || tree.Children[1] != 8 {
+		t.Errorf("QueryTree() = %+v", tree)
+	}
+}
+
+func TestTranslateCoordinates(t *testing.T) {
+	c, s := newTestConn(t)
+
+	result := make(chan *Translation)
+	go func() {
+		tr, err := c.TranslateCoordinates(0x123, 5, 100, -20)
+		if err != nil {
+			t.Error(err)
+		}
+		result <- tr
+	}()
+
+	var want x11byte.Builder
+	want.AddUint8(X11_REQUEST_TRANSLATE_COORDINATES) // opcode
+	want.AddUint8(0)                                 // unused
+	want.AddUint16(4)                                // requestLength
+	want.AddUint32(0x123)                            // srcWindow
+	want.AddUint32(5)                                // dstWindow
+	want.AddUint16(100)                              // srcX
+	want.AddUint16(0xffec)                           // srcY
+	if req := s.readRequest(); !bytes.Equal(req, want.BytesOrPanic()) {
+		t.Errorf("TranslateCoordinates sent\n%v, want\n%v", []byte(req), want.BytesOrPanic())
+	}
+
+	var body x11byte.Builder
+	body.AddUint32(7)      // child
+	body.AddUint16(90)     // dstX
+	body.AddUint16(0xffe2) // dstY
+	s.reply(1, body.BytesOrPanic())
+
+	tr := <-result
+	if !tr.SameScreen || tr.Child != 7 || tr.DstX != 90 || tr.DstY != -30 {
+		t.Errorf("TranslateCoordinates() = %+v", tr)
+	}
+}
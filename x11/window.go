@@ -0,0 +1,264 @@
+package x11
+
+import (
+	"sync"
+
+	"github.com/dzeromsk/helloX11/x11byte"
+)
+
+// Window is a window created by this client.
+type Window struct {
+	c  *Conn
+	ID uint32
+
+	// Parent is the parent the window was created in or last given with
+	// Reparent, which changes it under the window's lock. Frames a window
+	// manager puts the window in do not count.
+	Parent uint32
+
+	mu          sync.Mutex
+	mapped      bool
+	state       []uint32 // _NET_WM_STATE atoms
+	iconPixmaps []uint32 // WM_HINTS icon pixmap and mask
+}
+
+type windowConfig struct {
+	x, y             int16
+	borderWidth      uint16
+	class            uint16
+	depth            uint8
+	visual           uint32
+	background       uint32
+	eventMask        uint32
+	overrideRedirect bool
+	properties       []func(*Window) error
+}
+
+// A WindowOption configures a window created by CreateWindow.
+type WindowOption func(*windowConfig)
+
+// WithPosition places the window at x, y relative to its parent. Window
+// managers are free to ignore the position of top-level windows.
+func WithPosition(x, y int16) WindowOption {
+	return func(cfg *windowConfig) {
+		cfg.x, cfg.y = x, y
+	}
+}
+
+// WithBorderWidth sets the width of the window border.
+func WithBorderWidth(width uint16) WindowOption {
+	return func(cfg *windowConfig) {
+		cfg.borderWidth = width
+	}
+}
+
+// WithBackground sets the background pixel used when the window is exposed.
+func WithBackground(pixel uint32) WindowOption {
+	return func(cfg *windowConfig) {
+		cfg.background = pixel
+	}
+}
+
+// WithEventMask replaces the default event mask, which selects input,
+// exposure, structure and property events.
+func WithEventMask(mask uint32) WindowOption {
+	return func(cfg *windowConfig) {
+		cfg.eventMask = mask
+	}
+}
+
+// WithInputOnly creates an invisible InputOnly window, which receives input
+// events but is never drawn. Such windows have no background.
+func WithInputOnly() WindowOption {
+	return func(cfg *windowConfig) {
+		cfg.class = WINDOWCLASS_INPUTONLY
+	}
+}
+
+// WithProperty runs f after the window is created and before it can be
+// mapped, which is when window managers expect most properties to be set.
+func WithProperty(f func(*Window) error) WindowOption {
+	return func(cfg *windowConfig) {
+		cfg.properties = append(cfg.properties, f)
+	}
+}
+
+// CreateWindow creates an unmapped InputOutput window as a child of parent,
+// which is the root window for top-level windows.
+func (c *Conn) CreateWindow(parent uint32, width, height uint16, opts ...WindowOption) (*Window, error) {
+	cfg := windowConfig{
+		class: WINDOWCLASS_INPUTOUTPUT,
+		eventMask: X11_EVENT_FLAG_KEY_PRESS | X11_EVENT_FLAG_KEY_RELEASE |
+			X11_EVENT_FLAG_BUTTON_PRESS | X11_EVENT_FLAG_BUTTON_RELEASE | X11_EVENT_FLAG_POINTER_MOTION |
+			X11_EVENT_FLAG_ENTER_WINDOW | X11_EVENT_FLAG_LEAVE_WINDOW | X11_EVENT_FLAG_FOCUS_CHANGE |
+			X11_EVENT_FLAG_EXPOSURE | X11_EVENT_FLAG_STRUCTURE_NOTIFY | X11_EVENT_FLAG_PROPERTY_CHANGE,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	windowID, err := c.NewID()
+	if err != nil {
+		return nil, err
+	}
+
+	// values must be in the order of their bits in the value mask
+	var (
+		valueMask uint32
+		values    []uint32
+	)
+	if cfg.class != WINDOWCLASS_INPUTONLY {
+		valueMask |= X11_FLAG_BACKGROUND_PIXEL
+		values = append(values, cfg.background)
+	}
+	if cfg.overrideRedirect {
+		valueMask |= X11_FLAG_OVERRIDE_REDIRECT
+		values = append(values, 1)
+	}
+	valueMask |= X11_FLAG_WIN_EVENT
+	values = append(values, cfg.eventMask)
+
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_CREATE_WINDOW) // opcode
+	b.AddUint8(cfg.depth)                 // depth
+	b.AddUint16(uint16(8 + len(values)))  // requestLength
+	b.AddUint32(windowID)                 // windowID
+	b.AddUint32(parent)                   // parent
+	b.AddUint16(uint16(cfg.x))            // x
+	b.AddUint16(uint16(cfg.y))            // y
+	b.AddUint16(width)                    // width
+	b.AddUint16(height)                   // height
+	b.AddUint16(cfg.borderWidth)          // borderWidth
+	b.AddUint16(cfg.class)                // windowClass
+	b.AddUint32(cfg.visual)               // visualID
+	b.AddUint32(valueMask)                // windowValueMask
+	for _, v := range values {
+		b.AddUint32(v) // windowValues
+	}
+
+	if err := c.Send(b.BytesOrPanic()); err != nil {
+		return nil, err
+	}
+
+	w := &Window{c: c, ID: windowID, Parent: parent}
+	for _, f := range cfg.properties {
+		if err := f(w); err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// Conn returns the connection the window was created on.
+func (w *Window) Conn() *Conn {
+	return w.c
+}
+
+// Map maps the window, making it visible once its ancestors are mapped.
+func (w *Window) Map() error {
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_MAP_WINDOW) // opcode
+	b.AddUint8(0)                      // unused
+	b.AddUint16(2)                     // requestLength
+	b.AddUint32(w.ID)                  // windowID
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.c.Send(b.BytesOrPanic()); err != nil {
+		return err
+	}
+	w.mapped = true
+	return nil
+}
+
+// Unmap unmaps the window.
+func (w *Window) Unmap() error {
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_UNMAP_WINDOW) // opcode
+	b.AddUint8(0)                        // unused
+	b.AddUint16(2)                       // requestLength
+	b.AddUint32(w.ID)                    // windowID
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.c.Send(b.BytesOrPanic()); err != nil {
+		return err
+	}
+	w.mapped = false
+	return nil
+}
+
+// Destroy destroys the window and all of its subwindows.
+func (w *Window) Destroy() error {
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_DESTROY_WINDOW) // opcode
+	b.AddUint8(0)                          // unused
+	b.AddUint16(2)                         // requestLength
+	b.AddUint32(w.ID)                      // windowID
+	return w.c.Send(b.BytesOrPanic())
+}
+
+// Mapped reports whether Map was called more recently than Unmap.
+func (w *Window) Mapped() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.mapped
+}
+
+// EnableDeleteWindow lets the window manager know that we support
+// WM_DELETE_WINDOW, so closing the window sends a ClientMessage instead of
+// killing the connection.
+func (w *Window) EnableDeleteWindow() error {
+	atoms, err := w.c.Atoms("WM_PROTOCOLS", "WM_DELETE_WINDOW")
+	if err != nil {
+		return err
+	}
+	return w.c.ChangePropertyUint32(w.ID, atoms[0], X11_ATOM_ATOM, atoms[1])
+}
+
+// IsDeleteWindow reports whether ev is a WM_DELETE_WINDOW request for the
+// window.
+func (w *Window) IsDeleteWindow(ev *ClientMessageEvent) bool {
+	wmProtocols, ok := w.c.atoms.lookup("WM_PROTOCOLS")
+	if !ok || ev.Window != w.ID || ev.Type != wmProtocols {
+		return false
+	}
+	wmDeleteWindow, _ := w.c.atoms.lookup("WM_DELETE_WINDOW")
+	return ev.Data32()[0] == wmDeleteWindow
+}
+
+// SendEvent sends a 32-byte event to a window.
+func (c *Conn) SendEvent(propagate bool, destination, eventMask uint32, event []byte) error {
+	var p uint8
+	if propagate {
+		p = 1
+	}
+
+	var b x11byte.Builder
+	b.AddUint8(X11_REQUEST_SEND_EVENT) // opcode
+	b.AddUint8(p)                      // propagate
+	b.AddUint16(11)                    // requestLength
+	b.AddUint32(destination)           // destination
+	b.AddUint32(eventMask)             // eventMask
+	b.AddBytes(event)                  // event
+	return c.Send(b.BytesOrPanic())
+}
+
+// SendClientMessage sends a format 32 ClientMessage about window to
+// destination, as used by ICCCM and EWMH to talk to the window manager.
+func (c *Conn) SendClientMessage(destination, eventMask, window, typ uint32, data ...uint32) error {
+	var b x11byte.Builder
+	b.AddUint8(X11_EVENT_CLIENT_MESSAGE) // eventCode
+	b.AddUint8(32)                       // format
+	b.AddUint16(0)                       // sequenceNumber
+	b.AddUint32(window)                  // window
+	b.AddUint32(typ)                     // type
+	for i := range 5 {
+		var v uint32
+		if i < len(data) {
+			v = data[i]
+		}
+		b.AddUint32(v) // data
+	}
+	return c.SendEvent(false, destination, eventMask, b.BytesOrPanic())
+}
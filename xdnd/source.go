@@ -0,0 +1,379 @@
+package xdnd
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/dzeromsk/helloX11/x11"
+)
+
+// ErrDragging is returned by StartDrag while another drag is in progress.
+var ErrDragging = errors.New("xdnd: drag in progress")
+
+// Drag describes the data offered by a drag started with StartDrag.
+type Drag struct {
+	// Formats holds the data by MIME type.
+	Formats map[string][]byte
+
+	// Action is the action requested from targets, ActionCopy if empty.
+	Action string
+
+	// Cursor is shown during the drag, or X11_NONE to keep the window's.
+	Cursor uint32
+
+	// Finished is called when the drag is over, with the action the target
+	// performed, or "" if the drop was refused or cancelled.
+	Finished func(action string)
+}
+
+// activeDrag is the state of a drag started by us.
+type activeDrag struct {
+	w      *x11.Window
+	d      *Drag
+	types  []uint32
+	action uint32
+	keymap *x11.Keymap
+
+	// The XdndAware window under the pointer, if target is not X11_NONE.
+	target   uint32
+	version  uint32
+	accepted bool
+	waiting  bool // XdndPosition sent, XdndStatus not received yet
+
+	pending      bool // the pointer moved while waiting
+	rootX, rootY int16
+	time         uint32
+
+	dropped bool // XdndDrop sent, waiting for XdndFinished
+	serial  uint32
+	expire  *time.Timer // of the drop, unless the target finishes it
+}
+
+// StartDrag starts dragging data from w, usually when the pointer moves with
+// a button pressed. Time is the time of that event. The pointer and the
+// keyboard are grabbed until the button is released, dropping the data on
+// the window below if it accepts it. Escape or losing the grab cancels the
+// drag, and a target that does not finish a drop within Timeout is given
+// up on.
+func (d *DnD) StartDrag(w *x11.Window, drag *Drag, time uint32) error {
+	if d.drag != nil {
+		return ErrDragging
+	}
+	if err := d.sel.WriteFormats(drag.Formats); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(drag.Formats))
+	for mime := range drag.Formats {
+		names = append(names, mime)
+	}
+	slices.Sort(names)
+	types, err := d.c.Atoms(names...)
+	if err != nil {
+		return err
+	}
+	if len(types) > 3 {
+		if err := d.c.ChangePropertyUint32(w.ID, d.typeList, x11.X11_ATOM_ATOM, types...); err != nil {
+			return err
+		}
+	}
+	action := d.actionCopy
+	if drag.Action != "" {
+		if action, err = d.c.Atom(drag.Action); err != nil {
+			return err
+		}
+	}
+
+	var keymap *x11.Keymap
+	if d.Keyboard != nil {
+		keymap = d.Keyboard.Keymap()
+	} else if keymap, err = d.c.LoadKeymap(); err != nil {
+		return err
+	}
+
+	err = d.c.GrabPointer(w.ID, x11.PointerGrab{
+		EventMask: x11.X11_EVENT_FLAG_BUTTON_RELEASE | x11.X11_EVENT_FLAG_POINTER_MOTION |
+			x11.X11_EVENT_FLAG_ENTER_WINDOW | x11.X11_EVENT_FLAG_LEAVE_WINDOW,
+		PointerMode:  x11.X11_GRAB_MODE_ASYNC,
+		KeyboardMode: x11.X11_GRAB_MODE_ASYNC,
+		Cursor:       drag.Cursor,
+	}, time)
+	if err != nil {
+		return err
+	}
+	// Without the keyboard, Escape works only while w has the focus
+	err = d.c.GrabKeyboard(w.ID, false, x11.X11_GRAB_MODE_ASYNC, x11.X11_GRAB_MODE_ASYNC, time)
+	if _, ok := err.(x11.GrabStatus); err != nil && !ok {
+		return err
+	}
+	d.drag = &activeDrag{w: w, d: drag, types: types, action: action, keymap: keymap}
+	return nil
+}
+
+// filterDrag handles the pointer events and XDND messages of the drag in
+// progress.
+func (d *DnD) filterDrag(ev x11.Event) (bool, error) {
+	g := d.drag
+	switch ev := ev.(type) {
+	case *x11.MotionEvent:
+		if ev.Event != g.w.ID || g.dropped {
+			return false, nil
+		}
+		return true, d.dragMotion(g, ev.RootX, ev.RootY, ev.Time)
+	case *x11.ButtonEvent:
+		if ev.Event != g.w.ID || ev.Pressed || g.dropped {
+			return false, nil
+		}
+		return true, d.dragRelease(g, ev.Time)
+	case *x11.KeyEvent:
+		if ev.Event != g.w.ID || !ev.Pressed || g.dropped || g.keymap.Lookup(ev) != x11.XK_Escape {
+			return false, nil
+		}
+		return true, d.cancelDrag()
+	case *x11.CrossingEvent:
+		// Grabs are lost when their window becomes unviewable
+		if ev.Event != g.w.ID || ev.Mode != x11.X11_NOTIFY_MODE_UNGRAB || g.dropped {
+			return false, nil
+		}
+		return false, d.cancelDrag()
+	case *x11.FocusEvent:
+		if ev.Event != g.w.ID || ev.In || ev.Mode != x11.X11_NOTIFY_MODE_UNGRAB || g.dropped {
+			return false, nil
+		}
+		return false, d.cancelDrag()
+	case *x11.DestroyNotifyEvent:
+		if ev.Window != g.target || g.target == x11.X11_NONE {
+			return false, nil
+		}
+		g.target = x11.X11_NONE
+		g.accepted, g.waiting, g.pending = false, false, false
+		if g.dropped {
+			if err := d.endDrag(x11.X11_NONE); err != nil {
+				return false, err
+			}
+		}
+		// Our own windows are tracked by the Dispatcher as well
+		return d.target(ev.Window) == nil, nil
+	case *x11.ClientMessageEvent:
+		l := ev.Data32()
+		if ev.Window != g.w.ID || ev.Format != 32 || l[0] != g.target || g.target == x11.X11_NONE {
+			return false, nil
+		}
+		switch ev.Type {
+		case d.status:
+			g.accepted = l[1]&1 != 0
+			g.waiting = false
+			if g.pending && !g.dropped {
+				g.pending = false
+				return true, d.sendPosition(g)
+			}
+			return true, nil
+		case d.finished:
+			if !g.dropped {
+				return true, nil
+			}
+			action := uint32(x11.X11_NONE)
+			switch {
+			case g.version < 5:
+				action = g.action
+			case l[1]&1 != 0:
+				action = l[2]
+			}
+			return true, d.endDrag(action)
+		}
+	}
+	return false, nil
+}
+
+// dragMotion follows the pointer, telling the targets it enters and leaves
+// and the one under it where it is.
+func (d *DnD) dragMotion(g *activeDrag, rootX, rootY int16, time uint32) error {
+	g.rootX, g.rootY, g.time = rootX, rootY, time
+	target, version, err := d.findTarget(rootX, rootY)
+	if err != nil {
+		return err
+	}
+
+	if target != g.target {
+		if g.target != x11.X11_NONE {
+			if err := d.send(g.target, d.leave, g.w.ID); err != nil {
+				return err
+			}
+			if err := d.watch(g.target, false); err != nil {
+				return err
+			}
+		}
+		g.target, g.version = target, version
+		g.accepted, g.waiting, g.pending = false, false, false
+		if target == x11.X11_NONE {
+			return nil
+		}
+		if err := d.watch(target, true); err != nil {
+			return err
+		}
+		flags := version << 24
+		if len(g.types) > 3 {
+			flags |= 1
+		}
+		data := []uint32{g.w.ID, flags}
+		data = append(data, g.types[:min(len(g.types), 3)]...)
+		if err := d.send(target, d.enter, data...); err != nil {
+			return err
+		}
+	}
+	if target == x11.X11_NONE {
+		return nil
+	}
+
+	// Only one XdndPosition may be unanswered. Later moves are sent once
+	// the XdndStatus arrives.
+	if g.waiting {
+		g.pending = true
+		return nil
+	}
+	return d.sendPosition(g)
+}
+
+func (d *DnD) sendPosition(g *activeDrag) error {
+	g.waiting = true
+	return d.send(g.target, d.position, g.w.ID, 0, packPoint(g.rootX, g.rootY), g.time, g.action)
+}
+
+// watch selects or deselects the DestroyNotify event of a target, unless
+// it is one of our own windows.
+func (d *DnD) watch(window uint32, on bool) error {
+	if d.target(window) != nil {
+		return nil
+	}
+	mask := uint32(0)
+	if on {
+		mask = x11.X11_EVENT_FLAG_STRUCTURE_NOTIFY
+	}
+	return d.c.ChangeWindowAttributes(window, x11.X11_FLAG_WIN_EVENT, mask)
+}
+
+// ungrab releases the pointer and the keyboard.
+func (d *DnD) ungrab(time uint32) error {
+	if err := d.c.UngrabPointer(time); err != nil {
+		return err
+	}
+	return d.c.UngrabKeyboard(time)
+}
+
+// dragRelease drops the data on the target under the pointer, or cancels
+// the drag if there is none or it refused the data.
+func (d *DnD) dragRelease(g *activeDrag, time uint32) error {
+	if err := d.ungrab(time); err != nil {
+		return err
+	}
+	switch {
+	case g.target == x11.X11_NONE:
+		return d.endDrag(x11.X11_NONE)
+	case !g.accepted:
+		if err := d.send(g.target, d.leave, g.w.ID); err != nil {
+			return err
+		}
+		return d.endDrag(x11.X11_NONE)
+	}
+	g.dropped = true
+	d.expireDrop(g)
+	return d.send(g.target, d.drop, g.w.ID, 0, time)
+}
+
+// expireDrop has dropExpired called for g after Timeout, with a message to
+// the window, so it runs with the other callbacks.
+func (d *DnD) expireDrop(g *activeDrag) {
+	d.mu.Lock()
+	d.serial++
+	serial := d.serial
+	d.mu.Unlock()
+	g.serial = serial
+	g.expire = time.AfterFunc(d.Timeout, func() {
+		d.send(g.w.ID, d.expired, serial) // fails only if the connection is gone
+	})
+}
+
+// dropExpired gives up on a drop the target did not finish in time.
+func (d *DnD) dropExpired(serial uint32) error {
+	if g := d.drag; g == nil || !g.dropped || g.serial != serial {
+		return nil
+	}
+	return d.endDrag(x11.X11_NONE)
+}
+
+// cancelDrag ends the drag in progress, if any, without dropping.
+func (d *DnD) cancelDrag() error {
+	g := d.drag
+	if g == nil {
+		return nil
+	}
+	if !g.dropped {
+		if g.target != x11.X11_NONE {
+			if err := d.send(g.target, d.leave, g.w.ID); err != nil {
+				return err
+			}
+		}
+		if err := d.ungrab(x11.X11_CURRENT_TIME); err != nil {
+			return err
+		}
+	}
+	return d.endDrag(x11.X11_NONE)
+}
+
+// endDrag reports the action performed and forgets the drag. An action
+// whose name cannot be found is reported as "".
+func (d *DnD) endDrag(action uint32) error {
+	g := d.drag
+	d.drag = nil
+	if g.expire != nil {
+		g.expire.Stop()
+	}
+	if g.target != x11.X11_NONE {
+		if err := d.watch(g.target, false); err != nil {
+			return err
+		}
+	}
+	if g.d.Finished == nil {
+		return nil
+	}
+	var (
+		name string
+		err  error
+	)
+	if action != x11.X11_NONE {
+		name, err = d.c.AtomName(action)
+	}
+	g.d.Finished(name)
+	return err
+}
+
+// findTarget returns the XdndAware window at the root coordinates x, y and
+// the protocol version to speak with it, or X11_NONE. It descends from the
+// root, as the window manager's frames are usually between the root and
+// the application's top-level windows.
+func (d *DnD) findTarget(x, y int16) (uint32, uint32, error) {
+	root := d.c.Screen().Root
+	window := root
+	for {
+		tr, err := d.c.TranslateCoordinates(root, window, x, y)
+		if err != nil {
+			return x11.X11_NONE, 0, err
+		}
+		if tr.Child == x11.X11_NONE {
+			return x11.X11_NONE, 0, nil
+		}
+		window = tr.Child
+
+		version, err := d.c.GetPropertyUint32(window, d.aware, x11.X11_ATOM_ATOM)
+		if err != nil {
+			return x11.X11_NONE, 0, err
+		}
+		if len(version) > 0 {
+			if version[0] < xdndMinVersion {
+				return x11.X11_NONE, 0, nil
+			}
+			return window, min(version[0], XDND_VERSION), nil
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package xdnd
+
+import (
+	"context"
+	"slices"
+
+	"github.com/dzeromsk/helloX11/x11"
+)
+
+// Target holds the drop callbacks of a window. Nil callbacks are skipped.
+type Target struct {
+	// Types lists the MIME types the window accepts, best first. If nil,
+	// the first type offered is accepted.
+	Types []string
+
+	// Enter is called when a drag enters the window, with the types the
+	// source offers.
+	Enter func(types []string)
+
+	// Position is called as the drag moves over the window, in window
+	// coordinates, and reports whether a drop is welcome there. If nil,
+	// drops are accepted anywhere.
+	Position func(x, y int16, action string) bool
+
+	// Leave is called when the drag leaves the window or is cancelled.
+	Leave func()
+
+	// Drop is called with the dropped data.
+	Drop func(*Drop)
+}
+
+// Drop is data dropped on a window.
+type Drop struct {
+	Type   string // MIME type, the first of Target.Types offered by the source
+	Data   []byte
+	X, Y   int16  // window coordinates of the drop
+	Action string // action requested by the source, such as ActionCopy
+}
+
+// target is the state of a registered window.
+type target struct {
+	w *x11.Window
+	t *Target
+
+	// The drag over the window, if source is not X11_NONE.
+	source  uint32
+	version uint32
+	typ     string // type to read, "" if none is accepted
+	accept  bool
+	x, y    int16
+	action  uint32
+	name    string // of action
+	time    uint32 // of the XdndDrop, to convert the selection as of
+}
+
+// result is the outcome of reading the data of a drop, handed to the
+// goroutine running the Dispatcher with a HELLOX11_XDND_RECEIVED message.
+type result struct {
+	source  uint32
+	version uint32
+	action  uint32
+	drop    *Drop
+	err     error
+}
+
+// Register makes w, a top-level window, accept drops and report them to t.
+// It replaces callbacks registered before. Like Unregister, it may be
+// called from any goroutine.
+func (d *DnD) Register(w *x11.Window, t *Target) error {
+	d.mu.Lock()
+	d.targets[w.ID] = &target{w: w, t: t}
+	d.mu.Unlock()
+	return d.c.ChangePropertyUint32(w.ID, d.aware, x11.X11_ATOM_ATOM, XDND_VERSION)
+}
+
+// Unregister stops w from accepting drops.
+func (d *DnD) Unregister(w *x11.Window) error {
+	d.mu.Lock()
+	delete(d.targets, w.ID)
+	d.mu.Unlock()
+	return d.c.DeleteProperty(w.ID, d.aware)
+}
+
+// target returns the target registered for window, or nil.
+func (d *DnD) target(window uint32) *target {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.targets[window]
+}
+
+func (d *DnD) filterTarget(t *target, ev *x11.ClientMessageEvent) (bool, error) {
+	l := ev.Data32()
+	switch ev.Type {
+	case d.enter:
+		return true, d.handleEnter(t, l)
+	case d.position:
+		if l[0] != t.source {
+			return true, nil
+		}
+		return true, d.handlePosition(t, l)
+	case d.leave:
+		if l[0] != t.source {
+			return true, nil
+		}
+		d.resetTarget(t)
+		return true, nil
+	case d.drop:
+		if l[0] != t.source {
+			return true, nil
+		}
+		t.time = l[2]
+		return true, d.handleDrop(t)
+	case d.received:
+		return true, d.handleReceived(t, l[0])
+	}
+	return false, nil
+}
+
+// resetTarget forgets the drag over t, if any, as if it left the window.
+func (d *DnD) resetTarget(t *target) {
+	if t.source == x11.X11_NONE {
+		return
+	}
+	t.source = x11.X11_NONE
+	if t.t.Leave != nil {
+		t.t.Leave()
+	}
+}
+
+// handleEnter starts tracking a drag and picks the type to accept. The drag
+// is tracked only once the types offered are known.
+func (d *DnD) handleEnter(t *target, l [5]uint32) error {
+	source, version := l[0], min(l[1]>>24, XDND_VERSION)
+	t.source = x11.X11_NONE
+	if version < xdndMinVersion {
+		return nil
+	}
+
+	offered := l[2:]
+	if l[1]&1 != 0 { // more than three types
+		var err error
+		if offered, err = d.c.GetPropertyUint32(source, d.typeList, x11.X11_ATOM_ATOM); err != nil {
+			return err
+		}
+	}
+	var types []string
+	for _, atom := range offered {
+		if atom == x11.X11_NONE {
+			continue
+		}
+		name, err := d.c.AtomName(atom)
+		if err != nil {
+			return err
+		}
+		types = append(types, name)
+	}
+
+	t.source, t.version = source, version
+	t.typ, t.accept = chooseType(t.t.Types, types), false
+	if t.t.Enter != nil {
+		t.t.Enter(types)
+	}
+	return nil
+}
+
+// chooseType returns the first of accepted that is offered, or the first
+// offered type if accepted is nil.
+func chooseType(accepted, offered []string) string {
+	if accepted == nil && len(offered) > 0 {
+		return offered[0]
+	}
+	for _, typ := range accepted {
+		if slices.Contains(offered, typ) {
+			return typ
+		}
+	}
+	return ""
+}
+
+// handlePosition answers XdndPosition with XdndStatus.
+func (d *DnD) handlePosition(t *target, l [5]uint32) error {
+	rootX, rootY := unpackPoint(l[2])
+	tr, err := d.c.TranslateCoordinates(d.c.Screen().Root, t.w.ID, rootX, rootY)
+	if err != nil {
+		return err
+	}
+	t.x, t.y = tr.DstX, tr.DstY
+	t.action = d.actionCopy
+	if l[4] != x11.X11_NONE {
+		t.action = l[4]
+	}
+
+	if t.name, err = d.actionName(t.action); err != nil {
+		return err
+	}
+	t.accept = t.typ != ""
+	if t.accept && t.t.Position != nil {
+		t.accept = t.t.Position(t.x, t.y, t.name)
+	}
+
+	// Ask for positions everywhere, with an empty rectangle, so Position
+	// sees every move.
+	flags, action := uint32(2), uint32(x11.X11_NONE)
+	if t.accept {
+		flags, action = 3, t.action
+	}
+	return d.send(t.source, d.status, t.w.ID, flags, 0, 0, action)
+}
+
+// handleDrop reads the dropped data without blocking the event loop. The
+// reading goroutine reports back with a message to the window, so Drop runs
+// with the other callbacks.
+func (d *DnD) handleDrop(t *target) error {
+	source := t.source
+	t.source = x11.X11_NONE
+	if !t.accept {
+		if t.t.Leave != nil {
+			t.t.Leave()
+		}
+		return d.send(source, d.finished, t.w.ID, 0, x11.X11_NONE)
+	}
+
+	d.mu.Lock()
+	d.serial++
+	serial := d.serial
+	d.mu.Unlock()
+
+	r := &result{
+		source:  source,
+		version: t.version,
+		action:  t.action,
+		drop:    &Drop{Type: t.typ, X: t.x, Y: t.y, Action: t.name},
+	}
+	time := t.time
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), d.Timeout)
+		r.drop.Data, r.err = d.sel.ReadAtTime(ctx, r.drop.Type, time)
+		cancel()
+
+		d.mu.Lock()
+		d.results[serial] = r
+		d.mu.Unlock()
+		d.send(t.w.ID, d.received, serial) // fails only if the connection is gone
+	}()
+	return nil
+}
+
+// handleReceived delivers a drop whose data was read and tells the source
+// the drop is finished.
+func (d *DnD) handleReceived(t *target, serial uint32) error {
+	d.mu.Lock()
+	r := d.results[serial]
+	delete(d.results, serial)
+	d.mu.Unlock()
+	if r == nil {
+		return nil
+	}
+
+	var flags, action uint32
+	if r.err != nil {
+		if d.Error != nil {
+			d.Error(r.err)
+		}
+		if t.t.Leave != nil {
+			t.t.Leave()
+		}
+	} else {
+		flags, action = 1, r.action
+		if t.t.Drop != nil {
+			t.t.Drop(r.drop)
+		}
+	}
+	if r.version < 5 {
+		flags, action = 0, x11.X11_NONE
+	}
+	return d.send(r.source, d.finished, t.w.ID, flags, action)
+}
@@ -0,0 +1,168 @@
+// Package xdnd implements the XDND drag-and-drop protocol, version 5: windows
+// accepting drops of files and text from other applications, and drags
+// started by the application itself.
+//
+// XDND talks with ClientMessages on the application's main connection and
+// moves the data with the XdndSelection selection, which a selection.Manager
+// reads and owns on a connection of its own:
+//
+//	dnd, err := xdnd.New(conn, selections)
+//	d.Filter = dnd.Filter
+//	dnd.Register(window, &xdnd.Target{
+//		Types: []string{xdnd.MimeURIList},
+//		Drop:  func(drop *xdnd.Drop) { ... },
+//	})
+package xdnd
+
+import (
+	"sync"
+	"time"
+
+	"github.com/dzeromsk/helloX11/selection"
+	"github.com/dzeromsk/helloX11/x11"
+)
+
+// XDND_VERSION is the protocol version implemented. Peers speaking versions
+// 3 and 4 are supported as well.
+const XDND_VERSION = 5
+
+// xdndMinVersion is the oldest version spoken with other clients.
+const xdndMinVersion = 3
+
+// Actions a drag source requests and a target performs.
+const (
+	ActionCopy    = "XdndActionCopy"
+	ActionMove    = "XdndActionMove"
+	ActionLink    = "XdndActionLink"
+	ActionAsk     = "XdndActionAsk"
+	ActionPrivate = "XdndActionPrivate"
+)
+
+// MimeURIList is the type of dropped files, one file:// URI per line.
+const MimeURIList = "text/uri-list"
+
+// DnD handles drag and drop for the windows of a connection.
+type DnD struct {
+	// Error is called for drops whose data could not be read, and for
+	// protocol errors caused by other clients, such as a drag source
+	// destroying its window mid-drag. They are ignored if it is nil.
+	Error func(error)
+
+	// Timeout limits how long reading the data of a drop may take, and how
+	// long a target may take to finish a drop of ours, 10 seconds by
+	// default.
+	Timeout time.Duration
+
+	// Keyboard, if set, is used to recognize Escape, which cancels drags.
+	// Otherwise the keymap is loaded whenever a drag starts.
+	Keyboard *x11.Keyboard
+
+	c   *x11.Conn
+	sel *selection.Selection
+
+	// Atoms used by the protocol.
+	aware, enter, position, status, leave, drop, finished, typeList, actionCopy, received, expired uint32
+
+	drag *activeDrag // drag in progress, started by us
+
+	// mu guards the fields below, which Register, Unregister and the
+	// goroutines reading drops use besides Filter.
+	mu      sync.Mutex
+	targets map[uint32]*target // by window
+	serial  uint32
+	results map[uint32]*result // drop data read, by serial
+}
+
+// New returns a DnD for windows on c. It reads and offers drag data with
+// the XdndSelection selection of m, which should use a connection other than
+// c.
+func New(c *x11.Conn, m *selection.Manager) (*DnD, error) {
+	sel, err := m.Selection("XdndSelection")
+	if err != nil {
+		return nil, err
+	}
+	atoms, err := c.Atoms("XdndAware", "XdndEnter", "XdndPosition", "XdndStatus", "XdndLeave", "XdndDrop",
+		"XdndFinished", "XdndTypeList", ActionCopy, "HELLOX11_XDND_RECEIVED", "HELLOX11_XDND_EXPIRED")
+	if err != nil {
+		return nil, err
+	}
+
+	d := &DnD{
+		Timeout: 10 * time.Second,
+		c:       c,
+		sel:     sel,
+		targets: make(map[uint32]*target),
+		results: make(map[uint32]*result),
+	}
+	d.aware, d.enter, d.position, d.status, d.leave, d.drop, d.finished, d.typeList, d.actionCopy, d.received, d.expired =
+		atoms[0], atoms[1], atoms[2], atoms[3], atoms[4], atoms[5], atoms[6], atoms[7], atoms[8], atoms[9], atoms[10]
+	return d, nil
+}
+
+// Filter handles XDND messages for registered windows and the pointer
+// events of a drag in progress, reporting them as handled. It is meant to be
+// installed as the Dispatcher's Filter, or called from it, so the callbacks
+// run on the goroutine calling Dispatcher.Run.
+//
+// Requests about the windows and atoms of other clients fail when these go
+// away. Such errors end the drag they belong to and are passed to Error;
+// only connection errors are returned.
+func (d *DnD) Filter(ev x11.Event) (bool, error) {
+	if d.drag != nil {
+		if handled, err := d.filterDrag(ev); handled || err != nil {
+			if d.peerError(err) {
+				return true, d.cancelDrag()
+			}
+			return handled, err
+		}
+	}
+	if ev, ok := ev.(*x11.ClientMessageEvent); ok && ev.Format == 32 {
+		if ev.Type == d.expired {
+			return true, d.dropExpired(ev.Data32()[0])
+		}
+		if t := d.target(ev.Window); t != nil {
+			handled, err := d.filterTarget(t, ev)
+			if d.peerError(err) {
+				d.resetTarget(t)
+				return true, nil
+			}
+			return handled, err
+		}
+	}
+	return false, nil
+}
+
+// peerError reports err to Error if it is a protocol error rather than a
+// connection error.
+func (d *DnD) peerError(err error) bool {
+	if _, ok := err.(*x11.Error); !ok {
+		return false
+	}
+	if d.Error != nil {
+		d.Error(err)
+	}
+	return true
+}
+
+// send sends an XDND message about window to destination.
+func (d *DnD) send(destination, typ uint32, data ...uint32) error {
+	return d.c.SendClientMessage(destination, 0, destination, typ, data...)
+}
+
+// actionName returns the name of an action atom, ActionCopy for None.
+func (d *DnD) actionName(action uint32) (string, error) {
+	if action == x11.X11_NONE {
+		return ActionCopy, nil
+	}
+	return d.c.AtomName(action)
+}
+
+// packPoint packs root coordinates as XdndPosition carries them.
+func packPoint(x, y int16) uint32 {
+	return uint32(uint16(x))<<16 | uint32(uint16(y))
+}
+
+// unpackPoint is the inverse of packPoint.
+func unpackPoint(v uint32) (x, y int16) {
+	return int16(v >> 16), int16(v)
+}
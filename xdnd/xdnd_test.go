@@ -0,0 +1,394 @@
+package xdnd
+
+import (
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dzeromsk/helloX11/internal/xtest"
+	"github.com/dzeromsk/helloX11/selection"
+	"github.com/dzeromsk/helloX11/x11"
+)
+
+func TestChooseType(t *testing.T) {
+	offered := []string{"text/plain", MimeURIList, "UTF8_STRING"}
+	for _, tt := range []struct {
+		accepted []string
+		want     string
+	}{
+		{nil, "text/plain"},
+		{[]string{MimeURIList}, MimeURIList},
+		{[]string{"image/png", "UTF8_STRING", "text/plain"}, "UTF8_STRING"},
+		{[]string{"image/png"}, ""},
+	} {
+		if got := chooseType(tt.accepted, offered); got != tt.want {
+			t.Errorf("chooseType(%q) = %q, want %q", tt.accepted, got, tt.want)
+		}
+	}
+	if got := chooseType(nil, nil); got != "" {
+		t.Errorf("chooseType(nil, nil) = %q", got)
+	}
+}
+
+func TestPackPoint(t *testing.T) {
+	if v := packPoint(100, 200); v != 100<<16|200 {
+		t.Errorf("packPoint(100, 200) = %#x", v)
+	}
+	if x, y := unpackPoint(packPoint(-5, 1080)); x != -5 || y != 1080 {
+		t.Errorf("unpackPoint(packPoint(-5, 1080)) = %d, %d", x, y)
+	}
+}
+
+// peer is a client of the fake server with a DnD of its own.
+type peer struct {
+	c   *x11.Conn
+	dnd *DnD
+}
+
+func newPeer(t *testing.T, s *xtest.Server) *peer {
+	c := s.Dial()
+	m, err := selection.NewManager(s.Dial())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dnd, err := New(c, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &peer{c, dnd}
+}
+
+func (p *peer) window(t *testing.T, x, y int16, width, height uint16) *x11.Window {
+	t.Helper()
+	w, err := p.c.CreateWindow(xtest.Root, width, height, x11.WithPosition(x, y))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+// send sends an XDND message to window, as a peer speaking the protocol
+// by hand would.
+func (p *peer) send(t *testing.T, window, typ uint32, data ...uint32) {
+	t.Helper()
+	if err := p.c.SendClientMessage(window, 0, window, typ, data...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// next returns the next event of p, skipping the PropertyNotify events
+// windows get by default.
+func (p *peer) next(t *testing.T) x11.Event {
+	t.Helper()
+	for {
+		if p.c.PeekEventWithin(5*time.Second) == nil {
+			t.Fatal("no event")
+		}
+		ev, err := p.c.WaitForEvent()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := ev.(*x11.PropertyNotifyEvent); !ok {
+			return ev
+		}
+	}
+}
+
+// message returns the next event of p, which must be a message of type typ.
+func (p *peer) message(t *testing.T, typ uint32) [5]uint32 {
+	t.Helper()
+	ev := p.next(t)
+	m, ok := ev.(*x11.ClientMessageEvent)
+	if !ok || m.Type != typ {
+		t.Fatalf("got %#v, want message %d", ev, typ)
+	}
+	return m.Data32()
+}
+
+// filter passes ev to p's DnD, which must handle it.
+func (p *peer) filter(t *testing.T, ev x11.Event) {
+	t.Helper()
+	handled, err := p.dnd.Filter(ev)
+	if !handled || err != nil {
+		t.Fatalf("Filter(%#v) = %v, %v", ev, handled, err)
+	}
+}
+
+// relay filters the next event of p, which must be a message of type typ,
+// and returns its data.
+func (p *peer) relay(t *testing.T, typ uint32) [5]uint32 {
+	t.Helper()
+	ev := p.next(t)
+	m, ok := ev.(*x11.ClientMessageEvent)
+	if !ok || m.Type != typ {
+		t.Fatalf("got %#v, want message %d", ev, typ)
+	}
+	p.filter(t, ev)
+	return m.Data32()
+}
+
+// recorder records the callbacks of a Target and a Drag.
+type recorder struct {
+	calls []string
+}
+
+func (r *recorder) target(types []string, accept bool) *Target {
+	return &Target{
+		Types: types,
+		Enter: func(types []string) { r.add("enter %s", strings.Join(types, " ")) },
+		Position: func(x, y int16, action string) bool {
+			r.add("position %d,%d %s", x, y, action)
+			return accept
+		},
+		Leave: func() { r.add("leave") },
+		Drop:  func(d *Drop) { r.add("drop %s %q %d,%d %s", d.Type, d.Data, d.X, d.Y, d.Action) },
+	}
+}
+
+func (r *recorder) drag(formats map[string][]byte) *Drag {
+	return &Drag{
+		Formats:  formats,
+		Finished: func(action string) { r.add("finished %q", action) },
+	}
+}
+
+func (r *recorder) add(format string, args ...any) {
+	r.calls = append(r.calls, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) check(t *testing.T, want ...string) {
+	t.Helper()
+	if !slices.Equal(r.calls, want) {
+		t.Errorf("calls = %q, want %q", r.calls, want)
+	}
+	r.calls = nil
+}
+
+func TestDragAndDrop(t *testing.T) {
+	s := xtest.NewServer(t)
+	var converted atomic.Uint32 // time of the ConvertSelection
+	s.Handle = func(req []byte) []byte {
+		if req[0] == x11.X11_REQUEST_CONVERT_SELECTION {
+			converted.Store(binary.LittleEndian.Uint32(req[20:]))
+		}
+		return nil
+	}
+	src, dst := newPeer(t, s), newPeer(t, s)
+	sw, tw := src.window(t, 0, 0, 50, 50), dst.window(t, 100, 100, 200, 200)
+	var r recorder
+	if err := dst.dnd.Register(tw, r.target([]string{"image/png", "text/plain"}, true)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Four types, so the target reads them from XdndTypeList
+	err := src.dnd.StartDrag(sw, r.drag(map[string][]byte{
+		"text/plain": []byte("hello"),
+		"text/html":  []byte("<b>hello</b>"),
+		"text/x-moz": []byte("hello"),
+		MimeURIList:  []byte("file:///hello"),
+	}), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src.filter(t, &x11.MotionEvent{Event: sw.ID, RootX: 150, RootY: 160})
+	dst.relay(t, dst.dnd.enter)
+	r.check(t, "enter text/html text/plain text/uri-list text/x-moz")
+	dst.relay(t, dst.dnd.position)
+
+	// A move while the XdndStatus is on its way is sent after it
+	src.filter(t, &x11.MotionEvent{Event: sw.ID, RootX: 160, RootY: 170})
+	src.relay(t, src.dnd.status)
+	dst.relay(t, dst.dnd.position)
+	src.relay(t, src.dnd.status)
+	r.check(t, "position 50,60 XdndActionCopy", "position 60,70 XdndActionCopy")
+	if !src.dnd.drag.accepted {
+		t.Fatal("drop not accepted")
+	}
+
+	src.filter(t, &x11.ButtonEvent{Event: sw.ID, Button: 1, Time: 1000})
+	if l := dst.relay(t, dst.dnd.drop); l[2] != 1000 {
+		t.Errorf("XdndDrop time = %d, want 1000", l[2])
+	}
+	dst.relay(t, dst.dnd.received)
+	r.check(t, `drop text/plain "hello" 60,70 XdndActionCopy`)
+	if time := converted.Load(); time != 1000 {
+		t.Errorf("selection converted at %d, want the drop time 1000", time)
+	}
+	if l := src.relay(t, src.dnd.finished); l[0] != tw.ID || l[1] != 1 || l[2] != src.dnd.actionCopy {
+		t.Errorf("XdndFinished = %#x", l)
+	}
+	r.check(t, `finished "XdndActionCopy"`)
+	if src.dnd.drag != nil {
+		t.Error("drag still in progress")
+	}
+}
+
+func TestDropRefused(t *testing.T) {
+	s := xtest.NewServer(t)
+	src, dst := newPeer(t, s), newPeer(t, s)
+	sw, tw := src.window(t, 0, 0, 50, 50), dst.window(t, 100, 100, 200, 200)
+	var r recorder
+	if err := dst.dnd.Register(tw, r.target(nil, false)); err != nil {
+		t.Fatal(err)
+	}
+	text, err := src.c.Atom("text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src.send(t, tw.ID, src.dnd.enter, sw.ID, 5<<24, text)
+	dst.relay(t, dst.dnd.enter)
+	src.send(t, tw.ID, src.dnd.position, sw.ID, 0, packPoint(110, 120), 0, src.dnd.actionCopy)
+	dst.relay(t, dst.dnd.position)
+	if l := src.message(t, src.dnd.status); l[0] != tw.ID || l[1]&1 != 0 || l[4] != x11.X11_NONE {
+		t.Errorf("XdndStatus = %#x, want refusal", l)
+	}
+
+	// A source dropping anyway is told the drop failed
+	src.send(t, tw.ID, src.dnd.drop, sw.ID, 0, 0)
+	dst.relay(t, dst.dnd.drop)
+	if l := src.message(t, src.dnd.finished); l[0] != tw.ID || l[1] != 0 || l[2] != x11.X11_NONE {
+		t.Errorf("XdndFinished = %#x, want refusal", l)
+	}
+	r.check(t, "enter text/plain", "position 10,20 XdndActionCopy", "leave")
+}
+
+func TestRegisterConcurrent(t *testing.T) {
+	s := xtest.NewServer(t)
+	p := newPeer(t, s)
+	w := p.window(t, 0, 0, 50, 50)
+	var r recorder
+	done := make(chan error)
+	go func() {
+		for i := 0; i < 10; i++ {
+			if err := p.dnd.Register(w, r.target(nil, true)); err != nil {
+				done <- err
+				return
+			}
+			if err := p.dnd.Unregister(w); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+	leave := &x11.ClientMessageEvent{Window: w.ID, Format: 32, Type: p.dnd.leave}
+	for i := 0; i < 10; i++ {
+		if _, err := p.dnd.Filter(leave); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTargetOldVersion(t *testing.T) {
+	for _, version := range []uint32{3, 4} {
+		s := xtest.NewServer(t)
+		src, dst := newPeer(t, s), newPeer(t, s)
+		sw, tw := src.window(t, 0, 0, 50, 50), dst.window(t, 100, 100, 200, 200)
+		var r recorder
+		if err := dst.dnd.Register(tw, r.target(nil, true)); err != nil {
+			t.Fatal(err)
+		}
+		if err := src.dnd.sel.Write("text/plain", []byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		text, err := src.c.Atom("text/plain")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Before version 5 no action means a copy, and XdndFinished
+		// carries neither a result nor an action.
+		src.send(t, tw.ID, src.dnd.enter, sw.ID, version<<24, text)
+		dst.relay(t, dst.dnd.enter)
+		src.send(t, tw.ID, src.dnd.position, sw.ID, 0, packPoint(110, 120), 0, x11.X11_NONE)
+		dst.relay(t, dst.dnd.position)
+		if l := src.message(t, src.dnd.status); l[1]&1 == 0 || l[4] != src.dnd.actionCopy {
+			t.Errorf("version %d: XdndStatus = %#x", version, l)
+		}
+		src.send(t, tw.ID, src.dnd.drop, sw.ID, 0, 0)
+		dst.relay(t, dst.dnd.drop)
+		dst.relay(t, dst.dnd.received)
+		if l := src.message(t, src.dnd.finished); l[0] != tw.ID || l[1] != 0 || l[2] != x11.X11_NONE {
+			t.Errorf("version %d: XdndFinished = %#x", version, l)
+		}
+		r.check(t, "enter text/plain", "position 10,20 XdndActionCopy", `drop text/plain "hello" 10,20 XdndActionCopy`)
+	}
+}
+
+// startDrag drags text from a window of src over a target window of dst
+// speaking version, until the target accepts it.
+func startDrag(t *testing.T, version uint32) (src, dst *peer, sw, tw *x11.Window, r *recorder) {
+	s := xtest.NewServer(t)
+	src, dst = newPeer(t, s), newPeer(t, s)
+	sw, tw = src.window(t, 0, 0, 50, 50), dst.window(t, 100, 100, 200, 200)
+	if err := dst.c.ChangePropertyUint32(tw.ID, dst.dnd.aware, x11.X11_ATOM_ATOM, version); err != nil {
+		t.Fatal(err)
+	}
+	r = new(recorder)
+	if err := src.dnd.StartDrag(sw, r.drag(map[string][]byte{"text/plain": []byte("hello")}), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	src.filter(t, &x11.MotionEvent{Event: sw.ID, RootX: 150, RootY: 150})
+	if l := dst.message(t, dst.dnd.enter); l[0] != sw.ID || l[1]>>24 != version {
+		t.Fatalf("XdndEnter = %#x", l)
+	}
+	dst.message(t, dst.dnd.position)
+	dst.send(t, sw.ID, dst.dnd.status, tw.ID, 1, 0, 0, dst.dnd.actionCopy)
+	src.relay(t, src.dnd.status)
+	return src, dst, sw, tw, r
+}
+
+func TestSourceOldVersion(t *testing.T) {
+	src, dst, sw, tw, r := startDrag(t, 4)
+	src.filter(t, &x11.ButtonEvent{Event: sw.ID, Button: 1})
+	dst.message(t, dst.dnd.drop)
+
+	// The action requested is taken as performed
+	dst.send(t, sw.ID, dst.dnd.finished, tw.ID)
+	src.relay(t, src.dnd.finished)
+	r.check(t, `finished "XdndActionCopy"`)
+}
+
+func TestDropNotFinished(t *testing.T) {
+	src, dst, sw, _, r := startDrag(t, 5)
+	src.dnd.Timeout = 50 * time.Millisecond
+	src.filter(t, &x11.ButtonEvent{Event: sw.ID, Button: 1})
+	dst.message(t, dst.dnd.drop)
+	src.relay(t, src.dnd.expired)
+	r.check(t, `finished ""`)
+	if src.dnd.drag != nil {
+		t.Error("drag still in progress")
+	}
+}
+
+func TestDragCancelled(t *testing.T) {
+	src, dst, sw, tw, r := startDrag(t, 5)
+	src.filter(t, &x11.KeyEvent{Pressed: true, Keycode: 9, Event: sw.ID})
+	if l := dst.message(t, dst.dnd.leave); l[0] != sw.ID {
+		t.Errorf("XdndLeave = %#x", l)
+	}
+	r.check(t, `finished ""`)
+
+	// A target destroyed before finishing the drop ends the drag
+	src, dst, sw, tw, r = startDrag(t, 5)
+	src.filter(t, &x11.ButtonEvent{Event: sw.ID, Button: 1})
+	dst.message(t, dst.dnd.drop)
+	if err := tw.Destroy(); err != nil {
+		t.Fatal(err)
+	}
+	ev := src.next(t)
+	if e, ok := ev.(*x11.DestroyNotifyEvent); !ok || e.Window != tw.ID {
+		t.Fatalf("got %#v, want DestroyNotify", ev)
+	}
+	src.filter(t, ev)
+	r.check(t, `finished ""`)
+}
@@ -0,0 +1,183 @@
+package xinput
+
+import (
+	"errors"
+
+	"github.com/dzeromsk/helloX11/x11byte"
+)
+
+// Device uses reported by QueryDevice and hierarchy events.
+const (
+	XI_MASTER_POINTER  = 1
+	XI_MASTER_KEYBOARD = 2
+	XI_SLAVE_POINTER   = 3
+	XI_SLAVE_KEYBOARD  = 4
+	XI_FLOATING_SLAVE  = 5
+)
+
+// Input classes of a device.
+const (
+	XI_CLASS_KEY      = 0
+	XI_CLASS_BUTTON   = 1
+	XI_CLASS_VALUATOR = 2
+	XI_CLASS_SCROLL   = 3
+	XI_CLASS_TOUCH    = 8
+)
+
+// Scroll types of a scroll class.
+const (
+	XI_SCROLL_TYPE_VERTICAL   = 1
+	XI_SCROLL_TYPE_HORIZONTAL = 2
+)
+
+// Touch modes of a touch class.
+const (
+	XI_TOUCH_MODE_DIRECT    = 1 // touchscreen
+	XI_TOUCH_MODE_DEPENDENT = 2 // touchpad
+)
+
+var errMalformedDevice = errors.New("xinput: malformed QueryDevice reply")
+
+// DeviceInfo describes an input device.
+type DeviceInfo struct {
+	ID         uint16
+	Use        uint16 // XI_MASTER_* or XI_*_SLAVE*
+	Attachment uint16 // paired master, or master of a slave
+	Enabled    bool
+	Name       string
+	NumKeys    int
+	NumButtons int
+	Valuators  []ValuatorInfo
+	Scroll     []ScrollInfo
+	Touch      *TouchInfo // nil if the device has no touch class
+}
+
+// ValuatorInfo describes an axis of a device.
+type ValuatorInfo struct {
+	Number     uint16
+	Label      uint32 // atom such as "Rel X" or "Abs MT Position X"
+	Min, Max   float64
+	Value      float64
+	Resolution uint32
+	Absolute   bool
+}
+
+// ScrollInfo marks a valuator as a smooth scrolling axis. Increment is the
+// valuator change that amounts to one legacy wheel click.
+type ScrollInfo struct {
+	Number    uint16
+	Type      uint16 // XI_SCROLL_TYPE_*
+	Flags     uint32
+	Increment float64
+}
+
+// TouchInfo describes the touch capabilities of a device.
+type TouchInfo struct {
+	Mode       uint8 // XI_TOUCH_MODE_*
+	NumTouches uint8 // simultaneous touches, 0 if unknown
+}
+
+// QueryDevice describes the device with deviceID, or all devices for
+// XI_ALL_DEVICES and XI_ALL_MASTER_DEVICES.
+func (xi *XInput) QueryDevice(deviceID uint16) ([]DeviceInfo, error) {
+	var b x11byte.Builder
+	b.AddUint8(xi.opcode)               // opcode
+	b.AddUint8(XI_REQUEST_QUERY_DEVICE) // extension-minor
+	b.AddUint16(2)                      // requestLength
+	b.AddUint16(deviceID)               // deviceid
+	b.AddUint16(0)                      // unused
+
+	reply, err := xi.c.Request(b.BytesOrPanic())
+	if err != nil {
+		return nil, err
+	}
+	return parseDevices(reply)
+}
+
+func parseDevices(reply x11byte.String) ([]DeviceInfo, error) {
+	var numInfos uint16
+	reply.Skip(1) // reply
+	reply.Skip(1) // unused
+	reply.Skip(2) // sequenceNumber
+	reply.Skip(4) // replyLength
+	reply.ReadUint16(&numInfos)
+	reply.Skip(22) // unused
+
+	devices := make([]DeviceInfo, numInfos)
+	for i := range devices {
+		d := &devices[i]
+		var numClasses, nameLen uint16
+		var enabled uint8
+		reply.ReadUint16(&d.ID)
+		reply.ReadUint16(&d.Use)
+		reply.ReadUint16(&d.Attachment)
+		reply.ReadUint16(&numClasses)
+		reply.ReadUint16(&nameLen)
+		reply.ReadUint8(&enabled)
+		reply.Skip(1) // unused
+		var name []byte
+		if !reply.ReadBytes(&name, int(nameLen)) {
+			return nil, errMalformedDevice
+		}
+		reply.Skip((4 - int(nameLen)%4) % 4) // padding
+		d.Name = string(name)
+		d.Enabled = enabled != 0
+
+		for range numClasses {
+			var typ, length uint16
+			reply.ReadUint16(&typ)
+			reply.ReadUint16(&length)
+			var class x11byte.String
+			if length < 1 || !reply.ReadBytes((*[]byte)(&class), int(length)*4-4) {
+				return nil, errMalformedDevice
+			}
+			class.Skip(2) // sourceid
+			d.addClass(typ, class)
+		}
+	}
+	return devices, nil
+}
+
+func (d *DeviceInfo) addClass(typ uint16, class x11byte.String) {
+	switch typ {
+	case XI_CLASS_KEY:
+		var n uint16
+		class.ReadUint16(&n)
+		d.NumKeys = int(n)
+
+	case XI_CLASS_BUTTON:
+		var n uint16
+		class.ReadUint16(&n)
+		d.NumButtons = int(n)
+
+	case XI_CLASS_VALUATOR:
+		var (
+			v    ValuatorInfo
+			mode uint8
+		)
+		class.ReadUint16(&v.Number)
+		class.ReadUint32(&v.Label)
+		v.Min = readFP3232(&class)
+		v.Max = readFP3232(&class)
+		v.Value = readFP3232(&class)
+		class.ReadUint32(&v.Resolution)
+		class.ReadUint8(&mode)
+		v.Absolute = mode == 1
+		d.Valuators = append(d.Valuators, v)
+
+	case XI_CLASS_SCROLL:
+		var s ScrollInfo
+		class.ReadUint16(&s.Number)
+		class.ReadUint16(&s.Type)
+		class.Skip(2) // unused
+		class.ReadUint32(&s.Flags)
+		s.Increment = readFP3232(&class)
+		d.Scroll = append(d.Scroll, s)
+
+	case XI_CLASS_TOUCH:
+		var t TouchInfo
+		class.ReadUint8(&t.Mode)
+		class.ReadUint8(&t.NumTouches)
+		d.Touch = &t
+	}
+}
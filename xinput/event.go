@@ -0,0 +1,250 @@
+package xinput
+
+import (
+	"math/bits"
+
+	"github.com/dzeromsk/helloX11/x11"
+	"github.com/dzeromsk/helloX11/x11byte"
+)
+
+// Event types, used both in events and with SelectEvents.
+const (
+	XI_EVENT_DEVICE_CHANGED     = 1
+	XI_EVENT_KEY_PRESS          = 2
+	XI_EVENT_KEY_RELEASE        = 3
+	XI_EVENT_BUTTON_PRESS       = 4
+	XI_EVENT_BUTTON_RELEASE     = 5
+	XI_EVENT_MOTION             = 6
+	XI_EVENT_ENTER              = 7
+	XI_EVENT_LEAVE              = 8
+	XI_EVENT_FOCUS_IN           = 9
+	XI_EVENT_FOCUS_OUT          = 10
+	XI_EVENT_HIERARCHY          = 11
+	XI_EVENT_PROPERTY           = 12
+	XI_EVENT_RAW_KEY_PRESS      = 13
+	XI_EVENT_RAW_KEY_RELEASE    = 14
+	XI_EVENT_RAW_BUTTON_PRESS   = 15
+	XI_EVENT_RAW_BUTTON_RELEASE = 16
+	XI_EVENT_RAW_MOTION         = 17
+	XI_EVENT_TOUCH_BEGIN        = 18
+	XI_EVENT_TOUCH_UPDATE       = 19
+	XI_EVENT_TOUCH_END          = 20
+	XI_EVENT_TOUCH_OWNERSHIP    = 21
+	XI_EVENT_RAW_TOUCH_BEGIN    = 22
+	XI_EVENT_RAW_TOUCH_UPDATE   = 23
+	XI_EVENT_RAW_TOUCH_END      = 24
+)
+
+// Flags of device events.
+const (
+	XI_FLAG_KEY_REPEAT              = 0x10000 // key events
+	XI_FLAG_POINTER_EMULATED        = 0x10000 // button and motion events
+	XI_FLAG_TOUCH_PENDING_END       = 0x10000 // touch events
+	XI_FLAG_TOUCH_EMULATING_POINTER = 0x20000
+)
+
+// Flags of hierarchy changes.
+const (
+	XI_HIERARCHY_MASTER_ADDED    = 0x01
+	XI_HIERARCHY_MASTER_REMOVED  = 0x02
+	XI_HIERARCHY_SLAVE_ADDED     = 0x04
+	XI_HIERARCHY_SLAVE_REMOVED   = 0x08
+	XI_HIERARCHY_SLAVE_ATTACHED  = 0x10
+	XI_HIERARCHY_SLAVE_DETACHED  = 0x20
+	XI_HIERARCHY_DEVICE_ENABLED  = 0x40
+	XI_HIERARCHY_DEVICE_DISABLED = 0x80
+)
+
+// Valuator is the value of one device axis.
+type Valuator struct {
+	Number uint16
+	Value  float64
+}
+
+// Modifiers holds the XKB modifier or group state sent with device events.
+type Modifiers struct {
+	Base, Latched, Locked, Effective uint32
+}
+
+// DeviceEvent is a key, button, motion or touch event. For touch events
+// Detail is the touch ID, which stays the same from TouchBegin to TouchEnd.
+type DeviceEvent struct {
+	Type           uint16 // XI_EVENT_*
+	DeviceID       uint16
+	SourceID       uint16 // the slave device that generated the event
+	Time           uint32
+	Detail         uint32 // keycode, button or touch ID
+	Root           uint32
+	Event          uint32
+	Child          uint32
+	RootX, RootY   float64
+	EventX, EventY float64
+	Buttons        []uint32 // bitmask of buttons held down
+	Valuators      []Valuator
+	Flags          uint32 // XI_FLAG_*
+	Mods           Modifiers
+	Group          Modifiers
+}
+
+func (e *DeviceEvent) EventWindow() uint32 { return e.Event }
+
+// Valuator returns the value of axis number and whether the event has it.
+func (e *DeviceEvent) Valuator(number uint16) (float64, bool) {
+	for _, v := range e.Valuators {
+		if v.Number == number {
+			return v.Value, true
+		}
+	}
+	return 0, false
+}
+
+// RawDeviceEvent reports device input before pointer acceleration and
+// screen clamping, as needed for relative mouse look. Raw events are only
+// delivered to the root window.
+type RawDeviceEvent struct {
+	Type      uint16 // XI_EVENT_RAW_*
+	DeviceID  uint16
+	SourceID  uint16
+	Time      uint32
+	Detail    uint32
+	Flags     uint32
+	Valuators []Valuator // accelerated values
+	Raw       []Valuator // unaccelerated values
+}
+
+// HierarchyEvent reports devices added, removed, attached, detached,
+// enabled or disabled.
+type HierarchyEvent struct {
+	DeviceID uint16
+	Time     uint32
+	Flags    uint32 // XI_HIERARCHY_* of all changes
+	Infos    []HierarchyInfo
+}
+
+// HierarchyInfo describes the state of one device after a hierarchy change.
+type HierarchyInfo struct {
+	DeviceID   uint16
+	Attachment uint16
+	Use        uint8
+	Enabled    bool
+	Flags      uint32 // XI_HIERARCHY_* changes of this device
+}
+
+func decodeEvent(buf x11byte.String) x11.Event {
+	var (
+		evtype   uint16
+		deviceID uint16
+		time     uint32
+	)
+	buf.Skip(1) // eventCode
+	buf.Skip(1) // extension
+	buf.Skip(2) // sequenceNumber
+	buf.Skip(4) // length
+	buf.ReadUint16(&evtype)
+	buf.ReadUint16(&deviceID)
+	buf.ReadUint32(&time)
+
+	switch evtype {
+	case XI_EVENT_KEY_PRESS, XI_EVENT_KEY_RELEASE, XI_EVENT_BUTTON_PRESS, XI_EVENT_BUTTON_RELEASE,
+		XI_EVENT_MOTION, XI_EVENT_TOUCH_BEGIN, XI_EVENT_TOUCH_UPDATE, XI_EVENT_TOUCH_END:
+		var (
+			e                   = DeviceEvent{Type: evtype, DeviceID: deviceID, Time: time}
+			rootX, rootY        uint32
+			eventX, eventY      uint32
+			buttonsLen, valsLen uint16
+			group               [4]uint8
+		)
+		buf.ReadUint32(&e.Detail)
+		buf.ReadUint32(&e.Root)
+		buf.ReadUint32(&e.Event)
+		buf.ReadUint32(&e.Child)
+		buf.ReadUint32(&rootX)
+		buf.ReadUint32(&rootY)
+		buf.ReadUint32(&eventX)
+		buf.ReadUint32(&eventY)
+		buf.ReadUint16(&buttonsLen)
+		buf.ReadUint16(&valsLen)
+		buf.ReadUint16(&e.SourceID)
+		buf.Skip(2) // unused
+		buf.ReadUint32(&e.Flags)
+		buf.ReadUint32(&e.Mods.Base)
+		buf.ReadUint32(&e.Mods.Latched)
+		buf.ReadUint32(&e.Mods.Locked)
+		buf.ReadUint32(&e.Mods.Effective)
+		buf.CopyBytes(group[:])
+		e.Group = Modifiers{uint32(group[0]), uint32(group[1]), uint32(group[2]), uint32(group[3])}
+		e.RootX, e.RootY = fp1616(rootX), fp1616(rootY)
+		e.EventX, e.EventY = fp1616(eventX), fp1616(eventY)
+
+		e.Buttons = make([]uint32, buttonsLen)
+		for i := range e.Buttons {
+			buf.ReadUint32(&e.Buttons[i])
+		}
+		e.Valuators = readValuators(&buf, valsLen, nil)
+		return &e
+
+	case XI_EVENT_RAW_KEY_PRESS, XI_EVENT_RAW_KEY_RELEASE, XI_EVENT_RAW_BUTTON_PRESS, XI_EVENT_RAW_BUTTON_RELEASE,
+		XI_EVENT_RAW_MOTION, XI_EVENT_RAW_TOUCH_BEGIN, XI_EVENT_RAW_TOUCH_UPDATE, XI_EVENT_RAW_TOUCH_END:
+		var (
+			e       = RawDeviceEvent{Type: evtype, DeviceID: deviceID, Time: time}
+			valsLen uint16
+		)
+		buf.ReadUint32(&e.Detail)
+		buf.ReadUint16(&e.SourceID)
+		buf.ReadUint16(&valsLen)
+		buf.ReadUint32(&e.Flags)
+		buf.Skip(4) // unused
+		var numbers []uint16
+		e.Valuators = readValuators(&buf, valsLen, &numbers)
+		e.Raw = make([]Valuator, len(numbers))
+		for i, n := range numbers {
+			e.Raw[i] = Valuator{Number: n, Value: readFP3232(&buf)}
+		}
+		return &e
+
+	case XI_EVENT_HIERARCHY:
+		var (
+			e       = HierarchyEvent{DeviceID: deviceID, Time: time}
+			numInfo uint16
+		)
+		buf.ReadUint32(&e.Flags)
+		buf.ReadUint16(&numInfo)
+		buf.Skip(10) // unused
+		e.Infos = make([]HierarchyInfo, numInfo)
+		for i := range e.Infos {
+			info := &e.Infos[i]
+			var enabled uint8
+			buf.ReadUint16(&info.DeviceID)
+			buf.ReadUint16(&info.Attachment)
+			buf.ReadUint8(&info.Use)
+			buf.ReadUint8(&enabled)
+			buf.Skip(2) // unused
+			buf.ReadUint32(&info.Flags)
+			info.Enabled = enabled != 0
+		}
+		return &e
+	}
+	return nil
+}
+
+// readValuators reads a valuator mask of maskLen words followed by a
+// value for each bit set in it. The set valuator numbers are stored in
+// numbers if it is not nil.
+func readValuators(buf *x11byte.String, maskLen uint16, numbers *[]uint16) []Valuator {
+	mask := make([]uint32, maskLen)
+	for i := range mask {
+		buf.ReadUint32(&mask[i])
+	}
+	var vals []Valuator
+	for i, m := range mask {
+		for m != 0 {
+			n := uint16(i*32 + bits.TrailingZeros32(m))
+			m &= m - 1
+			vals = append(vals, Valuator{Number: n, Value: readFP3232(buf)})
+			if numbers != nil {
+				*numbers = append(*numbers, n)
+			}
+		}
+	}
+	return vals
+}
@@ -0,0 +1,72 @@
+package xinput
+
+import "sync"
+
+// Scroller turns the scroll valuators of motion events into smooth scroll
+// deltas, measured in legacy wheel clicks. Servers report the absolute
+// position of scroll axes, so the first motion after Reset only records it.
+type Scroller struct {
+	mu      sync.Mutex
+	devices map[uint16][]ScrollInfo
+	last    map[scrollAxis]float64
+}
+
+type scrollAxis struct {
+	device uint16
+	number uint16
+}
+
+// NewScroller returns a Scroller for the scroll classes of devices, as
+// returned by QueryDevice(XI_ALL_DEVICES).
+func NewScroller(devices []DeviceInfo) *Scroller {
+	s := &Scroller{
+		devices: make(map[uint16][]ScrollInfo),
+		last:    make(map[scrollAxis]float64),
+	}
+	for _, d := range devices {
+		if len(d.Scroll) > 0 {
+			s.devices[d.ID] = d.Scroll
+		}
+	}
+	return s
+}
+
+// Reset forgets the last scroll positions. Call it when the pointer enters
+// the window or the device hierarchy changes, since scrolling elsewhere
+// moves the axes.
+func (s *Scroller) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clear(s.last)
+}
+
+// Scroll returns the horizontal and vertical scroll distance of a motion
+// event, and false if it did not scroll.
+func (s *Scroller) Scroll(ev *DeviceEvent) (dx, dy float64, ok bool) {
+	if ev.Type != XI_EVENT_MOTION {
+		return 0, 0, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, info := range s.devices[ev.SourceID] {
+		value, found := ev.Valuator(info.Number)
+		if !found || info.Increment == 0 {
+			continue
+		}
+		axis := scrollAxis{ev.SourceID, info.Number}
+		last, seen := s.last[axis]
+		s.last[axis] = value
+		if !seen {
+			continue
+		}
+		delta := (value - last) / info.Increment
+		if info.Type == XI_SCROLL_TYPE_HORIZONTAL {
+			dx += delta
+		} else {
+			dy += delta
+		}
+		ok = ok || delta != 0
+	}
+	return dx, dy, ok
+}
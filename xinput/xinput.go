@@ -0,0 +1,121 @@
+// Package xinput implements the client side of the X Input Extension 2,
+// which reports smooth scrolling, multitouch and raw device motion that the
+// core protocol cannot express.
+package xinput
+
+import (
+	"fmt"
+
+	"github.com/dzeromsk/helloX11/x11"
+	"github.com/dzeromsk/helloX11/x11byte"
+)
+
+// Requests, as minor opcodes of the extension.
+const (
+	XI_REQUEST_SELECT_EVENTS = 46
+	XI_REQUEST_QUERY_VERSION = 47
+	XI_REQUEST_QUERY_DEVICE  = 48
+)
+
+// Protocol version requested by New. Touch events need 2.2.
+const (
+	XI_MAJOR_VERSION = 2
+	XI_MINOR_VERSION = 2
+)
+
+// Special device IDs.
+const (
+	XI_ALL_DEVICES        = 0
+	XI_ALL_MASTER_DEVICES = 1
+)
+
+// XInput is a connection's handle on the extension.
+type XInput struct {
+	c      *x11.Conn
+	opcode uint8
+
+	// Major and Minor are the protocol version the server agreed to.
+	Major, Minor uint16
+}
+
+// New initializes XInput 2 and registers decoders for its events. It fails
+// if the server lacks the extension or only supports version 1.
+func New(c *x11.Conn) (*XInput, error) {
+	ext, err := c.RequireExtension("XInputExtension")
+	if err != nil {
+		return nil, err
+	}
+	xi := &XInput{c: c, opcode: ext.MajorOpcode}
+	xi.Major, xi.Minor, err = xi.QueryVersion(XI_MAJOR_VERSION, XI_MINOR_VERSION)
+	if err != nil {
+		return nil, err
+	}
+	if xi.Major < 2 {
+		return nil, fmt.Errorf("xinput: server supports version %d.%d, need 2.0", xi.Major, xi.Minor)
+	}
+	c.RegisterGenericEventDecoder(ext.MajorOpcode, decodeEvent)
+	return xi, nil
+}
+
+// QueryVersion announces the version the client supports and returns the
+// version the server will use.
+func (xi *XInput) QueryVersion(major, minor uint16) (uint16, uint16, error) {
+	var b x11byte.Builder
+	b.AddUint8(xi.opcode)                // opcode
+	b.AddUint8(XI_REQUEST_QUERY_VERSION) // extension-minor
+	b.AddUint16(2)                       // requestLength
+	b.AddUint16(major)                   // majorVersion
+	b.AddUint16(minor)                   // minorVersion
+
+	reply, err := xi.c.Request(b.BytesOrPanic())
+	if err != nil {
+		return 0, 0, err
+	}
+
+	reply.Skip(1) // reply
+	reply.Skip(1) // unused
+	reply.Skip(2) // sequenceNumber
+	reply.Skip(4) // replyLength
+	reply.ReadUint16(&major)
+	reply.ReadUint16(&minor)
+	return major, minor, nil
+}
+
+// SelectEvents selects the XI_EVENT_* events for deviceID on window,
+// replacing the previous selection for that device. Selecting no events
+// clears it. Touch events must be selected together.
+func (xi *XInput) SelectEvents(window uint32, deviceID uint16, events ...uint16) error {
+	var mask []byte
+	for _, ev := range events {
+		for int(ev/8) >= len(mask) {
+			mask = append(mask, 0, 0, 0, 0)
+		}
+		mask[ev/8] |= 1 << (ev % 8)
+	}
+
+	var b x11byte.Builder
+	b.AddUint8(xi.opcode)                // opcode
+	b.AddUint8(XI_REQUEST_SELECT_EVENTS) // extension-minor
+	b.AddUint16(uint16(4 + len(mask)/4)) // requestLength
+	b.AddUint32(window)                  // window
+	b.AddUint16(1)                       // numMasks
+	b.AddUint16(0)                       // unused
+	b.AddUint16(deviceID)                // deviceid
+	b.AddUint16(uint16(len(mask) / 4))   // maskLen
+	b.AddBytes(mask)                     // mask
+
+	return xi.c.SendChecked(b.BytesOrPanic())
+}
+
+// fp1616 converts a 16.16 fixed point value.
+func fp1616(v uint32) float64 {
+	return float64(int32(v)) / 65536
+}
+
+// readFP3232 reads a 32.32 fixed point value.
+func readFP3232(s *x11byte.String) float64 {
+	var integral, frac uint32
+	s.ReadUint32(&integral)
+	s.ReadUint32(&frac)
+	return float64(int32(integral)) + float64(frac)/(1<<32)
+}
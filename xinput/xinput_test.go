@@ -0,0 +1,243 @@
+package xinput
+
+import (
+	"testing"
+
+	"github.com/dzeromsk/helloX11/x11byte"
+)
+
+func addFP3232(b *x11byte.Builder, v float64) {
+	integral := int32(v)
+	if float64(integral) > v {
+		integral--
+	}
+	b.AddUint32(uint32(integral))
+	b.AddUint32(uint32((v - float64(integral)) * (1 << 32)))
+}
+
+func TestParseDevices(t *testing.T) {
+	var b x11byte.Builder
+	b.AddUint8(1)                // reply
+	b.AddUint8(0)                // unused
+	b.AddUint16(1)               // sequenceNumber
+	b.AddUint32(0)               // replyLength
+	b.AddUint16(1)               // numInfos
+	b.AddBytes(make([]byte, 22)) // unused
+
+	b.AddUint16(11)                      // deviceid
+	b.AddUint16(XI_SLAVE_POINTER)        // type
+	b.AddUint16(2)                       // attachment
+	b.AddUint16(4)                       // numClasses
+	b.AddUint16(8)                       // nameLen
+	b.AddUint8(1)                        // enabled
+	b.AddUint8(0)                        // unused
+	b.AddBytes([]byte("Touchpad"))       // name
+	b.AddUint16(XI_CLASS_BUTTON)         // type
+	b.AddUint16(3)                       // length
+	b.AddUint16(11)                      // sourceid
+	b.AddUint16(7)                       // numButtons
+	b.AddUint32(0)                       // state
+	b.AddUint16(XI_CLASS_VALUATOR)       // type
+	b.AddUint16(11)                      // length
+	b.AddUint16(11)                      // sourceid
+	b.AddUint16(2)                       // number
+	b.AddUint32(0)                       // label
+	addFP3232(&b, -1)                    // min
+	addFP3232(&b, 1)                     // max
+	addFP3232(&b, 0.5)                   // value
+	b.AddUint32(0)                       // resolution
+	b.AddUint8(0)                        // mode
+	b.AddBytes(make([]byte, 3))          // unused
+	b.AddUint16(XI_CLASS_SCROLL)         // type
+	b.AddUint16(6)                       // length
+	b.AddUint16(11)                      // sourceid
+	b.AddUint16(2)                       // number
+	b.AddUint16(XI_SCROLL_TYPE_VERTICAL) // scrollType
+	b.AddUint16(0)                       // unused
+	b.AddUint32(0)                       // flags
+	addFP3232(&b, 15)                    // increment
+	b.AddUint16(XI_CLASS_TOUCH)          // type
+	b.AddUint16(2)                       // length
+	b.AddUint16(11)                      // sourceid
+	b.AddUint8(XI_TOUCH_MODE_DEPENDENT)  // mode
+	b.AddUint8(5)                        // numTouches
+
+	devices, err := parseDevices(b.BytesOrPanic())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 1 {
+		t.Fatalf("got %d devices, want 1", len(devices))
+	}
+	d := devices[0]
+	if d.ID != 11 || d.Use != XI_SLAVE_POINTER || d.Attachment != 2 || !d.Enabled || d.Name != "Touchpad" {
+		t.Errorf("device = %+v", d)
+	}
+	if d.NumButtons != 7 {
+		t.Errorf("NumButtons = %d, want 7", d.NumButtons)
+	}
+	if len(d.Valuators) != 1 || d.Valuators[0].Min != -1 || d.Valuators[0].Value != 0.5 {
+		t.Errorf("Valuators = %+v", d.Valuators)
+	}
+	if len(d.Scroll) != 1 || d.Scroll[0].Number != 2 || d.Scroll[0].Increment != 15 {
+		t.Errorf("Scroll = %+v", d.Scroll)
+	}
+	if d.Touch == nil || d.Touch.Mode != XI_TOUCH_MODE_DEPENDENT || d.Touch.NumTouches != 5 {
+		t.Errorf("Touch = %+v", d.Touch)
+	}
+}
+
+// motionEvent returns a Motion event from device 11 with the given
+// valuator values.
+func motionEvent(vals map[uint16]float64) []byte {
+	var mask uint32
+	for n := range vals {
+		mask |= 1 << n
+	}
+
+	var b x11byte.Builder
+	b.AddUint8(35)                // GenericEvent
+	b.AddUint8(131)               // extension
+	b.AddUint16(1)                // sequenceNumber
+	b.AddUint32(0)                // length
+	b.AddUint16(XI_EVENT_MOTION)  // evtype
+	b.AddUint16(2)                // deviceid
+	b.AddUint32(1000)             // time
+	b.AddUint32(0)                // detail
+	b.AddUint32(0x123)            // root
+	b.AddUint32(0x400001)         // event
+	b.AddUint32(0)                // child
+	b.AddUint32(100 << 16)        // rootX
+	b.AddUint32(200<<16 | 0x8000) // rootY
+	b.AddUint32(10 << 16)         // eventX
+	b.AddUint32(20 << 16)         // eventY
+	b.AddUint16(1)                // buttonsLen
+	b.AddUint16(1)                // valuatorsLen
+	b.AddUint16(11)               // sourceid
+	b.AddUint16(0)                // unused
+	b.AddUint32(0)                // flags
+	b.AddBytes(make([]byte, 16))  // mods
+	b.AddBytes(make([]byte, 4))   // group
+	b.AddUint32(1 << 1)           // buttons
+	b.AddUint32(mask)             // valuators
+	for n := range uint16(32) {
+		if v, ok := vals[n]; ok {
+			addFP3232(&b, v)
+		}
+	}
+	return b.BytesOrPanic()
+}
+
+func TestDecodeDeviceEvent(t *testing.T) {
+	ev, ok := decodeEvent(motionEvent(map[uint16]float64{0: 10, 3: -2.25})).(*DeviceEvent)
+	if !ok {
+		t.Fatal("not a DeviceEvent")
+	}
+	if ev.Type != XI_EVENT_MOTION || ev.DeviceID != 2 || ev.SourceID != 11 || ev.Time != 1000 {
+		t.Errorf("event = %+v", ev)
+	}
+	if ev.EventWindow() != 0x400001 {
+		t.Errorf("EventWindow = %#x", ev.EventWindow())
+	}
+	if ev.RootX != 100 || ev.RootY != 200.5 || ev.EventX != 10 || ev.EventY != 20 {
+		t.Errorf("position = %v,%v %v,%v", ev.RootX, ev.RootY, ev.EventX, ev.EventY)
+	}
+	if len(ev.Buttons) != 1 || ev.Buttons[0] != 2 {
+		t.Errorf("Buttons = %v", ev.Buttons)
+	}
+	if v, ok := ev.Valuator(3); !ok || v != -2.25 {
+		t.Errorf("Valuator(3) = %v, %v", v, ok)
+	}
+	if _, ok := ev.Valuator(1); ok {
+		t.Error("Valuator(1) present")
+	}
+}
+
+func TestDecodeRawEvent(t *testing.T) {
+	var b x11byte.Builder
+	b.AddUint8(35)                   // GenericEvent
+	b.AddUint8(131)                  // extension
+	b.AddUint16(1)                   // sequenceNumber
+	b.AddUint32(0)                   // length
+	b.AddUint16(XI_EVENT_RAW_MOTION) // evtype
+	b.AddUint16(2)                   // deviceid
+	b.AddUint32(1000)                // time
+	b.AddUint32(0)                   // detail
+	b.AddUint16(11)                  // sourceid
+	b.AddUint16(1)                   // valuatorsLen
+	b.AddUint32(0)                   // flags
+	b.AddUint32(0)                   // unused
+	b.AddUint32(0b11)                // valuators
+	addFP3232(&b, 3)                 // axisvalues
+	addFP3232(&b, -1.5)
+	addFP3232(&b, 2) // axisvalues_raw
+	addFP3232(&b, -1)
+
+	ev, ok := decodeEvent(b.BytesOrPanic()).(*RawDeviceEvent)
+	if !ok {
+		t.Fatal("not a RawDeviceEvent")
+	}
+	want := []Valuator{{0, 3}, {1, -1.5}}
+	wantRaw := []Valuator{{0, 2}, {1, -1}}
+	for i := range want {
+		if ev.Valuators[i] != want[i] || ev.Raw[i] != wantRaw[i] {
+			t.Errorf("valuator %d = %v raw %v, want %v raw %v", i, ev.Valuators[i], ev.Raw[i], want[i], wantRaw[i])
+		}
+	}
+}
+
+func TestDecodeHierarchy(t *testing.T) {
+	var b x11byte.Builder
+	b.AddUint8(35)                  // GenericEvent
+	b.AddUint8(131)                 // extension
+	b.AddUint16(1)                  // sequenceNumber
+	b.AddUint32(3)                  // length
+	b.AddUint16(XI_EVENT_HIERARCHY) // evtype
+	b.AddUint16(XI_ALL_DEVICES)     // deviceid
+	b.AddUint32(1000)               // time
+	b.AddUint32(XI_HIERARCHY_SLAVE_ADDED | XI_HIERARCHY_DEVICE_ENABLED)
+	b.AddUint16(1)               // num_info
+	b.AddBytes(make([]byte, 10)) // unused
+	b.AddUint16(12)              // deviceid
+	b.AddUint16(2)               // attachment
+	b.AddUint8(XI_SLAVE_POINTER) // type
+	b.AddUint8(1)                // enabled
+	b.AddUint16(0)               // unused
+	b.AddUint32(XI_HIERARCHY_SLAVE_ADDED | XI_HIERARCHY_DEVICE_ENABLED)
+
+	ev, ok := decodeEvent(b.BytesOrPanic()).(*HierarchyEvent)
+	if !ok {
+		t.Fatal("not a HierarchyEvent")
+	}
+	want := HierarchyInfo{12, 2, XI_SLAVE_POINTER, true, XI_HIERARCHY_SLAVE_ADDED | XI_HIERARCHY_DEVICE_ENABLED}
+	if len(ev.Infos) != 1 || ev.Infos[0] != want {
+		t.Errorf("Infos = %+v, want %+v", ev.Infos, want)
+	}
+}
+
+func TestScroller(t *testing.T) {
+	s := NewScroller([]DeviceInfo{{
+		ID: 11,
+		Scroll: []ScrollInfo{
+			{Number: 2, Type: XI_SCROLL_TYPE_VERTICAL, Increment: 15},
+			{Number: 3, Type: XI_SCROLL_TYPE_HORIZONTAL, Increment: 15},
+		},
+	}})
+	scroll := func(vals map[uint16]float64) (float64, float64, bool) {
+		return s.Scroll(decodeEvent(motionEvent(vals)).(*DeviceEvent))
+	}
+
+	if _, _, ok := scroll(map[uint16]float64{2: 100, 3: 50}); ok {
+		t.Error("first motion scrolled")
+	}
+	if dx, dy, ok := scroll(map[uint16]float64{2: 107.5, 3: 35}); !ok || dx != -1 || dy != 0.5 {
+		t.Errorf("Scroll = %v, %v, %v, want -1, 0.5, true", dx, dy, ok)
+	}
+	if _, _, ok := scroll(map[uint16]float64{0: 5}); ok {
+		t.Error("pointer motion scrolled")
+	}
+	s.Reset()
+	if _, _, ok := scroll(map[uint16]float64{2: 500}); ok {
+		t.Error("motion after Reset scrolled")
+	}
+}
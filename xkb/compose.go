@@ -0,0 +1,77 @@
+package xkb
+
+import "unicode/utf8"
+
+// deadKey describes a dead keysym: the accent it types on its own and the
+// letters it composes with, as pairs of base and composed runes.
+type deadKey struct {
+	spacing  rune
+	composed string
+}
+
+var deadKeys = map[uint32]deadKey{
+	0xfe50: {'`', "AÀaàEÈeèIÌiìNǸnǹOÒoòUÙuùWẀwẁYỲyỳ"},                               // dead_grave
+	0xfe51: {'´', "AÁaáCĆcćEÉeéGǴgǵIÍiíKḰkḱLĹlĺNŃnńOÓoóRŔrŕSŚsśUÚuúWẂwẃYÝyýZŹzź"},   // dead_acute
+	0xfe52: {'^', "AÂaâCĈcĉEÊeêGĜgĝHĤhĥIÎiîJĴjĵOÔoôSŜsŝUÛuûWŴwŵYŶyŷZẐzẑ"},           // dead_circumflex
+	0xfe53: {'~', "AÃaãEẼeẽIĨiĩNÑnñOÕoõUŨuũYỸyỹ"},                                   // dead_tilde
+	0xfe54: {'¯', "AĀaāEĒeēGḠgḡIĪiīOŌoōUŪuūYȲyȳ"},                                   // dead_macron
+	0xfe55: {'˘', "AĂaăEĔeĕGĞgğIĬiĭOŎoŏUŬuŭ"},                                       // dead_breve
+	0xfe56: {'˙', "AȦaȧCĊcċEĖeėGĠgġHḢhḣIİNṄnṅOȮoȯRṘrṙSṠsṡTṪtṫWẆwẇYẎyẏZŻzż"},         // dead_abovedot
+	0xfe57: {'¨', "AÄaäEËeëHḦhḧIÏiïOÖoötẗUÜuüWẄwẅYŸyÿ"},                             // dead_diaeresis
+	0xfe58: {'˚', "AÅaåUŮuůwẘyẙ"},                                                   // dead_abovering
+	0xfe59: {'˝', "OŐoőUŰuű"},                                                       // dead_doubleacute
+	0xfe5a: {'ˇ', "AǍaǎCČcčEĚeěGǦgǧHȞhȟIǏiǐjǰKǨkǩLĽlľNŇnňOǑoǒRŘrřSŠsšTŤtťUǓuǔZŽzž"}, // dead_caron
+	0xfe5b: {'¸', "CÇcçEȨeȩGĢgģHḨhḩKĶkķLĻlļNŅnņRŖrŗSŞsşTŢtţ"},                       // dead_cedilla
+	0xfe5c: {'˛', "AĄaąEĘeęIĮiįOǪoǫUŲuų"},                                           // dead_ogonek
+}
+
+// IsDeadKey reports whether ks is a dead key the Composer understands.
+func IsDeadKey(ks uint32) bool {
+	_, ok := deadKeys[ks]
+	return ok
+}
+
+// Composer combines dead keys with the key typed after them, so that
+// dead_acute followed by e types é. The zero value is ready to use.
+type Composer struct {
+	dead uint32
+}
+
+// Compose takes the keysym and text of a key press, as returned by Lookup
+// and Text, and returns the text to insert. A dead key returns "" and is
+// remembered until the next key that types text. Keys that do not compose
+// with the pending dead key type the accent followed by their own text.
+func (c *Composer) Compose(ks uint32, text string) string {
+	if d, ok := deadKeys[ks]; ok {
+		if c.dead == ks {
+			c.dead = 0
+			return string(d.spacing)
+		}
+		c.dead = ks
+		return ""
+	}
+	if text == "" || c.dead == 0 {
+		return text
+	}
+
+	d := deadKeys[c.dead]
+	c.dead = 0
+	base, size := utf8.DecodeRuneInString(text)
+	if base == ' ' && size == len(text) {
+		return string(d.spacing)
+	}
+	for s := d.composed; s != ""; {
+		r, n := utf8.DecodeRuneInString(s)
+		composed, m := utf8.DecodeRuneInString(s[n:])
+		if r == base {
+			return string(composed) + text[size:]
+		}
+		s = s[n+m:]
+	}
+	return string(d.spacing) + text
+}
+
+// Reset drops a pending dead key.
+func (c *Composer) Reset() {
+	c.dead = 0
+}
@@ -0,0 +1,107 @@
+package xkb
+
+import (
+	"github.com/dzeromsk/helloX11/x11"
+	"github.com/dzeromsk/helloX11/x11byte"
+)
+
+// NewKeyboardNotifyEvent reports that the core keyboard was replaced by a
+// different device or its keycode range changed.
+type NewKeyboardNotifyEvent struct {
+	Time          uint32
+	DeviceID      uint8
+	OldDeviceID   uint8
+	MinKeycode    uint8
+	MaxKeycode    uint8
+	OldMinKeycode uint8
+	OldMaxKeycode uint8
+	Changed       uint16
+}
+
+// MapNotifyEvent reports a change to the keymap.
+type MapNotifyEvent struct {
+	Time        uint32
+	DeviceID    uint8
+	Changed     uint16 // parts of the map that changed
+	MinKeycode  uint8
+	MaxKeycode  uint8
+	FirstKeySym uint8
+	NumKeySyms  uint8
+}
+
+// StateNotifyEvent reports a change to the modifiers or group.
+type StateNotifyEvent struct {
+	Time     uint32
+	DeviceID uint8
+	State    State
+	Changed  uint16 // parts of the state that changed
+	Keycode  uint8  // key that caused the change, if any
+}
+
+func decodeEvent(buf x11byte.String) x11.Event {
+	switch buf[1] {
+	case XKB_EVENT_NEW_KEYBOARD_NOTIFY:
+		var e NewKeyboardNotifyEvent
+		buf.Skip(1) // eventCode
+		buf.Skip(1) // xkbType
+		buf.Skip(2) // sequenceNumber
+		buf.ReadUint32(&e.Time)
+		buf.ReadUint8(&e.DeviceID)
+		buf.ReadUint8(&e.OldDeviceID)
+		buf.ReadUint8(&e.MinKeycode)
+		buf.ReadUint8(&e.MaxKeycode)
+		buf.ReadUint8(&e.OldMinKeycode)
+		buf.ReadUint8(&e.OldMaxKeycode)
+		buf.Skip(1) // requestMajor
+		buf.Skip(1) // requestMinor
+		buf.ReadUint16(&e.Changed)
+		return &e
+
+	case XKB_EVENT_MAP_NOTIFY:
+		var e MapNotifyEvent
+		buf.Skip(1) // eventCode
+		buf.Skip(1) // xkbType
+		buf.Skip(2) // sequenceNumber
+		buf.ReadUint32(&e.Time)
+		buf.ReadUint8(&e.DeviceID)
+		buf.Skip(1) // ptrBtnActions
+		buf.ReadUint16(&e.Changed)
+		buf.ReadUint8(&e.MinKeycode)
+		buf.ReadUint8(&e.MaxKeycode)
+		buf.Skip(1) // firstType
+		buf.Skip(1) // nTypes
+		buf.ReadUint8(&e.FirstKeySym)
+		buf.ReadUint8(&e.NumKeySyms)
+		return &e
+
+	case XKB_EVENT_STATE_NOTIFY:
+		var (
+			e                       StateNotifyEvent
+			baseGroup, latchedGroup uint16
+		)
+		buf.Skip(1) // eventCode
+		buf.Skip(1) // xkbType
+		buf.Skip(2) // sequenceNumber
+		buf.ReadUint32(&e.Time)
+		buf.ReadUint8(&e.DeviceID)
+		buf.ReadUint8(&e.State.Mods)
+		buf.ReadUint8(&e.State.BaseMods)
+		buf.ReadUint8(&e.State.LatchedMods)
+		buf.ReadUint8(&e.State.LockedMods)
+		buf.ReadUint8(&e.State.Group)
+		buf.ReadUint16(&baseGroup)
+		buf.ReadUint16(&latchedGroup)
+		buf.ReadUint8(&e.State.LockedGroup)
+		buf.Skip(1) // compatState
+		buf.Skip(1) // grabMods
+		buf.Skip(1) // compatGrabMods
+		buf.ReadUint8(&e.State.LookupMods)
+		buf.Skip(1) // compatLookupMods
+		buf.Skip(2) // ptrBtnState
+		buf.ReadUint16(&e.Changed)
+		buf.ReadUint8(&e.Keycode)
+		e.State.BaseGroup, e.State.LatchedGroup = int16(baseGroup), int16(latchedGroup)
+		return &e
+	}
+	return nil
+}
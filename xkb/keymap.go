@@ -0,0 +1,362 @@
+package xkb
+
+import (
+	"errors"
+
+	"github.com/dzeromsk/helloX11/x11"
+	"github.com/dzeromsk/helloX11/x11byte"
+)
+
+// Map parts for GetMap.
+const (
+	XKB_MAP_KEY_TYPES = 0x01
+	XKB_MAP_KEY_SYMS  = 0x02
+)
+
+// Names for GetNames.
+const (
+	XKB_NAME_SYMBOLS     = 0x0004
+	XKB_NAME_GROUP_NAMES = 0x1000
+)
+
+// Out of range group handling, in the top bits of a key's group info.
+const (
+	XKB_GROUP_WRAP     = 0x00
+	XKB_GROUP_CLAMP    = 0x40
+	XKB_GROUP_REDIRECT = 0x80
+)
+
+var errMalformedMap = errors.New("xkb: malformed GetMap reply")
+
+// Keymap is an XKB keyboard mapping. It is never modified after it is
+// loaded, so it can be shared freely.
+type Keymap struct {
+	MinKeycode uint8
+	MaxKeycode uint8
+	Types      []KeyType
+	Keys       []Key // indexed by keycode - MinKeycode
+	Names      *Names
+}
+
+// KeyType maps modifier combinations to shift levels.
+type KeyType struct {
+	Mods      uint8 // modifiers the type depends on
+	NumLevels uint8
+	Entries   []KeyTypeEntry
+}
+
+// KeyTypeEntry selects Level when exactly Mods, of the modifiers the type
+// depends on, are active. Preserve lists modifiers left unconsumed.
+type KeyTypeEntry struct {
+	Active   bool
+	Mods     uint8
+	Level    uint8
+	Preserve uint8
+}
+
+// Key holds the keysyms of one keycode, Width levels for each group.
+type Key struct {
+	Types     [4]uint8 // key type index for each group
+	GroupInfo uint8    // number of groups and out of range handling
+	Width     uint8
+	Syms      []uint32
+}
+
+// NumGroups returns the number of groups the key has.
+func (k *Key) NumGroups() int {
+	return int(k.GroupInfo & 0x0f)
+}
+
+// group returns the group used for the effective group g, wrapping, clamping
+// or redirecting it into range as the key specifies.
+func (k *Key) group(g uint8) (int, bool) {
+	n := k.NumGroups()
+	switch {
+	case n == 0:
+		return 0, false
+	case int(g) < n:
+		return int(g), true
+	}
+	switch k.GroupInfo & 0xc0 {
+	case XKB_GROUP_REDIRECT:
+		if r := int(k.GroupInfo>>4) & 3; r < n {
+			return r, true
+		}
+		return 0, true
+	case XKB_GROUP_CLAMP:
+		return n - 1, true
+	}
+	return int(g) % n, true
+}
+
+// Names holds the names of the keymap's components.
+type Names struct {
+	Symbols string   // e.g. "pc+us+de:2+inet(evdev)"
+	Groups  []string // layout names, e.g. "English (US)"
+}
+
+// Key returns the key with the given keycode, or nil if it is out of range.
+func (m *Keymap) Key(keycode uint8) *Key {
+	if keycode < m.MinKeycode || int(keycode-m.MinKeycode) >= len(m.Keys) {
+		return nil
+	}
+	return &m.Keys[keycode-m.MinKeycode]
+}
+
+// Keysym returns the keysym produced by keycode with the given effective
+// modifiers and group, and the modifiers consumed in selecting it.
+func (m *Keymap) Keysym(keycode, mods, group uint8) (keysym uint32, consumed uint8) {
+	key := m.Key(keycode)
+	if key == nil {
+		return x11.NoSymbol, 0
+	}
+	g, ok := key.group(group)
+	if !ok {
+		return x11.NoSymbol, 0
+	}
+
+	var level int
+	if i := int(key.Types[g]); i < len(m.Types) {
+		t := &m.Types[i]
+		var preserve uint8
+		for _, e := range t.Entries {
+			if e.Active && e.Mods == mods&t.Mods {
+				level, preserve = int(e.Level), e.Preserve
+				break
+			}
+		}
+		consumed = t.Mods &^ preserve
+	}
+	if level >= int(key.Width) || g*int(key.Width)+level >= len(key.Syms) {
+		return x11.NoSymbol, consumed
+	}
+	return key.Syms[g*int(key.Width)+level], consumed
+}
+
+// Text returns the text typed by keycode with the given effective modifiers
+// and group. Like xkbcommon, Lock capitalizes and Control produces control
+// characters unless the key type consumed them.
+func (m *Keymap) Text(keycode, mods, group uint8) string {
+	ks, consumed := m.Keysym(keycode, mods, group)
+	mods &^= consumed
+	if mods&x11.X11_MOD_MASK_LOCK != 0 {
+		_, ks = x11.ConvertCase(ks)
+	}
+	r := x11.KeysymToRune(ks)
+	if r < 0 {
+		return ""
+	}
+	if mods&x11.X11_MOD_MASK_CONTROL != 0 {
+		r = x11.ControlRune(r)
+	}
+	return string(r)
+}
+
+// GetMap fetches the key types and keysyms of all keys.
+func (k *Keyboard) GetMap() (*Keymap, error) {
+	var b x11byte.Builder
+	b.AddUint8(k.opcode)                              // opcode
+	b.AddUint8(XKB_REQUEST_GET_MAP)                   // extension-minor
+	b.AddUint16(7)                                    // requestLength
+	b.AddUint16(XKB_USE_CORE_KBD)                     // deviceSpec
+	b.AddUint16(XKB_MAP_KEY_TYPES | XKB_MAP_KEY_SYMS) // full
+	b.AddUint16(0)                                    // partial
+	b.AddUint8(0)                                     // firstType
+	b.AddUint8(0)                                     // nTypes
+	b.AddUint8(0)                                     // firstKeySym
+	b.AddUint8(0)                                     // nKeySyms
+	b.AddUint8(0)                                     // firstKeyAction
+	b.AddUint8(0)                                     // nKeyActions
+	b.AddUint8(0)                                     // firstKeyBehavior
+	b.AddUint8(0)                                     // nKeyBehaviors
+	b.AddUint16(0)                                    // virtualMods
+	b.AddUint8(0)                                     // firstKeyExplicit
+	b.AddUint8(0)                                     // nKeyExplicit
+	b.AddUint8(0)                                     // firstModMapKey
+	b.AddUint8(0)                                     // nModMapKeys
+	b.AddUint8(0)                                     // firstVModMapKey
+	b.AddUint8(0)                                     // nVModMapKeys
+	b.AddUint16(0)                                    // unused
+
+	reply, err := k.c.Request(b.BytesOrPanic())
+	if err != nil {
+		return nil, err
+	}
+	return parseMap(reply)
+}
+
+func parseMap(reply x11byte.String) (*Keymap, error) {
+	var (
+		m           Keymap
+		present     uint16
+		nTypes      uint8
+		firstKeySym uint8
+		nKeySyms    uint8
+	)
+	reply.Skip(1) // reply
+	reply.Skip(1) // deviceID
+	reply.Skip(2) // sequenceNumber
+	reply.Skip(4) // replyLength
+	reply.Skip(2) // unused
+	reply.ReadUint8(&m.MinKeycode)
+	reply.ReadUint8(&m.MaxKeycode)
+	reply.ReadUint16(&present)
+	reply.Skip(1) // firstType
+	reply.ReadUint8(&nTypes)
+	reply.Skip(1) // totalTypes
+	reply.ReadUint8(&firstKeySym)
+	reply.Skip(2) // totalSyms
+	reply.ReadUint8(&nKeySyms)
+	reply.Skip(1) // firstKeyAction
+	reply.Skip(2) // totalActions
+	reply.Skip(1) // nKeyActions
+	reply.Skip(3) // firstKeyBehavior, nKeyBehaviors, totalKeyBehaviors
+	reply.Skip(3) // firstKeyExplicit, nKeyExplicit, totalKeyExplicit
+	reply.Skip(3) // firstModMapKey, nModMapKeys, totalModMapKeys
+	reply.Skip(3) // firstVModMapKey, nVModMapKeys, totalVModMapKeys
+	reply.Skip(1) // unused
+	reply.Skip(2) // virtualMods
+
+	if m.MaxKeycode < m.MinKeycode {
+		return nil, errMalformedMap
+	}
+	m.Keys = make([]Key, int(m.MaxKeycode-m.MinKeycode)+1)
+
+	if present&XKB_MAP_KEY_TYPES != 0 {
+		m.Types = make([]KeyType, nTypes)
+		for i := range m.Types {
+			t := &m.Types[i]
+			var nMapEntries, hasPreserve uint8
+			reply.ReadUint8(&t.Mods)
+			reply.Skip(1) // modsMods
+			reply.Skip(2) // modsVmods
+			reply.ReadUint8(&t.NumLevels)
+			reply.ReadUint8(&nMapEntries)
+			reply.ReadUint8(&hasPreserve)
+			reply.Skip(1) // unused
+
+			t.Entries = make([]KeyTypeEntry, nMapEntries)
+			for j := range t.Entries {
+				e := &t.Entries[j]
+				var active uint8
+				reply.ReadUint8(&active)
+				reply.ReadUint8(&e.Mods)
+				reply.ReadUint8(&e.Level)
+				reply.Skip(1)       // modsMods
+				reply.Skip(2)       // modsVmods
+				if !reply.Skip(2) { // unused
+					return nil, errMalformedMap
+				}
+				e.Active = active != 0
+			}
+			if hasPreserve != 0 {
+				for j := range t.Entries {
+					reply.ReadUint8(&t.Entries[j].Preserve)
+					reply.Skip(1)       // realMods
+					if !reply.Skip(2) { // vmods
+						return nil, errMalformedMap
+					}
+				}
+			}
+		}
+	}
+
+	if present&XKB_MAP_KEY_SYMS != 0 {
+		for i := range int(nKeySyms) {
+			var (
+				key   Key
+				nSyms uint16
+			)
+			for j := range key.Types {
+				reply.ReadUint8(&key.Types[j])
+			}
+			reply.ReadUint8(&key.GroupInfo)
+			reply.ReadUint8(&key.Width)
+			if !reply.ReadUint16(&nSyms) {
+				return nil, errMalformedMap
+			}
+			key.Syms = make([]uint32, nSyms)
+			for j := range key.Syms {
+				if !reply.ReadUint32(&key.Syms[j]) {
+					return nil, errMalformedMap
+				}
+			}
+			keycode := int(firstKeySym) + i
+			if keycode >= int(m.MinKeycode) && keycode <= int(m.MaxKeycode) {
+				m.Keys[keycode-int(m.MinKeycode)] = key
+			}
+		}
+	}
+	return &m, nil
+}
+
+// GetNames fetches the symbols and group names of the keymap.
+func (k *Keyboard) GetNames() (*Names, error) {
+	var b x11byte.Builder
+	b.AddUint8(k.opcode)                                 // opcode
+	b.AddUint8(XKB_REQUEST_GET_NAMES)                    // extension-minor
+	b.AddUint16(3)                                       // requestLength
+	b.AddUint16(XKB_USE_CORE_KBD)                        // deviceSpec
+	b.AddUint16(0)                                       // unused
+	b.AddUint32(XKB_NAME_SYMBOLS | XKB_NAME_GROUP_NAMES) // which
+
+	reply, err := k.c.Request(b.BytesOrPanic())
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		which      uint32
+		groupNames uint8
+		symbols    uint32
+	)
+	reply.Skip(1) // reply
+	reply.Skip(1) // deviceID
+	reply.Skip(2) // sequenceNumber
+	reply.Skip(4) // replyLength
+	reply.ReadUint32(&which)
+	reply.Skip(1) // minKeyCode
+	reply.Skip(1) // maxKeyCode
+	reply.Skip(1) // nTypes
+	reply.ReadUint8(&groupNames)
+	reply.Skip(2) // virtualMods
+	reply.Skip(1) // firstKey
+	reply.Skip(1) // nKeys
+	reply.Skip(4) // indicators
+	reply.Skip(1) // nRadioGroups
+	reply.Skip(1) // nKeyAliases
+	reply.Skip(2) // nKTLevels
+	reply.Skip(4) // unused
+	if which&XKB_NAME_SYMBOLS != 0 {
+		reply.ReadUint32(&symbols)
+	}
+
+	var groups []uint32
+	if which&XKB_NAME_GROUP_NAMES != 0 {
+		for bit := range 4 {
+			if groupNames&(1<<bit) == 0 {
+				continue
+			}
+			var atom uint32
+			reply.ReadUint32(&atom)
+			groups = append(groups, atom)
+		}
+	}
+
+	var names Names
+	if symbols != x11.X11_ATOM_NONE {
+		if names.Symbols, err = k.c.AtomName(symbols); err != nil {
+			return nil, err
+		}
+	}
+	for _, atom := range groups {
+		var name string
+		if atom != x11.X11_ATOM_NONE {
+			if name, err = k.c.AtomName(atom); err != nil {
+				return nil, err
+			}
+		}
+		names.Groups = append(names.Groups, name)
+	}
+	return &names, nil
+}
@@ -0,0 +1,288 @@
+// Package xkb implements the client side of the X Keyboard Extension. It
+// reads the server's keymap and translates key events to keysyms and text
+// the way xkbcommon does, including multiple layout groups and levels
+// selected by modifiers such as ISO_Level3_Shift.
+package xkb
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/dzeromsk/helloX11/x11"
+	"github.com/dzeromsk/helloX11/x11byte"
+)
+
+// Requests, as minor opcodes of the extension.
+const (
+	XKB_REQUEST_USE_EXTENSION    = 0
+	XKB_REQUEST_SELECT_EVENTS    = 1
+	XKB_REQUEST_GET_STATE        = 4
+	XKB_REQUEST_GET_MAP          = 8
+	XKB_REQUEST_GET_NAMES        = 17
+	XKB_REQUEST_PER_CLIENT_FLAGS = 21
+)
+
+// Per-client flags for PerClientFlags.
+const (
+	XKB_PER_CLIENT_DETECTABLE_AUTO_REPEAT = 0x01
+)
+
+// Event subtypes, sent in the second byte of the extension's event.
+const (
+	XKB_EVENT_NEW_KEYBOARD_NOTIFY = 0
+	XKB_EVENT_MAP_NOTIFY          = 1
+	XKB_EVENT_STATE_NOTIFY        = 2
+)
+
+// Event masks for SelectEvents.
+const (
+	XKB_EVENT_FLAG_NEW_KEYBOARD_NOTIFY = 1 << XKB_EVENT_NEW_KEYBOARD_NOTIFY
+	XKB_EVENT_FLAG_MAP_NOTIFY          = 1 << XKB_EVENT_MAP_NOTIFY
+	XKB_EVENT_FLAG_STATE_NOTIFY        = 1 << XKB_EVENT_STATE_NOTIFY
+)
+
+// XKB_USE_CORE_KBD selects the core keyboard device.
+const XKB_USE_CORE_KBD = 0x100
+
+// Protocol version implemented by this package.
+const (
+	XKB_MAJOR_VERSION = 1
+	XKB_MINOR_VERSION = 0
+)
+
+var errUnsupported = errors.New("xkb: server does not support XKB 1.0")
+
+// State is the keyboard state reported by the server.
+type State struct {
+	Mods         uint8 // effective modifiers
+	BaseMods     uint8
+	LatchedMods  uint8
+	LockedMods   uint8
+	Group        uint8 // effective group
+	BaseGroup    int16
+	LatchedGroup int16
+	LockedGroup  uint8
+	LookupMods   uint8
+}
+
+// Keyboard tracks the XKB keymap and state of the core keyboard. The keymap
+// is replaced as a whole when the server reports a change, so key handlers
+// running on other goroutines always see a consistent keymap.
+type Keyboard struct {
+	c      *x11.Conn
+	opcode uint8
+
+	mu     sync.Mutex // serializes reloads
+	keymap atomic.Pointer[Keymap]
+	state  atomic.Pointer[State]
+}
+
+// New initializes the extension, loads the keymap and selects the events
+// that keep it current. It fails if the server lacks XKB.
+func New(c *x11.Conn) (*Keyboard, error) {
+	ext, err := c.RequireExtension("XKEYBOARD")
+	if err != nil {
+		return nil, err
+	}
+	k := &Keyboard{c: c, opcode: ext.MajorOpcode}
+	if err := k.useExtension(); err != nil {
+		return nil, err
+	}
+	c.RegisterEventDecoder(ext.FirstEvent, decodeEvent)
+
+	if err := k.reload(); err != nil {
+		return nil, err
+	}
+	state, err := k.GetState()
+	if err != nil {
+		return nil, err
+	}
+	k.state.Store(&state)
+
+	err = k.SelectEvents(XKB_EVENT_FLAG_NEW_KEYBOARD_NOTIFY | XKB_EVENT_FLAG_MAP_NOTIFY | XKB_EVENT_FLAG_STATE_NOTIFY)
+	if err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+func (k *Keyboard) useExtension() error {
+	var b x11byte.Builder
+	b.AddUint8(k.opcode)                  // opcode
+	b.AddUint8(XKB_REQUEST_USE_EXTENSION) // extension-minor
+	b.AddUint16(2)                        // requestLength
+	b.AddUint16(XKB_MAJOR_VERSION)        // wantedMajor
+	b.AddUint16(XKB_MINOR_VERSION)        // wantedMinor
+
+	reply, err := k.c.Request(b.BytesOrPanic())
+	if err != nil {
+		return err
+	}
+
+	var supported uint8
+	reply.Skip(1) // reply
+	reply.ReadUint8(&supported)
+	if supported == 0 {
+		return errUnsupported
+	}
+	return nil
+}
+
+// SelectEvents selects all details of the XKB_EVENT_FLAG_* events in mask
+// and deselects the others.
+func (k *Keyboard) SelectEvents(mask uint16) error {
+	var mapParts uint16
+	if mask&XKB_EVENT_FLAG_MAP_NOTIFY != 0 {
+		mapParts = 0xff
+	}
+
+	var b x11byte.Builder
+	b.AddUint8(k.opcode)                  // opcode
+	b.AddUint8(XKB_REQUEST_SELECT_EVENTS) // extension-minor
+	b.AddUint16(4)                        // requestLength
+	b.AddUint16(XKB_USE_CORE_KBD)         // deviceSpec
+	b.AddUint16(0xfff)                    // affectWhich
+	b.AddUint16(0xfff &^ mask)            // clear
+	b.AddUint16(mask)                     // selectAll
+	b.AddUint16(mapParts)                 // affectMap
+	b.AddUint16(mapParts)                 // map
+
+	return k.c.SendChecked(b.BytesOrPanic())
+}
+
+// GetState returns the current keyboard state.
+func (k *Keyboard) GetState() (State, error) {
+	var b x11byte.Builder
+	b.AddUint8(k.opcode)              // opcode
+	b.AddUint8(XKB_REQUEST_GET_STATE) // extension-minor
+	b.AddUint16(2)                    // requestLength
+	b.AddUint16(XKB_USE_CORE_KBD)     // deviceSpec
+	b.AddUint16(0)                    // unused
+
+	var s State
+	reply, err := k.c.Request(b.BytesOrPanic())
+	if err != nil {
+		return s, err
+	}
+
+	var baseGroup, latchedGroup uint16
+	reply.Skip(1) // reply
+	reply.Skip(1) // deviceID
+	reply.Skip(2) // sequenceNumber
+	reply.Skip(4) // replyLength
+	reply.ReadUint8(&s.Mods)
+	reply.ReadUint8(&s.BaseMods)
+	reply.ReadUint8(&s.LatchedMods)
+	reply.ReadUint8(&s.LockedMods)
+	reply.ReadUint8(&s.Group)
+	reply.ReadUint8(&s.LockedGroup)
+	reply.ReadUint16(&baseGroup)
+	reply.ReadUint16(&latchedGroup)
+	reply.Skip(1) // compatState
+	reply.Skip(1) // grabMods
+	reply.Skip(1) // compatGrabMods
+	reply.ReadUint8(&s.LookupMods)
+	s.BaseGroup, s.LatchedGroup = int16(baseGroup), int16(latchedGroup)
+	return s, nil
+}
+
+// PerClientFlags changes the XKB_PER_CLIENT_* flags in change to the values
+// in value and returns the flags the server supports and their new values.
+func (k *Keyboard) PerClientFlags(change, value uint32) (supported, values uint32, err error) {
+	var b x11byte.Builder
+	b.AddUint8(k.opcode)                     // opcode
+	b.AddUint8(XKB_REQUEST_PER_CLIENT_FLAGS) // extension-minor
+	b.AddUint16(7)                           // requestLength
+	b.AddUint16(XKB_USE_CORE_KBD)            // deviceSpec
+	b.AddUint16(0)                           // unused
+	b.AddUint32(change)                      // change
+	b.AddUint32(value)                       // value
+	b.AddUint32(0)                           // ctrlsToChange
+	b.AddUint32(0)                           // autoCtrls
+	b.AddUint32(0)                           // autoCtrlsValues
+
+	reply, err := k.c.Request(b.BytesOrPanic())
+	if err != nil {
+		return 0, 0, err
+	}
+
+	reply.Skip(1) // reply
+	reply.Skip(1) // deviceID
+	reply.Skip(2) // sequenceNumber
+	reply.Skip(4) // replyLength
+	reply.ReadUint32(&supported)
+	reply.ReadUint32(&values)
+	return supported, values, nil
+}
+
+// SetDetectableAutoRepeat asks the server not to send key releases between
+// auto-repeated key presses. It reports whether detectable auto-repeat is in
+// effect, which makes x11.RepeatDetector rely on key state alone.
+func (k *Keyboard) SetDetectableAutoRepeat(enable bool) (bool, error) {
+	var value uint32
+	if enable {
+		value = XKB_PER_CLIENT_DETECTABLE_AUTO_REPEAT
+	}
+	supported, values, err := k.PerClientFlags(XKB_PER_CLIENT_DETECTABLE_AUTO_REPEAT, value)
+	if err != nil {
+		return false, err
+	}
+	return supported&values&XKB_PER_CLIENT_DETECTABLE_AUTO_REPEAT != 0, nil
+}
+
+func (k *Keyboard) reload() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	m, err := k.GetMap()
+	if err != nil {
+		return err
+	}
+	if m.Names, err = k.GetNames(); err != nil {
+		return err
+	}
+	k.keymap.Store(m)
+	return nil
+}
+
+// Keymap returns the current keymap.
+func (k *Keyboard) Keymap() *Keymap {
+	return k.keymap.Load()
+}
+
+// State returns the keyboard state as of the last StateNotify event.
+func (k *Keyboard) State() State {
+	return *k.state.Load()
+}
+
+// Lookup returns the keysym produced by a key event. The modifiers and group
+// are taken from the event, which XKB-aware clients receive with the group
+// in bits 13 and 14 of the state.
+func (k *Keyboard) Lookup(ev *x11.KeyEvent) uint32 {
+	ks, _ := k.Keymap().Keysym(ev.Keycode, uint8(ev.State), eventGroup(ev.State))
+	return ks
+}
+
+// Text returns the text typed by a key event, or "" if it produces none.
+func (k *Keyboard) Text(ev *x11.KeyEvent) string {
+	return k.Keymap().Text(ev.Keycode, uint8(ev.State), eventGroup(ev.State))
+}
+
+func eventGroup(state x11.KeyButMask) uint8 {
+	return uint8(state>>13) & 3
+}
+
+// Filter tracks state and keymap changes. It reports XKB events as handled
+// and is meant to be installed as the Dispatcher's Filter.
+func (k *Keyboard) Filter(ev x11.Event) (bool, error) {
+	switch ev := ev.(type) {
+	case *StateNotifyEvent:
+		state := ev.State
+		k.state.Store(&state)
+		return true, nil
+	case *MapNotifyEvent, *NewKeyboardNotifyEvent:
+		return true, k.reload()
+	}
+	return false, nil
+}
@@ -0,0 +1,185 @@
+package xkb
+
+import (
+	"testing"
+
+	"github.com/dzeromsk/helloX11/x11"
+	"github.com/dzeromsk/helloX11/x11byte"
+)
+
+const (
+	shift = x11.X11_MOD_MASK_SHIFT
+	lock  = x11.X11_MOD_MASK_LOCK
+	ctrl  = x11.X11_MOD_MASK_CONTROL
+	level = x11.X11_MOD_MASK_5 // ISO_Level3_Shift
+)
+
+// testMap returns a GetMap reply for keycodes 8 to 11 with the ONE_LEVEL,
+// TWO_LEVEL, ALPHABETIC and FOUR_LEVEL key types.
+func testMap() []byte {
+	var b x11byte.Builder
+	b.AddUint8(1)  // reply
+	b.AddUint8(3)  // deviceID
+	b.AddUint16(1) // sequenceNumber
+	b.AddUint32(0) // replyLength
+	b.AddUint16(0) // unused
+	b.AddUint8(8)  // minKeyCode
+	b.AddUint8(11) // maxKeyCode
+	b.AddUint16(XKB_MAP_KEY_TYPES | XKB_MAP_KEY_SYMS)
+	b.AddUint8(0)                // firstType
+	b.AddUint8(4)                // nTypes
+	b.AddUint8(4)                // totalTypes
+	b.AddUint8(8)                // firstKeySym
+	b.AddUint16(9)               // totalSyms
+	b.AddUint8(4)                // nKeySyms
+	b.AddBytes(make([]byte, 19)) // other ranges, virtualMods
+
+	types := []struct {
+		mods    uint8
+		levels  uint8
+		entries [][2]uint8
+	}{
+		{0, 1, nil},
+		{shift, 2, [][2]uint8{{shift, 1}}},
+		{shift | lock, 2, [][2]uint8{{shift, 1}, {lock, 1}}},
+		{shift | level, 4, [][2]uint8{{shift, 1}, {level, 2}, {shift | level, 3}}},
+	}
+	for _, t := range types {
+		b.AddUint8(t.mods)
+		b.AddUint8(t.mods)
+		b.AddUint16(0)
+		b.AddUint8(t.levels)
+		b.AddUint8(uint8(len(t.entries)))
+		b.AddUint8(0) // hasPreserve
+		b.AddUint8(0)
+		for _, e := range t.entries {
+			b.AddUint8(1) // active
+			b.AddUint8(e[0])
+			b.AddUint8(e[1])
+			b.AddUint8(e[0])
+			b.AddUint32(0)
+		}
+	}
+
+	keys := []struct {
+		types     [4]uint8
+		groupInfo uint8
+		width     uint8
+		syms      []uint32
+	}{
+		{[4]uint8{2, 2}, 2, 2, []uint32{'a', 'A', 0x6c1, 0x6e1}},
+		{[4]uint8{3}, 1, 4, []uint32{'e', 'E', x11.XK_EuroSign, 0}},
+		{[4]uint8{1}, 1 | XKB_GROUP_CLAMP, 2, []uint32{'1', '!'}},
+		{[4]uint8{0}, 1, 1, []uint32{0xfe51}},
+	}
+	for _, k := range keys {
+		b.AddBytes(k.types[:])
+		b.AddUint8(k.groupInfo)
+		b.AddUint8(k.width)
+		b.AddUint16(uint16(len(k.syms)))
+		for _, ks := range k.syms {
+			b.AddUint32(ks)
+		}
+	}
+	return b.BytesOrPanic()
+}
+
+func TestKeysym(t *testing.T) {
+	m, err := parseMap(testMap())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Types) != 4 || len(m.Keys) != 4 {
+		t.Fatalf("parsed %d types and %d keys", len(m.Types), len(m.Keys))
+	}
+
+	for _, tt := range []struct {
+		keycode, mods, group uint8
+		want                 uint32
+	}{
+		{8, 0, 0, 'a'},
+		{8, shift, 0, 'A'},
+		{8, lock, 0, 'A'},
+		{8, shift | lock, 0, 'a'},
+		{8, 0, 1, 0x6c1},
+		{8, shift, 1, 0x6e1},
+		{8, 0, 3, 0x6c1}, // wraps
+		{9, level, 0, x11.XK_EuroSign},
+		{9, shift | level, 0, x11.NoSymbol},
+		{9, ctrl, 0, 'e'},
+		{10, shift, 2, '!'}, // clamped
+		{11, shift, 0, 0xfe51},
+		{12, 0, 0, x11.NoSymbol},
+	} {
+		if got, _ := m.Keysym(tt.keycode, tt.mods, tt.group); got != tt.want {
+			t.Errorf("Keysym(%d, %#x, %d) = %#x, want %#x", tt.keycode, tt.mods, tt.group, got, tt.want)
+		}
+	}
+
+	for _, tt := range []struct {
+		keycode, mods, group uint8
+		want                 string
+	}{
+		{8, shift | lock, 0, "a"},
+		{8, lock, 1, "А"},
+		{8, ctrl, 0, "\x01"},
+		{9, lock, 0, "E"}, // Lock is not consumed by FOUR_LEVEL
+		{9, level, 0, "€"},
+		{11, 0, 0, ""},
+	} {
+		if got := m.Text(tt.keycode, tt.mods, tt.group); got != tt.want {
+			t.Errorf("Text(%d, %#x, %d) = %q, want %q", tt.keycode, tt.mods, tt.group, got, tt.want)
+		}
+	}
+}
+
+func TestComposer(t *testing.T) {
+	const deadAcute, deadCaron = 0xfe51, 0xfe5a
+	var c Composer
+	for i, tt := range []struct {
+		ks   uint32
+		text string
+		want string
+	}{
+		{deadAcute, "", ""},
+		{x11.XK_Shift_L, "", ""},
+		{'E', "E", "É"},
+		{deadCaron, "", ""},
+		{'z', "z", "ž"},
+		{deadAcute, "", ""},
+		{deadAcute, "", "´"},
+		{deadCaron, "", ""},
+		{'x', "x", "ˇx"},
+		{deadAcute, "", ""},
+		{' ', " ", "´"},
+		{'q', "q", "q"},
+	} {
+		if got := c.Compose(tt.ks, tt.text); got != tt.want {
+			t.Errorf("step %d: Compose(%#x, %q) = %q, want %q", i, tt.ks, tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeStateNotify(t *testing.T) {
+	ev := make([]byte, 32)
+	ev[0], ev[1] = 85, XKB_EVENT_STATE_NOTIFY
+	ev[8] = 3                 // deviceID
+	ev[9], ev[12] = 0x81, 0x1 // mods, lockedMods
+	ev[13] = 1                // group
+	ev[16] = 0xff             // latchedGroup
+	ev[17] = 0xff
+	ev[18] = 1    // lockedGroup
+	ev[28] = 0x22 // keycode
+
+	e, ok := decodeEvent(ev).(*StateNotifyEvent)
+	if !ok {
+		t.Fatalf("decoded %T", decodeEvent(ev))
+	}
+	s := e.State
+	if s.Mods != 0x81 || s.LockedMods != 1 || s.Group != 1 || s.LatchedGroup != -1 || s.LockedGroup != 1 || e.Keycode != 0x22 {
+		t.Errorf("decoded %+v", e)
+	}
+	if decodeEvent(append([]byte{85, 99}, make([]byte, 30)...)) != nil {
+		t.Error("unknown subtype decoded")
+	}
+}